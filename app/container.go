@@ -0,0 +1,150 @@
+package app
+
+import (
+	"time"
+
+	"github.com/gimhanr9/go-loyalty-api/config"
+	"github.com/gimhanr9/go-loyalty-api/controllers"
+	"github.com/gimhanr9/go-loyalty-api/gateway"
+	"github.com/gimhanr9/go-loyalty-api/metrics"
+	"github.com/gimhanr9/go-loyalty-api/repositories"
+	"github.com/gimhanr9/go-loyalty-api/services"
+	"gorm.io/gorm"
+)
+
+// Container wires the application's repositories, services and controllers
+// around a single database handle. Build one per process, or per test.
+type Container struct {
+	DB            *gorm.DB
+	SquareGateway gateway.SquareGateway
+	APIUsage      metrics.APIUsage
+
+	AuthRepository                repositories.AuthRepository
+	PhoneChangeRepository         repositories.PhoneChangeRepository
+	AuditRepository               repositories.AuditRepository
+	PendingRegistrationRepository repositories.PendingRegistrationRepository
+	OutboxRepository              repositories.OutboxRepository
+	JobRepository                 repositories.JobRepository
+	PointsOperationRepository     repositories.PointsOperationRepository
+	AccountSnapshotRepository     repositories.AccountSnapshotRepository
+	StatementRepository           repositories.StatementRepository
+	WalletRepository              repositories.WalletRepository
+	StatusRepository              repositories.StatusRepository
+	ExpiryNoticeRepository        repositories.ExpiryNoticeRepository
+	ReferralRepository            repositories.ReferralRepository
+	Transactor                    repositories.Transactor
+
+	OutboxService           services.OutboxService
+	JobService              services.JobService
+	LoyaltyService          services.LoyaltyService
+	AuthService             services.AuthService
+	ProfileService          services.ProfileService
+	PrivacyService          services.PrivacyService
+	ContactMigrationService services.ContactMigrationService
+	StatementService        services.StatementService
+	RewardService           services.RewardService
+	CardService             services.CardService
+	WalletService           services.WalletService
+	StatusService           services.StatusService
+	ExpiryService           services.ExpiryService
+	ReferralService         services.ReferralService
+
+	AuthController    *controllers.AuthController
+	LoyaltyController *controllers.LoyaltyController
+	ProfileController *controllers.ProfileController
+	PrivacyController *controllers.PrivacyController
+	OutboxController  *controllers.OutboxController
+	JobController     *controllers.JobController
+	MetricsController *controllers.MetricsController
+
+	StatementController *controllers.StatementController
+	CardController      *controllers.CardController
+	WalletController    *controllers.WalletController
+	ExpiryController    *controllers.ExpiryController
+	ReferralController  *controllers.ReferralController
+
+	AuthV2Controller    *controllers.AuthV2Controller
+	LoyaltyV2Controller *controllers.LoyaltyV2Controller
+	ProfileV2Controller *controllers.ProfileV2Controller
+	RewardV2Controller  *controllers.RewardV2Controller
+}
+
+// NewContainer fails when the configuration can't run, e.g. a service that
+// isn't allowed in production
+func NewContainer(db *gorm.DB) (*Container, error) {
+	c := &Container{
+		DB:            db,
+		SquareGateway: gateway.NewResilientGateway(gateway.NewSquareGateway()),
+		APIUsage:      metrics.NewAPIUsage(),
+	}
+
+	c.AuthRepository = repositories.NewAuthRepository(db)
+	c.PhoneChangeRepository = repositories.NewPhoneChangeRepository(db)
+	c.AuditRepository = repositories.NewAuditRepository(db)
+	c.PendingRegistrationRepository = repositories.NewPendingRegistrationRepository(db)
+	c.OutboxRepository = repositories.NewOutboxRepository(db)
+	c.JobRepository = repositories.NewJobRepository(db)
+	c.PointsOperationRepository = repositories.NewPointsOperationRepository(db)
+	c.AccountSnapshotRepository = repositories.NewAccountSnapshotRepository(db)
+	c.StatementRepository = repositories.NewStatementRepository(db)
+	c.WalletRepository = repositories.NewWalletRepository(db)
+	c.StatusRepository = repositories.NewStatusRepository(db)
+	c.ExpiryNoticeRepository = repositories.NewExpiryNoticeRepository(db)
+	c.ReferralRepository = repositories.NewReferralRepository(db)
+	c.Transactor = repositories.NewTransactor(db)
+
+	sms, err := services.NewSMSSender()
+	if err != nil {
+		return nil, err
+	}
+
+	c.OutboxService = services.NewOutboxService(c.OutboxRepository)
+	services.RegisterSquareOutboxHandlers(c.OutboxService, c.AuthRepository, c.SquareGateway)
+	c.JobService = services.NewJobService(c.JobRepository)
+
+	c.LoyaltyService = services.NewLoyaltyService(c.SquareGateway, c.PointsOperationRepository, c.AccountSnapshotRepository, c.JobService)
+	services.RegisterLoyaltyJobs(c.JobService, c.LoyaltyService)
+	c.ReferralService, err = services.NewReferralService(c.AuthRepository, c.ReferralRepository, c.AuditRepository, c.LoyaltyService, c.SquareGateway, c.JobService)
+	if err != nil {
+		return nil, err
+	}
+	c.LoyaltyService.OnBalanceChange(c.ReferralService.BalanceChanged)
+	services.RegisterReferralJobs(c.JobService, c.ReferralService, config.GetEnvDuration("REFERRAL_CHECK_AT", 4*time.Hour))
+	c.AuthService = services.NewAuthService(c.AuthRepository, c.PendingRegistrationRepository, c.Transactor, c.OutboxService, c.AuditRepository, c.LoyaltyService, c.ReferralService, c.SquareGateway, sms)
+	c.ProfileService = services.NewProfileService(c.AuthRepository, c.PhoneChangeRepository, c.AuditRepository, c.Transactor, c.OutboxService, sms)
+	c.PrivacyService = services.NewPrivacyService(c.AuthRepository, c.AuditRepository, c.LoyaltyService, c.Transactor, c.OutboxService)
+	services.RegisterPrivacyJobs(c.JobService, c.PrivacyService, config.GetEnvDuration("DELETION_WORKER_INTERVAL", time.Hour))
+	c.ContactMigrationService = services.NewContactMigrationService(c.AuthRepository, c.PhoneChangeRepository, c.AuditRepository, c.LoyaltyService)
+	c.RewardService = services.NewRewardService(c.SquareGateway, c.PointsOperationRepository)
+	c.StatusService = services.NewStatusService(c.AuthRepository, c.StatusRepository, c.AuditRepository, c.LoyaltyService, c.JobService)
+	c.LoyaltyService.SetEarnMultiplier(c.StatusService.EarnMultiplier)
+	services.RegisterStatusJobs(c.JobService, c.StatusService, config.GetEnvDuration("STATUS_EVALUATION_AT", 3*time.Hour))
+	c.ExpiryService = services.NewExpiryService(c.AuthRepository, c.ExpiryNoticeRepository, c.SquareGateway, c.JobService, sms)
+	services.RegisterExpiryJobs(c.JobService, c.ExpiryService, config.GetEnvDuration("POINTS_EXPIRY_AT", 2*time.Hour))
+	c.CardService = services.NewCardService(c.AuthRepository, c.LoyaltyService)
+	c.WalletService = services.NewWalletService(c.AuthRepository, c.WalletRepository, c.LoyaltyService, c.CardService, c.SquareGateway, c.JobService)
+	c.LoyaltyService.OnBalanceChange(c.WalletService.BalanceChanged)
+	services.RegisterWalletJobs(c.JobService, c.WalletService, config.GetEnvDuration("WALLET_SYNC_INTERVAL", 15*time.Minute))
+	c.StatementService = services.NewStatementService(c.AuthRepository, c.StatementRepository, c.LoyaltyService, c.JobService)
+	services.RegisterStatementJobs(c.JobService, c.StatementService, config.GetEnvDuration("STATEMENT_PURGE_INTERVAL", time.Hour))
+
+	c.AuthController = controllers.NewAuthController(c.AuthService)
+	c.LoyaltyController = controllers.NewLoyaltyController(c.LoyaltyService)
+	c.ProfileController = controllers.NewProfileController(c.ProfileService)
+	c.PrivacyController = controllers.NewPrivacyController(c.PrivacyService)
+	c.OutboxController = controllers.NewOutboxController(c.OutboxService)
+	c.JobController = controllers.NewJobController(c.JobService)
+	c.MetricsController = controllers.NewMetricsController(c.APIUsage)
+	c.StatementController = controllers.NewStatementController(c.StatementService)
+	c.CardController = controllers.NewCardController(c.CardService)
+	c.WalletController = controllers.NewWalletController(c.WalletService)
+	c.ExpiryController = controllers.NewExpiryController(c.ExpiryService)
+	c.ReferralController = controllers.NewReferralController(c.ReferralService)
+
+	c.AuthV2Controller = controllers.NewAuthV2Controller(c.AuthService)
+	c.LoyaltyV2Controller = controllers.NewLoyaltyV2Controller(c.LoyaltyService, c.StatusService)
+	c.ProfileV2Controller = controllers.NewProfileV2Controller(c.ProfileService, c.PrivacyService, c.StatusService)
+	c.RewardV2Controller = controllers.NewRewardV2Controller(c.RewardService, c.LoyaltyService)
+
+	return c, nil
+}
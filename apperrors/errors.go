@@ -0,0 +1,117 @@
+package apperrors
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Code is the stable, machine readable identifier of an error returned to clients
+type Code string
+
+const (
+	CodeInvalidRequest      Code = "invalid_request"
+	CodeUnauthorized        Code = "unauthorized"
+	CodeForbidden           Code = "forbidden"
+	CodeNotFound            Code = "not_found"
+	CodeConflict            Code = "conflict"
+	CodeInsufficientPoints  Code = "insufficient_points"
+	CodeInvalidRewardTier   Code = "invalid_reward_tier"
+	CodePaymentDeclined     Code = "payment_declined"
+	CodeRateLimited         Code = "rate_limited"
+	CodeUpstreamUnavailable Code = "upstream_unavailable"
+	CodeInternal            Code = "internal_error"
+)
+
+var statuses = map[Code]int{
+	CodeInvalidRequest:      http.StatusBadRequest,
+	CodeUnauthorized:        http.StatusUnauthorized,
+	CodeForbidden:           http.StatusForbidden,
+	CodeNotFound:            http.StatusNotFound,
+	CodeConflict:            http.StatusConflict,
+	CodeInsufficientPoints:  http.StatusUnprocessableEntity,
+	CodeInvalidRewardTier:   http.StatusUnprocessableEntity,
+	CodePaymentDeclined:     http.StatusPaymentRequired,
+	CodeRateLimited:         http.StatusTooManyRequests,
+	CodeUpstreamUnavailable: http.StatusServiceUnavailable,
+	CodeInternal:            http.StatusInternalServerError,
+}
+
+// Error is a domain error. Message and Details are shown to clients, the
+// wrapped cause is only logged.
+type Error struct {
+	Code    Code
+	Message string
+	Details interface{}
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Status is the HTTP status the error is answered with
+func (e *Error) Status() int {
+	if status, ok := statuses[e.Code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// WithDetails returns a copy carrying extra client facing data, leaving shared sentinels untouched
+func (e *Error) WithDetails(details interface{}) *Error {
+	copied := *e
+	copied.Details = details
+	return &copied
+}
+
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+func Wrap(code Code, message string, err error) *Error {
+	return &Error{Code: code, Message: message, Err: err}
+}
+
+func InvalidRequest(message string) *Error {
+	return New(CodeInvalidRequest, message)
+}
+
+func Unauthorized(message string) *Error {
+	return New(CodeUnauthorized, message)
+}
+
+func NotFound(message string) *Error {
+	return New(CodeNotFound, message)
+}
+
+func Conflict(message string) *Error {
+	return New(CodeConflict, message)
+}
+
+// From returns the domain error in err's chain. Anything else is an internal
+// error whose text is hidden from the client.
+func From(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	return Wrap(CodeInternal, "Something went wrong, please try again later", err)
+}
+
+// FieldError describes one invalid field of a request body
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Validation is an invalid_request error listing every failing field
+func Validation(fields ...FieldError) *Error {
+	return InvalidRequest("Request validation failed").WithDetails(fields)
+}
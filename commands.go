@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gimhanr9/go-loyalty-api/app"
+	"github.com/gimhanr9/go-loyalty-api/docs"
+	"github.com/gimhanr9/go-loyalty-api/migrations"
+	"github.com/gimhanr9/go-loyalty-api/routes"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// runCommand runs a one-off maintenance command instead of the server
+func runCommand(container *app.Container, args []string) {
+	switch args[0] {
+	case "migrate":
+		migrate(container.DB, args[1:])
+	case "normalize-users":
+		if err := migrations.CheckCompatible(container.DB); err != nil {
+			log.Fatalf("Refusing to run: %v", err)
+		}
+		normalizeUsers(container, args[1:])
+	case "check-openapi":
+		checkOpenAPI(container)
+	default:
+		log.Fatalf("Unknown command %q", args[0])
+	}
+}
+
+func normalizeUsers(container *app.Container, args []string) {
+	flags := flag.NewFlagSet("normalize-users", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "report changes without writing them")
+	flags.Parse(args)
+
+	report, err := container.ContactMigrationService.NormalizeUsers(context.Background(), *dryRun)
+	if err != nil {
+		log.Fatalf("Failed to normalize users: %v", err)
+	}
+
+	log.Printf("Normalized %d users, merged %d duplicates", report.Normalized, report.Merged)
+	if len(report.Invalid) > 0 {
+		log.Printf("Users with unparseable phone or email left unchanged: %v", report.Invalid)
+	}
+}
+
+// migrate runs `migrate up|down|status|to <version>`
+func migrate(db *gorm.DB, args []string) {
+	if len(args) == 0 {
+		log.Fatalf("Usage: migrate up|down|status|to <version>")
+	}
+
+	var err error
+	switch args[0] {
+	case "up":
+		err = migrations.Up(db)
+	case "down":
+		err = migrations.Down(db)
+	case "to":
+		if len(args) < 2 {
+			log.Fatalf("Usage: migrate to <version>")
+		}
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			log.Fatalf("Invalid version %q", args[1])
+		}
+		err = migrations.To(db, version)
+	case "status":
+		printMigrationStatus(db)
+		return
+	default:
+		log.Fatalf("Unknown migrate action %q", args[0])
+	}
+
+	if err != nil {
+		log.Fatalf("Migration failed: %v", err)
+	}
+
+	current, err := migrations.Current(db)
+	if err != nil {
+		log.Fatalf("Failed to read schema version: %v", err)
+	}
+	log.Printf("Schema is at version %d", current)
+}
+
+func printMigrationStatus(db *gorm.DB) {
+	statuses, err := migrations.StatusList(db)
+	if err != nil {
+		log.Fatalf("Failed to read migration status: %v", err)
+	}
+
+	for _, status := range statuses {
+		applied := "pending"
+		if status.AppliedAt != nil {
+			applied = "applied " + status.AppliedAt.Format(time.RFC3339)
+		}
+		log.Printf("%04d_%s: %s", status.Version, status.Name, applied)
+	}
+}
+
+// checkOpenAPI fails when a registered route is missing from the OpenAPI
+// document or the document describes an operation no route serves
+func checkOpenAPI(container *app.Container) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	routes.RegisterRoutes(router, container)
+
+	missing, err := docs.MissingRoutes(router.Routes())
+	if err != nil {
+		log.Fatalf("Failed to check the OpenAPI document: %v", err)
+	}
+	if len(missing) > 0 {
+		log.Fatalf("Routes missing from docs/openapi.json: %s", strings.Join(missing, ", "))
+	}
+
+	unserved, err := docs.UnservedOperations(router.Routes())
+	if err != nil {
+		log.Fatalf("Failed to check the OpenAPI document: %v", err)
+	}
+	if len(unserved) > 0 {
+		log.Fatalf("Operations in docs/openapi.json with no route: %s", strings.Join(unserved, ", "))
+	}
+
+	log.Printf("All %d routes are documented", len(router.Routes()))
+}
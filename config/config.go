@@ -1,7 +1,11 @@
 // config/config.go
 package config
 
-import "os"
+import (
+	"os"
+	"strconv"
+	"time"
+)
 
 func GetEnv(key, fallback string) string {
 	value := os.Getenv(key)
@@ -9,4 +13,31 @@ func GetEnv(key, fallback string) string {
 		return fallback
 	}
 	return value
-}
\ No newline at end of file
+}
+
+// GetEnvInt reads an integer variable, falling back when unset or malformed
+func GetEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// GetEnvDuration reads a duration such as "15m", falling back when unset or malformed
+func GetEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// GetEnvDate reads a date such as "2027-01-31" (midnight UTC), falling back when unset or malformed
+func GetEnvDate(key string, fallback time.Time) time.Time {
+	value, err := time.Parse(time.DateOnly, os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
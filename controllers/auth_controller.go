@@ -1,55 +1,93 @@
 package controllers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/gimhanr9/go-loyalty-api/dto"
-	"github.com/gimhanr9/go-loyalty-api/repositories"
 	"github.com/gimhanr9/go-loyalty-api/services"
 	"github.com/gimhanr9/go-loyalty-api/utils"
 	"github.com/gin-gonic/gin"
 )
 
-var authService = services.NewAuthService(repositories.NewAuthRepository())
+type AuthController struct {
+	authService services.AuthService
+}
+
+func NewAuthController(authService services.AuthService) *AuthController {
+	return &AuthController{authService: authService}
+}
 
-func Register(c *gin.Context) {
+func (ctrl *AuthController) Register(c *gin.Context) {
 	var req dto.RegisterDTO
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	user, err := ctrl.authService.Register(c.Request.Context(), req)
+	if errors.Is(err, services.ErrVerificationRequired) {
+		c.JSON(http.StatusAccepted, gin.H{"verification_required": true, "message": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrAccountSetupPending) {
+		c.JSON(http.StatusAccepted, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	token, err := utils.GenerateToken(user.CustomerID)
+	if err != nil {
+		c.Error(fmt.Errorf("failed to generate token: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": token, "user": user})
+}
+
+func (ctrl *AuthController) VerifyRegistration(c *gin.Context) {
+	var req dto.VerifyRegistrationDTO
+	if !bindJSON(c, &req) {
 		return
 	}
 
-	user, err := authService.Register(req)
+	user, err := ctrl.authService.VerifyRegistration(c.Request.Context(), req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
 	token, err := utils.GenerateToken(user.CustomerID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		c.Error(fmt.Errorf("failed to generate token: %w", err))
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"token": token, "user": user})
 }
 
-func Login(c *gin.Context) {
+func (ctrl *AuthController) Login(c *gin.Context) {
 	var req dto.LoginDTO
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+	if !bindJSON(c, &req) {
 		return
 	}
 
-	user, err := authService.Login(req)
+	user, err := ctrl.authService.Login(req)
+	if errors.Is(err, services.ErrAccountSetupPending) {
+		c.JSON(http.StatusAccepted, gin.H{"message": err.Error()})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
 	token, err := utils.GenerateToken(user.CustomerID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		c.Error(fmt.Errorf("failed to generate token: %w", err))
 		return
 	}
 
@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"errors"
+
+	"github.com/gimhanr9/go-loyalty-api/apperrors"
+	"github.com/gimhanr9/go-loyalty-api/validation"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// bindJSON decodes and validates the body, answering with the field errors when it fails
+func bindJSON(c *gin.Context, obj interface{}) bool {
+	if err := c.ShouldBindJSON(obj); err != nil {
+		c.Error(validation.Error(err))
+		return false
+	}
+	return true
+}
+
+// bindQuery decodes and validates the query string, answering with the field errors when it fails
+func bindQuery(c *gin.Context, obj interface{}) bool {
+	err := c.ShouldBindQuery(obj)
+	if err == nil {
+		return true
+	}
+
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		c.Error(validation.Error(err))
+	} else {
+		c.Error(apperrors.InvalidRequest("Query parameters are not valid"))
+	}
+	return false
+}
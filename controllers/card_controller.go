@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gimhanr9/go-loyalty-api/dto"
+	"github.com/gimhanr9/go-loyalty-api/services"
+	"github.com/gin-gonic/gin"
+)
+
+var cardContentTypes = map[string]string{
+	dto.CardFormatPNG: "image/png",
+	dto.CardFormatSVG: "image/svg+xml",
+}
+
+type CardController struct {
+	cardService services.CardService
+}
+
+func NewCardController(cardService services.CardService) *CardController {
+	return &CardController{cardService: cardService}
+}
+
+// GetCard answers with the current card code, or its QR code or barcode image
+func (ctrl *CardController) GetCard(c *gin.Context) {
+	var query dto.CardQueryDTO
+	if !bindQuery(c, &query) {
+		return
+	}
+
+	// The code rotates, never serve a stale one from a cache
+	c.Header("Cache-Control", "no-store")
+
+	if query.Format == "" || query.Format == dto.CardFormatJSON {
+		card, err := ctrl.cardService.GetCard(c.GetUint("user_id"))
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, card)
+		return
+	}
+
+	image, card, err := ctrl.cardService.RenderCard(c.GetUint("user_id"), query)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Header("Expires", card.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Data(http.StatusOK, cardContentTypes[query.Format], image)
+}
+
+// ResolveCard identifies the customer from a scanned card code
+func (ctrl *CardController) ResolveCard(c *gin.Context) {
+	var req dto.ResolveCardDTO
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	holder, err := ctrl.cardService.Resolve(c.Request.Context(), req.Code)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, holder)
+}
@@ -0,0 +1,33 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gimhanr9/go-loyalty-api/dto"
+	"github.com/gimhanr9/go-loyalty-api/services"
+	"github.com/gin-gonic/gin"
+)
+
+type ExpiryController struct {
+	expiryService services.ExpiryService
+}
+
+func NewExpiryController(expiryService services.ExpiryService) *ExpiryController {
+	return &ExpiryController{expiryService: expiryService}
+}
+
+// GetExpiringPoints lists the customer's points by the date they expire
+func (ctrl *ExpiryController) GetExpiringPoints(c *gin.Context) {
+	var query dto.ExpiringPointsQueryDTO
+	if !bindQuery(c, &query) {
+		return
+	}
+
+	expiring, err := ctrl.expiryService.GetExpiringPoints(c.Request.Context(), c.GetString("customer_id"), query)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, expiring)
+}
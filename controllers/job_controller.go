@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gimhanr9/go-loyalty-api/apperrors"
+	"github.com/gimhanr9/go-loyalty-api/services"
+	"github.com/gin-gonic/gin"
+)
+
+type JobController struct {
+	jobService services.JobService
+}
+
+func NewJobController(jobService services.JobService) *JobController {
+	return &JobController{jobService: jobService}
+}
+
+func (ctrl *JobController) ListJobs(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 500 {
+		c.Error(apperrors.InvalidRequest("Invalid limit"))
+		return
+	}
+
+	jobs, err := ctrl.jobService.List(c.Query("status"), c.Query("kind"), limit)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"jobs": jobs})
+}
+
+func (ctrl *JobController) RetryJob(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(apperrors.InvalidRequest("Invalid job id"))
+		return
+	}
+
+	job, err := ctrl.jobService.Retry(uint(id))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"job": job})
+}
+
+func (ctrl *JobController) CancelJob(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(apperrors.InvalidRequest("Invalid job id"))
+		return
+	}
+
+	job, err := ctrl.jobService.Cancel(uint(id))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"job": job})
+}
@@ -1,124 +1,167 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 
+	"github.com/gimhanr9/go-loyalty-api/apperrors"
 	"github.com/gimhanr9/go-loyalty-api/dto"
 	"github.com/gimhanr9/go-loyalty-api/services"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
-func RedeemPoints(c *gin.Context) {
+type LoyaltyController struct {
+	loyaltyService services.LoyaltyService
+}
+
+func NewLoyaltyController(loyaltyService services.LoyaltyService) *LoyaltyController {
+	return &LoyaltyController{loyaltyService: loyaltyService}
+}
+
+func (ctrl *LoyaltyController) RedeemPoints(c *gin.Context) {
 	var req dto.RedeemPointsDTO
 
-	if err := c.ShouldBindJSON(&req); err != nil || req.Amount <= 0 || req.Description == "" || req.RewardTierId == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+	if !bindJSON(c, &req) {
 		return
 	}
 
 	req.AccountId = c.GetString("customer_id")
+	req.IdempotencyKey = idempotencyKey(c)
 
-	err := services.RedeemPoints(req)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	err := ctrl.loyaltyService.RedeemPoints(c.Request.Context(), req)
+	if !handlePointsOperationError(c, err, req.IdempotencyKey) {
 		return
 	}
 
-	rewardTier, err := services.GetDiscountPercentageByClosestRewardTier(req.AccountId)
+	rewardTier, err := ctrl.loyaltyService.GetDiscountPercentageByClosestRewardTier(c.Request.Context(), req.AccountId)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
-	balance, err := services.GetBalance(req.AccountId)
+	balance, err := ctrl.loyaltyService.GetBalance(c.Request.Context(), req.AccountId)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"balance": balance, "rewardtier": rewardTier})
 }
 
-func EarnPoints(c *gin.Context) {
+func (ctrl *LoyaltyController) EarnPoints(c *gin.Context) {
 	var req dto.EarnPointsDTO
 
-	if err := c.ShouldBindJSON(&req); err != nil || req.Amount <= 0 || req.Description == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+	if !bindJSON(c, &req) {
 		return
 	}
 
 	req.AccountId = c.GetString("customer_id")
+	req.IdempotencyKey = idempotencyKey(c)
 
-	err := services.EarnPoints(req)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	err := ctrl.loyaltyService.EarnPoints(c.Request.Context(), req)
+	if !handlePointsOperationError(c, err, req.IdempotencyKey) {
 		return
 	}
 
-	rewardTier, err := services.GetDiscountPercentageByClosestRewardTier(req.AccountId)
+	rewardTier, err := ctrl.loyaltyService.GetDiscountPercentageByClosestRewardTier(c.Request.Context(), req.AccountId)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
-	balance, err := services.GetBalance(req.AccountId)
+	balance, err := ctrl.loyaltyService.GetBalance(c.Request.Context(), req.AccountId)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"balance": balance, "rewardtier": rewardTier})
 }
-func GetBalance(c *gin.Context) {
+
+func (ctrl *LoyaltyController) GetBalance(c *gin.Context) {
 	accountId := c.GetString("customer_id")
 
-	balance, err := services.GetBalance(accountId)
+	balance, err := ctrl.loyaltyService.GetBalanceSnapshot(c.Request.Context(), accountId)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"balance": balance})
+	c.JSON(http.StatusOK, balance)
 }
 
-func GetHistory(c *gin.Context) {
+func (ctrl *LoyaltyController) GetHistory(c *gin.Context) {
 	accountId := c.GetString("customer_id")
 	if accountId == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "missing customer_id in context"})
+		c.Error(apperrors.InvalidRequest("missing customer_id in context"))
 		return
 	}
 
-	cursor := c.Query("cursor") // read from query param
+	var query dto.HistoryQueryDTO
+	if !bindQuery(c, &query) {
+		return
+	}
 
-	history, err := services.GetHistory(accountId, cursor)
+	history, err := ctrl.loyaltyService.GetHistory(c.Request.Context(), accountId, query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(), // Return error message
-		})
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, history)
+	c.JSON(http.StatusOK, dto.NewMappedLoyaltyHistoryResponseDTO(history))
 }
 
-func GetRewardTiers(c *gin.Context) {
+func (ctrl *LoyaltyController) GetRewardTiers(c *gin.Context) {
 	accountId := c.GetString("customer_id")
 	if accountId == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "missing customer_id in context"})
+		c.Error(apperrors.InvalidRequest("missing customer_id in context"))
 		return
 	}
 
-	rewardTier, err := services.GetDiscountPercentageByClosestRewardTier(accountId)
+	rewardTier, err := ctrl.loyaltyService.GetDiscountPercentageByClosestRewardTier(c.Request.Context(), accountId)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
-	balance, err := services.GetBalance(accountId)
+	balance, err := ctrl.loyaltyService.GetBalance(c.Request.Context(), accountId)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"balance": balance, "rewardtier": rewardTier})
 }
+
+// idempotencyKey reads the Idempotency-Key header, generating a key when the client sent none
+func idempotencyKey(c *gin.Context) string {
+	if key := c.GetHeader("Idempotency-Key"); key != "" {
+		return key
+	}
+	return uuid.New().String()
+}
+
+// handlePointsOperationError writes the response for a failed earn or redeem and
+// reports whether the handler should carry on
+func handlePointsOperationError(c *gin.Context, err error, key string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, services.ErrOperationPending):
+		c.JSON(http.StatusAccepted, gin.H{"message": err.Error(), "idempotency_key": key})
+	default:
+		c.Error(pointsOperationError(err, key))
+	}
+	return false
+}
+
+// pointsOperationError attaches the idempotency key to a failed earn or redeem,
+// since retrying with the same key resumes the operation instead of starting over
+func pointsOperationError(err error, key string) error {
+	appErr := apperrors.From(err)
+	if appErr.Details == nil {
+		appErr = appErr.WithDetails(gin.H{"idempotency_key": key})
+	}
+	return appErr
+}
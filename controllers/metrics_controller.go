@@ -0,0 +1,21 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gimhanr9/go-loyalty-api/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+type MetricsController struct {
+	usage metrics.APIUsage
+}
+
+func NewMetricsController(usage metrics.APIUsage) *MetricsController {
+	return &MetricsController{usage: usage}
+}
+
+// GetAPIVersionUsage reports this replica's request counts per API version and route
+func (ctrl *MetricsController) GetAPIVersionUsage(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"since": ctrl.usage.Since(), "versions": ctrl.usage.Snapshot()})
+}
@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gimhanr9/go-loyalty-api/apperrors"
+	"github.com/gimhanr9/go-loyalty-api/services"
+	"github.com/gin-gonic/gin"
+)
+
+type OutboxController struct {
+	outboxService services.OutboxService
+}
+
+func NewOutboxController(outboxService services.OutboxService) *OutboxController {
+	return &OutboxController{outboxService: outboxService}
+}
+
+func (ctrl *OutboxController) ListMessages(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 500 {
+		c.Error(apperrors.InvalidRequest("Invalid limit"))
+		return
+	}
+
+	msgs, err := ctrl.outboxService.List(c.Query("status"), limit)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"messages": msgs})
+}
+
+func (ctrl *OutboxController) RetryMessage(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(apperrors.InvalidRequest("Invalid message id"))
+		return
+	}
+
+	msg, err := ctrl.outboxService.Retry(uint(id))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": msg})
+}
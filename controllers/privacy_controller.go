@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gimhanr9/go-loyalty-api/apperrors"
+	"github.com/gimhanr9/go-loyalty-api/services"
+	"github.com/gin-gonic/gin"
+)
+
+type PrivacyController struct {
+	privacyService services.PrivacyService
+}
+
+func NewPrivacyController(privacyService services.PrivacyService) *PrivacyController {
+	return &PrivacyController{privacyService: privacyService}
+}
+
+func (ctrl *PrivacyController) DeleteAccount(c *gin.Context) {
+	user, err := ctrl.privacyService.RequestDeletion(c.Request.Context(), c.GetUint("user_id"), services.ActorCustomer, false)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"deletion_scheduled_at": user.DeletionScheduledAt})
+}
+
+func (ctrl *PrivacyController) CancelAccountDeletion(c *gin.Context) {
+	user, err := ctrl.privacyService.CancelDeletion(c.GetUint("user_id"), services.ActorCustomer)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+func (ctrl *PrivacyController) ExportAccount(c *gin.Context) {
+	archive, err := ctrl.privacyService.Export(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	filename := "loyalty-export-" + time.Now().Format("20060102") + ".zip"
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Data(http.StatusOK, "application/zip", archive)
+}
+
+func (ctrl *PrivacyController) AdminDeleteUser(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(apperrors.InvalidRequest("Invalid user id"))
+		return
+	}
+
+	immediate := c.Query("immediate") == "true"
+
+	user, err := ctrl.privacyService.RequestDeletion(c.Request.Context(), uint(userID), services.ActorAdmin, immediate)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if immediate {
+		c.JSON(http.StatusOK, gin.H{"anonymized_at": user.AnonymizedAt})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"deletion_scheduled_at": user.DeletionScheduledAt})
+}
+
+func (ctrl *PrivacyController) AdminCancelUserDeletion(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(apperrors.InvalidRequest("Invalid user id"))
+		return
+	}
+
+	user, err := ctrl.privacyService.CancelDeletion(uint(userID), services.ActorAdmin)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
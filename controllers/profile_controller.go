@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gimhanr9/go-loyalty-api/dto"
+	"github.com/gimhanr9/go-loyalty-api/services"
+	"github.com/gin-gonic/gin"
+)
+
+type ProfileController struct {
+	profileService services.ProfileService
+}
+
+func NewProfileController(profileService services.ProfileService) *ProfileController {
+	return &ProfileController{profileService: profileService}
+}
+
+func (ctrl *ProfileController) GetProfile(c *gin.Context) {
+	customerID := c.GetString("customer_id")
+
+	user, err := ctrl.profileService.GetProfile(customerID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+func (ctrl *ProfileController) UpdateProfile(c *gin.Context) {
+	var req dto.UpdateProfileDTO
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	user, err := ctrl.profileService.UpdateProfile(c.GetString("customer_id"), req)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+func (ctrl *ProfileController) RequestPhoneChange(c *gin.Context) {
+	var req dto.PhoneChangeDTO
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := ctrl.profileService.RequestPhoneChange(c.GetString("customer_id"), req); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Verification code sent"})
+}
+
+func (ctrl *ProfileController) VerifyPhoneChange(c *gin.Context) {
+	var req dto.VerifyPhoneChangeDTO
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	user, err := ctrl.profileService.ConfirmPhoneChange(c.Request.Context(), c.GetString("customer_id"), req)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
@@ -0,0 +1,27 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gimhanr9/go-loyalty-api/services"
+	"github.com/gin-gonic/gin"
+)
+
+type ReferralController struct {
+	referralService services.ReferralService
+}
+
+func NewReferralController(referralService services.ReferralService) *ReferralController {
+	return &ReferralController{referralService: referralService}
+}
+
+// GetReferrals shows the customer's referral code and how their referrals are doing
+func (ctrl *ReferralController) GetReferrals(c *gin.Context) {
+	status, err := ctrl.referralService.GetStatus(c.GetUint("user_id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gimhanr9/go-loyalty-api/apperrors"
+	"github.com/gimhanr9/go-loyalty-api/dto"
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"github.com/gimhanr9/go-loyalty-api/services"
+	"github.com/gin-gonic/gin"
+)
+
+var statementContentTypes = map[string]string{
+	models.StatementCSV: "text/csv; charset=utf-8",
+	models.StatementPDF: "application/pdf",
+}
+
+type StatementController struct {
+	statementService services.StatementService
+}
+
+func NewStatementController(statementService services.StatementService) *StatementController {
+	return &StatementController{statementService: statementService}
+}
+
+// ExportHistory answers with the statement file, or with 202 and a link when
+// it is generated in the background
+func (ctrl *StatementController) ExportHistory(c *gin.Context) {
+	var query dto.StatementQueryDTO
+	if !bindQuery(c, &query) {
+		return
+	}
+
+	statement, err := ctrl.statementService.Export(c.Request.Context(), c.GetUint("user_id"), query)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if statement.Status == models.StatementReady {
+		sendStatement(c, statement)
+		return
+	}
+
+	base := strings.TrimSuffix(c.FullPath(), "/history/export")
+	c.Header("Location", fmt.Sprintf("%s/statements/%d", base, statement.ID))
+	c.JSON(http.StatusAccepted, dto.NewStatementDTO(statement, statementDownloadURL(base, statement.ID)))
+}
+
+func (ctrl *StatementController) GetStatement(c *gin.Context) {
+	statement, ok := ctrl.getStatement(c)
+	if !ok {
+		return
+	}
+
+	base := strings.TrimSuffix(c.FullPath(), "/statements/:id")
+	c.JSON(http.StatusOK, dto.NewStatementDTO(statement, statementDownloadURL(base, statement.ID)))
+}
+
+func (ctrl *StatementController) DownloadStatement(c *gin.Context) {
+	statement, ok := ctrl.getStatement(c)
+	if !ok {
+		return
+	}
+
+	switch statement.Status {
+	case models.StatementPending:
+		c.Error(apperrors.Conflict("The statement is still being generated"))
+	case models.StatementFailed:
+		c.Error(apperrors.Conflict("The statement could not be generated, please request it again"))
+	default:
+		sendStatement(c, statement)
+	}
+}
+
+func (ctrl *StatementController) getStatement(c *gin.Context) (*models.Statement, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(apperrors.InvalidRequest("Invalid statement id"))
+		return nil, false
+	}
+
+	statement, err := ctrl.statementService.Get(c.GetUint("user_id"), uint(id))
+	if err != nil {
+		c.Error(err)
+		return nil, false
+	}
+	return statement, true
+}
+
+// statementDownloadURL links to the download under the API version the request came in on
+func statementDownloadURL(base string, id uint) string {
+	return fmt.Sprintf("%s/statements/%d/download", base, id)
+}
+
+func sendStatement(c *gin.Context, statement *models.Statement) {
+	c.Header("Content-Disposition", `attachment; filename="`+statement.Filename+`"`)
+	c.Data(http.StatusOK, statementContentTypes[statement.Format], statement.Content)
+}
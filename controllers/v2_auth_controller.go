@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gimhanr9/go-loyalty-api/dto"
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"github.com/gimhanr9/go-loyalty-api/services"
+	"github.com/gimhanr9/go-loyalty-api/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// AuthV2Controller serves the /api/v2 auth routes
+type AuthV2Controller struct {
+	authService services.AuthService
+}
+
+func NewAuthV2Controller(authService services.AuthService) *AuthV2Controller {
+	return &AuthV2Controller{authService: authService}
+}
+
+func (ctrl *AuthV2Controller) Register(c *gin.Context) {
+	var req dto.RegisterV2DTO
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	user, err := ctrl.authService.Register(c.Request.Context(), dto.RegisterDTO(req))
+	ctrl.respond(c, user, err)
+}
+
+func (ctrl *AuthV2Controller) VerifyRegistration(c *gin.Context) {
+	var req dto.VerifyRegistrationV2DTO
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	user, err := ctrl.authService.VerifyRegistration(c.Request.Context(), dto.VerifyRegistrationDTO(req))
+	ctrl.respond(c, user, err)
+}
+
+func (ctrl *AuthV2Controller) Login(c *gin.Context) {
+	var req dto.LoginV2DTO
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	user, err := ctrl.authService.Login(dto.LoginDTO(req))
+	ctrl.respond(c, user, err)
+}
+
+// respond issues a token for the user, or reports why none can be issued yet
+func (ctrl *AuthV2Controller) respond(c *gin.Context, user *models.User, err error) {
+	switch {
+	case errors.Is(err, services.ErrVerificationRequired):
+		c.JSON(http.StatusAccepted, dto.AcceptedV2DTO{Status: dto.StatusVerificationRequired, Message: err.Error()})
+		return
+	case errors.Is(err, services.ErrAccountSetupPending):
+		c.JSON(http.StatusAccepted, dto.AcceptedV2DTO{Status: dto.StatusAccountSetupPending, Message: err.Error()})
+		return
+	case err != nil:
+		c.Error(err)
+		return
+	}
+
+	token, err := utils.GenerateToken(user.CustomerID)
+	if err != nil {
+		c.Error(fmt.Errorf("failed to generate token: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.AuthV2DTO{Token: token, User: dto.NewUserV2DTO(user)})
+}
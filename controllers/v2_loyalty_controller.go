@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gimhanr9/go-loyalty-api/dto"
+	"github.com/gimhanr9/go-loyalty-api/services"
+	"github.com/gin-gonic/gin"
+)
+
+// LoyaltyV2Controller serves the /api/v2 points routes
+type LoyaltyV2Controller struct {
+	loyaltyService services.LoyaltyService
+	statusService  services.StatusService
+}
+
+func NewLoyaltyV2Controller(loyaltyService services.LoyaltyService, statusService services.StatusService) *LoyaltyV2Controller {
+	return &LoyaltyV2Controller{loyaltyService: loyaltyService, statusService: statusService}
+}
+
+func (ctrl *LoyaltyV2Controller) EarnPoints(c *gin.Context) {
+	var req dto.EarnPointsV2DTO
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	req.AccountId = c.GetString("customer_id")
+	req.IdempotencyKey = idempotencyKey(c)
+
+	err := ctrl.loyaltyService.EarnPoints(c.Request.Context(), dto.EarnPointsDTO(req))
+	if !ctrl.handlePointsOperationError(c, err, req.IdempotencyKey) {
+		return
+	}
+
+	respondWithPoints(c, ctrl.loyaltyService, req.AccountId)
+}
+
+func (ctrl *LoyaltyV2Controller) RedeemPoints(c *gin.Context) {
+	var req dto.RedeemPointsV2DTO
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	req.AccountId = c.GetString("customer_id")
+	req.IdempotencyKey = idempotencyKey(c)
+
+	err := ctrl.loyaltyService.RedeemPoints(c.Request.Context(), dto.RedeemPointsDTO(req))
+	if !ctrl.handlePointsOperationError(c, err, req.IdempotencyKey) {
+		return
+	}
+
+	respondWithPoints(c, ctrl.loyaltyService, req.AccountId)
+}
+
+func (ctrl *LoyaltyV2Controller) GetPoints(c *gin.Context) {
+	respondWithPoints(c, ctrl.loyaltyService, c.GetString("customer_id"))
+}
+
+func (ctrl *LoyaltyV2Controller) GetBalance(c *gin.Context) {
+	balance, err := ctrl.loyaltyService.GetBalanceSnapshot(c.Request.Context(), c.GetString("customer_id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	status, err := ctrl.statusService.GetStatus(c.GetUint("user_id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.NewBalanceV2DTO(balance, status))
+}
+
+func (ctrl *LoyaltyV2Controller) GetHistory(c *gin.Context) {
+	var query dto.HistoryQueryDTO
+	if !bindQuery(c, &query) {
+		return
+	}
+
+	history, err := ctrl.loyaltyService.GetHistory(c.Request.Context(), c.GetString("customer_id"), query)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.NewHistoryV2DTO(history))
+}
+
+// respondWithPoints answers with the balance and the best reward tier it reaches
+func respondWithPoints(c *gin.Context, loyaltyService services.LoyaltyService, accountID string) {
+	rewardTier, err := loyaltyService.GetDiscountPercentageByClosestRewardTier(c.Request.Context(), accountID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	balance, err := loyaltyService.GetBalance(c.Request.Context(), accountID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.NewPointsV2DTO(balance, rewardTier))
+}
+
+func (ctrl *LoyaltyV2Controller) handlePointsOperationError(c *gin.Context, err error, key string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, services.ErrOperationPending):
+		c.JSON(http.StatusAccepted, dto.AcceptedV2DTO{Status: dto.StatusOperationPending, Message: err.Error(), IdempotencyKey: key})
+	default:
+		c.Error(pointsOperationError(err, key))
+	}
+	return false
+}
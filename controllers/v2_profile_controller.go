@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gimhanr9/go-loyalty-api/dto"
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"github.com/gimhanr9/go-loyalty-api/services"
+	"github.com/gin-gonic/gin"
+)
+
+// ProfileV2Controller serves the /api/v2/me routes that return the user
+type ProfileV2Controller struct {
+	profileService services.ProfileService
+	privacyService services.PrivacyService
+	statusService  services.StatusService
+}
+
+func NewProfileV2Controller(profileService services.ProfileService, privacyService services.PrivacyService, statusService services.StatusService) *ProfileV2Controller {
+	return &ProfileV2Controller{profileService: profileService, privacyService: privacyService, statusService: statusService}
+}
+
+func (ctrl *ProfileV2Controller) GetProfile(c *gin.Context) {
+	user, err := ctrl.profileService.GetProfile(c.GetString("customer_id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	ctrl.respondWithProfile(c, user)
+}
+
+func (ctrl *ProfileV2Controller) UpdateProfile(c *gin.Context) {
+	var req dto.UpdateProfileDTO
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	user, err := ctrl.profileService.UpdateProfile(c.GetString("customer_id"), req)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	ctrl.respondWithProfile(c, user)
+}
+
+func (ctrl *ProfileV2Controller) RequestPhoneChange(c *gin.Context) {
+	var req dto.PhoneChangeV2DTO
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := ctrl.profileService.RequestPhoneChange(c.GetString("customer_id"), dto.PhoneChangeDTO(req)); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, dto.AcceptedV2DTO{Status: dto.StatusVerificationSent, Message: "Verification code sent"})
+}
+
+func (ctrl *ProfileV2Controller) VerifyPhoneChange(c *gin.Context) {
+	var req dto.VerifyPhoneChangeDTO
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	user, err := ctrl.profileService.ConfirmPhoneChange(c.Request.Context(), c.GetString("customer_id"), req)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.NewUserV2DTO(user))
+}
+
+func (ctrl *ProfileV2Controller) DeleteAccount(c *gin.Context) {
+	user, err := ctrl.privacyService.RequestDeletion(c.Request.Context(), c.GetUint("user_id"), services.ActorCustomer, false)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, dto.DeletionScheduledV2DTO{
+		AcceptedV2DTO:       dto.AcceptedV2DTO{Status: dto.StatusDeletionScheduled, Message: "Account scheduled for deletion"},
+		DeletionScheduledAt: user.DeletionScheduledAt,
+	})
+}
+
+func (ctrl *ProfileV2Controller) CancelAccountDeletion(c *gin.Context) {
+	user, err := ctrl.privacyService.CancelDeletion(c.GetUint("user_id"), services.ActorCustomer)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.NewUserV2DTO(user))
+}
+
+// respondWithProfile answers with the user and their status level
+func (ctrl *ProfileV2Controller) respondWithProfile(c *gin.Context, user *models.User) {
+	status, err := ctrl.statusService.GetStatus(user.ID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.ProfileV2DTO{UserV2DTO: dto.NewUserV2DTO(user), Status: status})
+}
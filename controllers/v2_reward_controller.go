@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gimhanr9/go-loyalty-api/dto"
+	"github.com/gimhanr9/go-loyalty-api/services"
+	"github.com/gin-gonic/gin"
+)
+
+// RewardV2Controller serves the /api/v2 rewards a customer claims and uses later
+type RewardV2Controller struct {
+	rewardService  services.RewardService
+	loyaltyService services.LoyaltyService
+}
+
+func NewRewardV2Controller(rewardService services.RewardService, loyaltyService services.LoyaltyService) *RewardV2Controller {
+	return &RewardV2Controller{rewardService: rewardService, loyaltyService: loyaltyService}
+}
+
+func (ctrl *RewardV2Controller) IssueReward(c *gin.Context) {
+	var req dto.IssueRewardV2DTO
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	reward, err := ctrl.rewardService.IssueReward(c.Request.Context(), c.GetString("customer_id"), req.RewardTierID, idempotencyKey(c))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, reward)
+}
+
+func (ctrl *RewardV2Controller) ListRewards(c *gin.Context) {
+	rewards, err := ctrl.rewardService.ListIssuedRewards(c.Request.Context(), c.GetString("customer_id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.RewardListV2DTO{Rewards: rewards})
+}
+
+// CancelReward answers with the balance the returned points were added to
+func (ctrl *RewardV2Controller) CancelReward(c *gin.Context) {
+	accountID := c.GetString("customer_id")
+
+	if err := ctrl.rewardService.CancelReward(c.Request.Context(), accountID, c.Param("id")); err != nil {
+		c.Error(err)
+		return
+	}
+
+	respondWithPoints(c, ctrl.loyaltyService, accountID)
+}
+
+func (ctrl *RewardV2Controller) ApplyReward(c *gin.Context) {
+	var req dto.ApplyRewardV2DTO
+	// The body is optional, without one the reward is marked used at the default location
+	if c.Request.ContentLength != 0 && !bindJSON(c, &req) {
+		return
+	}
+
+	reward, err := ctrl.rewardService.ApplyReward(c.Request.Context(), c.GetString("customer_id"), c.Param("id"), req, idempotencyKey(c))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, reward)
+}
@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gimhanr9/go-loyalty-api/dto"
+	"github.com/gimhanr9/go-loyalty-api/services"
+	"github.com/gin-gonic/gin"
+)
+
+const pkpassContentType = "application/vnd.apple.pkpass"
+
+type WalletController struct {
+	walletService services.WalletService
+}
+
+func NewWalletController(walletService services.WalletService) *WalletController {
+	return &WalletController{walletService: walletService}
+}
+
+// GetApplePass downloads the customer's pass for Apple Wallet
+func (ctrl *WalletController) GetApplePass(c *gin.Context) {
+	pass, err := ctrl.walletService.ApplePass(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="`+pass.Filename+`"`)
+	sendPass(c, pass)
+}
+
+// GetGooglePass answers with the link that saves the customer's pass to Google Wallet
+func (ctrl *WalletController) GetGooglePass(c *gin.Context) {
+	pass, err := ctrl.walletService.GooglePass(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, pass)
+}
+
+// RegisterDevice subscribes an Apple device to a pass's updates
+func (ctrl *WalletController) RegisterDevice(c *gin.Context) {
+	var req dto.RegisterPassDeviceDTO
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	created, err := ctrl.walletService.RegisterDevice(c.Param("deviceLibraryIdentifier"), passRef(c), req.PushToken)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if created {
+		c.Status(http.StatusCreated)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// UnregisterDevice stops a pass's updates to an Apple device
+func (ctrl *WalletController) UnregisterDevice(c *gin.Context) {
+	if err := ctrl.walletService.UnregisterDevice(c.Param("deviceLibraryIdentifier"), passRef(c)); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// ListUpdatedPasses tells an Apple device which of its passes changed
+func (ctrl *WalletController) ListUpdatedPasses(c *gin.Context) {
+	var query dto.UpdatedPassesQueryDTO
+	if !bindQuery(c, &query) {
+		return
+	}
+
+	updated, err := ctrl.walletService.UpdatedPasses(c.Param("deviceLibraryIdentifier"), c.Param("passTypeIdentifier"), query.PassesUpdatedSince)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if updated == nil {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// GetLatestPass sends an Apple device the current version of its pass
+func (ctrl *WalletController) GetLatestPass(c *gin.Context) {
+	pass, err := ctrl.walletService.LatestPass(c.Request.Context(), passRef(c))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if since, err := http.ParseTime(c.GetHeader("If-Modified-Since")); err == nil && !pass.LastModified.Truncate(time.Second).After(since) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	sendPass(c, pass)
+}
+
+// Log records problems Apple devices had with the pass web service
+func (ctrl *WalletController) Log(c *gin.Context) {
+	var req dto.PassLogDTO
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	for _, message := range req.Logs {
+		log.Printf("wallet: device log: %s", message)
+	}
+	c.Status(http.StatusOK)
+}
+
+// passRef reads the pass named in the path and the token from the
+// "Authorization: ApplePass <token>" header
+func passRef(c *gin.Context) services.PassRef {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "ApplePass ")
+	if !ok {
+		token = ""
+	}
+	return services.PassRef{
+		PassTypeID:   c.Param("passTypeIdentifier"),
+		SerialNumber: c.Param("serialNumber"),
+		AuthToken:    token,
+	}
+}
+
+func sendPass(c *gin.Context, pass *services.PassFile) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Last-Modified", pass.LastModified.UTC().Format(http.TimeFormat))
+	c.Data(http.StatusOK, pkpassContentType, pass.Content)
+}
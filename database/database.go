@@ -1,32 +1,69 @@
 package database
 
 import (
+	"fmt"
 	"log"
+	"time"
 
-	"github.com/gimhanr9/go-loyalty-api/models"
+	"github.com/gimhanr9/go-loyalty-api/config"
+	postgresDriver "gorm.io/driver/postgres"
 	sqliteDriver "gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 
 	_ "modernc.org/sqlite" // Register pure Go SQLite driver
 )
 
-var DB *gorm.DB
+// Connect opens the database configured by DB_DRIVER and DB_DSN/DB_PATH
+func Connect() *gorm.DB {
+	db, err := Open(config.GetEnv("DB_DRIVER", "sqlite"), dsn())
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	return db
+}
+
+// dsn prefers DB_DSN and falls back to the SQLite file at DB_PATH
+func dsn() string {
+	if value := config.GetEnv("DB_DSN", ""); value != "" {
+		return value
+	}
+	return config.GetEnv("DB_PATH", "loyalty.db")
+}
 
-func Connect() {
-	var err error
+// Open connects to a sqlite or postgres database and applies the pool settings
+func Open(driver, dsn string) (*gorm.DB, error) {
+	var dialector gorm.Dialector
 
-	// Use gorm sqlite driver configured to use pure Go driver
-	DB, err = gorm.Open(sqliteDriver.New(sqliteDriver.Config{
-		DriverName: "sqlite",
-		DSN:        "loyalty.db",
-	}), &gorm.Config{})
+	switch driver {
+	case "sqlite":
+		// Use gorm sqlite driver configured to use pure Go driver
+		dialector = sqliteDriver.New(sqliteDriver.Config{
+			DriverName: "sqlite",
+			DSN:        dsn,
+		})
+	case "postgres":
+		dialector = postgresDriver.Open(dsn)
+	default:
+		return nil, fmt.Errorf("unsupported DB_DRIVER %q, expected sqlite or postgres", driver)
+	}
 
+	db, err := gorm.Open(dialector, &gorm.Config{})
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		return nil, err
 	}
 
-	err = DB.AutoMigrate(&models.User{})
+	sqlDB, err := db.DB()
 	if err != nil {
-		log.Fatalf("Failed to migrate database: %v", err)
+		return nil, err
 	}
+
+	// Pool tuning only matters for a shared server, SQLite keeps database/sql defaults
+	if driver == "postgres" {
+		sqlDB.SetMaxOpenConns(config.GetEnvInt("DB_MAX_OPEN_CONNS", 25))
+		sqlDB.SetMaxIdleConns(config.GetEnvInt("DB_MAX_IDLE_CONNS", 5))
+		sqlDB.SetConnMaxLifetime(config.GetEnvDuration("DB_CONN_MAX_LIFETIME", 30*time.Minute))
+		sqlDB.SetConnMaxIdleTime(config.GetEnvDuration("DB_CONN_MAX_IDLE_TIME", 5*time.Minute))
+	}
+
+	return db, nil
 }
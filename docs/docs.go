@@ -0,0 +1,137 @@
+package docs
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed openapi.json
+var spec []byte
+
+// assets holds the Swagger UI files, served from the binary so the page works
+// without reaching a CDN
+//
+//go:embed swagger-ui/swagger-ui-bundle.js swagger-ui/swagger-ui.css
+var assets embed.FS
+
+const uiPage = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>Square Loyalty API</title>
+  <link rel="stylesheet" href="/api/docs/assets/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="/api/docs/assets/swagger-ui-bundle.js"></script>
+  <script>
+    SwaggerUIBundle({ url: "/api/openapi.json", dom_id: "#swagger-ui" });
+  </script>
+</body>
+</html>`
+
+// Spec serves the OpenAPI document
+func Spec(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json; charset=utf-8", spec)
+}
+
+// UI serves the interactive documentation page
+func UI(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(uiPage))
+}
+
+// Asset serves a Swagger UI file for the documentation page
+func Asset(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.FileFromFS("swagger-ui/"+c.Param("file"), http.FS(assets))
+}
+
+// operationMethods are the keys of a path item that describe an operation
+var operationMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// specPaths reads the document's operations, by path and lower case method
+func specPaths() (map[string]map[string]json.RawMessage, error) {
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+	return doc.Paths, nil
+}
+
+// MissingRoutes lists the registered routes the OpenAPI document does not describe
+func MissingRoutes(routes gin.RoutesInfo) ([]string, error) {
+	paths, err := specPaths()
+	if err != nil {
+		return nil, err
+	}
+
+	described := func(method, path string) bool {
+		_, ok := paths[path][strings.ToLower(method)]
+		return ok
+	}
+
+	var missing []string
+	for _, route := range routes {
+		path := openAPIPath(route.Path)
+		if described(route.Method, path) {
+			continue
+		}
+		// The unversioned /api/... customer routes are aliases of /api/v1/...
+		if alias, ok := strings.CutPrefix(path, "/api/"); ok && described(route.Method, "/api/v1/"+alias) {
+			continue
+		}
+		missing = append(missing, route.Method+" "+route.Path)
+	}
+	sort.Strings(missing)
+	return missing, nil
+}
+
+// UnservedOperations lists the operations in the OpenAPI document that no
+// registered route serves
+func UnservedOperations(routes gin.RoutesInfo) ([]string, error) {
+	paths, err := specPaths()
+	if err != nil {
+		return nil, err
+	}
+
+	served := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		served[route.Method+" "+openAPIPath(route.Path)] = true
+	}
+
+	var unserved []string
+	for path, operations := range paths {
+		for method := range operations {
+			// A path item may also hold fields shared by its operations, such as parameters
+			if !slices.Contains(operationMethods, method) {
+				continue
+			}
+			operation := strings.ToUpper(method) + " " + path
+			if !served[operation] {
+				unserved = append(unserved, operation)
+			}
+		}
+	}
+	sort.Strings(unserved)
+	return unserved, nil
+}
+
+// openAPIPath converts gin's /users/:id into /users/{id}
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,9 @@
+package dto
+
+import "time"
+
+type BalanceDTO struct {
+	Balance int        `json:"balance"`
+	Stale   bool       `json:"stale,omitempty"`
+	AsOf    *time.Time `json:"as_of,omitempty"`
+}
@@ -0,0 +1,59 @@
+package dto
+
+import "time"
+
+const (
+	CardFormatJSON = "json"
+	CardFormatPNG  = "png"
+	CardFormatSVG  = "svg"
+)
+
+const (
+	CardSymbologyQR      = "qr"
+	CardSymbologyCode128 = "code128"
+)
+
+const defaultCardImageSize = 300
+
+// CardQueryDTO selects how /me/card renders the code. Images are about size pixels wide.
+type CardQueryDTO struct {
+	Format string `form:"format" json:"format" binding:"omitempty,oneof=json png svg"`
+	Type   string `form:"type" json:"type" binding:"omitempty,oneof=qr code128"`
+	Size   int    `form:"size" json:"size" binding:"omitempty,min=64,max=1024"`
+}
+
+func (q CardQueryDTO) Symbology() string {
+	if q.Type == "" {
+		return CardSymbologyQR
+	}
+	return q.Type
+}
+
+func (q CardQueryDTO) ImageSize() int {
+	if q.Size == 0 {
+		return defaultCardImageSize
+	}
+	return q.Size
+}
+
+// CardDTO is the code currently shown on the customer's card, to be fetched
+// again once it expires
+type CardDTO struct {
+	Code          string    `json:"code"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	PeriodSeconds int       `json:"period_seconds"`
+}
+
+type ResolveCardDTO struct {
+	Code string `json:"code" binding:"required,notblank,max=64"`
+}
+
+// CardHolderDTO identifies the customer a scanned card belongs to
+type CardHolderDTO struct {
+	UserID           uint       `json:"user_id"`
+	Name             string     `json:"name"`
+	LoyaltyAccountID string     `json:"loyalty_account_id"`
+	Balance          *int       `json:"balance"`
+	Stale            bool       `json:"stale"`
+	AsOf             *time.Time `json:"as_of"`
+}
@@ -2,6 +2,9 @@ package dto
 
 type EarnPointsDTO struct {
 	AccountId   string `json:"customer_id"`
-	Amount      int    `json:"amount"`
-	Description string `json:"description"`
+	Amount      int    `json:"amount" binding:"min=1,max=1000000"`
+	Description string `json:"description" binding:"required,notblank,max=255"`
+
+	// IdempotencyKey comes from the Idempotency-Key header
+	IdempotencyKey string `json:"-"`
 }
@@ -0,0 +1,28 @@
+package dto
+
+import "time"
+
+// Where the points expiry schedule comes from
+const (
+	ExpiryPolicySquare = "square" // the Square program's expiration policy, Square expires the points
+	ExpiryPolicyLocal  = "local"  // POINTS_EXPIRATION, this API expires the points
+	ExpiryPolicyNone   = "none"
+)
+
+type ExpiringPointsQueryDTO struct {
+	Days int `form:"days" json:"days" binding:"omitempty,min=1,max=3650"`
+}
+
+// ExpiringPointsDTO lists the points still on the account by when they
+// expire, soonest first
+type ExpiringPointsDTO struct {
+	Policy     string                `json:"policy"`
+	Expiration *string               `json:"expiration"` // how long points last as an ISO 8601 duration, null without a policy
+	Total      int                   `json:"total"`
+	Points     []ExpiringPointsEntry `json:"points"`
+}
+
+type ExpiringPointsEntry struct {
+	Points    int       `json:"points"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
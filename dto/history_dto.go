@@ -0,0 +1,35 @@
+package dto
+
+import "time"
+
+// MoneyDTO is an amount in the currency's smallest unit, e.g. cents
+type MoneyDTO struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// HistoryEntry is a loyalty event as the services return it, each API version
+// maps it to its own response shape. Points are signed: negative when points
+// leave the account.
+type HistoryEntry struct {
+	ID             string     `json:"id"`
+	Type           string     `json:"type"`
+	Points         int        `json:"points"`
+	Description    string     `json:"description"`
+	OrderID        string     `json:"order_id,omitempty"`
+	OrderTotal     *MoneyDTO  `json:"order_total,omitempty"`
+	LocationID     string     `json:"location_id,omitempty"`
+	LocationName   string     `json:"location_name,omitempty"`
+	RewardID       string     `json:"reward_id,omitempty"`
+	RewardTierID   string     `json:"reward_tier_id,omitempty"`
+	RewardTierName string     `json:"reward_tier_name,omitempty"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+type HistoryPage struct {
+	Transactions []HistoryEntry `json:"transactions"`
+	Cursor       string         `json:"cursor"`
+	Stale        bool           `json:"stale,omitempty"`
+	AsOf         *time.Time     `json:"as_of,omitempty"`
+}
@@ -0,0 +1,51 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/gimhanr9/go-loyalty-api/utils"
+)
+
+// Event types customers can filter history by
+const (
+	HistoryTypeEarned   = "earned"
+	HistoryTypeRedeemed = "redeemed"
+	HistoryTypeAdjusted = "adjusted"
+	HistoryTypeExpired  = "expired"
+)
+
+const (
+	HistorySortNewest = "newest"
+	HistorySortOldest = "oldest"
+)
+
+// HistoryQueryDTO holds the optional history filters from the query string.
+// type and location_id may be repeated.
+type HistoryQueryDTO struct {
+	Cursor      string   `form:"cursor" json:"cursor" binding:"max=512"`
+	Types       []string `form:"type" json:"type" binding:"max=4,dive,oneof=earned redeemed adjusted expired"`
+	From        string   `form:"from" json:"from" binding:"omitempty,date_or_time"`
+	To          string   `form:"to" json:"to" binding:"omitempty,date_or_time"`
+	LocationIDs []string `form:"location_id" json:"location_id" binding:"max=10,dive,notblank,max=64"`
+	OrderID     string   `form:"order_id" json:"order_id" binding:"max=192"`
+	Limit       int      `form:"limit" json:"limit" binding:"omitempty,min=1,max=30"`
+	Sort        string   `form:"sort" json:"sort" binding:"omitempty,oneof=newest oldest"`
+}
+
+// Range parses from and to, which have already been validated. A date-only
+// to includes that whole day.
+func (q HistoryQueryDTO) Range() (from, to *time.Time) {
+	if t, err := utils.ParseDateOrTime(q.From, false); err == nil {
+		from = &t
+	}
+	if t, err := utils.ParseDateOrTime(q.To, true); err == nil {
+		to = &t
+	}
+	return from, to
+}
+
+// IsUnfiltered reports whether this is the first page of the default listing
+func (q HistoryQueryDTO) IsUnfiltered() bool {
+	return q.Cursor == "" && len(q.Types) == 0 && q.From == "" && q.To == "" &&
+		len(q.LocationIDs) == 0 && q.OrderID == "" && q.Sort != HistorySortOldest
+}
@@ -1,5 +1,5 @@
 package dto
 
 type LoginDTO struct {
-	Phone string `json:"phoneNumber"`
+	Phone string `json:"phoneNumber" binding:"required,phone"`
 }
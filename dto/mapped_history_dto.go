@@ -1,6 +1,19 @@
 package dto
 
+import "time"
+
 type MappedLoyaltyHistoryResponseDTO struct {
 	Transactions []TransactionDTO `json:"transactions"`
 	Cursor       string           `json:"cursor"`
+	Stale        bool             `json:"stale,omitempty"`
+	AsOf         *time.Time       `json:"as_of,omitempty"`
+}
+
+func NewMappedLoyaltyHistoryResponseDTO(page *HistoryPage) *MappedLoyaltyHistoryResponseDTO {
+	return &MappedLoyaltyHistoryResponseDTO{
+		Transactions: NewTransactionDTOs(page.Transactions),
+		Cursor:       page.Cursor,
+		Stale:        page.Stale,
+		AsOf:         page.AsOf,
+	}
 }
@@ -0,0 +1,14 @@
+package dto
+
+type UpdateProfileDTO struct {
+	Name  *string `json:"name" binding:"required_without=Email,omitnil,notblank,max=100"`
+	Email *string `json:"email" binding:"omitnil,max=254,contact_email"`
+}
+
+type PhoneChangeDTO struct {
+	Phone string `json:"phoneNumber" binding:"required,phone"`
+}
+
+type VerifyPhoneChangeDTO struct {
+	Code string `json:"code" binding:"required,len=6,numeric"`
+}
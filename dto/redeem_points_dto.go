@@ -2,7 +2,10 @@ package dto
 
 type RedeemPointsDTO struct {
 	AccountId    string `json:"customer_id"`
-	Amount       int    `json:"amount"`
-	Description  string `json:"description"`
-	RewardTierId string `json:"rewardtier"`
+	Amount       int    `json:"amount" binding:"min=1,max=1000000"`
+	Description  string `json:"description" binding:"required,notblank,max=255"`
+	RewardTierId string `json:"rewardtier" binding:"required,max=64"`
+
+	// IdempotencyKey comes from the Idempotency-Key header
+	IdempotencyKey string `json:"-"`
 }
@@ -0,0 +1,29 @@
+package dto
+
+import "time"
+
+// ReferralStatusDTO is the customer's referral code, what referring a friend
+// earns and how their referrals are doing
+type ReferralStatusDTO struct {
+	Code             string        `json:"code"`
+	ReferrerPoints   int           `json:"referrer_points"`   // what the customer earns per friend
+	RefereePoints    int           `json:"referee_points"`    // what the friend earns
+	QualifyingPoints int           `json:"qualifying_points"` // what the friend's first earn must reach
+	MaxReferrals     *int          `json:"max_referrals"`     // null without a cap
+	Remaining        *int          `json:"remaining"`
+	PointsEarned     int           `json:"points_earned"`
+	Referrals        []ReferralDTO `json:"referrals"`
+	ReferredBy       *ReferralDTO  `json:"referred_by"` // the customer's own referral, null if they registered without a code
+}
+
+// ReferralDTO is one referral. name is the referred friend's first name, and
+// is empty on the customer's own referral. points is the bonus the customer
+// received for it.
+type ReferralDTO struct {
+	Name       string     `json:"name"`
+	Status     string     `json:"status"`
+	Points     int        `json:"points"`
+	CreatedAt  time.Time  `json:"created_at"`
+	QualifyBy  *time.Time `json:"qualify_by"`
+	RewardedAt *time.Time `json:"rewarded_at"`
+}
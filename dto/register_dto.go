@@ -1,7 +1,11 @@
 package dto
 
 type RegisterDTO struct {
-	Name  string `json:"name"`
-	Email string `json:"email"`
-	Phone string `json:"phoneNumber"`
+	Name  string `json:"name" binding:"required,notblank,max=100"`
+	Email string `json:"email" binding:"required,max=254,contact_email"`
+	Phone string `json:"phoneNumber" binding:"required,phone"`
+	// ReferralCode is the code of the customer who referred this one, and
+	// DeviceID an identifier of the app install, used to spot self-referrals
+	ReferralCode string `json:"referralCode" binding:"omitempty,max=32"`
+	DeviceID     string `json:"deviceId" binding:"omitempty,max=200"`
 }
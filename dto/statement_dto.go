@@ -0,0 +1,50 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/gimhanr9/go-loyalty-api/models"
+)
+
+// StatementQueryDTO selects the format and period of a statement. Without from
+// the statement starts when the account was opened, without to it runs to now.
+type StatementQueryDTO struct {
+	Format string `form:"format" json:"format" binding:"required,oneof=csv pdf"`
+	From   string `form:"from" json:"from" binding:"omitempty,date_or_time"`
+	To     string `form:"to" json:"to" binding:"omitempty,date_or_time"`
+}
+
+// Range parses from and to like HistoryQueryDTO.Range
+func (q StatementQueryDTO) Range() (from, to *time.Time) {
+	return HistoryQueryDTO{From: q.From, To: q.To}.Range()
+}
+
+// StatementDTO describes a statement generated in the background
+type StatementDTO struct {
+	ID          uint      `json:"id"`
+	Status      string    `json:"status"`
+	Format      string    `json:"format"`
+	From        string    `json:"from,omitempty"`
+	To          string    `json:"to,omitempty"`
+	DownloadURL string    `json:"download_url"`
+	Error       string    `json:"error,omitempty"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func NewStatementDTO(statement *models.Statement, downloadURL string) StatementDTO {
+	result := StatementDTO{
+		ID:          statement.ID,
+		Status:      statement.Status,
+		Format:      statement.Format,
+		From:        statement.From,
+		To:          statement.To,
+		DownloadURL: downloadURL,
+		ExpiresAt:   statement.ExpiresAt,
+		CreatedAt:   statement.CreatedAt,
+	}
+	if statement.Status == models.StatementFailed {
+		result.Error = "The statement could not be generated, please request it again"
+	}
+	return result
+}
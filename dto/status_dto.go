@@ -0,0 +1,24 @@
+package dto
+
+import "time"
+
+// What status levels are qualified by
+const (
+	StatusBasisPoints = "points" // points earned
+	StatusBasisSpend  = "spend"  // order totals, in the currency's smallest unit
+)
+
+// StatusDTO is the customer's status level. level is null below the first
+// level, next_level is null at the top one.
+type StatusDTO struct {
+	Level           *string    `json:"level"`
+	Name            *string    `json:"name"`
+	EarnMultiplier  float64    `json:"earn_multiplier"`
+	Basis           string     `json:"basis"`
+	QualifyingValue int        `json:"qualifying_value"`
+	NextLevel       *string    `json:"next_level"`
+	NextLevelAt     *int       `json:"next_level_at"`
+	AchievedAt      *time.Time `json:"achieved_at"`
+	DowngradeAt     *time.Time `json:"downgrade_at"`
+	EvaluatedAt     *time.Time `json:"evaluated_at"`
+}
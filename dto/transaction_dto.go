@@ -6,3 +6,29 @@ type TransactionDTO struct {
 	Points    int    `json:"points"`
 	Timestamp string `json:"timestamp"`
 }
+
+// NewTransactionDTOs maps history entries to the v1 shape, with the timestamp
+// pre-formatted in Square's time zone
+func NewTransactionDTOs(entries []HistoryEntry) []TransactionDTO {
+	transactions := make([]TransactionDTO, 0, len(entries))
+	for _, e := range entries {
+		transactions = append(transactions, TransactionDTO{
+			Id:        e.ID,
+			Type:      e.Type,
+			Points:    legacyPoints(e),
+			Timestamp: e.CreatedAt.Format("2 Jan 2006 15:04"),
+		})
+	}
+	return transactions
+}
+
+// legacyPoints is the value v1 has always reported: Square's points for the
+// event types it knew about, rewards being negative, and none for the others
+func legacyPoints(e HistoryEntry) int {
+	switch e.Type {
+	case "ACCUMULATE_POINTS", "ADJUST_POINTS", "CREATE_REWARD":
+		return e.Points
+	default:
+		return 0
+	}
+}
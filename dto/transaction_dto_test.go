@@ -0,0 +1,30 @@
+package dto
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// v1 history keeps the shape shipped apps parse
+func TestNewTransactionDTOsV1Shape(t *testing.T) {
+	at := time.Date(2026, 3, 4, 15, 30, 0, 0, time.UTC)
+	entries := []HistoryEntry{
+		{ID: "earn", Type: "ACCUMULATE_POINTS", Points: 25, OrderID: "order", CreatedAt: at},
+		{ID: "reward", Type: "CREATE_REWARD", Points: -100, RewardID: "r", RewardTierName: "Free coffee", CreatedAt: at},
+		{ID: "expired", Type: "EXPIRE_POINTS", Points: -10, CreatedAt: at},
+	}
+
+	body, err := json.Marshal(NewTransactionDTOs(entries))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[` +
+		`{"id":"earn","type":"ACCUMULATE_POINTS","points":25,"timestamp":"4 Mar 2026 15:30"},` +
+		`{"id":"reward","type":"CREATE_REWARD","points":-100,"timestamp":"4 Mar 2026 15:30"},` +
+		`{"id":"expired","type":"EXPIRE_POINTS","points":0,"timestamp":"4 Mar 2026 15:30"}` +
+		`]`
+	if string(body) != want {
+		t.Errorf("got  %s\nwant %s", body, want)
+	}
+}
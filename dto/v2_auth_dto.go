@@ -0,0 +1,68 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/gimhanr9/go-loyalty-api/models"
+)
+
+// The v2 request DTOs carry the same fields as their v1 counterparts so they
+// convert directly, only the JSON names differ
+
+type RegisterV2DTO struct {
+	Name         string `json:"name" binding:"required,notblank,max=100"`
+	Email        string `json:"email" binding:"required,max=254,contact_email"`
+	Phone        string `json:"phone" binding:"required,phone"`
+	ReferralCode string `json:"referral_code" binding:"omitempty,max=32"`
+	DeviceID     string `json:"device_id" binding:"omitempty,max=200"`
+}
+
+type VerifyRegistrationV2DTO struct {
+	Phone string `json:"phone" binding:"required,phone"`
+	Code  string `json:"code" binding:"required,len=6,numeric"`
+}
+
+type LoginV2DTO struct {
+	Phone string `json:"phone" binding:"required,phone"`
+}
+
+type UserV2DTO struct {
+	ID                  uint       `json:"id"`
+	Name                string     `json:"name"`
+	Email               string     `json:"email"`
+	Phone               string     `json:"phone"`
+	LoyaltyAccountID    string     `json:"loyalty_account_id"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at"`
+}
+
+func NewUserV2DTO(user *models.User) UserV2DTO {
+	return UserV2DTO{
+		ID:                  user.ID,
+		Name:                user.Name,
+		Email:               user.Email,
+		Phone:               user.Phone,
+		LoyaltyAccountID:    user.CustomerID,
+		DeletionScheduledAt: user.DeletionScheduledAt,
+	}
+}
+
+type AuthV2DTO struct {
+	Token string    `json:"token"`
+	User  UserV2DTO `json:"user"`
+}
+
+// Statuses reported by v2 202 Accepted responses
+const (
+	StatusVerificationRequired = "verification_required"
+	StatusAccountSetupPending  = "account_setup_pending"
+	StatusVerificationSent     = "verification_sent"
+	StatusOperationPending     = "pending"
+	StatusDeletionScheduled    = "deletion_scheduled"
+)
+
+// AcceptedV2DTO is the body of every v2 202 Accepted response
+type AcceptedV2DTO struct {
+	Status         string `json:"status"`
+	Message        string `json:"message"`
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
@@ -0,0 +1,117 @@
+package dto
+
+import "time"
+
+type EarnPointsV2DTO struct {
+	AccountId   string `json:"-"`
+	Amount      int    `json:"amount" binding:"min=1,max=1000000"`
+	Description string `json:"description" binding:"required,notblank,max=255"`
+
+	IdempotencyKey string `json:"-"`
+}
+
+type RedeemPointsV2DTO struct {
+	AccountId    string `json:"-"`
+	Amount       int    `json:"amount" binding:"min=1,max=1000000"`
+	Description  string `json:"description" binding:"required,notblank,max=255"`
+	RewardTierId string `json:"reward_tier_id" binding:"required,max=64"`
+
+	IdempotencyKey string `json:"-"`
+}
+
+type RewardTierV2DTO struct {
+	ID                 string  `json:"id"`
+	DiscountPercentage float32 `json:"discount_percentage"`
+}
+
+// PointsV2DTO is the balance with the best reward tier it reaches, or a null tier
+type PointsV2DTO struct {
+	Balance    int              `json:"balance"`
+	RewardTier *RewardTierV2DTO `json:"reward_tier"`
+}
+
+func NewPointsV2DTO(balance int, tier *RewardTierDTO) PointsV2DTO {
+	points := PointsV2DTO{Balance: balance}
+	if tier != nil && tier.RewardTierId != "" {
+		points.RewardTier = &RewardTierV2DTO{ID: tier.RewardTierId, DiscountPercentage: tier.DiscountPercentage}
+	}
+	return points
+}
+
+// BalanceV2DTO is the balance with the customer's status level, status is
+// null when status levels are off
+type BalanceV2DTO struct {
+	Balance int        `json:"balance"`
+	Stale   bool       `json:"stale"`
+	AsOf    *time.Time `json:"as_of"`
+	Status  *StatusDTO `json:"status"`
+}
+
+func NewBalanceV2DTO(balance *BalanceDTO, status *StatusDTO) BalanceV2DTO {
+	return BalanceV2DTO{Balance: balance.Balance, Stale: balance.Stale, AsOf: balance.AsOf, Status: status}
+}
+
+// TransactionV2DTO is a history entry, details that don't apply to the event are null
+type TransactionV2DTO struct {
+	ID             string     `json:"id"`
+	Type           string     `json:"type"`
+	Points         int        `json:"points"`
+	Description    string     `json:"description"`
+	OrderID        *string    `json:"order_id"`
+	OrderTotal     *MoneyDTO  `json:"order_total"`
+	LocationID     *string    `json:"location_id"`
+	LocationName   *string    `json:"location_name"`
+	RewardID       *string    `json:"reward_id"`
+	RewardTierID   *string    `json:"reward_tier_id"`
+	RewardTierName *string    `json:"reward_tier_name"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+func NewTransactionV2DTO(e HistoryEntry) TransactionV2DTO {
+	return TransactionV2DTO{
+		ID:             e.ID,
+		Type:           e.Type,
+		Points:         e.Points,
+		Description:    e.Description,
+		OrderID:        nullable(e.OrderID),
+		OrderTotal:     e.OrderTotal,
+		LocationID:     nullable(e.LocationID),
+		LocationName:   nullable(e.LocationName),
+		RewardID:       nullable(e.RewardID),
+		RewardTierID:   nullable(e.RewardTierID),
+		RewardTierName: nullable(e.RewardTierName),
+		ExpiresAt:      e.ExpiresAt,
+		CreatedAt:      e.CreatedAt,
+	}
+}
+
+func nullable(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// HistoryV2DTO is a page of events, next_cursor is null on the last page
+type HistoryV2DTO struct {
+	Transactions []TransactionV2DTO `json:"transactions"`
+	NextCursor   *string            `json:"next_cursor"`
+	Stale        bool               `json:"stale"`
+	AsOf         *time.Time         `json:"as_of"`
+}
+
+func NewHistoryV2DTO(page *HistoryPage) HistoryV2DTO {
+	history := HistoryV2DTO{
+		Transactions: make([]TransactionV2DTO, 0, len(page.Transactions)),
+		Stale:        page.Stale,
+		AsOf:         page.AsOf,
+	}
+	for _, e := range page.Transactions {
+		history.Transactions = append(history.Transactions, NewTransactionV2DTO(e))
+	}
+	if page.Cursor != "" {
+		history.NextCursor = &page.Cursor
+	}
+	return history
+}
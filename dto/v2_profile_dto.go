@@ -0,0 +1,21 @@
+package dto
+
+import "time"
+
+type PhoneChangeV2DTO struct {
+	Phone string `json:"phone" binding:"required,phone"`
+}
+
+// DeletionScheduledV2DTO answers a deletion request, the account is removed
+// at DeletionScheduledAt unless the deletion is cancelled first
+type DeletionScheduledV2DTO struct {
+	AcceptedV2DTO
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at"`
+}
+
+// ProfileV2DTO is the user with their status level, status is null when
+// status levels are off
+type ProfileV2DTO struct {
+	UserV2DTO
+	Status *StatusDTO `json:"status"`
+}
@@ -0,0 +1,38 @@
+package dto
+
+import "time"
+
+// Reward statuses, Square's in lower case
+const (
+	RewardStatusIssued   = "issued"
+	RewardStatusRedeemed = "redeemed"
+	RewardStatusDeleted  = "deleted"
+)
+
+// IssueRewardV2DTO claims a reward now, to be used at a later checkout
+type IssueRewardV2DTO struct {
+	RewardTierID string `json:"reward_tier_id" binding:"required,max=64"`
+}
+
+// ApplyRewardV2DTO uses an issued reward at checkout. With an order ID the
+// reward's discount goes on that Square order and is redeemed when it is paid,
+// without one the reward is marked used at the location.
+type ApplyRewardV2DTO struct {
+	OrderID    string `json:"order_id" binding:"max=192"`
+	LocationID string `json:"location_id" binding:"max=64"`
+}
+
+type RewardV2DTO struct {
+	ID             string     `json:"id"`
+	Status         string     `json:"status"`
+	RewardTierID   string     `json:"reward_tier_id"`
+	RewardTierName *string    `json:"reward_tier_name"`
+	Points         int        `json:"points"`
+	OrderID        *string    `json:"order_id"`
+	CreatedAt      *time.Time `json:"created_at"`
+	RedeemedAt     *time.Time `json:"redeemed_at"`
+}
+
+type RewardListV2DTO struct {
+	Rewards []RewardV2DTO `json:"rewards"`
+}
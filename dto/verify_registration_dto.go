@@ -0,0 +1,6 @@
+package dto
+
+type VerifyRegistrationDTO struct {
+	Phone string `json:"phoneNumber" binding:"required,phone"`
+	Code  string `json:"code" binding:"required,len=6,numeric"`
+}
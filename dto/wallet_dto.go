@@ -0,0 +1,31 @@
+package dto
+
+// GoogleWalletPassDTO saves the customer's pass to Google Wallet. Open
+// save_url, or pass jwt to the Add to Google Wallet button.
+type GoogleWalletPassDTO struct {
+	JWT     string `json:"jwt"`
+	SaveURL string `json:"save_url"`
+}
+
+// The pass web service types below follow Apple's Wallet protocol, which
+// names its fields in camelCase.
+
+type RegisterPassDeviceDTO struct {
+	PushToken string `json:"pushToken" binding:"required,notblank,max=200"`
+}
+
+type UpdatedPassesQueryDTO struct {
+	PassesUpdatedSince string `form:"passesUpdatedSince" binding:"omitempty,max=32"`
+}
+
+// UpdatedPassesDTO lists the device's passes that changed, and the tag to
+// send as passesUpdatedSince next time
+type UpdatedPassesDTO struct {
+	SerialNumbers []string `json:"serialNumbers"`
+	LastUpdated   string   `json:"lastUpdated"`
+}
+
+// PassLogDTO carries messages a device logs about problems with the web service
+type PassLogDTO struct {
+	Logs []string `json:"logs" binding:"max=100"`
+}
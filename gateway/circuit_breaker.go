@@ -0,0 +1,84 @@
+package gateway
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gimhanr9/go-loyalty-api/apperrors"
+)
+
+// ErrCircuitOpen is returned without calling Square while an endpoint is failing
+var ErrCircuitOpen = apperrors.New(apperrors.CodeUpstreamUnavailable, "Square is temporarily unavailable, please try again shortly")
+
+const (
+	circuitClosed = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuitBreaker opens after threshold consecutive failures, then lets a single
+// trial call through once cooldown has passed. A successful trial closes it.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    int
+	failures int
+	openedAt time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow reports whether a call may go ahead
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.state = circuitHalfOpen
+		return nil
+	case circuitHalfOpen:
+		// The trial call is still in flight
+		return ErrCircuitOpen
+	default:
+		return nil
+	}
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = circuitClosed
+	b.failures = 0
+}
+
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.threshold {
+		b.state = circuitOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// release ends a half-open trial that neither succeeded nor failed, such as a
+// call cancelled by the client, so the next caller can try instead
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == circuitHalfOpen {
+		b.state = circuitOpen
+		b.openedAt = time.Now().Add(-b.cooldown)
+	}
+}
@@ -0,0 +1,82 @@
+package gateway
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	tests := []struct {
+		name      string
+		cooldown  time.Duration
+		calls     func(b *circuitBreaker)
+		wantOpen  bool
+		wantState int
+	}{
+		{
+			name:      "stays closed below the threshold",
+			cooldown:  time.Hour,
+			calls:     func(b *circuitBreaker) { b.failure(); b.failure() },
+			wantState: circuitClosed,
+		},
+		{
+			name:      "opens at the threshold",
+			cooldown:  time.Hour,
+			calls:     func(b *circuitBreaker) { b.failure(); b.failure(); b.failure() },
+			wantOpen:  true,
+			wantState: circuitOpen,
+		},
+		{
+			name:      "success resets the count",
+			cooldown:  time.Hour,
+			calls:     func(b *circuitBreaker) { b.failure(); b.failure(); b.success(); b.failure(); b.failure() },
+			wantState: circuitClosed,
+		},
+		{
+			name:      "lets one trial through after the cooldown",
+			calls:     func(b *circuitBreaker) { b.failure(); b.failure(); b.failure(); b.allow() },
+			wantOpen:  true,
+			wantState: circuitHalfOpen,
+		},
+		{
+			name:      "failed trial opens again",
+			cooldown:  time.Hour,
+			calls:     func(b *circuitBreaker) { b.state = circuitHalfOpen; b.failure() },
+			wantOpen:  true,
+			wantState: circuitOpen,
+		},
+		{
+			name:      "successful trial closes",
+			calls:     func(b *circuitBreaker) { b.failure(); b.failure(); b.failure(); b.allow(); b.success() },
+			wantState: circuitClosed,
+		},
+		{
+			name:      "released trial lets the next caller try",
+			cooldown:  time.Hour,
+			calls:     func(b *circuitBreaker) { b.state = circuitHalfOpen; b.release() },
+			wantState: circuitOpen,
+		},
+		{
+			name:      "release outside a trial changes nothing",
+			cooldown:  time.Hour,
+			calls:     func(b *circuitBreaker) { b.failure(); b.release() },
+			wantState: circuitClosed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newCircuitBreaker(3, tt.cooldown)
+			tt.calls(b)
+
+			if b.state != tt.wantState {
+				t.Errorf("state = %d, want %d", b.state, tt.wantState)
+			}
+			err := b.allow()
+			if open := errors.Is(err, ErrCircuitOpen); open != tt.wantOpen {
+				t.Errorf("allow() = %v, want open %v", err, tt.wantOpen)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gimhanr9/go-loyalty-api/apperrors"
+	square "github.com/square/square-go-sdk"
+	"github.com/square/square-go-sdk/core"
+)
+
+// translateError maps a failed Square call onto a domain error using the
+// category and code of Square's first error. The original error is kept as the
+// cause for logs, clients only see the domain message.
+func translateError(op string, err error) error {
+	var appErr *apperrors.Error
+	if err == nil || errors.As(err, &appErr) || errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	if IsTransient(err) {
+		return apperrors.Wrap(apperrors.CodeUpstreamUnavailable, "Square is temporarily unavailable, please try again shortly", err)
+	}
+
+	var apiErr *core.APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+
+	squareErr := firstSquareError(apiErr)
+	code, detail := "", ""
+	if squareErr != nil {
+		code = string(squareErr.Code)
+		if squareErr.Detail != nil {
+			detail = *squareErr.Detail
+		}
+	}
+	lowerDetail := strings.ToLower(detail)
+
+	switch {
+	case squareErr != nil && squareErr.Category == square.ErrorCategoryPaymentMethodError,
+		strings.HasPrefix(code, "CARD_DECLINED"), code == string(square.ErrorCodeInsufficientFunds):
+		return apperrors.Wrap(apperrors.CodePaymentDeclined, "The payment was declined", err)
+	case code == "INSUFFICIENT_POINTS", strings.Contains(lowerDetail, "enough points"), strings.Contains(lowerDetail, "insufficient points"):
+		return apperrors.Wrap(apperrors.CodeInsufficientPoints, "Not enough points for this reward", err)
+	case code == string(square.ErrorCodeUnsupportedLoyaltyRewardTier),
+		op == OpCreateReward && apiErr.StatusCode == http.StatusNotFound:
+		return apperrors.Wrap(apperrors.CodeInvalidRewardTier, "The reward tier does not exist", err)
+	case apiErr.StatusCode == http.StatusNotFound:
+		return apperrors.Wrap(apperrors.CodeNotFound, notFoundMessage(op), err)
+	case apiErr.StatusCode == http.StatusConflict, code == string(square.ErrorCodeIdempotencyKeyReused):
+		return apperrors.Wrap(apperrors.CodeConflict, "The request conflicts with an earlier one", err)
+	case apiErr.StatusCode == http.StatusBadRequest || apiErr.StatusCode == http.StatusUnprocessableEntity:
+		message := "Square rejected the request"
+		if detail != "" {
+			message += ": " + detail
+		}
+		return apperrors.Wrap(apperrors.CodeInvalidRequest, message, err)
+	default:
+		return err
+	}
+}
+
+func firstSquareError(apiErr *core.APIError) *square.Error {
+	cause := apiErr.Unwrap()
+	if cause == nil {
+		return nil
+	}
+
+	var body struct {
+		Errors []*square.Error `json:"errors"`
+	}
+	if json.Unmarshal([]byte(cause.Error()), &body) != nil || len(body.Errors) == 0 {
+		return nil
+	}
+	return body.Errors[0]
+}
+
+func notFoundMessage(op string) string {
+	switch op {
+	case OpGetAccount:
+		return "Loyalty account not found"
+	case OpGetOrder:
+		return "Order not found"
+	case OpGetReward, OpDeleteReward, OpRedeemReward:
+		return "Reward not found"
+	case OpUpdateCustomer, OpDeleteCustomer:
+		return "Customer not found"
+	default:
+		return "Not found"
+	}
+}
@@ -0,0 +1,291 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gimhanr9/go-loyalty-api/config"
+	"github.com/gimhanr9/go-loyalty-api/utils"
+	square "github.com/square/square-go-sdk"
+	loyalty "github.com/square/square-go-sdk/loyalty"
+)
+
+// idempotentOps are safe to repeat after a failure where Square may have acted:
+// reads and calls carrying an idempotency key. Deletes and the customer update
+// are not, a repeat after a lost response fails with not found or can undo a
+// later change, so their callers retry at a higher level. Throttled calls were
+// never processed, so every operation is retried on 429.
+var idempotentOps = map[string]bool{
+	OpGetProgram:     true,
+	OpGetAccount:     true,
+	OpSearchAccounts: true,
+	OpCreateAccount:  true,
+	OpAccumulate:     true,
+	OpAdjust:         true,
+	OpCreateReward:   true,
+	OpSearchEvents:   true,
+	OpCreateOrder:    true,
+	OpGetOrder:       true,
+	OpBatchGetOrders: true,
+	OpGetReward:      true,
+	OpSearchRewards:  true,
+	OpRedeemReward:   true,
+	OpListLocations:  true,
+	OpCreatePayment:  true,
+}
+
+// IsTransient reports whether err is a temporary Square failure, as opposed to
+// Square rejecting the request
+func IsTransient(err error) bool {
+	if errors.Is(err, ErrCircuitOpen) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var status *statusError
+	if errors.As(err, &status) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// isThrottled reports whether Square answered 429 Too Many Requests
+func isThrottled(err error) bool {
+	var status *statusError
+	return errors.As(err, &status) && status.StatusCode == http.StatusTooManyRequests
+}
+
+// resilientGateway retries transient failures with jittered backoff and keeps a
+// circuit breaker per Square endpoint
+type resilientGateway struct {
+	inner       SquareGateway
+	breakers    map[string]*circuitBreaker
+	maxAttempts int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+}
+
+func NewResilientGateway(inner SquareGateway) SquareGateway {
+	threshold := config.GetEnvInt("SQUARE_BREAKER_THRESHOLD", 5)
+	cooldown := config.GetEnvDuration("SQUARE_BREAKER_COOLDOWN", 30*time.Second)
+
+	breakers := make(map[string]*circuitBreaker)
+	for _, op := range []string{
+		OpGetProgram, OpGetAccount, OpSearchAccounts, OpCreateAccount, OpAccumulate, OpAdjust, OpCreateReward,
+		OpSearchEvents, OpCreateOrder, OpGetOrder, OpBatchGetOrders, OpGetReward, OpSearchRewards, OpDeleteReward,
+		OpRedeemReward, OpListLocations, OpCreatePayment, OpUpdateCustomer, OpDeleteCustomer,
+	} {
+		breakers[op] = newCircuitBreaker(threshold, cooldown)
+	}
+
+	return &resilientGateway{
+		inner:       inner,
+		breakers:    breakers,
+		maxAttempts: config.GetEnvInt("SQUARE_RETRY_ATTEMPTS", 3),
+		baseBackoff: config.GetEnvDuration("SQUARE_RETRY_BASE_BACKOFF", 200*time.Millisecond),
+		maxBackoff:  config.GetEnvDuration("SQUARE_RETRY_MAX_BACKOFF", 5*time.Second),
+	}
+}
+
+// call runs fn through the endpoint's breaker, retrying while the failure is
+// transient, and returns the final failure as a domain error
+func call[T any](g *resilientGateway, ctx context.Context, op string, fn func(context.Context) (T, error)) (T, error) {
+	result, err := attempt(g, ctx, op, fn)
+	return result, translateError(op, err)
+}
+
+func attempt[T any](g *resilientGateway, ctx context.Context, op string, fn func(context.Context) (T, error)) (T, error) {
+	breaker := g.breakers[op]
+
+	for attempts := 1; ; attempts++ {
+		if err := breaker.allow(); err != nil {
+			var zero T
+			return zero, err
+		}
+
+		result, err := fn(ctx)
+		switch {
+		case err == nil:
+			breaker.success()
+			return result, nil
+		case ctx.Err() != nil:
+			// The caller gave up, that says nothing about Square's health
+			breaker.release()
+			return result, err
+		case !IsTransient(err):
+			// Square answered, the endpoint is up even if it rejected the request
+			breaker.success()
+			return result, err
+		}
+
+		if isThrottled(err) {
+			// Square is up and rate limiting us, backing off is enough
+			breaker.release()
+		} else {
+			breaker.failure()
+		}
+
+		wait, ok := g.retryDelay(ctx, op, attempts, err)
+		if !ok {
+			return result, err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return result, err
+		case <-timer.C:
+		}
+	}
+}
+
+// retryDelay decides whether another attempt is worthwhile and how long to wait
+// for it. A Retry-After longer than the maximum backoff or past the caller's
+// deadline gives up instead of holding the request open.
+func (g *resilientGateway) retryDelay(ctx context.Context, op string, attempt int, err error) (time.Duration, bool) {
+	if attempt >= g.maxAttempts {
+		return 0, false
+	}
+
+	wait := utils.JitteredBackoff(g.baseBackoff, g.maxBackoff, attempt)
+
+	throttled := isThrottled(err)
+	var status *statusError
+	if throttled && errors.As(err, &status) && status.RetryAfter > 0 {
+		wait = status.RetryAfter
+	}
+	if !throttled && !idempotentOps[op] {
+		return 0, false
+	}
+
+	if wait > g.maxBackoff {
+		return 0, false
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+		return 0, false
+	}
+	return wait, true
+}
+
+// do adapts calls that only return an error
+func do(g *resilientGateway, ctx context.Context, op string, fn func(context.Context) error) error {
+	_, err := call(g, ctx, op, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	})
+	return err
+}
+
+func (g *resilientGateway) GetProgram(ctx context.Context) (*square.LoyaltyProgram, error) {
+	return call(g, ctx, OpGetProgram, g.inner.GetProgram)
+}
+
+func (g *resilientGateway) GetLoyaltyAccount(ctx context.Context, accountID string) (*square.LoyaltyAccount, error) {
+	return call(g, ctx, OpGetAccount, func(ctx context.Context) (*square.LoyaltyAccount, error) {
+		return g.inner.GetLoyaltyAccount(ctx, accountID)
+	})
+}
+
+func (g *resilientGateway) SearchLoyaltyAccountsByPhone(ctx context.Context, phone string) ([]*square.LoyaltyAccount, error) {
+	return call(g, ctx, OpSearchAccounts, func(ctx context.Context) ([]*square.LoyaltyAccount, error) {
+		return g.inner.SearchLoyaltyAccountsByPhone(ctx, phone)
+	})
+}
+
+func (g *resilientGateway) CreateLoyaltyAccount(ctx context.Context, phone, idempotencyKey string) (*square.LoyaltyAccount, error) {
+	return call(g, ctx, OpCreateAccount, func(ctx context.Context) (*square.LoyaltyAccount, error) {
+		return g.inner.CreateLoyaltyAccount(ctx, phone, idempotencyKey)
+	})
+}
+
+func (g *resilientGateway) AccumulatePoints(ctx context.Context, req *loyalty.AccumulateLoyaltyPointsRequest) ([]*square.LoyaltyEvent, error) {
+	return call(g, ctx, OpAccumulate, func(ctx context.Context) ([]*square.LoyaltyEvent, error) {
+		return g.inner.AccumulatePoints(ctx, req)
+	})
+}
+
+func (g *resilientGateway) AdjustPoints(ctx context.Context, req *loyalty.AdjustLoyaltyPointsRequest) error {
+	return do(g, ctx, OpAdjust, func(ctx context.Context) error {
+		return g.inner.AdjustPoints(ctx, req)
+	})
+}
+
+func (g *resilientGateway) CreateReward(ctx context.Context, req *loyalty.CreateLoyaltyRewardRequest) (*square.LoyaltyReward, error) {
+	return call(g, ctx, OpCreateReward, func(ctx context.Context) (*square.LoyaltyReward, error) {
+		return g.inner.CreateReward(ctx, req)
+	})
+}
+
+func (g *resilientGateway) SearchEvents(ctx context.Context, req *square.SearchLoyaltyEventsRequest) (*square.SearchLoyaltyEventsResponse, error) {
+	return call(g, ctx, OpSearchEvents, func(ctx context.Context) (*square.SearchLoyaltyEventsResponse, error) {
+		return g.inner.SearchEvents(ctx, req)
+	})
+}
+
+func (g *resilientGateway) CreateOrder(ctx context.Context, req *square.CreateOrderRequest) (*square.Order, error) {
+	return call(g, ctx, OpCreateOrder, func(ctx context.Context) (*square.Order, error) {
+		return g.inner.CreateOrder(ctx, req)
+	})
+}
+
+func (g *resilientGateway) GetOrder(ctx context.Context, orderID string) (*square.Order, error) {
+	return call(g, ctx, OpGetOrder, func(ctx context.Context) (*square.Order, error) {
+		return g.inner.GetOrder(ctx, orderID)
+	})
+}
+
+func (g *resilientGateway) BatchGetOrders(ctx context.Context, orderIDs []string) ([]*square.Order, error) {
+	return call(g, ctx, OpBatchGetOrders, func(ctx context.Context) ([]*square.Order, error) {
+		return g.inner.BatchGetOrders(ctx, orderIDs)
+	})
+}
+
+func (g *resilientGateway) GetReward(ctx context.Context, rewardID string) (*square.LoyaltyReward, error) {
+	return call(g, ctx, OpGetReward, func(ctx context.Context) (*square.LoyaltyReward, error) {
+		return g.inner.GetReward(ctx, rewardID)
+	})
+}
+
+func (g *resilientGateway) SearchRewards(ctx context.Context, req *loyalty.SearchLoyaltyRewardsRequest) (*square.SearchLoyaltyRewardsResponse, error) {
+	return call(g, ctx, OpSearchRewards, func(ctx context.Context) (*square.SearchLoyaltyRewardsResponse, error) {
+		return g.inner.SearchRewards(ctx, req)
+	})
+}
+
+func (g *resilientGateway) DeleteReward(ctx context.Context, rewardID string) error {
+	return do(g, ctx, OpDeleteReward, func(ctx context.Context) error {
+		return g.inner.DeleteReward(ctx, rewardID)
+	})
+}
+
+func (g *resilientGateway) RedeemReward(ctx context.Context, req *loyalty.RedeemLoyaltyRewardRequest) (*square.LoyaltyEvent, error) {
+	return call(g, ctx, OpRedeemReward, func(ctx context.Context) (*square.LoyaltyEvent, error) {
+		return g.inner.RedeemReward(ctx, req)
+	})
+}
+
+func (g *resilientGateway) LocationNames(ctx context.Context) (map[string]string, error) {
+	return call(g, ctx, OpListLocations, g.inner.LocationNames)
+}
+
+func (g *resilientGateway) CreatePayment(ctx context.Context, req *square.CreatePaymentRequest) (*square.Payment, error) {
+	return call(g, ctx, OpCreatePayment, func(ctx context.Context) (*square.Payment, error) {
+		return g.inner.CreatePayment(ctx, req)
+	})
+}
+
+func (g *resilientGateway) UpdateCustomerPhone(ctx context.Context, customerID, phone string) error {
+	return do(g, ctx, OpUpdateCustomer, func(ctx context.Context) error {
+		return g.inner.UpdateCustomerPhone(ctx, customerID, phone)
+	})
+}
+
+func (g *resilientGateway) DeleteCustomer(ctx context.Context, customerID string) error {
+	return do(g, ctx, OpDeleteCustomer, func(ctx context.Context) error {
+		return g.inner.DeleteCustomer(ctx, customerID)
+	})
+}
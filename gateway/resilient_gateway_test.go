@@ -0,0 +1,94 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAttemptBreaker(t *testing.T) {
+	throttled := &statusError{StatusCode: http.StatusTooManyRequests}
+	unavailable := &statusError{StatusCode: http.StatusServiceUnavailable}
+
+	tests := []struct {
+		name      string
+		op        string
+		errs      []error // returned by successive calls, nil once exhausted
+		wantCalls int
+		wantErr   bool
+		wantState int
+	}{
+		{name: "throttled then served", op: OpAdjust, errs: []error{throttled, throttled}, wantCalls: 3, wantState: circuitClosed},
+		{name: "throttled on every attempt keeps the circuit closed", op: OpAdjust, errs: []error{throttled, throttled, throttled}, wantCalls: 3, wantErr: true, wantState: circuitClosed},
+		{name: "throttled calls are retried even when not idempotent", op: "not_idempotent", errs: []error{throttled}, wantCalls: 2, wantState: circuitClosed},
+		{name: "server errors open the circuit", op: OpAdjust, errs: []error{unavailable, unavailable, unavailable}, wantCalls: 3, wantErr: true, wantState: circuitOpen},
+		{name: "keyed calls are retried", op: OpCreatePayment, errs: []error{unavailable}, wantCalls: 2, wantState: circuitClosed},
+		{name: "deleting a reward is not retried", op: OpDeleteReward, errs: []error{unavailable}, wantCalls: 1, wantErr: true, wantState: circuitClosed},
+		{name: "deleting a customer is retried when throttled", op: OpDeleteCustomer, errs: []error{throttled}, wantCalls: 2, wantState: circuitClosed},
+		{name: "server errors are not retried when not idempotent", op: OpUpdateCustomer, errs: []error{unavailable}, wantCalls: 1, wantErr: true, wantState: circuitClosed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breaker := newCircuitBreaker(3, time.Hour)
+			g := &resilientGateway{
+				breakers:    map[string]*circuitBreaker{tt.op: breaker},
+				maxAttempts: 3,
+				baseBackoff: time.Millisecond,
+				maxBackoff:  time.Millisecond,
+			}
+
+			calls := 0
+			_, err := attempt(g, context.Background(), tt.op, func(context.Context) (struct{}, error) {
+				calls++
+				if calls <= len(tt.errs) {
+					return struct{}{}, tt.errs[calls-1]
+				}
+				return struct{}{}, nil
+			})
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if breaker.state != tt.wantState {
+				t.Errorf("breaker state = %d, want %d", breaker.state, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	g := &resilientGateway{maxAttempts: 3, baseBackoff: time.Millisecond, maxBackoff: time.Second}
+
+	tests := []struct {
+		name     string
+		op       string
+		attempt  int
+		err      error
+		wantWait time.Duration // checked when non-zero
+		wantOK   bool
+	}{
+		{name: "honors Retry-After", op: OpAdjust, attempt: 1, err: &statusError{StatusCode: http.StatusTooManyRequests, RetryAfter: 500 * time.Millisecond}, wantWait: 500 * time.Millisecond, wantOK: true},
+		{name: "Retry-After past the maximum backoff gives up", op: OpAdjust, attempt: 1, err: &statusError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Minute}},
+		{name: "last attempt gives up", op: OpAdjust, attempt: 3, err: &statusError{StatusCode: http.StatusServiceUnavailable}},
+		{name: "idempotent server error", op: OpGetAccount, attempt: 1, err: &statusError{StatusCode: http.StatusServiceUnavailable}, wantOK: true},
+		{name: "network error on a delete", op: OpDeleteCustomer, attempt: 1, err: errors.New("connection reset")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wait, ok := g.retryDelay(context.Background(), tt.op, tt.attempt, tt.err)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if tt.wantWait != 0 && wait != tt.wantWait {
+				t.Errorf("wait = %s, want %s", wait, tt.wantWait)
+			}
+		})
+	}
+}
@@ -0,0 +1,381 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gimhanr9/go-loyalty-api/apperrors"
+	"github.com/gimhanr9/go-loyalty-api/config"
+	square "github.com/square/square-go-sdk"
+	client "github.com/square/square-go-sdk/client"
+	loyalty "github.com/square/square-go-sdk/loyalty"
+	option "github.com/square/square-go-sdk/option"
+)
+
+// Square operation names, used for per-operation timeouts (SQUARE_TIMEOUT_<OP>)
+const (
+	OpGetProgram     = "get_program"
+	OpGetAccount     = "get_account"
+	OpSearchAccounts = "search_accounts"
+	OpCreateAccount  = "create_account"
+	OpAccumulate     = "accumulate_points"
+	OpAdjust         = "adjust_points"
+	OpCreateReward   = "create_reward"
+	OpSearchEvents   = "search_events"
+	OpCreateOrder    = "create_order"
+	OpGetOrder       = "get_order"
+	OpBatchGetOrders = "batch_get_orders"
+	OpGetReward      = "get_reward"
+	OpSearchRewards  = "search_rewards"
+	OpDeleteReward   = "delete_reward"
+	OpRedeemReward   = "redeem_reward"
+	OpListLocations  = "list_locations"
+	OpCreatePayment  = "create_payment"
+	OpUpdateCustomer = "update_customer"
+	OpDeleteCustomer = "delete_customer"
+)
+
+// SquareGateway is the single place the API talks to Square. Every call takes
+// the caller's context and is bounded by a per-operation timeout.
+type SquareGateway interface {
+	GetProgram(ctx context.Context) (*square.LoyaltyProgram, error)
+	GetLoyaltyAccount(ctx context.Context, accountID string) (*square.LoyaltyAccount, error)
+	SearchLoyaltyAccountsByPhone(ctx context.Context, phone string) ([]*square.LoyaltyAccount, error)
+	CreateLoyaltyAccount(ctx context.Context, phone, idempotencyKey string) (*square.LoyaltyAccount, error)
+	AccumulatePoints(ctx context.Context, req *loyalty.AccumulateLoyaltyPointsRequest) ([]*square.LoyaltyEvent, error)
+	AdjustPoints(ctx context.Context, req *loyalty.AdjustLoyaltyPointsRequest) error
+	CreateReward(ctx context.Context, req *loyalty.CreateLoyaltyRewardRequest) (*square.LoyaltyReward, error)
+	SearchEvents(ctx context.Context, req *square.SearchLoyaltyEventsRequest) (*square.SearchLoyaltyEventsResponse, error)
+	CreateOrder(ctx context.Context, req *square.CreateOrderRequest) (*square.Order, error)
+	GetOrder(ctx context.Context, orderID string) (*square.Order, error)
+	BatchGetOrders(ctx context.Context, orderIDs []string) ([]*square.Order, error)
+	GetReward(ctx context.Context, rewardID string) (*square.LoyaltyReward, error)
+	SearchRewards(ctx context.Context, req *loyalty.SearchLoyaltyRewardsRequest) (*square.SearchLoyaltyRewardsResponse, error)
+	DeleteReward(ctx context.Context, rewardID string) error
+	RedeemReward(ctx context.Context, req *loyalty.RedeemLoyaltyRewardRequest) (*square.LoyaltyEvent, error)
+	LocationNames(ctx context.Context) (map[string]string, error)
+	CreatePayment(ctx context.Context, req *square.CreatePaymentRequest) (*square.Payment, error)
+	UpdateCustomerPhone(ctx context.Context, customerID, phone string) error
+	DeleteCustomer(ctx context.Context, customerID string) error
+}
+
+type squareGateway struct {
+	client         *client.Client
+	defaultTimeout time.Duration
+
+	programMu sync.Mutex
+	program   *square.LoyaltyProgram
+
+	locationsMu   sync.Mutex
+	locationNames map[string]string
+}
+
+func NewSquareGateway() SquareGateway {
+	return &squareGateway{
+		client: client.NewClient(
+			option.WithBaseURL(square.Environments.Sandbox),
+			option.WithToken(os.Getenv("SQUARE_ACCESS_TOKEN")),
+			// Retries are handled by the resilient gateway, which knows which calls are safe to repeat
+			option.WithMaxAttempts(1),
+			option.WithHTTPClient(&statusClient{client: &http.Client{}}),
+		),
+		defaultTimeout: config.GetEnvDuration("SQUARE_TIMEOUT", 10*time.Second),
+	}
+}
+
+// withTimeout bounds ctx by SQUARE_TIMEOUT_<OP>, falling back to SQUARE_TIMEOUT
+func (g *squareGateway) withTimeout(ctx context.Context, op string) (context.Context, context.CancelFunc) {
+	timeout := config.GetEnvDuration("SQUARE_TIMEOUT_"+strings.ToUpper(op), g.defaultTimeout)
+	return context.WithTimeout(ctx, timeout)
+}
+
+// GetProgram returns the default loyalty program, cached after the first success
+func (g *squareGateway) GetProgram(ctx context.Context) (*square.LoyaltyProgram, error) {
+	g.programMu.Lock()
+	defer g.programMu.Unlock()
+
+	if g.program != nil {
+		return g.program, nil
+	}
+
+	ctx, cancel := g.withTimeout(ctx, OpGetProgram)
+	defer cancel()
+
+	res, err := g.client.Loyalty.Programs.Get(ctx, &loyalty.GetProgramsRequest{
+		ProgramID: "main", //Default program ID
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve program: %w", err)
+	}
+	if res.Program == nil || res.Program.ID == nil {
+		return nil, fmt.Errorf("no active loyalty program found")
+	}
+
+	g.program = res.Program
+	return g.program, nil
+}
+
+func (g *squareGateway) GetLoyaltyAccount(ctx context.Context, accountID string) (*square.LoyaltyAccount, error) {
+	ctx, cancel := g.withTimeout(ctx, OpGetAccount)
+	defer cancel()
+
+	res, err := g.client.Loyalty.Accounts.Get(ctx, &loyalty.GetAccountsRequest{AccountID: accountID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get loyalty account %s: %w", accountID, err)
+	}
+	if res == nil || res.LoyaltyAccount == nil {
+		return nil, fmt.Errorf("loyalty account %s not found", accountID)
+	}
+	return res.LoyaltyAccount, nil
+}
+
+func (g *squareGateway) SearchLoyaltyAccountsByPhone(ctx context.Context, phone string) ([]*square.LoyaltyAccount, error) {
+	ctx, cancel := g.withTimeout(ctx, OpSearchAccounts)
+	defer cancel()
+
+	res, err := g.client.Loyalty.Accounts.Search(ctx, &loyalty.SearchLoyaltyAccountsRequest{
+		Query: &square.SearchLoyaltyAccountsRequestLoyaltyAccountQuery{
+			Mappings: []*square.LoyaltyAccountMapping{
+				{PhoneNumber: square.String(phone)},
+			},
+		},
+		Limit: square.Int(1),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search loyalty accounts: %w", err)
+	}
+	return res.LoyaltyAccounts, nil
+}
+
+func (g *squareGateway) CreateLoyaltyAccount(ctx context.Context, phone, idempotencyKey string) (*square.LoyaltyAccount, error) {
+	program, err := g.GetProgram(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := g.withTimeout(ctx, OpCreateAccount)
+	defer cancel()
+
+	res, err := g.client.Loyalty.Accounts.Create(ctx, &loyalty.CreateLoyaltyAccountRequest{
+		LoyaltyAccount: &square.LoyaltyAccount{
+			Mapping: &square.LoyaltyAccountMapping{
+				PhoneNumber: square.String(phone),
+			},
+			ProgramID: *program.ID,
+		},
+		IdempotencyKey: idempotencyKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create loyalty account: %w", err)
+	}
+	if res.LoyaltyAccount == nil {
+		return nil, fmt.Errorf("failed to create loyalty account: empty response")
+	}
+	return res.LoyaltyAccount, nil
+}
+
+func (g *squareGateway) AccumulatePoints(ctx context.Context, req *loyalty.AccumulateLoyaltyPointsRequest) ([]*square.LoyaltyEvent, error) {
+	ctx, cancel := g.withTimeout(ctx, OpAccumulate)
+	defer cancel()
+
+	res, err := g.client.Loyalty.Accounts.AccumulatePoints(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to accumulate points: %w", err)
+	}
+	return res.Events, nil
+}
+
+func (g *squareGateway) AdjustPoints(ctx context.Context, req *loyalty.AdjustLoyaltyPointsRequest) error {
+	ctx, cancel := g.withTimeout(ctx, OpAdjust)
+	defer cancel()
+
+	if _, err := g.client.Loyalty.Accounts.Adjust(ctx, req); err != nil {
+		return fmt.Errorf("failed to adjust points for account %s: %w", req.AccountID, err)
+	}
+	return nil
+}
+
+func (g *squareGateway) CreateReward(ctx context.Context, req *loyalty.CreateLoyaltyRewardRequest) (*square.LoyaltyReward, error) {
+	ctx, cancel := g.withTimeout(ctx, OpCreateReward)
+	defer cancel()
+
+	res, err := g.client.Loyalty.Rewards.Create(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reward: %w", err)
+	}
+	return res.Reward, nil
+}
+
+func (g *squareGateway) SearchEvents(ctx context.Context, req *square.SearchLoyaltyEventsRequest) (*square.SearchLoyaltyEventsResponse, error) {
+	ctx, cancel := g.withTimeout(ctx, OpSearchEvents)
+	defer cancel()
+
+	res, err := g.client.Loyalty.SearchEvents(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search loyalty events: %w", err)
+	}
+	return res, nil
+}
+
+func (g *squareGateway) CreateOrder(ctx context.Context, req *square.CreateOrderRequest) (*square.Order, error) {
+	ctx, cancel := g.withTimeout(ctx, OpCreateOrder)
+	defer cancel()
+
+	res, err := g.client.Orders.Create(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create order: %w", err)
+	}
+	if res.Order == nil || res.Order.ID == nil {
+		return nil, fmt.Errorf("failed to create order: empty response")
+	}
+	return res.Order, nil
+}
+
+func (g *squareGateway) GetOrder(ctx context.Context, orderID string) (*square.Order, error) {
+	ctx, cancel := g.withTimeout(ctx, OpGetOrder)
+	defer cancel()
+
+	res, err := g.client.Orders.Get(ctx, &square.GetOrdersRequest{OrderID: orderID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order details: %w", err)
+	}
+	if res.Order == nil {
+		return nil, fmt.Errorf("order %s not found", orderID)
+	}
+	return res.Order, nil
+}
+
+// BatchGetOrders fetches up to 100 orders in one call, unknown IDs are left out
+func (g *squareGateway) BatchGetOrders(ctx context.Context, orderIDs []string) ([]*square.Order, error) {
+	ctx, cancel := g.withTimeout(ctx, OpBatchGetOrders)
+	defer cancel()
+
+	res, err := g.client.Orders.BatchGet(ctx, &square.BatchGetOrdersRequest{OrderIDs: orderIDs})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get orders: %w", err)
+	}
+	return res.Orders, nil
+}
+
+func (g *squareGateway) GetReward(ctx context.Context, rewardID string) (*square.LoyaltyReward, error) {
+	ctx, cancel := g.withTimeout(ctx, OpGetReward)
+	defer cancel()
+
+	res, err := g.client.Loyalty.Rewards.Get(ctx, &loyalty.GetRewardsRequest{RewardID: rewardID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reward %s: %w", rewardID, err)
+	}
+	if res.Reward == nil {
+		return nil, fmt.Errorf("reward %s not found", rewardID)
+	}
+	return res.Reward, nil
+}
+
+func (g *squareGateway) SearchRewards(ctx context.Context, req *loyalty.SearchLoyaltyRewardsRequest) (*square.SearchLoyaltyRewardsResponse, error) {
+	ctx, cancel := g.withTimeout(ctx, OpSearchRewards)
+	defer cancel()
+
+	res, err := g.client.Loyalty.Rewards.Search(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search rewards: %w", err)
+	}
+	return res, nil
+}
+
+// DeleteReward deletes an issued reward, returning its points to the account
+func (g *squareGateway) DeleteReward(ctx context.Context, rewardID string) error {
+	ctx, cancel := g.withTimeout(ctx, OpDeleteReward)
+	defer cancel()
+
+	if _, err := g.client.Loyalty.Rewards.Delete(ctx, &loyalty.DeleteRewardsRequest{RewardID: rewardID}); err != nil {
+		return fmt.Errorf("failed to delete reward %s: %w", rewardID, err)
+	}
+	return nil
+}
+
+// RedeemReward marks an issued reward as used outside of Square orders
+func (g *squareGateway) RedeemReward(ctx context.Context, req *loyalty.RedeemLoyaltyRewardRequest) (*square.LoyaltyEvent, error) {
+	ctx, cancel := g.withTimeout(ctx, OpRedeemReward)
+	defer cancel()
+
+	res, err := g.client.Loyalty.Rewards.Redeem(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to redeem reward %s: %w", req.RewardID, err)
+	}
+	return res.Event, nil
+}
+
+// LocationNames maps the seller's location IDs to their names, cached after the first success
+func (g *squareGateway) LocationNames(ctx context.Context) (map[string]string, error) {
+	g.locationsMu.Lock()
+	defer g.locationsMu.Unlock()
+
+	if g.locationNames != nil {
+		return g.locationNames, nil
+	}
+
+	ctx, cancel := g.withTimeout(ctx, OpListLocations)
+	defer cancel()
+
+	res, err := g.client.Locations.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list locations: %w", err)
+	}
+
+	names := make(map[string]string, len(res.Locations))
+	for _, location := range res.Locations {
+		if location != nil && location.ID != nil && location.Name != nil {
+			names[*location.ID] = *location.Name
+		}
+	}
+
+	g.locationNames = names
+	return g.locationNames, nil
+}
+
+func (g *squareGateway) CreatePayment(ctx context.Context, req *square.CreatePaymentRequest) (*square.Payment, error) {
+	ctx, cancel := g.withTimeout(ctx, OpCreatePayment)
+	defer cancel()
+
+	res, err := g.client.Payments.Create(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create payment: %w", err)
+	}
+	if res.Payment == nil || res.Payment.Status == nil || *res.Payment.Status != "COMPLETED" {
+		status := "unknown"
+		if res.Payment != nil && res.Payment.Status != nil {
+			status = *res.Payment.Status
+		}
+		return nil, apperrors.New(apperrors.CodePaymentDeclined, fmt.Sprintf("payment not completed, status: %s", status))
+	}
+	return res.Payment, nil
+}
+
+func (g *squareGateway) UpdateCustomerPhone(ctx context.Context, customerID, phone string) error {
+	ctx, cancel := g.withTimeout(ctx, OpUpdateCustomer)
+	defer cancel()
+
+	_, err := g.client.Customers.Update(ctx, &square.UpdateCustomerRequest{
+		CustomerID:  customerID,
+		PhoneNumber: square.String(phone),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update customer phone number: %w", err)
+	}
+	return nil
+}
+
+func (g *squareGateway) DeleteCustomer(ctx context.Context, customerID string) error {
+	ctx, cancel := g.withTimeout(ctx, OpDeleteCustomer)
+	defer cancel()
+
+	if _, err := g.client.Customers.Delete(ctx, &square.DeleteCustomersRequest{CustomerID: customerID}); err != nil {
+		return fmt.Errorf("failed to delete customer: %w", err)
+	}
+	return nil
+}
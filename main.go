@@ -1,16 +1,27 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 
+	"github.com/gimhanr9/go-loyalty-api/app"
+	"github.com/gimhanr9/go-loyalty-api/config"
 	"github.com/gimhanr9/go-loyalty-api/database"
+	"github.com/gimhanr9/go-loyalty-api/middleware"
+	"github.com/gimhanr9/go-loyalty-api/migrations"
 	"github.com/gimhanr9/go-loyalty-api/routes"
+	"github.com/gimhanr9/go-loyalty-api/validation"
+	"gorm.io/gorm"
 )
 
 func init() {
@@ -31,27 +42,101 @@ func init() {
 }
 
 func main() {
-	database.Connect()
+	db := database.Connect()
+	container, err := app.NewContainer(db)
+	if err != nil {
+		log.Fatalf("Refusing to start: %v", err)
+	}
+
+	if len(os.Args) > 1 {
+		runCommand(container, os.Args[1:])
+		return
+	}
+
+	prepareSchema(db)
+
+	container.OutboxService.Start(config.GetEnvDuration("OUTBOX_POLL_INTERVAL", 5*time.Second))
+
+	container.JobService.Start()
 
+	validation.Setup()
 	router := gin.Default()
 
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-Admin-Key", "X-Staff-Key", "Idempotency-Key", "X-Request-ID"},
+		ExposeHeaders:    []string{"Content-Length", "Content-Disposition", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After", "Expires", "X-Request-ID", "API-Version", "Deprecation", "Sunset", "Link"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 
-	routes.RegisterRoutes(router)
+	router.Use(middleware.RequestIDMiddleware(), middleware.ErrorMiddleware())
+
+	routes.RegisterRoutes(router, container)
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
-	log.Printf("Server running on port %s", port)
-	if err := router.Run(":" + port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	server := &http.Server{Addr: ":" + port, Handler: router}
+
+	go func() {
+		log.Printf("Server running on port %s", port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	// Drain in-flight requests, outbox dispatches and jobs on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	log.Println("Shutting down")
+	drainTimeout := config.GetEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server shutdown: %v", err)
+	}
+
+	outboxCtx, cancelOutbox := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancelOutbox()
+	if err := container.OutboxService.Stop(outboxCtx); err != nil {
+		log.Printf("Outbox dispatcher shutdown: %v", err)
+	}
+
+	if err := container.JobService.Stop(drainTimeout); err != nil {
+		log.Printf("Job runner shutdown: %v", err)
+	}
+
+	// Close the database last, dispatches and jobs record their outcome in it
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
+
+// prepareSchema refuses to start against a schema newer than this binary and
+// applies pending migrations unless DB_AUTO_MIGRATE is false
+func prepareSchema(db *gorm.DB) {
+	if err := migrations.CheckCompatible(db); err != nil {
+		log.Fatalf("Refusing to start: %v", err)
+	}
+
+	if config.GetEnv("DB_AUTO_MIGRATE", "true") == "true" {
+		if err := migrations.Up(db); err != nil {
+			log.Fatalf("Failed to migrate database: %v", err)
+		}
+		return
+	}
+
+	current, err := migrations.Current(db)
+	if err != nil {
+		log.Fatalf("Failed to read schema version: %v", err)
+	}
+	if current < migrations.Latest() {
+		log.Fatalf("Refusing to start: schema version %d is behind %d, run `migrate up`", current, migrations.Latest())
 	}
 }
@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// VersionUsage counts the requests one API version has served
+type VersionUsage struct {
+	Version       string           `json:"version"`
+	Requests      int64            `json:"requests"`
+	ClientErrors  int64            `json:"client_errors"`
+	ServerErrors  int64            `json:"server_errors"`
+	Routes        map[string]int64 `json:"routes"`
+	LastRequestAt time.Time        `json:"last_request_at"`
+}
+
+// APIUsage records which API versions and routes clients are still calling,
+// so a deprecated version can be switched off once traffic has moved on
+type APIUsage interface {
+	Record(version, route string, status int)
+	Snapshot() []VersionUsage
+	Since() time.Time
+}
+
+type memoryAPIUsage struct {
+	mu       sync.Mutex
+	versions map[string]*VersionUsage
+	since    time.Time
+}
+
+// NewAPIUsage returns an APIUsage counting in process memory since startup.
+// Each replica reports its own counts.
+func NewAPIUsage() APIUsage {
+	return &memoryAPIUsage{
+		versions: make(map[string]*VersionUsage),
+		since:    time.Now(),
+	}
+}
+
+func (u *memoryAPIUsage) Record(version, route string, status int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	usage, ok := u.versions[version]
+	if !ok {
+		usage = &VersionUsage{Version: version, Routes: make(map[string]int64)}
+		u.versions[version] = usage
+	}
+
+	usage.Requests++
+	usage.Routes[route]++
+	usage.LastRequestAt = time.Now()
+
+	switch {
+	case status >= 500:
+		usage.ServerErrors++
+	case status >= 400:
+		usage.ClientErrors++
+	}
+}
+
+// Snapshot copies the counters, ordered by version
+func (u *memoryAPIUsage) Snapshot() []VersionUsage {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	snapshot := make([]VersionUsage, 0, len(u.versions))
+	for _, usage := range u.versions {
+		copied := *usage
+		copied.Routes = make(map[string]int64, len(usage.Routes))
+		for route, count := range usage.Routes {
+			copied.Routes[route] = count
+		}
+		snapshot = append(snapshot, copied)
+	}
+
+	sort.Slice(snapshot, func(i, j int) bool { return snapshot[i].Version < snapshot[j].Version })
+	return snapshot
+}
+
+func (u *memoryAPIUsage) Since() time.Time {
+	return u.since
+}
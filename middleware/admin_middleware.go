@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"os"
+
+	"github.com/gimhanr9/go-loyalty-api/apperrors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminMiddleware only lets through requests carrying the ADMIN_API_KEY in X-Admin-Key
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		adminKey := os.Getenv("ADMIN_API_KEY")
+		if adminKey == "" {
+			abortWithError(c, apperrors.New(apperrors.CodeForbidden, "Admin API is disabled"))
+			return
+		}
+
+		key := c.GetHeader("X-Admin-Key")
+		if subtle.ConstantTimeCompare([]byte(key), []byte(adminKey)) != 1 {
+			abortWithError(c, apperrors.Unauthorized("Invalid admin key"))
+			return
+		}
+
+		c.Next()
+	}
+}
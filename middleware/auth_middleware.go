@@ -1,39 +1,53 @@
 package middleware
 
 import (
-	"net/http"
 	"strings"
 
-	"github.com/gin-gonic/gin"
+	"github.com/gimhanr9/go-loyalty-api/apperrors"
+	"github.com/gimhanr9/go-loyalty-api/repositories"
 	"github.com/gimhanr9/go-loyalty-api/utils"
+	"github.com/gin-gonic/gin"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+func AuthMiddleware(authRepository repositories.AuthRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		auth := c.GetHeader("Authorization")
 		if auth == "" || !strings.HasPrefix(auth, "Bearer ") {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing or invalid Authorization header"})
-			c.Abort()
+			abortWithError(c, apperrors.Unauthorized("Missing or invalid Authorization header"))
 			return
 		}
 
 		tokenStr := strings.TrimPrefix(auth, "Bearer ")
 		claims, err := utils.ParseToken(tokenStr)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-			c.Abort()
+			abortWithError(c, apperrors.Unauthorized("Invalid or expired token"))
 			return
 		}
 
 		customerID, ok := claims["customer_id"].(string)
 		if !ok || customerID == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token payload"})
-			c.Abort()
+			abortWithError(c, apperrors.Unauthorized("Invalid token payload"))
+			return
+		}
+
+		// Reject tokens of deleted accounts or issued before a revocation
+		user, err := authRepository.GetByCustomerID(customerID)
+		if err != nil {
+			abortWithError(c, apperrors.Unauthorized("Invalid or expired token"))
 			return
 		}
 
-		// Attach customer ID to context
+		if user.TokensRevokedAt != nil {
+			issuedAt, err := claims.GetIssuedAt()
+			if err != nil || issuedAt == nil || issuedAt.Before(*user.TokensRevokedAt) {
+				abortWithError(c, apperrors.Unauthorized("Invalid or expired token"))
+				return
+			}
+		}
+
+		// Attach customer and user IDs to context
 		c.Set("customer_id", customerID)
+		c.Set("user_id", user.ID)
 		c.Next()
 	}
 }
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"log"
+
+	"github.com/gimhanr9/go-loyalty-api/apperrors"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDMiddleware tags each request with the caller's X-Request-ID or a new one
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader("X-Request-ID")
+		if requestID == "" || len(requestID) > 128 {
+			requestID = uuid.New().String()
+		}
+
+		c.Set("request_id", requestID)
+		c.Header("X-Request-ID", requestID)
+		c.Next()
+	}
+}
+
+// ErrorMiddleware renders the last error a handler attached with c.Error as
+//
+//	{"error": {"code": ..., "message": ..., "details": ..., "request_id": ...}}
+func ErrorMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		err := c.Errors.Last().Err
+		appErr := apperrors.From(err)
+		requestID := c.GetString("request_id")
+
+		if appErr.Status() >= 500 {
+			log.Printf("request %s %s %s failed: %v", requestID, c.Request.Method, c.FullPath(), err)
+		}
+
+		body := gin.H{
+			"code":       appErr.Code,
+			"message":    appErr.Message,
+			"request_id": requestID,
+		}
+		if appErr.Details != nil {
+			body["details"] = appErr.Details
+		}
+		c.JSON(appErr.Status(), gin.H{"error": body})
+	}
+}
+
+// abortWithError hands err to ErrorMiddleware and stops the chain
+func abortWithError(c *gin.Context, err error) {
+	c.Error(err)
+	c.Abort()
+}
+
+// responseStatus is the status the request will be answered with, including an
+// error that ErrorMiddleware has not rendered yet
+func responseStatus(c *gin.Context) int {
+	if len(c.Errors) > 0 && !c.Writer.Written() {
+		return apperrors.From(c.Errors.Last().Err).Status()
+	}
+	return c.Writer.Status()
+}
@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gimhanr9/go-loyalty-api/apperrors"
+	"github.com/gimhanr9/go-loyalty-api/ratelimit"
+	"github.com/gimhanr9/go-loyalty-api/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// KeyFunc extracts the identity a request is throttled by. An empty key skips the limiter.
+type KeyFunc func(c *gin.Context) string
+
+// KeyByIP throttles by client IP
+func KeyByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// KeyByCustomerID throttles by the authenticated customer ID
+func KeyByCustomerID(c *gin.Context) string {
+	customerID := c.GetString("customer_id")
+	if customerID == "" {
+		return ""
+	}
+	return "customer:" + customerID
+}
+
+// KeyByPhone throttles by the phone number in the JSON body
+func KeyByPhone(c *gin.Context) string {
+	phone := peekPhone(c)
+	if phone == "" {
+		return ""
+	}
+	return "phone:" + phone
+}
+
+// peekPhone reads the phone number from the body (phoneNumber in v1, phone in v2)
+// and restores the body for the handler.
+// The number is normalized so formatting variants share one bucket.
+func peekPhone(c *gin.Context) string {
+	if c.Request.Body == nil {
+		return ""
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	var payload struct {
+		PhoneNumber string `json:"phoneNumber"`
+		Phone       string `json:"phone"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return ""
+	}
+
+	raw := payload.PhoneNumber
+	if raw == "" {
+		raw = payload.Phone
+	}
+	if phone, err := utils.NormalizePhone(raw); err == nil {
+		return phone
+	}
+	return raw
+}
+
+// RateLimitMiddleware applies a token bucket per key and sets the RateLimit-* headers
+func RateLimitMiddleware(store ratelimit.Store, name string, rate ratelimit.Rate, keyFunc KeyFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := keyFunc(c)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		result, err := store.Take(name+":"+key, rate)
+		if err != nil {
+			// Fail open, a broken limiter backend must not take the API down
+			log.Printf("rate limiter %s unavailable: %v", name, err)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", seconds(result.ResetAfter))
+
+		if !result.Allowed {
+			c.Header("Retry-After", seconds(result.RetryAfter))
+			abortWithError(c, apperrors.New(apperrors.CodeRateLimited, "Too many requests, please try again later"))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// LoginLockoutMiddleware rejects logins for a locked phone and counts 401 responses as failures
+func LoginLockoutMiddleware(guard ratelimit.LoginGuard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		phone := peekPhone(c)
+		if phone == "" {
+			c.Next()
+			return
+		}
+
+		if remaining := guard.LockedFor(phone); remaining > 0 {
+			c.Header("Retry-After", seconds(remaining))
+			abortWithError(c, apperrors.New(apperrors.CodeRateLimited, "Too many failed login attempts, please try again later"))
+			return
+		}
+
+		c.Next()
+
+		switch responseStatus(c) {
+		case http.StatusOK:
+			guard.Reset(phone)
+		case http.StatusUnauthorized:
+			guard.RecordFailure(phone)
+		}
+	}
+}
+
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,183 @@
+package middleware
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/gimhanr9/go-loyalty-api/apperrors"
+	"github.com/gimhanr9/go-loyalty-api/ratelimit"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// brokenStore is a limiter backend that is down
+type brokenStore struct{}
+
+func (brokenStore) Take(key string, rate ratelimit.Rate) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("connection refused")
+}
+
+// newRateLimitedRouter answers POST /login with the body it received
+func newRateLimitedRouter(store ratelimit.Store, keyFunc KeyFunc) *gin.Engine {
+	router := gin.New()
+	router.Use(ErrorMiddleware())
+	router.POST("/login", RateLimitMiddleware(store, "auth", ratelimit.Rate{Burst: 2, Period: time.Minute}, keyFunc), func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, string(body))
+	})
+	return router
+}
+
+func post(router http.Handler, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		store      ratelimit.Store
+		keyFunc    KeyFunc
+		bodies     []string
+		wantStatus []int
+	}{
+		{
+			name:       "refuses once the burst is spent",
+			keyFunc:    KeyByIP,
+			bodies:     []string{`{}`, `{}`, `{}`},
+			wantStatus: []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name:       "phone formats share a bucket",
+			keyFunc:    KeyByPhone,
+			bodies:     []string{`{"phoneNumber": "+16502530000"}`, `{"phone": "(650) 253-0000"}`, `{"phone": "650.253.0000"}`},
+			wantStatus: []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name:       "no key skips the limiter",
+			keyFunc:    KeyByPhone,
+			bodies:     []string{`{}`, `not json`, `{}`},
+			wantStatus: []int{http.StatusOK, http.StatusOK, http.StatusOK},
+		},
+		{
+			name:       "fails open when the store is down",
+			store:      brokenStore{},
+			keyFunc:    KeyByIP,
+			bodies:     []string{`{}`, `{}`, `{}`},
+			wantStatus: []int{http.StatusOK, http.StatusOK, http.StatusOK},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := tt.store
+			if store == nil {
+				store = ratelimit.NewMemoryStore()
+			}
+			router := newRateLimitedRouter(store, tt.keyFunc)
+
+			for i, body := range tt.bodies {
+				w := post(router, body)
+				if w.Code != tt.wantStatus[i] {
+					t.Fatalf("request %d: status = %d, want %d", i, w.Code, tt.wantStatus[i])
+				}
+				if w.Code == http.StatusOK && w.Body.String() != body {
+					t.Errorf("request %d: handler read %q, want the original body", i, w.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimitMiddlewareHeaders(t *testing.T) {
+	router := newRateLimitedRouter(ratelimit.NewMemoryStore(), KeyByIP)
+
+	post(router, `{}`)
+	post(router, `{}`)
+	w := post(router, `{}`)
+	want := map[string]string{"RateLimit-Limit": "2", "RateLimit-Remaining": "0", "RateLimit-Reset": "60", "Retry-After": "30"}
+	for header, value := range want {
+		if got := w.Header().Get(header); got != value {
+			t.Errorf("%s = %q, want %q", header, got, value)
+		}
+	}
+	if !strings.Contains(w.Body.String(), string(apperrors.CodeRateLimited)) {
+		t.Errorf("body = %s", w.Body.String())
+	}
+}
+
+func TestLoginLockoutMiddleware(t *testing.T) {
+	const good, bad = `{"phone": "+16502530000", "ok": true}`, `{"phone": "+16502530000"}`
+
+	tests := []struct {
+		name       string
+		bodies     []string
+		wantStatus []int
+	}{
+		{
+			name:       "locks after repeated 401s",
+			bodies:     []string{bad, bad, bad, good},
+			wantStatus: []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests, http.StatusTooManyRequests},
+		},
+		{
+			name:       "a successful login resets the count",
+			bodies:     []string{bad, good, bad, good},
+			wantStatus: []int{http.StatusUnauthorized, http.StatusOK, http.StatusUnauthorized, http.StatusOK},
+		},
+		{
+			name:       "formatting variants count against one phone",
+			bodies:     []string{bad, `{"phoneNumber": "(650) 253-0000"}`, good},
+			wantStatus: []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests},
+		},
+		{
+			name:       "other errors are not failures",
+			bodies:     []string{`{"phone": "+16502530000", "fail": "invalid"}`, `{"phone": "+16502530000", "fail": "invalid"}`, good},
+			wantStatus: []int{http.StatusBadRequest, http.StatusBadRequest, http.StatusOK},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(ErrorMiddleware())
+			guard := ratelimit.NewMemoryLoginGuard(2, time.Minute, 5*time.Minute)
+			router.POST("/login", LoginLockoutMiddleware(guard), func(c *gin.Context) {
+				var req struct {
+					OK   bool   `json:"ok"`
+					Fail string `json:"fail"`
+				}
+				c.ShouldBindJSON(&req)
+				switch {
+				case req.Fail != "":
+					c.Error(apperrors.InvalidRequest(req.Fail))
+				case req.OK:
+					c.Status(http.StatusOK)
+				default:
+					c.Error(apperrors.New(apperrors.CodeUnauthorized, "invalid credentials"))
+				}
+			})
+
+			for i, body := range tt.bodies {
+				w := post(router, body)
+				if w.Code != tt.wantStatus[i] {
+					t.Fatalf("request %d: status = %d, want %d", i, w.Code, tt.wantStatus[i])
+				}
+				if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "300" {
+					t.Errorf("request %d: Retry-After = %q", i, w.Header().Get("Retry-After"))
+				}
+			}
+		})
+	}
+}
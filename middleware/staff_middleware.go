@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"os"
+
+	"github.com/gimhanr9/go-loyalty-api/apperrors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StaffMiddleware only lets through requests carrying the STAFF_API_KEY in
+// X-Staff-Key, the key given to in-store terminals
+func StaffMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		staffKey := os.Getenv("STAFF_API_KEY")
+		if staffKey == "" {
+			abortWithError(c, apperrors.New(apperrors.CodeForbidden, "Staff API is disabled"))
+			return
+		}
+
+		key := c.GetHeader("X-Staff-Key")
+		if subtle.ConstantTimeCompare([]byte(key), []byte(staffKey)) != 1 {
+			abortWithError(c, apperrors.Unauthorized("Invalid staff key"))
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gimhanr9/go-loyalty-api/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// APIVersionMiddleware tags the response with the API version and counts the
+// request against that version and route
+func APIVersionMiddleware(usage metrics.APIUsage, version string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("api_version", version)
+		c.Header("API-Version", version)
+
+		c.Next()
+
+		usage.Record(version, c.Request.Method+" "+c.FullPath(), responseStatus(c))
+	}
+}
+
+// DeprecationMiddleware announces that the version is deprecated (RFC 9745) and
+// when it will stop being served (RFC 8594), linking to the migration docs
+func DeprecationMiddleware(deprecatedAt, sunset time.Time, docsURL string) gin.HandlerFunc {
+	deprecation := "@" + strconv.FormatInt(deprecatedAt.Unix(), 10)
+	sunsetAt := sunset.UTC().Format(http.TimeFormat)
+	link := "<" + docsURL + `>; rel="deprecation"`
+
+	return func(c *gin.Context) {
+		c.Header("Deprecation", deprecation)
+		c.Header("Sunset", sunsetAt)
+		c.Header("Link", link)
+		c.Next()
+	}
+}
@@ -0,0 +1,94 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Schema snapshots as they were before versioned migrations. Databases created
+// by the old AutoMigrate already have these tables and they are left alone.
+type userV1 struct {
+	ID                  uint `gorm:"primaryKey"`
+	Name                string
+	Email               string
+	Phone               string
+	CustomerID          string
+	DeletionScheduledAt *time.Time
+	AnonymizedAt        *time.Time
+	TokensRevokedAt     *time.Time
+}
+
+func (userV1) TableName() string { return "users" }
+
+type phoneChangeV1 struct {
+	ID        uint `gorm:"primaryKey"`
+	UserID    uint `gorm:"index"`
+	NewPhone  string
+	CodeHash  string
+	Attempts  int
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+func (phoneChangeV1) TableName() string { return "phone_changes" }
+
+type auditEntryV1 struct {
+	ID        uint `gorm:"primaryKey"`
+	UserID    uint `gorm:"index"`
+	Action    string
+	Actor     string
+	Details   string
+	CreatedAt time.Time
+}
+
+func (auditEntryV1) TableName() string { return "audit_entries" }
+
+type pendingRegistrationV1 struct {
+	ID        uint `gorm:"primaryKey"`
+	Name      string
+	Email     string
+	Phone     string `gorm:"index"`
+	AccountID string
+	CodeHash  string
+	Attempts  int
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+func (pendingRegistrationV1) TableName() string { return "pending_registrations" }
+
+func init() {
+	register(Migration{
+		Version: 1,
+		Name:    "users_unique_indexes",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&userV1{}, &phoneChangeV1{}, &auditEntryV1{}, &pendingRegistrationV1{}); err != nil {
+				return err
+			}
+
+			// Existing duplicates make these fail, run `normalize-users` first.
+			// Anonymized users have no customer ID, so that index skips empty values.
+			statements := []string{
+				"CREATE UNIQUE INDEX idx_users_email ON users (email)",
+				"CREATE UNIQUE INDEX idx_users_phone ON users (phone)",
+				"CREATE UNIQUE INDEX idx_users_customer_id ON users (customer_id) WHERE customer_id <> ''",
+			}
+			for _, statement := range statements {
+				if err := tx.Exec(statement).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		// Tables may predate this migration and hold data, so only the indexes are dropped
+		Down: func(tx *gorm.DB) error {
+			for _, index := range []string{"idx_users_email", "idx_users_phone", "idx_users_customer_id"} {
+				if err := tx.Exec("DROP INDEX IF EXISTS " + index).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
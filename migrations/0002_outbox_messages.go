@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type outboxMessageV2 struct {
+	ID             uint `gorm:"primaryKey"`
+	Kind           string
+	Payload        string
+	IdempotencyKey string
+	Status         string `gorm:"index"`
+	Attempts       int
+	LastError      string
+	NextAttemptAt  time.Time
+	Version        int
+	CompletedAt    *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (outboxMessageV2) TableName() string { return "outbox_messages" }
+
+func init() {
+	register(Migration{
+		Version: 2,
+		Name:    "outbox_messages",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&outboxMessageV2{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&outboxMessageV2{})
+		},
+	})
+}
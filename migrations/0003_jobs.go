@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type jobV3 struct {
+	ID          uint   `gorm:"primaryKey"`
+	Kind        string `gorm:"index"`
+	Payload     string
+	UniqueKey   string `gorm:"index"`
+	Status      string `gorm:"index"`
+	Attempts    int
+	MaxAttempts int
+	RunAt       time.Time `gorm:"index"`
+	LastError   string
+	Version     int
+	FinishedAt  *time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (jobV3) TableName() string { return "jobs" }
+
+func init() {
+	register(Migration{
+		Version: 3,
+		Name:    "jobs",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&jobV3{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&jobV3{})
+		},
+	})
+}
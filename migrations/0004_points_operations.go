@@ -0,0 +1,39 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type pointsOperationV4 struct {
+	ID             uint `gorm:"primaryKey"`
+	Kind           string
+	AccountID      string `gorm:"index"`
+	IdempotencyKey string `gorm:"uniqueIndex"`
+	Amount         int
+	Description    string
+	RewardTierID   string
+	Step           string
+	OrderID        string
+	RewardID       string
+	PaymentID      string
+	LastError      string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (pointsOperationV4) TableName() string { return "points_operations" }
+
+func init() {
+	register(Migration{
+		Version: 4,
+		Name:    "points_operations",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&pointsOperationV4{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&pointsOperationV4{})
+		},
+	})
+}
@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type accountSnapshotV5 struct {
+	ID        uint   `gorm:"primaryKey"`
+	AccountID string `gorm:"uniqueIndex"`
+	Balance   int
+	BalanceAt *time.Time
+	History   string
+	HistoryAt *time.Time
+	UpdatedAt time.Time
+}
+
+func (accountSnapshotV5) TableName() string { return "account_snapshots" }
+
+func init() {
+	register(Migration{
+		Version: 5,
+		Name:    "account_snapshots",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&accountSnapshotV5{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&accountSnapshotV5{})
+		},
+	})
+}
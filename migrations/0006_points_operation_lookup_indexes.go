@@ -0,0 +1,31 @@
+package migrations
+
+import "gorm.io/gorm"
+
+func init() {
+	register(Migration{
+		Version: 6,
+		Name:    "points_operation_lookup_indexes",
+		// History entries are matched to local operations by order and reward ID
+		Up: func(tx *gorm.DB) error {
+			statements := []string{
+				"CREATE INDEX idx_points_operations_order_id ON points_operations (order_id)",
+				"CREATE INDEX idx_points_operations_reward_id ON points_operations (reward_id)",
+			}
+			for _, statement := range statements {
+				if err := tx.Exec(statement).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, index := range []string{"idx_points_operations_order_id", "idx_points_operations_reward_id"} {
+				if err := tx.Exec("DROP INDEX IF EXISTS " + index).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type statementV7 struct {
+	ID        uint `gorm:"primaryKey"`
+	UserID    uint `gorm:"index"`
+	AccountID string
+	Format    string
+	From      string
+	To        string
+	Status    string
+	Filename  string
+	Content   []byte
+	LastError string
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (statementV7) TableName() string { return "statements" }
+
+func init() {
+	register(Migration{
+		Version: 7,
+		Name:    "statements",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&statementV7{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&statementV7{})
+		},
+	})
+}
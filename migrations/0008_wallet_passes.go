@@ -0,0 +1,47 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type walletPassV8 struct {
+	ID               uint   `gorm:"primaryKey"`
+	UserID           uint   `gorm:"uniqueIndex"`
+	AccountID        string `gorm:"index"`
+	SerialNumber     string `gorm:"uniqueIndex"`
+	AuthToken        string
+	Content          string
+	ContentUpdatedAt time.Time `gorm:"index"`
+	PushedAt         *time.Time
+	GoogleIssuedAt   *time.Time
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+func (walletPassV8) TableName() string { return "wallet_passes" }
+
+type walletRegistrationV8 struct {
+	ID              uint   `gorm:"primaryKey"`
+	DeviceLibraryID string `gorm:"uniqueIndex:idx_wallet_registrations_device_pass"`
+	PassID          uint   `gorm:"uniqueIndex:idx_wallet_registrations_device_pass;index"`
+	PushToken       string
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+func (walletRegistrationV8) TableName() string { return "wallet_registrations" }
+
+func init() {
+	register(Migration{
+		Version: 8,
+		Name:    "wallet_passes",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&walletPassV8{}, &walletRegistrationV8{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&walletRegistrationV8{}, &walletPassV8{})
+		},
+	})
+}
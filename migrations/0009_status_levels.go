@@ -0,0 +1,56 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type customerStatusV9 struct {
+	ID              uint   `gorm:"primaryKey"`
+	UserID          uint   `gorm:"uniqueIndex"`
+	AccountID       string `gorm:"index"`
+	Level           string
+	QualifyingValue int
+	AchievedAt      *time.Time
+	DowngradeAt     *time.Time
+	EvaluatedAt     time.Time
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+func (customerStatusV9) TableName() string { return "customer_statuses" }
+
+// pointsOperationV9 holds only the columns this migration adds
+type pointsOperationV9 struct {
+	BonusPoints int
+	BonusReason string
+}
+
+func (pointsOperationV9) TableName() string { return "points_operations" }
+
+func init() {
+	register(Migration{
+		Version: 9,
+		Name:    "status_levels",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().CreateTable(&customerStatusV9{}); err != nil {
+				return err
+			}
+			for _, column := range []string{"BonusPoints", "BonusReason"} {
+				if err := tx.Migrator().AddColumn(&pointsOperationV9{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, column := range []string{"BonusPoints", "BonusReason"} {
+				if err := tx.Migrator().DropColumn(&pointsOperationV9{}, column); err != nil {
+					return err
+				}
+			}
+			return tx.Migrator().DropTable(&customerStatusV9{})
+		},
+	})
+}
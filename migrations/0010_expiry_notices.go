@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type expiryNoticeV10 struct {
+	ID              uint `gorm:"primaryKey"`
+	UserID          uint `gorm:"uniqueIndex"`
+	NotifiedThrough time.Time
+	SentAt          time.Time
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+func (expiryNoticeV10) TableName() string { return "expiry_notices" }
+
+func init() {
+	register(Migration{
+		Version: 10,
+		Name:    "expiry_notices",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&expiryNoticeV10{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&expiryNoticeV10{})
+		},
+	})
+}
@@ -0,0 +1,48 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type referralCodeV11 struct {
+	ID         uint   `gorm:"primaryKey"`
+	UserID     uint   `gorm:"uniqueIndex"`
+	Code       string `gorm:"uniqueIndex"`
+	DeviceHash string `gorm:"index"`
+	CreatedAt  time.Time
+}
+
+func (referralCodeV11) TableName() string { return "referral_codes" }
+
+type referralV11 struct {
+	ID             uint   `gorm:"primaryKey"`
+	ReferrerID     uint   `gorm:"index"`
+	RefereeID      uint   `gorm:"uniqueIndex"`
+	Status         string `gorm:"index"`
+	RejectReason   string
+	PhoneHash      string `gorm:"index"`
+	DeviceHash     string `gorm:"index"`
+	ReferrerPoints int
+	RefereePoints  int
+	QualifiedAt    *time.Time
+	RewardedAt     *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (referralV11) TableName() string { return "referrals" }
+
+func init() {
+	register(Migration{
+		Version: 11,
+		Name:    "referrals",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&referralCodeV11{}, &referralV11{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&referralV11{}, &referralCodeV11{})
+		},
+	})
+}
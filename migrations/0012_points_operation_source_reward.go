@@ -0,0 +1,23 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// pointsOperationV12 holds only the column this migration adds
+type pointsOperationV12 struct {
+	SourceRewardID string
+}
+
+func (pointsOperationV12) TableName() string { return "points_operations" }
+
+func init() {
+	register(Migration{
+		Version: 12,
+		Name:    "points_operation_source_reward",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(&pointsOperationV12{}, "SourceRewardID")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&pointsOperationV12{}, "SourceRewardID")
+		},
+	})
+}
@@ -0,0 +1,34 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// pointsOperationV13 holds only the columns this migration adds
+type pointsOperationV13 struct {
+	RewardPoints int
+	EarnedPoints int
+}
+
+func (pointsOperationV13) TableName() string { return "points_operations" }
+
+func init() {
+	register(Migration{
+		Version: 13,
+		Name:    "points_operation_ledger",
+		Up: func(tx *gorm.DB) error {
+			for _, column := range []string{"RewardPoints", "EarnedPoints"} {
+				if err := tx.Migrator().AddColumn(&pointsOperationV13{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, column := range []string{"RewardPoints", "EarnedPoints"} {
+				if err := tx.Migrator().DropColumn(&pointsOperationV13{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,48 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type jobScheduleV14 struct {
+	Kind      string `gorm:"primaryKey"`
+	NextRunAt time.Time
+	UpdatedAt time.Time
+}
+
+func (jobScheduleV14) TableName() string { return "job_schedules" }
+
+func init() {
+	register(Migration{
+		Version: 14,
+		Name:    "job_dedupe",
+		Up: func(tx *gorm.DB) error {
+			// Keep one active job of each unique key, a running one over a queued
+			// one and then the oldest, the index refuses the rest
+			err := tx.Exec(`UPDATE jobs SET status = ?, finished_at = ?, last_error = ?, version = version + 1
+				WHERE unique_key <> '' AND status IN ('queued', 'running')
+				AND EXISTS (SELECT 1 FROM jobs kept
+					WHERE kept.unique_key = jobs.unique_key AND kept.id <> jobs.id
+					AND ((kept.status = 'running' AND jobs.status = 'queued')
+						OR (kept.status = jobs.status AND kept.id < jobs.id)))`,
+				"cancelled", time.Now(), "duplicate of another active job with the same unique key").Error
+			if err != nil {
+				return err
+			}
+
+			err = tx.Exec("CREATE UNIQUE INDEX idx_jobs_active_unique_key ON jobs (unique_key) WHERE unique_key <> '' AND status IN ('queued', 'running')").Error
+			if err != nil {
+				return err
+			}
+			return tx.Migrator().CreateTable(&jobScheduleV14{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&jobScheduleV14{}); err != nil {
+				return err
+			}
+			return tx.Exec("DROP INDEX IF EXISTS idx_jobs_active_unique_key").Error
+		},
+	})
+}
@@ -0,0 +1,19 @@
+package migrations
+
+import "testing"
+
+// Registered returns the compiled-in migrations, in order
+func Registered() []Migration {
+	return registry
+}
+
+// UseRegistry registers ms in place of the compiled-in migrations until the test ends
+func UseRegistry(t testing.TB, ms ...Migration) {
+	saved := registry
+	registry = nil
+	t.Cleanup(func() { registry = saved })
+
+	for _, m := range ms {
+		register(m)
+	}
+}
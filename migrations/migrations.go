@@ -0,0 +1,194 @@
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration is one versioned schema change. Migrations are compiled into the
+// binary and must never be edited once released, add a new version instead.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// SchemaMigration records an applied migration in the schema_migrations table
+type SchemaMigration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+// Status describes a known migration and whether it has been applied
+type Status struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+var registry []Migration
+
+// register adds a migration, called from the init of each migration file
+func register(m Migration) {
+	registry = append(registry, m)
+	sort.Slice(registry, func(i, j int) bool { return registry[i].Version < registry[j].Version })
+}
+
+// Latest returns the highest version known to this binary
+func Latest() int {
+	if len(registry) == 0 {
+		return 0
+	}
+	return registry[len(registry)-1].Version
+}
+
+// Current returns the highest applied version, 0 for an empty database
+func Current(db *gorm.DB) (int, error) {
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return 0, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	var current int
+	err := db.Model(&SchemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&current).Error
+	return current, err
+}
+
+// CheckCompatible refuses to run against a schema migrated by a newer binary
+func CheckCompatible(db *gorm.DB) error {
+	current, err := Current(db)
+	if err != nil {
+		return err
+	}
+	if current > Latest() {
+		return fmt.Errorf("database schema version %d is newer than this binary supports (%d)", current, Latest())
+	}
+	return nil
+}
+
+// Up applies every pending migration
+func Up(db *gorm.DB) error {
+	return To(db, Latest())
+}
+
+// Down rolls back the most recently applied migration
+func Down(db *gorm.DB) error {
+	current, err := Current(db)
+	if err != nil {
+		return err
+	}
+	if current == 0 {
+		return errors.New("no migrations to roll back")
+	}
+
+	target := 0
+	for _, m := range registry {
+		if m.Version < current {
+			target = m.Version
+		}
+	}
+	return To(db, target)
+}
+
+// To migrates up or down until version is the latest applied migration
+func To(db *gorm.DB, version int) error {
+	if version != 0 && find(version) == nil {
+		return fmt.Errorf("unknown migration version %d", version)
+	}
+
+	current, err := Current(db)
+	if err != nil {
+		return err
+	}
+	if current > Latest() {
+		return fmt.Errorf("database schema version %d is newer than this binary supports (%d)", current, Latest())
+	}
+
+	if version >= current {
+		for _, m := range registry {
+			if m.Version > current && m.Version <= version {
+				if err := apply(db, m); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	for i := len(registry) - 1; i >= 0; i-- {
+		m := registry[i]
+		if m.Version <= current && m.Version > version {
+			if err := revert(db, m); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// StatusList reports every known migration with its applied time
+func StatusList(db *gorm.DB) ([]Status, error) {
+	if _, err := Current(db); err != nil {
+		return nil, err
+	}
+
+	var applied []SchemaMigration
+	if err := db.Find(&applied).Error; err != nil {
+		return nil, err
+	}
+
+	appliedAt := make(map[int]time.Time)
+	for _, a := range applied {
+		appliedAt[a.Version] = a.AppliedAt
+	}
+
+	statuses := make([]Status, 0, len(registry))
+	for _, m := range registry {
+		status := Status{Version: m.Version, Name: m.Name}
+		if t, ok := appliedAt[m.Version]; ok {
+			status.AppliedAt = &t
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func apply(db *gorm.DB, m Migration) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := m.Up(tx); err != nil {
+			return err
+		}
+		return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("migration %d_%s failed: %w", m.Version, m.Name, err)
+	}
+	return nil
+}
+
+func revert(db *gorm.DB, m Migration) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := m.Down(tx); err != nil {
+			return err
+		}
+		return tx.Delete(&SchemaMigration{}, m.Version).Error
+	})
+	if err != nil {
+		return fmt.Errorf("rollback of %d_%s failed: %w", m.Version, m.Name, err)
+	}
+	return nil
+}
+
+func find(version int) *Migration {
+	for i := range registry {
+		if registry[i].Version == version {
+			return &registry[i]
+		}
+	}
+	return nil
+}
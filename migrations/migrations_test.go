@@ -0,0 +1,147 @@
+package migrations_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gimhanr9/go-loyalty-api/database/dbtest"
+	"github.com/gimhanr9/go-loyalty-api/migrations"
+	"github.com/gimhanr9/go-loyalty-api/models"
+)
+
+func TestUpAppliesEveryMigration(t *testing.T) {
+	db := dbtest.Open(t)
+
+	if err := migrations.Up(db); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	current, err := migrations.Current(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current != migrations.Latest() {
+		t.Errorf("current = %d, want %d", current, migrations.Latest())
+	}
+
+	// Up again is a no-op
+	if err := migrations.Up(db); err != nil {
+		t.Fatalf("second Up: %v", err)
+	}
+
+	statuses, err := migrations.StatusList(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			t.Errorf("migration %d_%s not applied", status.Version, status.Name)
+		}
+	}
+}
+
+// Every migration rolls back and applies again, one version at a time
+func TestDownAndUpAgain(t *testing.T) {
+	db := dbtest.Migrated(t)
+
+	statuses, err := migrations.StatusList(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := len(statuses) - 1; i >= 0; i-- {
+		if err := migrations.Down(db); err != nil {
+			t.Fatalf("Down from %d: %v", statuses[i].Version, err)
+		}
+		want := 0
+		if i > 0 {
+			want = statuses[i-1].Version
+		}
+		if current, _ := migrations.Current(db); current != want {
+			t.Fatalf("after rolling back %d current = %d, want %d", statuses[i].Version, current, want)
+		}
+	}
+
+	if err := migrations.Down(db); err == nil {
+		t.Error("Down with nothing applied should fail")
+	}
+	if err := migrations.Up(db); err != nil {
+		t.Fatalf("Up after rolling back everything: %v", err)
+	}
+}
+
+func TestToUnknownVersion(t *testing.T) {
+	db := dbtest.Open(t)
+	if err := migrations.To(db, migrations.Latest()+1); err == nil {
+		t.Error("migrating to an unknown version should fail")
+	}
+}
+
+func TestCheckCompatibleRefusesNewerSchema(t *testing.T) {
+	db := dbtest.Migrated(t)
+	if err := migrations.CheckCompatible(db); err != nil {
+		t.Fatalf("CheckCompatible on the latest schema: %v", err)
+	}
+
+	newer := migrations.SchemaMigration{Version: migrations.Latest() + 1, Name: "from_the_future", AppliedAt: time.Now()}
+	if err := db.Create(&newer).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := migrations.CheckCompatible(db); err == nil {
+		t.Error("CheckCompatible should refuse a schema newer than the binary")
+	}
+	if err := migrations.Up(db); err == nil {
+		t.Error("Up should refuse a schema newer than the binary")
+	}
+}
+
+// The users indexes from migration 1 behave the same on every driver,
+// including the partial index that lets many users have no customer ID
+func TestUsersUniqueIndexes(t *testing.T) {
+	tests := []struct {
+		name    string
+		first   models.User
+		second  models.User
+		wantErr bool
+	}{
+		{
+			name:   "distinct users",
+			first:  models.User{Email: "a@example.com", Phone: "+14155550100", CustomerID: "acc1"},
+			second: models.User{Email: "b@example.com", Phone: "+14155550101", CustomerID: "acc2"},
+		},
+		{
+			name:   "both without a customer ID",
+			first:  models.User{Email: "a@example.com", Phone: "+14155550100"},
+			second: models.User{Email: "b@example.com", Phone: "+14155550101"},
+		},
+		{
+			name:    "same customer ID",
+			first:   models.User{Email: "a@example.com", Phone: "+14155550100", CustomerID: "acc1"},
+			second:  models.User{Email: "b@example.com", Phone: "+14155550101", CustomerID: "acc1"},
+			wantErr: true,
+		},
+		{
+			name:    "same email",
+			first:   models.User{Email: "a@example.com", Phone: "+14155550100"},
+			second:  models.User{Email: "a@example.com", Phone: "+14155550101"},
+			wantErr: true,
+		},
+		{
+			name:    "same phone",
+			first:   models.User{Email: "a@example.com", Phone: "+14155550100"},
+			second:  models.User{Email: "b@example.com", Phone: "+14155550100"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dbtest.Migrated(t)
+			if err := db.Create(&tt.first).Error; err != nil {
+				t.Fatalf("create first: %v", err)
+			}
+			err := db.Create(&tt.second).Error
+			if (err != nil) != tt.wantErr {
+				t.Errorf("create second: err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
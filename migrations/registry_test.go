@@ -0,0 +1,124 @@
+package migrations_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"github.com/gimhanr9/go-loyalty-api/database/dbtest"
+	"github.com/gimhanr9/go-loyalty-api/migrations"
+)
+
+// Every compiled-in migration has a unique version and both directions
+func TestRegistry(t *testing.T) {
+	registry := migrations.Registered()
+	seen := make(map[int]bool)
+	for i, m := range registry {
+		if m.Version <= 0 {
+			t.Errorf("migration %s has version %d", m.Name, m.Version)
+		}
+		if seen[m.Version] {
+			t.Errorf("version %d is registered twice", m.Version)
+		}
+		seen[m.Version] = true
+		if i > 0 && registry[i-1].Version >= m.Version {
+			t.Errorf("registry out of order at %d_%s", m.Version, m.Name)
+		}
+		if m.Name == "" || m.Up == nil || m.Down == nil {
+			t.Errorf("migration %d is missing a name, Up or Down", m.Version)
+		}
+	}
+}
+
+// useRegistry swaps in migrations that record what ran, for the test's duration
+func useRegistry(t *testing.T, versions []int, failing int) *[]string {
+	t.Helper()
+
+	var ran []string
+	var ms []migrations.Migration
+	for _, version := range versions {
+		ms = append(ms, migrations.Migration{
+			Version: version,
+			Name:    "test",
+			Up: func(tx *gorm.DB) error {
+				ran = append(ran, fmt.Sprintf("up %d", version))
+				if version == failing {
+					return errors.New("broken migration")
+				}
+				return nil
+			},
+			Down: func(tx *gorm.DB) error {
+				ran = append(ran, fmt.Sprintf("down %d", version))
+				return nil
+			},
+		})
+	}
+	migrations.UseRegistry(t, ms...)
+	return &ran
+}
+
+func TestMigrateTo(t *testing.T) {
+	tests := []struct {
+		name        string
+		versions    []int // registered, in init order
+		failing     int
+		from        int // applied before the test
+		to          int
+		wantRan     []string
+		wantCurrent int
+		wantErr     bool
+	}{
+		{name: "registers out of order", versions: []int{3, 1, 2}, to: 3, wantRan: []string{"up 1", "up 2", "up 3"}, wantCurrent: 3},
+		{name: "up part of the way", versions: []int{1, 2, 3}, to: 2, wantRan: []string{"up 1", "up 2"}, wantCurrent: 2},
+		{name: "down in reverse order", versions: []int{1, 2, 3}, from: 3, to: 1, wantRan: []string{"down 3", "down 2"}, wantCurrent: 1},
+		{name: "gaps in the versions", versions: []int{1, 2, 5}, to: 5, wantRan: []string{"up 1", "up 2", "up 5"}, wantCurrent: 5},
+		{name: "unknown version", versions: []int{1, 2}, to: 4, wantErr: true},
+		{name: "stops at a failing migration", versions: []int{1, 2, 3}, failing: 2, to: 3, wantRan: []string{"up 1", "up 2"}, wantCurrent: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dbtest.Open(t)
+			ran := useRegistry(t, tt.versions, tt.failing)
+			if tt.from > 0 {
+				if err := migrations.To(db, tt.from); err != nil {
+					t.Fatal(err)
+				}
+				*ran = nil
+			}
+
+			err := migrations.To(db, tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(*ran, tt.wantRan) {
+				t.Errorf("ran %v, want %v", *ran, tt.wantRan)
+			}
+			if current, _ := migrations.Current(db); current != tt.wantCurrent {
+				t.Errorf("current = %d, want %d", current, tt.wantCurrent)
+			}
+		})
+	}
+}
+
+func TestDownSkipsGaps(t *testing.T) {
+	db := dbtest.Open(t)
+	ran := useRegistry(t, []int{1, 2, 5}, 0)
+	if err := migrations.Up(db); err != nil {
+		t.Fatal(err)
+	}
+	*ran = nil
+
+	if err := migrations.Down(db); err != nil {
+		t.Fatal(err)
+	}
+	if current, _ := migrations.Current(db); current != 2 {
+		t.Errorf("current = %d, want 2", current)
+	}
+	if !reflect.DeepEqual(*ran, []string{"down 5"}) {
+		t.Errorf("ran %v", *ran)
+	}
+}
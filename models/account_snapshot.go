@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// AccountSnapshot is the last balance and first history page read from Square
+// for a loyalty account, served when Square is unavailable
+type AccountSnapshot struct {
+	ID        uint       `gorm:"primaryKey" json:"-"`
+	AccountID string     `gorm:"uniqueIndex" json:"account_id"`
+	Balance   int        `json:"balance"`
+	BalanceAt *time.Time `json:"balance_at"`
+	History   string     `json:"-"` // JSON encoded dto.HistoryPage
+	HistoryAt *time.Time `json:"history_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// AuditEntry records an action taken on a user's account
+type AuditEntry struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"index" json:"user_id"`
+	Action    string    `json:"action"`
+	Actor     string    `json:"actor"`
+	Details   string    `json:"details"`
+	CreatedAt time.Time `json:"created_at"`
+}
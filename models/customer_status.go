@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// CustomerStatus is the status level an account holds, set by the nightly
+// evaluation. Level is empty below the first level.
+type CustomerStatus struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	UserID          uint       `gorm:"uniqueIndex" json:"user_id"`
+	AccountID       string     `gorm:"index" json:"account_id"`
+	Level           string     `json:"level"`
+	QualifyingValue int        `json:"qualifying_value"`       // lifetime points or rolling spend at the last evaluation
+	AchievedAt      *time.Time `json:"achieved_at,omitempty"`  // when the account reached Level
+	DowngradeAt     *time.Time `json:"downgrade_at,omitempty"` // end of the grace period, set while the account no longer qualifies for Level
+	EvaluatedAt     time.Time  `json:"evaluated_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
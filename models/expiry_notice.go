@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// ExpiryNotice remembers the last "your points expire soon" message sent to
+// a user, so each expiring point is announced once
+type ExpiryNotice struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	UserID          uint      `gorm:"uniqueIndex" json:"user_id"`
+	NotifiedThrough time.Time `json:"notified_through"` // the latest expiry date the message covered
+	SentAt          time.Time `json:"sent_at"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Job statuses
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobDead      = "dead"
+	JobCancelled = "cancelled"
+)
+
+// Job is a unit of deferred work run by the in-process job runner
+type Job struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	Kind        string     `gorm:"index" json:"kind"`
+	Payload     string     `json:"payload"`
+	UniqueKey   string     `gorm:"index" json:"unique_key,omitempty"`
+	Status      string     `gorm:"index" json:"status"`
+	Attempts    int        `json:"attempts"`
+	MaxAttempts int        `json:"max_attempts"`
+	RunAt       time.Time  `gorm:"index" json:"run_at"`
+	LastError   string     `json:"last_error"`
+	Version     int        `json:"-"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// JobSchedule is when a recurring job next runs, shared by every replica so
+// only the one that claims a run enqueues it
+type JobSchedule struct {
+	Kind      string    `gorm:"primaryKey" json:"kind"`
+	NextRunAt time.Time `json:"next_run_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
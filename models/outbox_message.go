@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Outbox message statuses
+const (
+	OutboxPending    = "pending"
+	OutboxProcessing = "processing"
+	OutboxDone       = "done"
+	OutboxFailed     = "failed"
+)
+
+// OutboxMessage is a Square side effect recorded in the same transaction as
+// the local change it belongs to and executed afterwards by the dispatcher
+type OutboxMessage struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	Kind           string     `json:"kind"`
+	Payload        string     `json:"payload"`
+	IdempotencyKey string     `json:"idempotency_key"`
+	Status         string     `gorm:"index" json:"status"`
+	Attempts       int        `json:"attempts"`
+	LastError      string     `json:"last_error"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	Version        int        `json:"-"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
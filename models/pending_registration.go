@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// PendingRegistration holds a registration that must verify ownership of a
+// phone number already mapped to an in-store Square loyalty account
+type PendingRegistration struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Phone     string    `gorm:"index" json:"phone"`
+	AccountID string    `json:"account_id"`
+	CodeHash  string    `json:"-"`
+	Attempts  int       `json:"-"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// PhoneChange is a pending phone number change awaiting code verification
+type PhoneChange struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"index" json:"user_id"`
+	NewPhone  string    `json:"new_phone"`
+	CodeHash  string    `json:"-"`
+	Attempts  int       `json:"-"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
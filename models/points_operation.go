@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// Points operation kinds
+const (
+	PointsOperationEarn        = "earn"
+	PointsOperationRedeem      = "redeem"
+	PointsOperationApplyReward = "apply_reward" // an issued reward moved onto an order
+)
+
+// Points operation steps, in the order they are completed
+const (
+	StepStarted       = "started"
+	StepOrderCreated  = "order_created"
+	StepRewardDeleted = "reward_deleted"
+	StepRewardCreated = "reward_created"
+	StepPaid          = "paid"
+	StepAccumulated   = "accumulated" // points earned, the status bonus is still to be added
+	StepCompleted     = "completed"
+)
+
+// PointsOperation tracks a multi-step earn or redeem flow against Square so an
+// interrupted flow can resume from its last completed step
+type PointsOperation struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	Kind           string    `json:"kind"`
+	AccountID      string    `gorm:"index" json:"account_id"`
+	IdempotencyKey string    `gorm:"uniqueIndex" json:"idempotency_key"`
+	Amount         int       `json:"amount"`
+	Description    string    `json:"description"`
+	RewardTierID   string    `json:"reward_tier_id,omitempty"`
+	Step           string    `json:"step"`
+	OrderID        string    `json:"order_id,omitempty"`
+	RewardID       string    `json:"reward_id,omitempty"`
+	SourceRewardID string    `json:"source_reward_id,omitempty"`
+	PaymentID      string    `json:"payment_id,omitempty"`
+	RewardPoints   int       `json:"reward_points,omitempty"` // taken by the reward a redeem created
+	EarnedPoints   int       `json:"earned_points,omitempty"` // accumulated on the paid order
+	BonusPoints    int       `json:"bonus_points,omitempty"`
+	BonusReason    string    `json:"bonus_reason,omitempty"`
+	LastError      string    `json:"last_error,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
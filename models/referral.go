@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// Referral statuses. A pending referral becomes qualified with the referee's
+// first qualifying earn and rewarded once both bonuses are added.
+const (
+	ReferralPending   = "pending"
+	ReferralQualified = "qualified"
+	ReferralRewarded  = "rewarded"
+	ReferralRejected  = "rejected"
+	ReferralExpired   = "expired"
+)
+
+// ReferralCode is the code a customer shares to refer friends. DeviceHash is
+// the device they registered from, if the app sent one.
+type ReferralCode struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	UserID     uint      `gorm:"uniqueIndex" json:"user_id"`
+	Code       string    `gorm:"uniqueIndex" json:"code"`
+	DeviceHash string    `gorm:"index" json:"-"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Referral links a customer who registered with a referral code to the
+// customer whose code it was. The phone and device hashes outlive account
+// deletion so the same phone or device can't be referred twice.
+type Referral struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	ReferrerID     uint       `gorm:"index" json:"referrer_id"`
+	RefereeID      uint       `gorm:"uniqueIndex" json:"referee_id"`
+	Status         string     `gorm:"index" json:"status"`
+	RejectReason   string     `json:"reject_reason,omitempty"`
+	PhoneHash      string     `gorm:"index" json:"-"`
+	DeviceHash     string     `gorm:"index" json:"-"`
+	ReferrerPoints int        `json:"referrer_points"` // bonus added to the referrer, 0 until rewarded
+	RefereePoints  int        `json:"referee_points"`  // bonus added to the referee, 0 until rewarded
+	QualifiedAt    *time.Time `json:"qualified_at,omitempty"`
+	RewardedAt     *time.Time `json:"rewarded_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Statement formats
+const (
+	StatementCSV = "csv"
+	StatementPDF = "pdf"
+)
+
+// Statement statuses
+const (
+	StatementPending = "pending"
+	StatementReady   = "ready"
+	StatementFailed  = "failed"
+)
+
+// Statement is a points history export generated in the background, kept
+// until ExpiresAt for the customer to download
+type Statement struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"index" json:"-"`
+	AccountID string    `json:"-"`
+	Format    string    `json:"format"`
+	From      string    `json:"from,omitempty"` // as requested, a date or an RFC 3339 time
+	To        string    `json:"to,omitempty"`
+	Status    string    `json:"status"`
+	Filename  string    `json:"filename,omitempty"`
+	Content   []byte    `json:"-"`
+	LastError string    `json:"-"`
+	ExpiresAt time.Time `gorm:"index" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -1,9 +1,14 @@
 package models
 
+import "time"
+
 type User struct {
-	ID         uint   `gorm:"primaryKey" json:"id"`
-	Name       string `json:"name"`
-	Email      string `json:"email"`
-	Phone      string `json:"phone"`
-	CustomerID string `json:"customer_id"`
+	ID                  uint       `gorm:"primaryKey" json:"id"`
+	Name                string     `json:"name"`
+	Email               string     `json:"email"`
+	Phone               string     `json:"phone"`
+	CustomerID          string     `json:"customer_id"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+	AnonymizedAt        *time.Time `json:"anonymized_at,omitempty"`
+	TokensRevokedAt     *time.Time `json:"-"`
 }
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// WalletPass is a customer's loyalty pass, one per user shared by Apple Wallet
+// and Google Wallet. Content is what the pass last showed, as JSON, and
+// ContentUpdatedAt when that last changed, so wallets are only told about
+// real changes.
+type WalletPass struct {
+	ID               uint   `gorm:"primaryKey"`
+	UserID           uint   `gorm:"uniqueIndex"`
+	AccountID        string `gorm:"index"`
+	SerialNumber     string `gorm:"uniqueIndex"`
+	AuthToken        string // authenticates Apple devices to the pass web service
+	Content          string
+	ContentUpdatedAt time.Time  `gorm:"index"`
+	PushedAt         *time.Time // ContentUpdatedAt of the content wallets were last told about
+	GoogleIssuedAt   *time.Time // when a Google Wallet save link was first issued
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+// WalletRegistration is an Apple device asking to be pushed updates to a pass
+type WalletRegistration struct {
+	ID              uint   `gorm:"primaryKey"`
+	DeviceLibraryID string `gorm:"uniqueIndex:idx_wallet_registrations_device_pass"`
+	PassID          uint   `gorm:"uniqueIndex:idx_wallet_registrations_device_pass;index"`
+	PushToken       string
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rate describes a token bucket: Burst tokens that refill evenly over Period
+type Rate struct {
+	Burst  int
+	Period time.Duration
+}
+
+// Result is the outcome of taking a token from a bucket
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	ResetAfter time.Duration // time until the bucket is full again
+	RetryAfter time.Duration // time until the next token, zero when allowed
+}
+
+// Store is the pluggable backend holding bucket state, e.g. in memory or Redis
+type Store interface {
+	Take(key string, rate Rate) (Result, error)
+}
+
+// ParseRate parses a rate written as "<burst>/<period>", e.g. "10/1m"
+func ParseRate(raw string) (Rate, error) {
+	parts := strings.SplitN(raw, "/", 2)
+	if len(parts) != 2 {
+		return Rate{}, fmt.Errorf("invalid rate %q, expected <burst>/<period>", raw)
+	}
+
+	burst, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || burst <= 0 {
+		return Rate{}, fmt.Errorf("invalid burst in rate %q", raw)
+	}
+
+	period, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+	if err != nil || period <= 0 {
+		return Rate{}, fmt.Errorf("invalid period in rate %q", raw)
+	}
+
+	return Rate{Burst: burst, Period: period}, nil
+}
+
+// MustParseRate is ParseRate for rates that fall back to a known-good default
+func MustParseRate(raw, fallback string) Rate {
+	rate, err := ParseRate(raw)
+	if err == nil {
+		return rate
+	}
+	rate, err = ParseRate(fallback)
+	if err != nil {
+		panic(err)
+	}
+	return rate
+}
@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// LoginGuard locks an identifier out after repeated failed logins
+type LoginGuard interface {
+	LockedFor(key string) time.Duration
+	RecordFailure(key string) time.Duration
+	Reset(key string)
+}
+
+type attempts struct {
+	failures    int
+	firstFailed time.Time
+	lockedUntil time.Time
+}
+
+type memoryLoginGuard struct {
+	mu          sync.Mutex
+	attempts    map[string]*attempts
+	maxFailures int
+	window      time.Duration
+	lockout     time.Duration
+	lastSweep   time.Time
+	now         func() time.Time
+}
+
+// NewMemoryLoginGuard locks a key for lockout once maxFailures failures
+// happen within window. It panics if maxFailures is not positive.
+func NewMemoryLoginGuard(maxFailures int, window, lockout time.Duration) LoginGuard {
+	if maxFailures <= 0 {
+		panic(fmt.Sprintf("invalid login guard max failures %d", maxFailures))
+	}
+	return &memoryLoginGuard{
+		attempts:    make(map[string]*attempts),
+		maxFailures: maxFailures,
+		window:      window,
+		lockout:     lockout,
+		now:         time.Now,
+	}
+}
+
+// LockedFor returns how long the key remains locked, zero if it is not
+func (g *memoryLoginGuard) LockedFor(key string) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	a, ok := g.attempts[key]
+	if !ok {
+		return 0
+	}
+
+	remaining := a.lockedUntil.Sub(g.now())
+	if remaining <= 0 {
+		return 0
+	}
+	return remaining
+}
+
+// RecordFailure counts a failed attempt and returns the lockout it triggered, if any
+func (g *memoryLoginGuard) RecordFailure(key string) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	g.sweep(now)
+
+	a, ok := g.attempts[key]
+	if !ok {
+		a = &attempts{firstFailed: now}
+		g.attempts[key] = a
+	} else if now.Sub(a.firstFailed) > g.window {
+		a.failures = 0
+		a.firstFailed = now
+	}
+
+	a.failures++
+	if a.failures >= g.maxFailures {
+		a.lockedUntil = now.Add(g.lockout)
+		a.failures = 0
+		a.firstFailed = now
+		return g.lockout
+	}
+	return 0
+}
+
+// Reset clears the failure count after a successful login
+func (g *memoryLoginGuard) Reset(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.attempts, key)
+}
+
+// sweep drops keys whose failure window and lockout have both passed
+func (g *memoryLoginGuard) sweep(now time.Time) {
+	if now.Sub(g.lastSweep) < time.Minute {
+		return
+	}
+	g.lastSweep = now
+
+	for key, a := range g.attempts {
+		if now.Sub(a.firstFailed) > g.window && !now.Before(a.lockedUntil) {
+			delete(g.attempts, key)
+		}
+	}
+}
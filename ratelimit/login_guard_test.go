@@ -0,0 +1,128 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryLoginGuard(t *testing.T) {
+	type step struct {
+		after      time.Duration // clock advance before the action
+		action     string        // "fail", "reset" or "check"
+		key        string        // "a" when empty
+		wantLocked time.Duration // lockout returned by fail, or LockedFor after check
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "locks after the maximum failures",
+			steps: []step{
+				{action: "fail"},
+				{action: "fail"},
+				{action: "check"},
+				{action: "fail", wantLocked: 10 * time.Minute},
+				{action: "check", wantLocked: 10 * time.Minute},
+				{after: 4 * time.Minute, action: "check", wantLocked: 6 * time.Minute},
+				{after: 6 * time.Minute, action: "check"},
+			},
+		},
+		{
+			name: "failures outside the window start a new count",
+			steps: []step{
+				{action: "fail"},
+				{action: "fail"},
+				{after: 6 * time.Minute, action: "fail"},
+				{action: "fail"},
+				{action: "check"},
+				{action: "fail", wantLocked: 10 * time.Minute},
+			},
+		},
+		{
+			name: "a successful login resets the count",
+			steps: []step{
+				{action: "fail"},
+				{action: "fail"},
+				{action: "reset"},
+				{action: "fail"},
+				{action: "check"},
+			},
+		},
+		{
+			name: "keys are counted apart",
+			steps: []step{
+				{action: "fail"},
+				{action: "fail"},
+				{action: "fail", key: "b"},
+				{action: "check"},
+				{action: "check", key: "b"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock()
+			guard := NewMemoryLoginGuard(3, 5*time.Minute, 10*time.Minute).(*memoryLoginGuard)
+			guard.now = clock.Now
+
+			for i, step := range tt.steps {
+				clock.Advance(step.after)
+				key := step.key
+				if key == "" {
+					key = "a"
+				}
+
+				var got time.Duration
+				switch step.action {
+				case "fail":
+					got = guard.RecordFailure(key)
+				case "reset":
+					guard.Reset(key)
+					continue
+				case "check":
+					got = guard.LockedFor(key)
+				}
+				if got != step.wantLocked {
+					t.Errorf("step %d (%s %s): locked for %s, want %s", i, step.action, key, got, step.wantLocked)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryLoginGuardSweep(t *testing.T) {
+	clock := newFakeClock()
+	guard := NewMemoryLoginGuard(2, 5*time.Minute, 10*time.Minute).(*memoryLoginGuard)
+	guard.now = clock.Now
+
+	guard.RecordFailure("failed")
+	guard.RecordFailure("locked")
+	guard.RecordFailure("locked")
+
+	clock.Advance(6 * time.Minute)
+	guard.RecordFailure("recent")
+	if _, ok := guard.attempts["failed"]; ok {
+		t.Error("expired failure window not swept")
+	}
+	if _, ok := guard.attempts["locked"]; !ok {
+		t.Error("active lockout swept")
+	}
+
+	clock.Advance(5 * time.Minute)
+	guard.RecordFailure("recent")
+	if _, ok := guard.attempts["locked"]; ok {
+		t.Error("expired lockout not swept")
+	}
+}
+
+func TestNewMemoryLoginGuardRejectsZeroFailures(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic")
+		}
+	}()
+	NewMemoryLoginGuard(0, time.Minute, time.Minute)
+}
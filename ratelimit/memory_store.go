@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens   float64
+	lastSeen time.Time
+	period   time.Duration
+}
+
+type memoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryStore returns a Store keeping buckets in process memory.
+// It is suitable for a single replica only.
+func NewMemoryStore() Store {
+	return &memoryStore{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+func (s *memoryStore) Take(key string, rate Rate) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	perToken := rate.Period / time.Duration(rate.Burst)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rate.Burst), lastSeen: now, period: rate.Period}
+		s.buckets[key] = b
+	} else {
+		elapsed := now.Sub(b.lastSeen)
+		b.tokens = math.Min(float64(rate.Burst), b.tokens+float64(elapsed)/float64(perToken))
+		b.lastSeen = now
+	}
+
+	result := Result{Limit: rate.Burst}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - b.tokens) * float64(perToken))
+	}
+
+	result.Remaining = int(b.tokens)
+	result.ResetAfter = time.Duration((float64(rate.Burst) - b.tokens) * float64(perToken))
+
+	return result, nil
+}
+
+// sweep drops buckets that have been idle long enough to be full again
+func (s *memoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		if now.Sub(b.lastSeen) > b.period {
+			delete(s.buckets, key)
+		}
+	}
+}
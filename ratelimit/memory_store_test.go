@@ -0,0 +1,128 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a time source tests move by hand
+type fakeClock struct {
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestStore(clock *fakeClock) *memoryStore {
+	return &memoryStore{buckets: map[string]*bucket{}, now: clock.Now}
+}
+
+func TestMemoryStoreTake(t *testing.T) {
+	rate := Rate{Burst: 3, Period: 3 * time.Second} // a token a second
+
+	type step struct {
+		after      time.Duration // clock advance before taking
+		key        string        // "a" when empty
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "burst then refused",
+			steps: []step{
+				{allowed: true, remaining: 2},
+				{allowed: true, remaining: 1},
+				{allowed: true, remaining: 0},
+				{allowed: false, remaining: 0, retryAfter: time.Second},
+			},
+		},
+		{
+			name: "refills a token per interval",
+			steps: []step{
+				{allowed: true, remaining: 2},
+				{allowed: true, remaining: 1},
+				{allowed: true, remaining: 0},
+				{after: 500 * time.Millisecond, allowed: false, retryAfter: 500 * time.Millisecond},
+				{after: 500 * time.Millisecond, allowed: true, remaining: 0},
+			},
+		},
+		{
+			name: "keys have their own buckets",
+			steps: []step{
+				{allowed: true, remaining: 2},
+				{allowed: true, remaining: 1},
+				{allowed: true, remaining: 0},
+				{key: "b", allowed: true, remaining: 2},
+				{allowed: false, retryAfter: time.Second},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock()
+			store := newTestStore(clock)
+
+			for i, step := range tt.steps {
+				clock.Advance(step.after)
+				key := step.key
+				if key == "" {
+					key = "a"
+				}
+
+				result, err := store.Take(key, rate)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Allowed != step.allowed || result.Remaining != step.remaining || result.RetryAfter != step.retryAfter {
+					t.Errorf("step %d: got allowed=%v remaining=%d retryAfter=%s, want allowed=%v remaining=%d retryAfter=%s",
+						i, result.Allowed, result.Remaining, result.RetryAfter, step.allowed, step.remaining, step.retryAfter)
+				}
+				if result.Limit != rate.Burst {
+					t.Errorf("step %d: limit = %d", i, result.Limit)
+				}
+			}
+		})
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    Rate
+		wantErr bool
+	}{
+		{raw: "10/1m", want: Rate{Burst: 10, Period: time.Minute}},
+		{raw: " 5 / 10m ", want: Rate{Burst: 5, Period: 10 * time.Minute}},
+		{raw: "10", wantErr: true},
+		{raw: "0/1m", wantErr: true},
+		{raw: "x/1m", wantErr: true},
+		{raw: "10/0s", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := ParseRate(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("rate = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
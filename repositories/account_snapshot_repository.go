@@ -0,0 +1,50 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type AccountSnapshotRepository interface {
+	GetByAccountID(accountID string) (*models.AccountSnapshot, error)
+	SaveBalance(accountID string, balance int) error
+	SaveHistory(accountID string, history string) error
+}
+
+type accountSnapshotRepository struct {
+	db *gorm.DB
+}
+
+func NewAccountSnapshotRepository(db *gorm.DB) AccountSnapshotRepository {
+	return &accountSnapshotRepository{db: db}
+}
+
+func (r *accountSnapshotRepository) GetByAccountID(accountID string) (*models.AccountSnapshot, error) {
+	var snapshot models.AccountSnapshot
+	err := r.db.Where("account_id = ?", accountID).First(&snapshot).Error
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+func (r *accountSnapshotRepository) SaveBalance(accountID string, balance int) error {
+	now := time.Now()
+	return r.upsert(&models.AccountSnapshot{AccountID: accountID, Balance: balance, BalanceAt: &now}, "balance", "balance_at")
+}
+
+func (r *accountSnapshotRepository) SaveHistory(accountID string, history string) error {
+	now := time.Now()
+	return r.upsert(&models.AccountSnapshot{AccountID: accountID, History: history, HistoryAt: &now}, "history", "history_at")
+}
+
+// upsert writes only the given columns so balance and history refresh independently
+func (r *accountSnapshotRepository) upsert(snapshot *models.AccountSnapshot, columns ...string) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "account_id"}},
+		DoUpdates: clause.AssignmentColumns(append(columns, "updated_at")),
+	}).Create(snapshot).Error
+}
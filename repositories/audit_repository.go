@@ -0,0 +1,38 @@
+package repositories
+
+import (
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"gorm.io/gorm"
+)
+
+type AuditRepository interface {
+	Create(entry *models.AuditEntry) error
+	ListByUserID(userID uint) ([]models.AuditEntry, error)
+	ReassignUser(fromUserID, toUserID uint) error
+}
+
+type auditRepository struct {
+	db *gorm.DB
+}
+
+func NewAuditRepository(db *gorm.DB) AuditRepository {
+	return &auditRepository{db: db}
+}
+
+func (r *auditRepository) Create(entry *models.AuditEntry) error {
+	return r.db.Create(entry).Error
+}
+
+func (r *auditRepository) ListByUserID(userID uint) ([]models.AuditEntry, error) {
+	var entries []models.AuditEntry
+	err := r.db.Where("user_id = ?", userID).Order("id ASC").Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ReassignUser moves all entries of one user to another, used when merging duplicates
+func (r *auditRepository) ReassignUser(fromUserID, toUserID uint) error {
+	return r.db.Model(&models.AuditEntry{}).Where("user_id = ?", fromUserID).Update("user_id", toUserID).Error
+}
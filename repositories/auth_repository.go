@@ -1,25 +1,36 @@
 package repositories
 
 import (
-	"github.com/gimhanr9/go-loyalty-api/database"
+	"time"
+
 	"github.com/gimhanr9/go-loyalty-api/models"
+	"gorm.io/gorm"
 )
 
 type AuthRepository interface {
 	GetByEmailOrPhone(email, phone string) (*models.User, error)
 	GetByPhone(phone string) (*models.User, error)
+	GetByID(id uint) (*models.User, error)
+	GetByCustomerID(customerID string) (*models.User, error)
+	ListDueForDeletion(now time.Time) ([]models.User, error)
+	List() ([]models.User, error)
+	GetOtherByEmailOrPhone(id uint, email, phone string) (*models.User, error)
 	Create(user *models.User) error
+	Update(user *models.User) error
+	Delete(user *models.User) error
 }
 
-type authRepository struct{}
+type authRepository struct {
+	db *gorm.DB
+}
 
-func NewAuthRepository() AuthRepository {
-	return &authRepository{}
+func NewAuthRepository(db *gorm.DB) AuthRepository {
+	return &authRepository{db: db}
 }
 
 func (r *authRepository) GetByEmailOrPhone(email, phone string) (*models.User, error) {
 	var user models.User
-	err := database.DB.Where("email = ? OR phone = ?", email, phone).First(&user).Error
+	err := r.db.Where("email = ? OR phone = ?", email, phone).First(&user).Error
 	if err != nil {
 		return nil, err
 	}
@@ -28,13 +39,68 @@ func (r *authRepository) GetByEmailOrPhone(email, phone string) (*models.User, e
 
 func (r *authRepository) GetByPhone(phone string) (*models.User, error) {
 	var user models.User
-	err := database.DB.Where("phone = ?", phone).First(&user).Error
+	err := r.db.Where("phone = ?", phone).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *authRepository) GetByID(id uint) (*models.User, error) {
+	var user models.User
+	err := r.db.First(&user, id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
+func (r *authRepository) GetByCustomerID(customerID string) (*models.User, error) {
+	var user models.User
+	err := r.db.Where("customer_id = ?", customerID).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetOtherByEmailOrPhone finds a user other than id holding the email or phone
+func (r *authRepository) GetOtherByEmailOrPhone(id uint, email, phone string) (*models.User, error) {
+	var user models.User
+	err := r.db.Where("id <> ? AND (email = ? OR phone = ?)", id, email, phone).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ListDueForDeletion returns users whose deletion grace period has ended
+func (r *authRepository) ListDueForDeletion(now time.Time) ([]models.User, error) {
+	var users []models.User
+	err := r.db.Where("deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ? AND anonymized_at IS NULL", now).Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *authRepository) List() ([]models.User, error) {
+	var users []models.User
+	err := r.db.Order("id ASC").Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
 func (r *authRepository) Create(user *models.User) error {
-	return database.DB.Create(user).Error
+	return r.db.Create(user).Error
+}
+
+func (r *authRepository) Update(user *models.User) error {
+	return r.db.Save(user).Error
+}
+
+func (r *authRepository) Delete(user *models.User) error {
+	return r.db.Delete(user).Error
 }
@@ -0,0 +1,142 @@
+package repositories_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/gimhanr9/go-loyalty-api/database/dbtest"
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"github.com/gimhanr9/go-loyalty-api/repositories"
+)
+
+func TestAuthRepositoryLookups(t *testing.T) {
+	db := dbtest.Migrated(t)
+	repo := repositories.NewAuthRepository(db)
+
+	alice := &models.User{Name: "Alice", Email: "alice@example.com", Phone: "+14155550100", CustomerID: "acc1"}
+	bob := &models.User{Name: "Bob", Email: "bob@example.com", Phone: "+14155550101"}
+	for _, u := range []*models.User{alice, bob} {
+		if err := repo.Create(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		lookup func() (*models.User, error)
+		wantID uint // 0 for not found
+	}{
+		{"by email", func() (*models.User, error) { return repo.GetByEmailOrPhone("alice@example.com", "") }, alice.ID},
+		{"by phone", func() (*models.User, error) { return repo.GetByEmailOrPhone("", "+14155550101") }, bob.ID},
+		{"by email or phone, neither", func() (*models.User, error) { return repo.GetByEmailOrPhone("x@example.com", "+1") }, 0},
+		{"phone", func() (*models.User, error) { return repo.GetByPhone("+14155550100") }, alice.ID},
+		{"id", func() (*models.User, error) { return repo.GetByID(bob.ID) }, bob.ID},
+		{"customer ID", func() (*models.User, error) { return repo.GetByCustomerID("acc1") }, alice.ID},
+		{"unknown customer ID", func() (*models.User, error) { return repo.GetByCustomerID("acc9") }, 0},
+		{"other user with the email", func() (*models.User, error) { return repo.GetOtherByEmailOrPhone(bob.ID, "alice@example.com", "") }, alice.ID},
+		{"no other user with own email", func() (*models.User, error) { return repo.GetOtherByEmailOrPhone(alice.ID, "alice@example.com", "") }, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := tt.lookup()
+			if tt.wantID == 0 {
+				if !errors.Is(err, gorm.ErrRecordNotFound) {
+					t.Errorf("err = %v, want record not found", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.ID != tt.wantID {
+				t.Errorf("user = %d, want %d", user.ID, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestAuthRepositoryListDueForDeletion(t *testing.T) {
+	db := dbtest.Migrated(t)
+	repo := repositories.NewAuthRepository(db)
+
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	users := []*models.User{
+		{Email: "due@example.com", Phone: "+14155550100", DeletionScheduledAt: &past},
+		{Email: "later@example.com", Phone: "+14155550101", DeletionScheduledAt: &future},
+		{Email: "kept@example.com", Phone: "+14155550102"},
+		{Email: "gone@example.com", Phone: "+14155550103", DeletionScheduledAt: &past, AnonymizedAt: &past},
+	}
+	for _, u := range users {
+		if err := repo.Create(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	due, err := repo.ListDueForDeletion(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 1 || due[0].ID != users[0].ID {
+		t.Errorf("due = %v, want only user %d", due, users[0].ID)
+	}
+}
+
+func TestAuthRepositoryUpdateAndDelete(t *testing.T) {
+	db := dbtest.Migrated(t)
+	repo := repositories.NewAuthRepository(db)
+
+	user := &models.User{Email: "a@example.com", Phone: "+14155550100"}
+	other := &models.User{Email: "b@example.com", Phone: "+14155550101"}
+	for _, u := range []*models.User{user, other} {
+		if err := repo.Create(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	other.Phone = user.Phone
+	if err := repo.Update(other); err == nil {
+		t.Error("taking another user's phone should violate the unique index")
+	}
+
+	user.CustomerID = "acc1"
+	if err := repo.Update(user); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := repo.GetByCustomerID("acc1"); got == nil || got.ID != user.ID {
+		t.Errorf("customer ID not saved")
+	}
+
+	if err := repo.Delete(user); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetByID(user.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("deleted user still found: %v", err)
+	}
+}
+
+func TestAuditRepositoryReassignUser(t *testing.T) {
+	db := dbtest.Migrated(t)
+	repo := repositories.NewAuditRepository(db)
+
+	for _, entry := range []*models.AuditEntry{{UserID: 1, Action: "a"}, {UserID: 2, Action: "b"}, {UserID: 1, Action: "c"}} {
+		if err := repo.Create(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.ReassignUser(1, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := repo.ListByUserID(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[0].Action != "a" || entries[2].Action != "c" {
+		t.Errorf("entries = %+v, want a, b and c in order", entries)
+	}
+}
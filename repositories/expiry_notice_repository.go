@@ -0,0 +1,33 @@
+package repositories
+
+import (
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"gorm.io/gorm"
+)
+
+type ExpiryNoticeRepository interface {
+	GetByUserID(userID uint) (*models.ExpiryNotice, error)
+	Save(notice *models.ExpiryNotice) error
+}
+
+type expiryNoticeRepository struct {
+	db *gorm.DB
+}
+
+func NewExpiryNoticeRepository(db *gorm.DB) ExpiryNoticeRepository {
+	return &expiryNoticeRepository{db: db}
+}
+
+func (r *expiryNoticeRepository) GetByUserID(userID uint) (*models.ExpiryNotice, error) {
+	var notice models.ExpiryNotice
+	err := r.db.Where("user_id = ?", userID).First(&notice).Error
+	if err != nil {
+		return nil, err
+	}
+	return &notice, nil
+}
+
+// Save creates the notice on the first message and updates it afterwards
+func (r *expiryNoticeRepository) Save(notice *models.ExpiryNotice) error {
+	return r.db.Save(notice).Error
+}
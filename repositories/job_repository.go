@@ -0,0 +1,163 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrStaleJob is returned when a job was modified by someone else since it was read
+var ErrStaleJob = errors.New("job was modified concurrently")
+
+type JobRepository interface {
+	Create(job *models.Job) error
+	GetByID(id uint) (*models.Job, error)
+	GetActiveByUniqueKey(uniqueKey string) (*models.Job, error)
+	ListDue(now time.Time, staleBefore time.Time, kinds []string, limit int) ([]models.Job, error)
+	List(status, kind string, limit int) ([]models.Job, error)
+	Claim(job *models.Job) (bool, error)
+	Update(job *models.Job) error
+	Touch(id uint) error
+	ClaimScheduledRun(kind string, now, next time.Time) (bool, error)
+}
+
+type jobRepository struct {
+	db *gorm.DB
+}
+
+func NewJobRepository(db *gorm.DB) JobRepository {
+	return &jobRepository{db: db}
+}
+
+// Create inserts the job. A queued or running job already holding its unique
+// key makes it fail with a unique violation.
+func (r *jobRepository) Create(job *models.Job) error {
+	return r.db.Create(job).Error
+}
+
+func (r *jobRepository) GetByID(id uint) (*models.Job, error) {
+	var job models.Job
+	err := r.db.First(&job, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// GetActiveByUniqueKey finds a queued or running job holding the unique key
+func (r *jobRepository) GetActiveByUniqueKey(uniqueKey string) (*models.Job, error) {
+	var job models.Job
+	err := r.db.Where("unique_key = ? AND status IN ?", uniqueKey, []string{models.JobQueued, models.JobRunning}).First(&job).Error
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ListDue returns queued jobs of the given kinds whose run time has come, plus
+// running jobs not touched since staleBefore (their worker died)
+func (r *jobRepository) ListDue(now time.Time, staleBefore time.Time, kinds []string, limit int) ([]models.Job, error) {
+	var jobs []models.Job
+	err := r.db.
+		Where("kind IN ?", kinds).
+		Where("(status = ? AND run_at <= ?) OR (status = ? AND updated_at < ?)",
+			models.JobQueued, now, models.JobRunning, staleBefore).
+		Order("run_at ASC").
+		Limit(limit).
+		Find(&jobs).Error
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (r *jobRepository) List(status, kind string, limit int) ([]models.Job, error) {
+	var jobs []models.Job
+	query := r.db.Order("id DESC").Limit(limit)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	if err := query.Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// Claim marks the job as running if no other worker got to it first
+func (r *jobRepository) Claim(job *models.Job) (bool, error) {
+	now := time.Now()
+	result := r.db.Model(&models.Job{}).
+		Where("id = ? AND version = ?", job.ID, job.Version).
+		Updates(map[string]interface{}{
+			"status":     models.JobRunning,
+			"attempts":   job.Attempts + 1,
+			"version":    job.Version + 1,
+			"updated_at": now,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	job.Status = models.JobRunning
+	job.Attempts++
+	job.Version++
+	job.UpdatedAt = now
+	return true, nil
+}
+
+// Update saves the job only if it hasn't changed since it was read, so a
+// cancellation made while the job was running is not overwritten
+func (r *jobRepository) Update(job *models.Job) error {
+	result := r.db.Model(&models.Job{}).
+		Where("id = ? AND version = ?", job.ID, job.Version).
+		Updates(map[string]interface{}{
+			"status":      job.Status,
+			"attempts":    job.Attempts,
+			"run_at":      job.RunAt,
+			"last_error":  job.LastError,
+			"finished_at": job.FinishedAt,
+			"version":     job.Version + 1,
+			"updated_at":  time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrStaleJob
+	}
+	job.Version++
+	return nil
+}
+
+// Touch refreshes a running job's heartbeat so it isn't reclaimed as stale
+func (r *jobRepository) Touch(id uint) error {
+	return r.db.Model(&models.Job{}).Where("id = ? AND status = ?", id, models.JobRunning).Update("updated_at", time.Now()).Error
+}
+
+// ClaimScheduledRun takes the run of kind due by now and moves the next run to
+// next. It reports false when another replica took the run first. A schedule
+// seen for the first time is due now.
+func (r *jobRepository) ClaimScheduledRun(kind string, now, next time.Time) (bool, error) {
+	err := r.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.JobSchedule{Kind: kind, NextRunAt: now}).Error
+	if err != nil {
+		return false, err
+	}
+
+	result := r.db.Model(&models.JobSchedule{}).
+		Where("kind = ? AND next_run_at <= ?", kind, now).
+		Updates(map[string]interface{}{"next_run_at": next, "updated_at": now})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
@@ -0,0 +1,174 @@
+package repositories_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gimhanr9/go-loyalty-api/database/dbtest"
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"github.com/gimhanr9/go-loyalty-api/repositories"
+)
+
+func TestJobRepositoryListDue(t *testing.T) {
+	db := dbtest.Migrated(t)
+	repo := repositories.NewJobRepository(db)
+
+	now := time.Now()
+	jobs := map[string]*models.Job{
+		"due":           {Kind: "k", Status: models.JobQueued, RunAt: now.Add(-time.Minute)},
+		"not yet due":   {Kind: "k", Status: models.JobQueued, RunAt: now.Add(time.Minute)},
+		"other kind":    {Kind: "other", Status: models.JobQueued, RunAt: now.Add(-time.Minute)},
+		"running":       {Kind: "k", Status: models.JobRunning, RunAt: now.Add(-time.Hour)},
+		"stale running": {Kind: "k", Status: models.JobRunning, RunAt: now.Add(-time.Hour)},
+		"succeeded":     {Kind: "k", Status: models.JobSucceeded, RunAt: now.Add(-time.Minute)},
+	}
+	for _, job := range jobs {
+		if err := repo.Create(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The worker running this one stopped sending heartbeats
+	if err := db.Model(jobs["stale running"]).UpdateColumn("updated_at", now.Add(-time.Hour)).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	due, err := repo.ListDue(now, now.Add(-10*time.Minute), []string{"k"}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[uint]bool{}
+	for _, job := range due {
+		got[job.ID] = true
+	}
+	for name, job := range jobs {
+		want := name == "due" || name == "stale running"
+		if got[job.ID] != want {
+			t.Errorf("%s listed = %v, want %v", name, got[job.ID], want)
+		}
+	}
+}
+
+func TestJobRepositoryClaimAndUpdate(t *testing.T) {
+	tests := []struct {
+		name string
+		// act runs against two copies of the same freshly read job
+		act func(repo repositories.JobRepository, first, second *models.Job) error
+		// wantErr is the error of act's last step
+		wantErr    error
+		wantStatus string
+	}{
+		{
+			name: "second claim of the same read loses",
+			act: func(repo repositories.JobRepository, first, second *models.Job) error {
+				if ok, err := repo.Claim(first); !ok || err != nil {
+					return errors.New("first claim failed")
+				}
+				if ok, err := repo.Claim(second); ok || err != nil {
+					return errors.New("second claim succeeded")
+				}
+				return nil
+			},
+			wantStatus: models.JobRunning,
+		},
+		{
+			name: "result of a cancelled run is dropped",
+			act: func(repo repositories.JobRepository, worker, admin *models.Job) error {
+				repo.Claim(worker)
+				cancelled, _ := repo.GetByID(admin.ID)
+				cancelled.Status = models.JobCancelled
+				if err := repo.Update(cancelled); err != nil {
+					return err
+				}
+				worker.Status = models.JobSucceeded
+				return repo.Update(worker)
+			},
+			wantErr:    repositories.ErrStaleJob,
+			wantStatus: models.JobCancelled,
+		},
+		{
+			name: "a stale job can be reclaimed",
+			act: func(repo repositories.JobRepository, crashed, other *models.Job) error {
+				repo.Claim(crashed)
+				reread, _ := repo.GetByID(other.ID)
+				if ok, err := repo.Claim(reread); !ok || err != nil {
+					return errors.New("reclaim failed")
+				}
+				if reread.Attempts != 2 {
+					return errors.New("reclaim did not count an attempt")
+				}
+				return nil
+			},
+			wantStatus: models.JobRunning,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dbtest.Migrated(t)
+			repo := repositories.NewJobRepository(db)
+
+			job := &models.Job{Kind: "k", Status: models.JobQueued, MaxAttempts: 3, RunAt: time.Now()}
+			if err := repo.Create(job); err != nil {
+				t.Fatal(err)
+			}
+			first, second := *job, *job
+
+			if err := tt.act(repo, &first, &second); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			stored, err := repo.GetByID(job.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", stored.Status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestJobRepositoryTouch(t *testing.T) {
+	db := dbtest.Migrated(t)
+	repo := repositories.NewJobRepository(db)
+
+	old := time.Now().Add(-time.Hour)
+	running := &models.Job{Kind: "k", Status: models.JobRunning, RunAt: old}
+	finished := &models.Job{Kind: "k", Status: models.JobSucceeded, RunAt: old}
+	for _, job := range []*models.Job{running, finished} {
+		repo.Create(job)
+		db.Model(job).UpdateColumn("updated_at", old)
+		if err := repo.Touch(job.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if job, _ := repo.GetByID(running.ID); !job.UpdatedAt.After(old.Add(time.Minute)) {
+		t.Errorf("running job not touched, updated_at %s", job.UpdatedAt)
+	}
+	if job, _ := repo.GetByID(finished.ID); job.UpdatedAt.After(old.Add(time.Minute)) {
+		t.Errorf("finished job touched, updated_at %s", job.UpdatedAt)
+	}
+}
+
+func TestJobRepositoryActiveUniqueKey(t *testing.T) {
+	db := dbtest.Migrated(t)
+	repo := repositories.NewJobRepository(db)
+
+	first := &models.Job{Kind: "k", UniqueKey: "key", Status: models.JobQueued, RunAt: time.Now()}
+	if err := repo.Create(first); err != nil {
+		t.Fatal(err)
+	}
+	err := repo.Create(&models.Job{Kind: "k", UniqueKey: "key", Status: models.JobQueued, RunAt: time.Now()})
+	if !repositories.IsUniqueViolation(err) {
+		t.Fatalf("second active job: err = %v, want a unique violation", err)
+	}
+
+	first.Status = models.JobSucceeded
+	if err := repo.Update(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Create(&models.Job{Kind: "k", UniqueKey: "key", Status: models.JobQueued, RunAt: time.Now()}); err != nil {
+		t.Errorf("key held by a finished job: %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"gorm.io/gorm"
+)
+
+type OutboxRepository interface {
+	Create(msg *models.OutboxMessage) error
+	GetByID(id uint) (*models.OutboxMessage, error)
+	ListDue(now time.Time, staleBefore time.Time, limit int) ([]models.OutboxMessage, error)
+	List(status string, limit int) ([]models.OutboxMessage, error)
+	Claim(msg *models.OutboxMessage) (bool, error)
+	Update(msg *models.OutboxMessage) error
+}
+
+type outboxRepository struct {
+	db *gorm.DB
+}
+
+func NewOutboxRepository(db *gorm.DB) OutboxRepository {
+	return &outboxRepository{db: db}
+}
+
+func (r *outboxRepository) Create(msg *models.OutboxMessage) error {
+	return r.db.Create(msg).Error
+}
+
+func (r *outboxRepository) GetByID(id uint) (*models.OutboxMessage, error) {
+	var msg models.OutboxMessage
+	err := r.db.First(&msg, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// ListDue returns pending messages whose next attempt is due, plus messages
+// stuck in processing since before staleBefore (e.g. after a crash)
+func (r *outboxRepository) ListDue(now time.Time, staleBefore time.Time, limit int) ([]models.OutboxMessage, error) {
+	var msgs []models.OutboxMessage
+	err := r.db.
+		Where("(status = ? AND next_attempt_at <= ?) OR (status = ? AND updated_at < ?)",
+			models.OutboxPending, now, models.OutboxProcessing, staleBefore).
+		Order("id ASC").
+		Limit(limit).
+		Find(&msgs).Error
+	if err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
+
+func (r *outboxRepository) List(status string, limit int) ([]models.OutboxMessage, error) {
+	var msgs []models.OutboxMessage
+	query := r.db.Order("id DESC").Limit(limit)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Find(&msgs).Error; err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
+
+// Claim marks the message as processing if no other dispatcher got to it first
+func (r *outboxRepository) Claim(msg *models.OutboxMessage) (bool, error) {
+	now := time.Now()
+	result := r.db.Model(&models.OutboxMessage{}).
+		Where("id = ? AND version = ?", msg.ID, msg.Version).
+		Updates(map[string]interface{}{
+			"status":     models.OutboxProcessing,
+			"attempts":   msg.Attempts + 1,
+			"version":    msg.Version + 1,
+			"updated_at": now,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	msg.Status = models.OutboxProcessing
+	msg.Attempts++
+	msg.Version++
+	msg.UpdatedAt = now
+	return true, nil
+}
+
+func (r *outboxRepository) Update(msg *models.OutboxMessage) error {
+	return r.db.Save(msg).Error
+}
@@ -0,0 +1,77 @@
+package repositories_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gimhanr9/go-loyalty-api/database/dbtest"
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"github.com/gimhanr9/go-loyalty-api/repositories"
+)
+
+func TestOutboxRepositoryListDue(t *testing.T) {
+	db := dbtest.Migrated(t)
+	repo := repositories.NewOutboxRepository(db)
+
+	now := time.Now()
+	messages := map[string]*models.OutboxMessage{
+		"due":              {Kind: "k", Status: models.OutboxPending, NextAttemptAt: now.Add(-time.Minute)},
+		"not yet due":      {Kind: "k", Status: models.OutboxPending, NextAttemptAt: now.Add(time.Minute)},
+		"done":             {Kind: "k", Status: models.OutboxDone, NextAttemptAt: now.Add(-time.Minute)},
+		"stale processing": {Kind: "k", Status: models.OutboxProcessing, NextAttemptAt: now},
+		"processing":       {Kind: "k", Status: models.OutboxProcessing, NextAttemptAt: now},
+	}
+	for _, msg := range messages {
+		if err := repo.Create(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The dispatcher that claimed this one stopped touching it
+	if err := db.Model(messages["stale processing"]).UpdateColumn("updated_at", now.Add(-time.Hour)).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	due, err := repo.ListDue(now, now.Add(-10*time.Minute), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[uint]bool{}
+	for _, msg := range due {
+		got[msg.ID] = true
+	}
+	for name, msg := range messages {
+		want := name == "due" || name == "stale processing"
+		if got[msg.ID] != want {
+			t.Errorf("%s listed = %v, want %v", name, got[msg.ID], want)
+		}
+	}
+}
+
+func TestOutboxRepositoryClaim(t *testing.T) {
+	db := dbtest.Migrated(t)
+	repo := repositories.NewOutboxRepository(db)
+
+	msg := &models.OutboxMessage{Kind: "k", Status: models.OutboxPending, NextAttemptAt: time.Now()}
+	if err := repo.Create(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two dispatchers read the same row, only the first claim wins
+	first, second := *msg, *msg
+	claimed, err := repo.Claim(&first)
+	if err != nil || !claimed {
+		t.Fatalf("first claim = %v, %v", claimed, err)
+	}
+	claimed, err = repo.Claim(&second)
+	if err != nil || claimed {
+		t.Fatalf("second claim = %v, %v, want false", claimed, err)
+	}
+
+	stored, err := repo.GetByID(msg.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != models.OutboxProcessing || stored.Attempts != 1 || stored.Version != first.Version {
+		t.Errorf("stored = %+v", stored)
+	}
+}
@@ -0,0 +1,42 @@
+package repositories
+
+import (
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"gorm.io/gorm"
+)
+
+type PendingRegistrationRepository interface {
+	GetLatestByPhone(phone string) (*models.PendingRegistration, error)
+	Create(pending *models.PendingRegistration) error
+	Update(pending *models.PendingRegistration) error
+	DeleteByPhone(phone string) error
+}
+
+type pendingRegistrationRepository struct {
+	db *gorm.DB
+}
+
+func NewPendingRegistrationRepository(db *gorm.DB) PendingRegistrationRepository {
+	return &pendingRegistrationRepository{db: db}
+}
+
+func (r *pendingRegistrationRepository) GetLatestByPhone(phone string) (*models.PendingRegistration, error) {
+	var pending models.PendingRegistration
+	err := r.db.Where("phone = ?", phone).Order("id DESC").First(&pending).Error
+	if err != nil {
+		return nil, err
+	}
+	return &pending, nil
+}
+
+func (r *pendingRegistrationRepository) Create(pending *models.PendingRegistration) error {
+	return r.db.Create(pending).Error
+}
+
+func (r *pendingRegistrationRepository) Update(pending *models.PendingRegistration) error {
+	return r.db.Save(pending).Error
+}
+
+func (r *pendingRegistrationRepository) DeleteByPhone(phone string) error {
+	return r.db.Where("phone = ?", phone).Delete(&models.PendingRegistration{}).Error
+}
@@ -0,0 +1,42 @@
+package repositories
+
+import (
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"gorm.io/gorm"
+)
+
+type PhoneChangeRepository interface {
+	GetLatestByUserID(userID uint) (*models.PhoneChange, error)
+	Create(change *models.PhoneChange) error
+	Update(change *models.PhoneChange) error
+	DeleteByUserID(userID uint) error
+}
+
+type phoneChangeRepository struct {
+	db *gorm.DB
+}
+
+func NewPhoneChangeRepository(db *gorm.DB) PhoneChangeRepository {
+	return &phoneChangeRepository{db: db}
+}
+
+func (r *phoneChangeRepository) GetLatestByUserID(userID uint) (*models.PhoneChange, error) {
+	var change models.PhoneChange
+	err := r.db.Where("user_id = ?", userID).Order("id DESC").First(&change).Error
+	if err != nil {
+		return nil, err
+	}
+	return &change, nil
+}
+
+func (r *phoneChangeRepository) Create(change *models.PhoneChange) error {
+	return r.db.Create(change).Error
+}
+
+func (r *phoneChangeRepository) Update(change *models.PhoneChange) error {
+	return r.db.Save(change).Error
+}
+
+func (r *phoneChangeRepository) DeleteByUserID(userID uint) error {
+	return r.db.Where("user_id = ?", userID).Delete(&models.PhoneChange{}).Error
+}
@@ -0,0 +1,77 @@
+package repositories
+
+import (
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"gorm.io/gorm"
+)
+
+type PointsOperationRepository interface {
+	GetByID(id uint) (*models.PointsOperation, error)
+	GetByIdempotencyKey(key string) (*models.PointsOperation, error)
+	Create(op *models.PointsOperation) error
+	Update(op *models.PointsOperation) error
+	ListByOrderOrRewardIDs(orderIDs, rewardIDs []string) ([]models.PointsOperation, error)
+	ListByAccountID(accountID string, kinds []string) ([]models.PointsOperation, error)
+}
+
+type pointsOperationRepository struct {
+	db *gorm.DB
+}
+
+func NewPointsOperationRepository(db *gorm.DB) PointsOperationRepository {
+	return &pointsOperationRepository{db: db}
+}
+
+func (r *pointsOperationRepository) GetByID(id uint) (*models.PointsOperation, error) {
+	var op models.PointsOperation
+	err := r.db.First(&op, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &op, nil
+}
+
+func (r *pointsOperationRepository) GetByIdempotencyKey(key string) (*models.PointsOperation, error) {
+	var op models.PointsOperation
+	err := r.db.Where("idempotency_key = ?", key).First(&op).Error
+	if err != nil {
+		return nil, err
+	}
+	return &op, nil
+}
+
+func (r *pointsOperationRepository) Create(op *models.PointsOperation) error {
+	return r.db.Create(op).Error
+}
+
+func (r *pointsOperationRepository) Update(op *models.PointsOperation) error {
+	return r.db.Save(op).Error
+}
+
+// ListByOrderOrRewardIDs returns the operations that created any of the orders or rewards
+func (r *pointsOperationRepository) ListByOrderOrRewardIDs(orderIDs, rewardIDs []string) ([]models.PointsOperation, error) {
+	var ops []models.PointsOperation
+	if len(orderIDs) == 0 && len(rewardIDs) == 0 {
+		return ops, nil
+	}
+
+	query := r.db.Where("1 = 0")
+	if len(orderIDs) > 0 {
+		query = query.Or("order_id IN ?", orderIDs)
+	}
+	if len(rewardIDs) > 0 {
+		query = query.Or("reward_id IN ?", rewardIDs)
+	}
+
+	err := query.Find(&ops).Error
+	return ops, err
+}
+
+// ListByAccountID returns the account's operations of the kinds, newest first
+func (r *pointsOperationRepository) ListByAccountID(accountID string, kinds []string) ([]models.PointsOperation, error) {
+	var ops []models.PointsOperation
+	err := r.db.Where("account_id = ? AND kind IN ?", accountID, kinds).
+		Order("updated_at DESC, id DESC").
+		Find(&ops).Error
+	return ops, err
+}
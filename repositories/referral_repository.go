@@ -0,0 +1,120 @@
+package repositories
+
+import (
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"gorm.io/gorm"
+)
+
+type ReferralRepository interface {
+	GetCodeByUserID(userID uint) (*models.ReferralCode, error)
+	GetCode(code string) (*models.ReferralCode, error)
+	CreateCode(code *models.ReferralCode) error
+
+	GetByID(id uint) (*models.Referral, error)
+	GetByRefereeID(refereeID uint) (*models.Referral, error)
+	ListByReferrer(referrerID uint) ([]models.Referral, error)
+	ListOpen() ([]models.Referral, error)
+	CountTowardsCap(referrerID uint) (int64, error)
+	PhoneReferred(phoneHash string) (bool, error)
+	DeviceReferred(deviceHash string) (bool, error)
+	Create(referral *models.Referral) error
+	Update(referral *models.Referral) error
+}
+
+type referralRepository struct {
+	db *gorm.DB
+}
+
+func NewReferralRepository(db *gorm.DB) ReferralRepository {
+	return &referralRepository{db: db}
+}
+
+func (r *referralRepository) GetCodeByUserID(userID uint) (*models.ReferralCode, error) {
+	var code models.ReferralCode
+	err := r.db.Where("user_id = ?", userID).First(&code).Error
+	if err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+func (r *referralRepository) GetCode(code string) (*models.ReferralCode, error) {
+	var referralCode models.ReferralCode
+	err := r.db.Where("code = ?", code).First(&referralCode).Error
+	if err != nil {
+		return nil, err
+	}
+	return &referralCode, nil
+}
+
+// CreateCode runs in a savepoint when called inside a transaction, so a
+// unique violation leaves the transaction usable and the caller can retry
+func (r *referralRepository) CreateCode(code *models.ReferralCode) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return tx.Create(code).Error
+	})
+}
+
+func (r *referralRepository) GetByID(id uint) (*models.Referral, error) {
+	var referral models.Referral
+	err := r.db.First(&referral, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &referral, nil
+}
+
+func (r *referralRepository) GetByRefereeID(refereeID uint) (*models.Referral, error) {
+	var referral models.Referral
+	err := r.db.Where("referee_id = ?", refereeID).First(&referral).Error
+	if err != nil {
+		return nil, err
+	}
+	return &referral, nil
+}
+
+// ListByReferrer returns the customer's referrals, newest first
+func (r *referralRepository) ListByReferrer(referrerID uint) ([]models.Referral, error) {
+	var referrals []models.Referral
+	err := r.db.Where("referrer_id = ?", referrerID).Order("created_at DESC, id DESC").Find(&referrals).Error
+	return referrals, err
+}
+
+// ListOpen returns the referrals still waiting to qualify or to be rewarded
+func (r *referralRepository) ListOpen() ([]models.Referral, error) {
+	var referrals []models.Referral
+	err := r.db.Where("status IN ?", []string{models.ReferralPending, models.ReferralQualified}).Order("id").Find(&referrals).Error
+	return referrals, err
+}
+
+// CountTowardsCap counts the referrer's referrals that were not
+// rejected or left to expire
+func (r *referralRepository) CountTowardsCap(referrerID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Referral{}).
+		Where("referrer_id = ? AND status NOT IN ?", referrerID, []string{models.ReferralRejected, models.ReferralExpired}).
+		Count(&count).Error
+	return count, err
+}
+
+// PhoneReferred reports whether any referral, whatever its status, was for the phone
+func (r *referralRepository) PhoneReferred(phoneHash string) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.Referral{}).Where("phone_hash = ?", phoneHash).Count(&count).Error
+	return count > 0, err
+}
+
+// DeviceReferred reports whether any referral, whatever its status, came from the device
+func (r *referralRepository) DeviceReferred(deviceHash string) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.Referral{}).Where("device_hash = ?", deviceHash).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *referralRepository) Create(referral *models.Referral) error {
+	return r.db.Create(referral).Error
+}
+
+func (r *referralRepository) Update(referral *models.Referral) error {
+	return r.db.Save(referral).Error
+}
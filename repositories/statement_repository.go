@@ -0,0 +1,46 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"gorm.io/gorm"
+)
+
+type StatementRepository interface {
+	GetByID(id uint) (*models.Statement, error)
+	Create(statement *models.Statement) error
+	Update(statement *models.Statement) error
+	DeleteExpired(now time.Time) (int64, error)
+}
+
+type statementRepository struct {
+	db *gorm.DB
+}
+
+func NewStatementRepository(db *gorm.DB) StatementRepository {
+	return &statementRepository{db: db}
+}
+
+func (r *statementRepository) GetByID(id uint) (*models.Statement, error) {
+	var statement models.Statement
+	err := r.db.First(&statement, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &statement, nil
+}
+
+func (r *statementRepository) Create(statement *models.Statement) error {
+	return r.db.Create(statement).Error
+}
+
+func (r *statementRepository) Update(statement *models.Statement) error {
+	return r.db.Save(statement).Error
+}
+
+// DeleteExpired removes statements past their retention, returning how many were removed
+func (r *statementRepository) DeleteExpired(now time.Time) (int64, error) {
+	result := r.db.Where("expires_at < ?", now).Delete(&models.Statement{})
+	return result.RowsAffected, result.Error
+}
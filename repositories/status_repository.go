@@ -0,0 +1,47 @@
+package repositories
+
+import (
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"gorm.io/gorm"
+)
+
+type StatusRepository interface {
+	GetByUserID(userID uint) (*models.CustomerStatus, error)
+	GetByAccountID(accountID string) (*models.CustomerStatus, error)
+	Save(status *models.CustomerStatus) error
+	DeleteByUserID(userID uint) error
+}
+
+type statusRepository struct {
+	db *gorm.DB
+}
+
+func NewStatusRepository(db *gorm.DB) StatusRepository {
+	return &statusRepository{db: db}
+}
+
+func (r *statusRepository) GetByUserID(userID uint) (*models.CustomerStatus, error) {
+	return r.getWhere("user_id = ?", userID)
+}
+
+func (r *statusRepository) GetByAccountID(accountID string) (*models.CustomerStatus, error) {
+	return r.getWhere("account_id = ?", accountID)
+}
+
+func (r *statusRepository) getWhere(query string, args ...interface{}) (*models.CustomerStatus, error) {
+	var status models.CustomerStatus
+	err := r.db.Where(query, args...).First(&status).Error
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Save creates the status on first evaluation and updates it afterwards
+func (r *statusRepository) Save(status *models.CustomerStatus) error {
+	return r.db.Save(status).Error
+}
+
+func (r *statusRepository) DeleteByUserID(userID uint) error {
+	return r.db.Where("user_id = ?", userID).Delete(&models.CustomerStatus{}).Error
+}
@@ -0,0 +1,35 @@
+package repositories
+
+import "gorm.io/gorm"
+
+// TxRepositories are repositories bound to a single database transaction
+type TxRepositories struct {
+	Users     AuthRepository
+	Audit     AuditRepository
+	Outbox    OutboxRepository
+	Referrals ReferralRepository
+}
+
+// Transactor runs work atomically across repositories
+type Transactor interface {
+	WithinTransaction(fn func(repos TxRepositories) error) error
+}
+
+type transactor struct {
+	db *gorm.DB
+}
+
+func NewTransactor(db *gorm.DB) Transactor {
+	return &transactor{db: db}
+}
+
+func (t *transactor) WithinTransaction(fn func(repos TxRepositories) error) error {
+	return t.db.Transaction(func(tx *gorm.DB) error {
+		return fn(TxRepositories{
+			Users:     NewAuthRepository(tx),
+			Audit:     NewAuditRepository(tx),
+			Outbox:    NewOutboxRepository(tx),
+			Referrals: NewReferralRepository(tx),
+		})
+	})
+}
@@ -0,0 +1,117 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"gorm.io/gorm"
+)
+
+type WalletRepository interface {
+	GetByID(id uint) (*models.WalletPass, error)
+	GetByUserID(userID uint) (*models.WalletPass, error)
+	GetBySerialNumber(serialNumber string) (*models.WalletPass, error)
+	GetByAccountID(accountID string) (*models.WalletPass, error)
+	Create(pass *models.WalletPass) error
+	Update(pass *models.WalletPass) error
+	ListInWallets() ([]uint, error)
+	ListUpdatedForDevice(deviceLibraryID string, since time.Time) ([]models.WalletPass, error)
+	Register(registration *models.WalletRegistration) (bool, error)
+	Unregister(deviceLibraryID string, passID uint) error
+	ListRegistrations(passID uint) ([]models.WalletRegistration, error)
+	DeleteRegistration(id uint) error
+}
+
+type walletRepository struct {
+	db *gorm.DB
+}
+
+func NewWalletRepository(db *gorm.DB) WalletRepository {
+	return &walletRepository{db: db}
+}
+
+func (r *walletRepository) GetByID(id uint) (*models.WalletPass, error) {
+	return r.getWhere("id = ?", id)
+}
+
+func (r *walletRepository) GetByUserID(userID uint) (*models.WalletPass, error) {
+	return r.getWhere("user_id = ?", userID)
+}
+
+func (r *walletRepository) GetBySerialNumber(serialNumber string) (*models.WalletPass, error) {
+	return r.getWhere("serial_number = ?", serialNumber)
+}
+
+func (r *walletRepository) GetByAccountID(accountID string) (*models.WalletPass, error) {
+	return r.getWhere("account_id = ?", accountID)
+}
+
+func (r *walletRepository) getWhere(query string, args ...interface{}) (*models.WalletPass, error) {
+	var pass models.WalletPass
+	err := r.db.Where(query, args...).First(&pass).Error
+	if err != nil {
+		return nil, err
+	}
+	return &pass, nil
+}
+
+func (r *walletRepository) Create(pass *models.WalletPass) error {
+	return r.db.Create(pass).Error
+}
+
+func (r *walletRepository) Update(pass *models.WalletPass) error {
+	return r.db.Save(pass).Error
+}
+
+// ListInWallets returns the passes a device is registered for or that may have
+// been saved to Google Wallet, the ones worth keeping up to date
+func (r *walletRepository) ListInWallets() ([]uint, error) {
+	var ids []uint
+	err := r.db.Model(&models.WalletPass{}).
+		Where("google_issued_at IS NOT NULL OR id IN (?)", r.db.Model(&models.WalletRegistration{}).Select("pass_id")).
+		Order("id").
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+// ListUpdatedForDevice returns the passes registered on the device whose content changed after since
+func (r *walletRepository) ListUpdatedForDevice(deviceLibraryID string, since time.Time) ([]models.WalletPass, error) {
+	var passes []models.WalletPass
+	err := r.db.
+		Joins("JOIN wallet_registrations ON wallet_registrations.pass_id = wallet_passes.id").
+		Where("wallet_registrations.device_library_id = ? AND wallet_passes.content_updated_at > ?", deviceLibraryID, since).
+		Order("wallet_passes.id").
+		Find(&passes).Error
+	return passes, err
+}
+
+// Register records the device's push token for the pass, reporting whether
+// the registration is new
+func (r *walletRepository) Register(registration *models.WalletRegistration) (bool, error) {
+	var existing models.WalletRegistration
+	err := r.db.Where("device_library_id = ? AND pass_id = ?", registration.DeviceLibraryID, registration.PassID).First(&existing).Error
+	if err == nil {
+		existing.PushToken = registration.PushToken
+		*registration = existing
+		return false, r.db.Save(registration).Error
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, err
+	}
+	return true, r.db.Create(registration).Error
+}
+
+func (r *walletRepository) Unregister(deviceLibraryID string, passID uint) error {
+	return r.db.Where("device_library_id = ? AND pass_id = ?", deviceLibraryID, passID).Delete(&models.WalletRegistration{}).Error
+}
+
+func (r *walletRepository) ListRegistrations(passID uint) ([]models.WalletRegistration, error) {
+	var registrations []models.WalletRegistration
+	err := r.db.Where("pass_id = ?", passID).Order("id").Find(&registrations).Error
+	return registrations, err
+}
+
+func (r *walletRepository) DeleteRegistration(id uint) error {
+	return r.db.Delete(&models.WalletRegistration{}, id).Error
+}
@@ -0,0 +1,47 @@
+package routes_test
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/gimhanr9/go-loyalty-api/app"
+	"github.com/gimhanr9/go-loyalty-api/database/dbtest"
+	"github.com/gimhanr9/go-loyalty-api/docs"
+	"github.com/gimhanr9/go-loyalty-api/routes"
+)
+
+// Every registered route, including the unversioned aliases, is described in
+// docs/openapi.json, and every operation it describes is served
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("ADMIN_API_KEY", "test-admin-key")
+
+	container, err := app.NewContainer(dbtest.Migrated(t))
+	if err != nil {
+		t.Fatalf("NewContainer: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	routes.RegisterRoutes(router, container)
+	if len(router.Routes()) == 0 {
+		t.Fatal("no routes registered")
+	}
+
+	missing, err := docs.MissingRoutes(router.Routes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) > 0 {
+		t.Errorf("routes missing from docs/openapi.json: %v", missing)
+	}
+
+	unserved, err := docs.UnservedOperations(router.Routes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unserved) > 0 {
+		t.Errorf("operations in docs/openapi.json with no route: %v", unserved)
+	}
+}
@@ -1,26 +1,110 @@
 package routes
 
 import (
-	"github.com/gimhanr9/go-loyalty-api/controllers"
+	"time"
+
+	"github.com/gimhanr9/go-loyalty-api/app"
+	"github.com/gimhanr9/go-loyalty-api/config"
+	"github.com/gimhanr9/go-loyalty-api/docs"
 	"github.com/gimhanr9/go-loyalty-api/middleware"
+	"github.com/gimhanr9/go-loyalty-api/ratelimit"
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterRoutes(router *gin.Engine) {
+// guards are the auth and throttling middlewares shared by every API version,
+// so a client can't double its limits by mixing versions
+type guards struct {
+	requireAuth      gin.HandlerFunc
+	authByIP         gin.HandlerFunc
+	authByPhone      gin.HandlerFunc
+	loginLockout     gin.HandlerFunc
+	pointsByCustomer gin.HandlerFunc
+	verifyByCustomer gin.HandlerFunc
+	exportByCustomer gin.HandlerFunc
+	walletByIP       gin.HandlerFunc
+}
+
+func newGuards(container *app.Container) guards {
+	limiter := ratelimit.NewMemoryStore()
+	loginGuard := ratelimit.NewMemoryLoginGuard(
+		config.GetEnvInt("LOGIN_MAX_FAILURES", 5),
+		config.GetEnvDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+		config.GetEnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+	)
+
+	return guards{
+		requireAuth: middleware.AuthMiddleware(container.AuthRepository),
+		authByIP: middleware.RateLimitMiddleware(limiter, "auth",
+			ratelimit.MustParseRate(config.GetEnv("RATE_LIMIT_AUTH_IP", ""), "20/1m"), middleware.KeyByIP),
+		authByPhone: middleware.RateLimitMiddleware(limiter, "auth",
+			ratelimit.MustParseRate(config.GetEnv("RATE_LIMIT_AUTH_PHONE", ""), "5/1m"), middleware.KeyByPhone),
+		loginLockout: middleware.LoginLockoutMiddleware(loginGuard),
+		pointsByCustomer: middleware.RateLimitMiddleware(limiter, "points",
+			ratelimit.MustParseRate(config.GetEnv("RATE_LIMIT_POINTS_CUSTOMER", ""), "10/1m"), middleware.KeyByCustomerID),
+		verifyByCustomer: middleware.RateLimitMiddleware(limiter, "verify",
+			ratelimit.MustParseRate(config.GetEnv("RATE_LIMIT_VERIFY_CUSTOMER", ""), "5/10m"), middleware.KeyByCustomerID),
+		exportByCustomer: middleware.RateLimitMiddleware(limiter, "export",
+			ratelimit.MustParseRate(config.GetEnv("RATE_LIMIT_EXPORT_CUSTOMER", ""), "10/1h"), middleware.KeyByCustomerID),
+		walletByIP: middleware.RateLimitMiddleware(limiter, "wallet",
+			ratelimit.MustParseRate(config.GetEnv("RATE_LIMIT_WALLET_IP", ""), "120/1m"), middleware.KeyByIP),
+	}
+}
+
+func RegisterRoutes(router *gin.Engine, container *app.Container) {
 	api := router.Group("/api")
+	g := newGuards(container)
+
+	// Documentation
+	api.GET("/openapi.json", docs.Spec)
+	api.GET("/docs", docs.UI)
+	api.GET("/docs/assets/:file", docs.Asset)
+
+	// v1 is deprecated, the unversioned paths shipped apps call are kept as an alias
+	v1Deprecation := middleware.DeprecationMiddleware(
+		config.GetEnvDate("API_V1_DEPRECATED_AT", time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)),
+		config.GetEnvDate("API_V1_SUNSET", time.Date(2027, 5, 1, 0, 0, 0, 0, time.UTC)),
+		"/api/docs",
+	)
+	v1Usage := middleware.APIVersionMiddleware(container.APIUsage, "v1")
+	registerV1(api.Group("", v1Usage, v1Deprecation), container, g)
+	registerV1(api.Group("/v1", v1Usage, v1Deprecation), container, g)
+
+	registerV2(api.Group("/v2", middleware.APIVersionMiddleware(container.APIUsage, "v2")), container, g)
+
+	// Staff, for in-store terminals
+	staff := api.Group("/staff")
+	staff.Use(middleware.StaffMiddleware())
+	{
+		staff.POST("/cards/resolve", container.CardController.ResolveCard)
+	}
+
+	// Apple Wallet pass web service, called by devices holding a pass. The
+	// path is fixed by Apple's protocol, passes carry the URL up to /v1.
+	wallet := container.WalletController
+	appleWallet := api.Group("/wallet/apple/v1", g.walletByIP)
+	{
+		appleWallet.POST("/devices/:deviceLibraryIdentifier/registrations/:passTypeIdentifier/:serialNumber", wallet.RegisterDevice)
+		appleWallet.DELETE("/devices/:deviceLibraryIdentifier/registrations/:passTypeIdentifier/:serialNumber", wallet.UnregisterDevice)
+		appleWallet.GET("/devices/:deviceLibraryIdentifier/registrations/:passTypeIdentifier", wallet.ListUpdatedPasses)
+		appleWallet.GET("/passes/:passTypeIdentifier/:serialNumber", wallet.GetLatestPass)
+		appleWallet.POST("/log", wallet.Log)
+	}
 
-	// Public
-	api.POST("/register", controllers.Register)
-	api.POST("/login", controllers.Login)
+	// Admin
+	outbox := container.OutboxController
+	jobs := container.JobController
+	privacy := container.PrivacyController
 
-	// Protected
-	protected := api.Group("/")
-	protected.Use(middleware.AuthMiddleware())
+	admin := api.Group("/admin")
+	admin.Use(middleware.AdminMiddleware())
 	{
-		protected.POST("/earn", controllers.EarnPoints)
-		protected.POST("/redeem", controllers.RedeemPoints)
-		protected.GET("/balance", controllers.GetBalance)
-		protected.GET("/history", controllers.GetHistory)
-		protected.GET("/rewardtiers", controllers.GetRewardTiers)
+		admin.DELETE("/users/:id", privacy.AdminDeleteUser)
+		admin.POST("/users/:id/deletion/cancel", privacy.AdminCancelUserDeletion)
+		admin.GET("/outbox", outbox.ListMessages)
+		admin.POST("/outbox/:id/retry", outbox.RetryMessage)
+		admin.GET("/jobs", jobs.ListJobs)
+		admin.POST("/jobs/:id/retry", jobs.RetryJob)
+		admin.POST("/jobs/:id/cancel", jobs.CancelJob)
+		admin.GET("/metrics/api-versions", container.MetricsController.GetAPIVersionUsage)
 	}
 }
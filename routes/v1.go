@@ -0,0 +1,39 @@
+package routes
+
+import (
+	"github.com/gimhanr9/go-loyalty-api/app"
+	"github.com/gin-gonic/gin"
+)
+
+// registerV1 registers the original API, whose request and response shapes
+// must not change. New features are added to v2 only.
+func registerV1(api *gin.RouterGroup, container *app.Container, g guards) {
+	auth := container.AuthController
+	loyalty := container.LoyaltyController
+	profile := container.ProfileController
+	privacy := container.PrivacyController
+
+	// Public
+	api.POST("/register", g.authByIP, g.authByPhone, auth.Register)
+	api.POST("/register/verify", g.authByIP, g.authByPhone, auth.VerifyRegistration)
+	api.POST("/login", g.authByIP, g.authByPhone, g.loginLockout, auth.Login)
+
+	// Protected
+	protected := api.Group("/")
+	protected.Use(g.requireAuth)
+	{
+		protected.POST("/earn", g.pointsByCustomer, loyalty.EarnPoints)
+		protected.POST("/redeem", g.pointsByCustomer, loyalty.RedeemPoints)
+		protected.GET("/balance", loyalty.GetBalance)
+		protected.GET("/history", loyalty.GetHistory)
+		protected.GET("/rewardtiers", loyalty.GetRewardTiers)
+
+		protected.GET("/me", profile.GetProfile)
+		protected.PATCH("/me", profile.UpdateProfile)
+		protected.POST("/me/phone", g.verifyByCustomer, profile.RequestPhoneChange)
+		protected.POST("/me/phone/verify", g.verifyByCustomer, profile.VerifyPhoneChange)
+		protected.DELETE("/me", privacy.DeleteAccount)
+		protected.POST("/me/deletion/cancel", privacy.CancelAccountDeletion)
+		protected.GET("/me/export", privacy.ExportAccount)
+	}
+}
@@ -0,0 +1,57 @@
+package routes
+
+import (
+	"github.com/gimhanr9/go-loyalty-api/app"
+	"github.com/gin-gonic/gin"
+)
+
+// registerV2 registers the current API: snake_case fields throughout, typed
+// responses and a status on every 202
+func registerV2(api *gin.RouterGroup, container *app.Container, g guards) {
+	auth := container.AuthV2Controller
+	loyalty := container.LoyaltyV2Controller
+	profile := container.ProfileV2Controller
+	privacy := container.PrivacyController
+	statements := container.StatementController
+	cards := container.CardController
+	expiry := container.ExpiryController
+	referrals := container.ReferralController
+	rewards := container.RewardV2Controller
+	wallet := container.WalletController
+
+	// Public
+	api.POST("/register", g.authByIP, g.authByPhone, auth.Register)
+	api.POST("/register/verify", g.authByIP, g.authByPhone, auth.VerifyRegistration)
+	api.POST("/login", g.authByIP, g.authByPhone, g.loginLockout, auth.Login)
+
+	// Protected
+	protected := api.Group("/")
+	protected.Use(g.requireAuth)
+	{
+		protected.POST("/earn", g.pointsByCustomer, loyalty.EarnPoints)
+		protected.POST("/redeem", g.pointsByCustomer, loyalty.RedeemPoints)
+		protected.GET("/points", loyalty.GetPoints)
+		protected.GET("/balance", loyalty.GetBalance)
+		protected.GET("/history", loyalty.GetHistory)
+		protected.GET("/points/expiring", expiry.GetExpiringPoints)
+		protected.GET("/rewards", rewards.ListRewards)
+		protected.POST("/rewards", g.pointsByCustomer, rewards.IssueReward)
+		protected.DELETE("/rewards/:id", g.pointsByCustomer, rewards.CancelReward)
+		protected.POST("/rewards/:id/redeem", g.pointsByCustomer, rewards.ApplyReward)
+		protected.GET("/history/export", g.exportByCustomer, statements.ExportHistory)
+		protected.GET("/statements/:id", statements.GetStatement)
+		protected.GET("/statements/:id/download", statements.DownloadStatement)
+
+		protected.GET("/me", profile.GetProfile)
+		protected.PATCH("/me", profile.UpdateProfile)
+		protected.GET("/me/card", cards.GetCard)
+		protected.GET("/me/referrals", referrals.GetReferrals)
+		protected.GET("/me/wallet/apple", wallet.GetApplePass)
+		protected.GET("/me/wallet/google", wallet.GetGooglePass)
+		protected.POST("/me/phone", g.verifyByCustomer, profile.RequestPhoneChange)
+		protected.POST("/me/phone/verify", g.verifyByCustomer, profile.VerifyPhoneChange)
+		protected.DELETE("/me", profile.DeleteAccount)
+		protected.POST("/me/deletion/cancel", profile.CancelAccountDeletion)
+		protected.GET("/me/export", privacy.ExportAccount)
+	}
+}
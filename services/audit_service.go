@@ -0,0 +1,29 @@
+package services
+
+import (
+	"log"
+
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"github.com/gimhanr9/go-loyalty-api/repositories"
+)
+
+// Audit actors
+const (
+	ActorCustomer = "customer"
+	ActorAdmin    = "admin"
+	ActorSystem   = "system"
+)
+
+// recordAudit stores an audit entry. Failures are logged rather than
+// returned so auditing never blocks the action being audited.
+func recordAudit(repo repositories.AuditRepository, userID uint, action, actor, details string) {
+	entry := &models.AuditEntry{
+		UserID:  userID,
+		Action:  action,
+		Actor:   actor,
+		Details: details,
+	}
+	if err := repo.Create(entry); err != nil {
+		log.Printf("failed to record audit entry %s for user %d: %v", action, userID, err)
+	}
+}
@@ -2,105 +2,245 @@ package services
 
 import (
 	"context"
+	"crypto/subtle"
 	"errors"
 	"fmt"
-	"os"
+	"strings"
+	"time"
 
+	"github.com/gimhanr9/go-loyalty-api/apperrors"
+	"github.com/gimhanr9/go-loyalty-api/config"
 	"github.com/gimhanr9/go-loyalty-api/dto"
+	"github.com/gimhanr9/go-loyalty-api/gateway"
 	"github.com/gimhanr9/go-loyalty-api/models"
 	"github.com/gimhanr9/go-loyalty-api/repositories"
-	"github.com/google/uuid"
-	square "github.com/square/square-go-sdk"
-	client "github.com/square/square-go-sdk/client"
-	loyalty "github.com/square/square-go-sdk/loyalty"
-	option "github.com/square/square-go-sdk/option"
+	"github.com/gimhanr9/go-loyalty-api/utils"
 	"gorm.io/gorm"
 )
 
+// ErrVerificationRequired is returned by Register when the phone number already
+// has a Square loyalty account and a code has been sent to prove ownership
+var ErrVerificationRequired = errors.New("phone number has an existing loyalty account, verification code sent")
+
+// ErrAccountSetupPending is returned when the user was saved but the Square
+// loyalty account is still being created in the background
+var ErrAccountSetupPending = errors.New("account is being set up, please try logging in shortly")
+
 type AuthService interface {
-	Register(req dto.RegisterDTO) (*models.User, error)
+	Register(ctx context.Context, req dto.RegisterDTO) (*models.User, error)
+	VerifyRegistration(ctx context.Context, req dto.VerifyRegistrationDTO) (*models.User, error)
 	Login(req dto.LoginDTO) (*models.User, error)
 }
 
 type authService struct {
-	repo repositories.AuthRepository
+	repo        repositories.AuthRepository
+	pendingRepo repositories.PendingRegistrationRepository
+	transactor  repositories.Transactor
+	outbox      OutboxService
+	auditRepo   repositories.AuditRepository
+	loyalty     LoyaltyService
+	referrals   ReferralService
+	square      gateway.SquareGateway
+	sms         SMSSender
+	codeTTL     time.Duration
 }
 
-func NewAuthService(repo repositories.AuthRepository) AuthService {
+func NewAuthService(repo repositories.AuthRepository, pendingRepo repositories.PendingRegistrationRepository, transactor repositories.Transactor, outbox OutboxService, auditRepo repositories.AuditRepository, loyalty LoyaltyService, referrals ReferralService, squareGateway gateway.SquareGateway, sms SMSSender) AuthService {
 
 	return &authService{
-		repo: repo,
+		repo:        repo,
+		pendingRepo: pendingRepo,
+		transactor:  transactor,
+		outbox:      outbox,
+		auditRepo:   auditRepo,
+		loyalty:     loyalty,
+		referrals:   referrals,
+		square:      squareGateway,
+		sms:         sms,
+		codeTTL:     config.GetEnvDuration("REGISTRATION_CODE_TTL", 10*time.Minute),
 	}
 }
 
-func (s *authService) Register(req dto.RegisterDTO) (*models.User, error) {
+func (s *authService) Register(ctx context.Context, req dto.RegisterDTO) (*models.User, error) {
+	// Normalize before any lookups so formatting variants map to one user
+	phone, err := utils.NormalizePhone(req.Phone)
+	if err != nil {
+		return nil, err
+	}
+	email, err := utils.NormalizeEmail(req.Email)
+	if err != nil {
+		return nil, err
+	}
+	req.Phone = phone
+	req.Email = email
+
 	// Check for existing email or phone
 	existing, _ := s.repo.GetByEmailOrPhone(req.Email, req.Phone)
 	if existing != nil {
-		return nil, errors.New("user with email or phone already exists")
+		return nil, apperrors.Conflict("user with email or phone already exists")
+	}
+
+	// Customers who signed up in store already have an account for this phone.
+	// They aren't new customers, so a referral code is ignored.
+	accountID, err := s.findLoyaltyAccountByPhone(ctx, req.Phone)
+	if err != nil {
+		return nil, err
+	}
+	if accountID != "" {
+		if err := s.startAccountLink(req, accountID); err != nil {
+			return nil, err
+		}
+		return nil, ErrVerificationRequired
+	}
+
+	// Save the user and the account creation together, the Square call runs
+	// from the outbox so a failed insert can't leave an orphan account
+	user := &models.User{
+		Name:  req.Name,
+		Email: req.Email,
+		Phone: req.Phone,
+	}
+
+	var msg *models.OutboxMessage
+	err = s.transactor.WithinTransaction(func(repos repositories.TxRepositories) error {
+		if err := repos.Users.Create(user); err != nil {
+			return err
+		}
+		if err := s.referrals.Enroll(repos, user, req); err != nil {
+			return err
+		}
+
+		msg, err = NewOutboxMessage(OutboxCreateLoyaltyAccount, createLoyaltyAccountPayload{UserID: user.ID, Phone: user.Phone})
+		if err != nil {
+			return err
+		}
+		return repos.Outbox.Create(msg)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Try right away, the dispatcher retries in the background on failure
+	if err := s.outbox.Dispatch(ctx, msg.ID); err != nil {
+		return nil, ErrAccountSetupPending
+	}
+
+	return s.repo.GetByID(user.ID)
+}
+
+// findLoyaltyAccountByPhone returns the ID of the loyalty account mapped to the phone, or "" if none
+func (s *authService) findLoyaltyAccountByPhone(ctx context.Context, phone string) (string, error) {
+	accounts, err := s.square.SearchLoyaltyAccountsByPhone(ctx, phone)
+	if err != nil {
+		return "", err
 	}
 
-	squareClient := client.NewClient(
-		option.WithBaseURL(
-			square.Environments.Sandbox,
-		),
-		option.WithToken(os.Getenv("SQUARE_ACCESS_TOKEN")),
-	)
+	if len(accounts) == 0 || accounts[0].ID == nil {
+		return "", nil
+	}
+	return *accounts[0].ID, nil
+}
 
-	programRes, programErr := squareClient.Loyalty.Programs.Get(
-		context.TODO(),
-		&loyalty.GetProgramsRequest{
-			ProgramID: "main", //Default program ID
-		},
-	)
+// startAccountLink stores the registration and texts a code to the phone number
+func (s *authService) startAccountLink(req dto.RegisterDTO, accountID string) error {
+	code, err := generateVerificationCode()
+	if err != nil {
+		return fmt.Errorf("failed to generate verification code: %w", err)
+	}
 
-	if programErr != nil {
-		return nil, errors.New(programErr.Error())
+	if err := s.pendingRepo.DeleteByPhone(req.Phone); err != nil {
+		return err
 	}
 
-	programID = *programRes.Program.ID
+	pending := &models.PendingRegistration{
+		Name:      req.Name,
+		Email:     req.Email,
+		Phone:     req.Phone,
+		AccountID: accountID,
+		CodeHash:  hashVerificationCode(code),
+		ExpiresAt: time.Now().Add(s.codeTTL),
+	}
+	if err := s.pendingRepo.Create(pending); err != nil {
+		return err
+	}
 
-	// Create Loyalty Account in Square
-	idempotencyKey := uuid.New().String()
+	return s.sms.Send(req.Phone, fmt.Sprintf("Your loyalty verification code is %s", code))
+}
 
-	reqReg := &loyalty.CreateLoyaltyAccountRequest{
-		LoyaltyAccount: &square.LoyaltyAccount{
-			Mapping: &square.LoyaltyAccountMapping{
-				PhoneNumber: square.String(req.Phone),
-			},
-			ProgramID: programID,
-		},
-		IdempotencyKey: idempotencyKey,
+// VerifyRegistration checks the code and links the existing loyalty account to a new user.
+// Balance and history live on the Square account, so they carry over with the link.
+func (s *authService) VerifyRegistration(ctx context.Context, req dto.VerifyRegistrationDTO) (*models.User, error) {
+	phone, err := utils.NormalizePhone(req.Phone)
+	if err != nil {
+		return nil, err
 	}
 
-	res, err := squareClient.Loyalty.Accounts.Create(context.TODO(), reqReg)
-	if err != nil || res.LoyaltyAccount == nil {
-		return nil, fmt.Errorf("failed to create loyalty account: %v", err)
+	pending, err := s.pendingRepo.GetLatestByPhone(phone)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperrors.NotFound("no pending registration")
+		}
+		return nil, err
 	}
 
-	customerId := *res.LoyaltyAccount.ID
+	if time.Now().After(pending.ExpiresAt) || pending.Attempts >= maxVerificationAttempts {
+		_ = s.pendingRepo.DeleteByPhone(phone)
+		return nil, apperrors.InvalidRequest("verification code expired, please register again")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashVerificationCode(strings.TrimSpace(req.Code))), []byte(pending.CodeHash)) != 1 {
+		pending.Attempts++
+		if err := s.pendingRepo.Update(pending); err != nil {
+			return nil, err
+		}
+		return nil, apperrors.InvalidRequest("invalid verification code")
+	}
+
+	// The phone or email may have been taken while the code was outstanding
+	existing, _ := s.repo.GetByEmailOrPhone(pending.Email, pending.Phone)
+	if existing != nil {
+		return nil, apperrors.Conflict("user with email or phone already exists")
+	}
 
 	user := &models.User{
-		Name:       req.Name,
-		Email:      req.Email,
-		Phone:      req.Phone,
-		CustomerID: customerId,
+		Name:       pending.Name,
+		Email:      pending.Email,
+		Phone:      pending.Phone,
+		CustomerID: pending.AccountID,
 	}
 
 	if err := s.repo.Create(user); err != nil {
 		return nil, err
 	}
 
+	if err := s.pendingRepo.DeleteByPhone(phone); err != nil {
+		return nil, err
+	}
+
+	details := ""
+	if balance, err := s.loyalty.GetBalance(ctx, user.CustomerID); err == nil {
+		details = fmt.Sprintf("linked existing loyalty account %s with balance %d", user.CustomerID, balance)
+	}
+	recordAudit(s.auditRepo, user.ID, "loyalty_account_linked", ActorCustomer, details)
+
 	return user, nil
 }
 
 func (s *authService) Login(req dto.LoginDTO) (*models.User, error) {
-	user, err := s.repo.GetByPhone(req.Phone)
+	phone, err := utils.NormalizePhone(req.Phone)
+	if err != nil {
+		return nil, apperrors.Unauthorized("user not found")
+	}
+
+	user, err := s.repo.GetByPhone(phone)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("user not found")
+			return nil, apperrors.Unauthorized("user not found")
 		}
 		return nil, err
 	}
+	if user.CustomerID == "" {
+		return nil, ErrAccountSetupPending
+	}
 	return user, nil
 }
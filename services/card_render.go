@@ -0,0 +1,130 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	"github.com/boombuler/barcode/qr"
+
+	"github.com/gimhanr9/go-loyalty-api/dto"
+)
+
+// cardSymbol is a barcode's modules with the quiet zone scanners need around them
+type cardSymbol struct {
+	code   barcode.Barcode
+	width  int // modules across, without the quiet zone
+	height int // 1 for Code128
+	quiet  int
+}
+
+func encodeCard(code, symbology string) (*cardSymbol, error) {
+	if symbology == dto.CardSymbologyCode128 {
+		bc, err := code128.Encode(code)
+		if err != nil {
+			return nil, err
+		}
+		return &cardSymbol{code: bc, width: bc.Bounds().Dx(), height: 1, quiet: 10}, nil
+	}
+
+	// Codes are upper case letters, digits and dashes, which QR's alphanumeric mode packs tightly
+	bc, err := qr.Encode(code, qr.M, qr.AlphaNumeric)
+	if err != nil {
+		return nil, err
+	}
+	return &cardSymbol{code: bc, width: bc.Bounds().Dx(), height: bc.Bounds().Dy(), quiet: 4}, nil
+}
+
+func (s *cardSymbol) dark(x, y int) bool {
+	r, _, _, _ := s.code.At(x, y).RGBA()
+	return r < 0x8000
+}
+
+// rows is the symbol's height in modules when drawn, Code128 bars being a third as tall as the symbol is wide
+func (s *cardSymbol) rows() int {
+	if s.height == 1 {
+		return (s.width + 2*s.quiet) / 3
+	}
+	return s.height + 2*s.quiet
+}
+
+func (s *cardSymbol) darkAt(x, y int) bool {
+	x -= s.quiet
+	if x < 0 || x >= s.width {
+		return false
+	}
+	if s.height == 1 {
+		return y >= s.quiet && y < s.rows()-s.quiet && s.dark(x, 0)
+	}
+	y -= s.quiet
+	return y >= 0 && y < s.height && s.dark(x, y)
+}
+
+// renderCard draws the code as an SVG size pixels wide, or as a PNG about as
+// wide with whole pixels per module
+func renderCard(code string, query dto.CardQueryDTO) ([]byte, error) {
+	symbol, err := encodeCard(code, query.Symbology())
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode card code: %w", err)
+	}
+
+	columns := symbol.width + 2*symbol.quiet
+	if query.Format == dto.CardFormatSVG {
+		return renderCardSVG(symbol, columns, query.ImageSize()), nil
+	}
+	return renderCardPNG(symbol, columns, max(query.ImageSize()/columns, 1))
+}
+
+func renderCardPNG(symbol *cardSymbol, columns, scale int) ([]byte, error) {
+	rows := symbol.rows()
+	img := image.NewGray(image.Rect(0, 0, columns*scale, rows*scale))
+	for py := 0; py < rows*scale; py++ {
+		for px := 0; px < columns*scale; px++ {
+			c := color.Gray{Y: 0xff}
+			if symbol.darkAt(px/scale, py/scale) {
+				c.Y = 0
+			}
+			img.SetGray(px, py, c)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renderCardSVG draws one rectangle per horizontal run of dark modules, or
+// per bar for Code128
+func renderCardSVG(symbol *cardSymbol, columns, size int) []byte {
+	rows := symbol.rows()
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		size, size*rows/columns, columns, rows)
+	fmt.Fprintf(buf, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, columns, rows)
+
+	first, last, runHeight := 0, rows, 1
+	if symbol.height == 1 {
+		first, last, runHeight = symbol.quiet, symbol.quiet+1, rows-2*symbol.quiet
+	}
+	for y := first; y < last; y++ {
+		for x := 0; x < columns; {
+			if !symbol.darkAt(x, y) {
+				x++
+				continue
+			}
+			start := x
+			for x < columns && symbol.darkAt(x, y) {
+				x++
+			}
+			fmt.Fprintf(buf, "M%d %dh%dv%dh-%dz", start, y, x-start, runHeight, x-start)
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+	return buf.Bytes()
+}
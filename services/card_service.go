@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/gimhanr9/go-loyalty-api/apperrors"
+	"github.com/gimhanr9/go-loyalty-api/cardcode"
+	"github.com/gimhanr9/go-loyalty-api/config"
+	"github.com/gimhanr9/go-loyalty-api/dto"
+	"github.com/gimhanr9/go-loyalty-api/repositories"
+	"gorm.io/gorm"
+)
+
+// CardService issues the rotating code on a customer's loyalty card and
+// resolves scanned codes for staff
+type CardService interface {
+	GetCard(userID uint) (*dto.CardDTO, error)
+	RenderCard(userID uint, query dto.CardQueryDTO) ([]byte, *dto.CardDTO, error)
+	Resolve(ctx context.Context, code string) (*dto.CardHolderDTO, error)
+	PassCode(userID uint, at time.Time) (string, bool)
+}
+
+type cardService struct {
+	users     repositories.AuthRepository
+	loyalty   LoyaltyService
+	codec     cardcode.Codec // nil when CARD_CODE_KEY is not set
+	passCodec cardcode.Codec // the slower rotating codes printed on wallet passes
+}
+
+func NewCardService(users repositories.AuthRepository, loyalty LoyaltyService) CardService {
+	s := &cardService{users: users, loyalty: loyalty}
+	if key := os.Getenv("CARD_CODE_KEY"); key != "" {
+		s.codec = cardcode.NewCodec([]byte(key),
+			config.GetEnvDuration("CARD_CODE_PERIOD", 30*time.Second),
+			config.GetEnvInt("CARD_CODE_SKEW", 1))
+		s.passCodec = cardcode.NewCodec([]byte(key),
+			config.GetEnvDuration("WALLET_CODE_PERIOD", 24*time.Hour),
+			config.GetEnvInt("CARD_CODE_SKEW", 1))
+	}
+	return s
+}
+
+// GetCard returns the code for the current period
+func (s *cardService) GetCard(userID uint) (*dto.CardDTO, error) {
+	if s.codec == nil {
+		return nil, apperrors.New(apperrors.CodeForbidden, "Loyalty cards are disabled")
+	}
+
+	user, err := s.users.GetByID(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperrors.NotFound("user not found")
+		}
+		return nil, err
+	}
+	if user.AnonymizedAt != nil {
+		return nil, apperrors.Conflict("user has already been deleted")
+	}
+	if user.CustomerID == "" {
+		return nil, apperrors.Conflict("loyalty account is not set up yet")
+	}
+
+	code, expiresAt := s.codec.Generate(user.ID, time.Now())
+	return &dto.CardDTO{Code: code, ExpiresAt: expiresAt, PeriodSeconds: int(s.codec.Period() / time.Second)}, nil
+}
+
+// RenderCard draws the current code as a QR code or Code128 barcode
+func (s *cardService) RenderCard(userID uint, query dto.CardQueryDTO) ([]byte, *dto.CardDTO, error) {
+	card, err := s.GetCard(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	image, err := renderCard(card.Code, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	return image, card, nil
+}
+
+// Resolve finds the customer a scanned card or wallet pass code was issued to. The balance is best
+// effort, a scan still identifies the customer while Square is unavailable.
+func (s *cardService) Resolve(ctx context.Context, code string) (*dto.CardHolderDTO, error) {
+	if s.codec == nil {
+		return nil, apperrors.New(apperrors.CodeForbidden, "Loyalty cards are disabled")
+	}
+
+	now := time.Now()
+	userID, err := s.codec.Verify(code, now)
+	if errors.Is(err, cardcode.ErrInvalid) {
+		userID, err = s.passCodec.Verify(code, now)
+	}
+	if errors.Is(err, cardcode.ErrMalformed) {
+		return nil, apperrors.Validation(apperrors.FieldError{Field: "code", Message: "is not a loyalty card code"})
+	}
+	if err != nil {
+		return nil, apperrors.NotFound("The card code has expired or is not valid")
+	}
+
+	user, err := s.users.GetByID(userID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if user == nil || user.AnonymizedAt != nil || user.CustomerID == "" {
+		return nil, apperrors.NotFound("The card code has expired or is not valid")
+	}
+
+	holder := &dto.CardHolderDTO{UserID: user.ID, Name: user.Name, LoyaltyAccountID: user.CustomerID}
+	balance, err := s.loyalty.GetBalanceSnapshot(ctx, user.CustomerID)
+	if err != nil {
+		log.Printf("cards: no balance for account %s: %v", user.CustomerID, err)
+		return holder, nil
+	}
+	holder.Balance = &balance.Balance
+	holder.Stale = balance.Stale
+	holder.AsOf = balance.AsOf
+	return holder, nil
+}
+
+// PassCode returns the code printed on the user's wallet pass, which changes
+// every WALLET_CODE_PERIOD, or false when cards are disabled
+func (s *cardService) PassCode(userID uint, at time.Time) (string, bool) {
+	if s.passCodec == nil {
+		return "", false
+	}
+	code, _ := s.passCodec.Generate(userID, at)
+	return code, true
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/gimhanr9/go-loyalty-api/dto"
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"github.com/gimhanr9/go-loyalty-api/repositories"
+	"github.com/gimhanr9/go-loyalty-api/utils"
+)
+
+// ContactMigrationReport summarizes a normalization run
+type ContactMigrationReport struct {
+	Normalized int
+	Merged     int
+	Invalid    []uint
+}
+
+type ContactMigrationService interface {
+	NormalizeUsers(ctx context.Context, dryRun bool) (*ContactMigrationReport, error)
+}
+
+type contactMigrationService struct {
+	repo      repositories.AuthRepository
+	phoneRepo repositories.PhoneChangeRepository
+	auditRepo repositories.AuditRepository
+	loyalty   LoyaltyService
+}
+
+func NewContactMigrationService(repo repositories.AuthRepository, phoneRepo repositories.PhoneChangeRepository, auditRepo repositories.AuditRepository, loyalty LoyaltyService) ContactMigrationService {
+	return &contactMigrationService{
+		repo:      repo,
+		phoneRepo: phoneRepo,
+		auditRepo: auditRepo,
+		loyalty:   loyalty,
+	}
+}
+
+// NormalizeUsers rewrites stored phones as E.164 and emails in lower case, then
+// merges users that collapse onto the same phone or email into the oldest one.
+// Rows that cannot be parsed are left untouched and reported as invalid.
+// All users are grouped before anything is written, so a keeper's new phone or
+// email never collides with a duplicate that has not been merged yet.
+func (s *contactMigrationService) NormalizeUsers(ctx context.Context, dryRun bool) (*ContactMigrationReport, error) {
+	users, err := s.repo.List()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ContactMigrationReport{}
+	var contacts []normalizedContact
+	for i := range users {
+		user := &users[i]
+		if user.AnonymizedAt != nil {
+			continue
+		}
+
+		phone, phoneErr := utils.NormalizePhone(user.Phone)
+		email, emailErr := utils.NormalizeEmail(user.Email)
+		if phoneErr != nil || emailErr != nil {
+			report.Invalid = append(report.Invalid, user.ID)
+			if phoneErr != nil {
+				phone = user.Phone
+			}
+			if emailErr != nil {
+				email = user.Email
+			}
+		}
+		contacts = append(contacts, normalizedContact{user: user, phone: phone, email: email})
+	}
+
+	keepers := groupContacts(contacts)
+	for i, c := range contacts {
+		if keepers[i] == i {
+			continue
+		}
+		if !dryRun {
+			if err := s.merge(ctx, c.user, contacts[keepers[i]].user); err != nil {
+				return report, err
+			}
+		}
+		report.Merged++
+	}
+
+	for i, c := range contacts {
+		if keepers[i] != i || (c.phone == c.user.Phone && c.email == c.user.Email) {
+			continue
+		}
+		c.user.Phone = c.phone
+		c.user.Email = c.email
+		if !dryRun {
+			if err := s.repo.Update(c.user); err != nil {
+				return report, fmt.Errorf("failed to update user %d: %w", c.user.ID, err)
+			}
+		}
+		report.Normalized++
+	}
+
+	return report, nil
+}
+
+// normalizedContact is a user with the phone and email it will be stored with
+type normalizedContact struct {
+	user  *models.User
+	phone string
+	email string
+}
+
+// groupContacts links contacts sharing a phone or email, directly or through
+// another contact, and returns the index of each one's keeper. The keeper is
+// the oldest user of the group, contacts are in ascending id order.
+func groupContacts(contacts []normalizedContact) []int {
+	keepers := make([]int, len(contacts))
+	for i := range keepers {
+		keepers[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if keepers[i] != i {
+			keepers[i] = find(keepers[i])
+		}
+		return keepers[i]
+	}
+	link := func(i, j int) {
+		i, j = find(i), find(j)
+		if i > j {
+			i, j = j, i
+		}
+		keepers[j] = i
+	}
+
+	byPhone := make(map[string]int)
+	byEmail := make(map[string]int)
+	for i, c := range contacts {
+		if j, ok := byPhone[c.phone]; ok {
+			link(i, j)
+		} else if c.phone != "" {
+			byPhone[c.phone] = i
+		}
+		if j, ok := byEmail[c.email]; ok {
+			link(i, j)
+		} else if c.email != "" {
+			byEmail[c.email] = i
+		}
+	}
+
+	for i := range keepers {
+		find(i)
+	}
+	return keepers
+}
+
+// merge moves the duplicate's points and audit trail to the keeper and removes the duplicate.
+// A run that failed part way can be repeated: the points debited from the
+// duplicate earlier are found in its history and credited with the same
+// idempotency keys, so neither side is adjusted twice.
+func (s *contactMigrationService) merge(ctx context.Context, duplicate, keeper *models.User) error {
+	if duplicate.CustomerID != "" && duplicate.CustomerID != keeper.CustomerID {
+		debitReason := fmt.Sprintf("Merged into account %s", keeper.CustomerID)
+		creditReason := fmt.Sprintf("Merged from account %s", duplicate.CustomerID)
+
+		moved, err := s.adjustedPoints(ctx, duplicate.CustomerID, debitReason)
+		if err != nil {
+			return err
+		}
+		if moved == 0 {
+			balance, err := s.loyalty.GetBalance(ctx, duplicate.CustomerID)
+			if err != nil {
+				return err
+			}
+			if balance > 0 {
+				if err := s.loyalty.AdjustPoints(ctx, duplicate.CustomerID, -balance, debitReason, mergeKey(duplicate, keeper, "debit")); err != nil {
+					return err
+				}
+				moved = -balance
+			}
+		}
+
+		if moved < 0 {
+			credited, err := s.adjustedPoints(ctx, keeper.CustomerID, creditReason)
+			if err != nil {
+				return err
+			}
+			if credited == 0 {
+				if err := s.loyalty.AdjustPoints(ctx, keeper.CustomerID, -moved, creditReason, mergeKey(duplicate, keeper, "credit")); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if err := s.auditRepo.ReassignUser(duplicate.ID, keeper.ID); err != nil {
+		return err
+	}
+	if err := s.phoneRepo.DeleteByUserID(duplicate.ID); err != nil {
+		return err
+	}
+	if err := s.repo.Delete(duplicate); err != nil {
+		return fmt.Errorf("failed to delete duplicate user %d: %w", duplicate.ID, err)
+	}
+
+	recordAudit(s.auditRepo, keeper.ID, "duplicate_merged", ActorSystem, fmt.Sprintf("merged user %d", duplicate.ID))
+	return nil
+}
+
+// adjustedPoints totals the account's adjustments made for the reason
+func (s *contactMigrationService) adjustedPoints(ctx context.Context, accountID, reason string) (int, error) {
+	entries, err := s.loyalty.ListHistory(ctx, accountID, dto.HistoryQueryDTO{Types: []string{dto.HistoryTypeAdjusted}})
+	if err != nil {
+		return 0, err
+	}
+
+	points := 0
+	for _, entry := range entries {
+		if entry.Description == reason {
+			points += entry.Points
+		}
+	}
+	return points, nil
+}
+
+// mergeKey is the idempotency key of one side of a merge, the same on every run
+func mergeKey(duplicate, keeper *models.User, direction string) string {
+	key := fmt.Sprintf("merge_points:%d:%d:%s", duplicate.ID, keeper.ID, direction)
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(key)).String()
+}
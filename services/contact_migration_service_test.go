@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/gimhanr9/go-loyalty-api/database/dbtest"
+	"github.com/gimhanr9/go-loyalty-api/dto"
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"github.com/gimhanr9/go-loyalty-api/repositories"
+)
+
+// ledgerLoyalty keeps balances and adjustments in memory and, like Square,
+// applies each idempotency key once
+type ledgerLoyalty struct {
+	LoyaltyService
+	balances   map[string]int
+	history    map[string][]dto.HistoryEntry
+	keys       map[string]bool
+	failCredit bool
+	calls      int
+}
+
+func newLedgerLoyalty(balances map[string]int) *ledgerLoyalty {
+	return &ledgerLoyalty{balances: balances, history: map[string][]dto.HistoryEntry{}, keys: map[string]bool{}}
+}
+
+func (l *ledgerLoyalty) GetBalance(ctx context.Context, accountID string) (int, error) {
+	return l.balances[accountID], nil
+}
+
+func (l *ledgerLoyalty) ListHistory(ctx context.Context, accountID string, query dto.HistoryQueryDTO) ([]dto.HistoryEntry, error) {
+	return l.history[accountID], nil
+}
+
+func (l *ledgerLoyalty) AdjustPoints(ctx context.Context, accountID string, points int, reason, idempotencyKey string) error {
+	l.calls++
+	if l.failCredit && points > 0 {
+		return errors.New("square unavailable")
+	}
+	if l.keys[idempotencyKey] {
+		return nil
+	}
+	l.keys[idempotencyKey] = true
+	l.balances[accountID] += points
+	l.history[accountID] = append(l.history[accountID], dto.HistoryEntry{Type: dto.HistoryTypeAdjusted, Points: points, Description: reason})
+	return nil
+}
+
+func TestNormalizeUsersMerge(t *testing.T) {
+	tests := []struct {
+		name         string
+		balance      int
+		failFirstRun bool
+		// the older user is stored unformatted and the newer one in E.164
+		unformattedFirst bool
+		wantKeeper       int
+	}{
+		{name: "moves the balance", balance: 40, wantKeeper: 140},
+		{name: "nothing to move", balance: 0, wantKeeper: 100},
+		{name: "rerun after the credit failed", balance: 40, failFirstRun: true, wantKeeper: 140},
+		{name: "unformatted phone first", balance: 40, unformattedFirst: true, wantKeeper: 140},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dbtest.Migrated(t)
+			users := repositories.NewAuthRepository(db)
+			audit := repositories.NewAuditRepository(db)
+			keeper := &models.User{Name: "Keeper", Email: "a@example.com", Phone: "+14155550100", CustomerID: "keep"}
+			duplicate := &models.User{Name: "Dup", Email: "b@example.com", Phone: "(415) 555-0100", CustomerID: "dup"}
+			if tt.unformattedFirst {
+				keeper.Phone, duplicate.Phone = duplicate.Phone, keeper.Phone
+			}
+			for _, u := range []*models.User{keeper, duplicate} {
+				if err := users.Create(u); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			loyalty := newLedgerLoyalty(map[string]int{"keep": 100, "dup": tt.balance})
+			svc := NewContactMigrationService(users, repositories.NewPhoneChangeRepository(db), audit, loyalty)
+
+			if tt.failFirstRun {
+				loyalty.failCredit = true
+				if _, err := svc.NormalizeUsers(context.Background(), false); err == nil {
+					t.Fatal("first run should fail")
+				}
+				loyalty.failCredit = false
+			}
+
+			report, err := svc.NormalizeUsers(context.Background(), false)
+			if err != nil {
+				t.Fatalf("NormalizeUsers: %v", err)
+			}
+			if report.Merged != 1 {
+				t.Errorf("merged = %d, want 1", report.Merged)
+			}
+			if loyalty.balances["keep"] != tt.wantKeeper || loyalty.balances["dup"] != 0 {
+				t.Errorf("balances = %v, want keeper %d and duplicate 0", loyalty.balances, tt.wantKeeper)
+			}
+			if _, err := users.GetByID(duplicate.ID); err == nil {
+				t.Error("duplicate was not deleted")
+			}
+			if stored, err := users.GetByID(keeper.ID); err != nil || stored.Phone != "+14155550100" {
+				t.Errorf("keeper = %+v, %v, want phone +14155550100", stored, err)
+			}
+
+			// Nothing is adjusted again once the merge is done
+			calls := loyalty.calls
+			if _, err := svc.NormalizeUsers(context.Background(), false); err != nil {
+				t.Fatal(err)
+			}
+			if loyalty.calls != calls {
+				t.Errorf("a repeated run adjusted points again")
+			}
+		})
+	}
+}
+
+func TestMergeKeyIsStable(t *testing.T) {
+	duplicate, keeper := &models.User{ID: 2}, &models.User{ID: 1}
+	if mergeKey(duplicate, keeper, "debit") != mergeKey(duplicate, keeper, "debit") {
+		t.Error("key changes between runs")
+	}
+	if mergeKey(duplicate, keeper, "debit") == mergeKey(duplicate, keeper, "credit") {
+		t.Error("debit and credit share a key")
+	}
+}
+
+// A contact sharing a phone with one user and an email with another joins both
+func TestGroupContactsLinksThroughSharedContacts(t *testing.T) {
+	contacts := []normalizedContact{
+		{phone: "+14155550100", email: "a@example.com"},
+		{phone: "+14155550101", email: "b@example.com"},
+		{phone: "+14155550101", email: "a@example.com"},
+		{phone: "+14155550102", email: ""},
+		{phone: "+14155550103", email: ""},
+	}
+	want := []int{0, 0, 0, 3, 4}
+	if got := groupContacts(contacts); !reflect.DeepEqual(got, want) {
+		t.Errorf("keepers = %v, want %v", got, want)
+	}
+}
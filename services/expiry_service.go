@@ -0,0 +1,397 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	square "github.com/square/square-go-sdk"
+	loyalty "github.com/square/square-go-sdk/loyalty"
+	"gorm.io/gorm"
+
+	"github.com/gimhanr9/go-loyalty-api/config"
+	"github.com/gimhanr9/go-loyalty-api/dto"
+	"github.com/gimhanr9/go-loyalty-api/gateway"
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"github.com/gimhanr9/go-loyalty-api/repositories"
+	"github.com/gimhanr9/go-loyalty-api/utils"
+)
+
+// ExpiryService reports when customers' points expire and, for programs
+// Square doesn't expire points in, expires them. Customers are sent a notice
+// before their points expire.
+type ExpiryService interface {
+	GetExpiringPoints(ctx context.Context, accountID string, query dto.ExpiringPointsQueryDTO) (*dto.ExpiringPointsDTO, error)
+	Process(ctx context.Context, userID uint) error
+	ProcessAll() error
+}
+
+// localExpiry expires points a fixed time after they are earned, for
+// programs without a Square expiration policy
+type localExpiry struct {
+	duration string    // ISO 8601, e.g. "P12M"
+	start    time.Time // points earned before start count as earned at start
+}
+
+// loadLocalExpiry reads POINTS_EXPIRATION, nil when points don't expire locally
+func loadLocalExpiry() *localExpiry {
+	duration := os.Getenv("POINTS_EXPIRATION")
+	if duration == "" {
+		return nil
+	}
+	if _, err := utils.AddISODuration(time.Now(), duration); err != nil {
+		log.Fatalf("Invalid POINTS_EXPIRATION: %v", err)
+	}
+
+	// Without a start date every point older than the duration would expire
+	// the first night, so it has to be chosen
+	start := config.GetEnvDate("POINTS_EXPIRATION_START", time.Time{})
+	if start.IsZero() {
+		log.Fatalf("POINTS_EXPIRATION_START must be set with POINTS_EXPIRATION")
+	}
+	return &localExpiry{duration: duration, start: start}
+}
+
+func (p *localExpiry) expiresAt(earnedAt time.Time) time.Time {
+	if earnedAt.Before(p.start) {
+		earnedAt = p.start
+	}
+	expiresAt, _ := utils.AddISODuration(earnedAt, p.duration)
+	return expiresAt
+}
+
+// remainingPoints works out which of the points added to the account are
+// still on it, spending the oldest first. entries are oldest first, and so
+// is the result.
+func (p *localExpiry) remainingPoints(entries []dto.HistoryEntry) []dto.ExpiringPointsEntry {
+	var lots []dto.ExpiringPointsEntry
+	for _, e := range entries {
+		if e.Points > 0 {
+			lots = append(lots, dto.ExpiringPointsEntry{Points: e.Points, ExpiresAt: p.expiresAt(e.CreatedAt)})
+			continue
+		}
+
+		spent := -e.Points
+		for i := range lots {
+			if spent == 0 {
+				break
+			}
+			used := min(spent, lots[i].Points)
+			lots[i].Points -= used
+			spent -= used
+		}
+	}
+
+	remaining := make([]dto.ExpiringPointsEntry, 0, len(lots))
+	for _, lot := range lots {
+		if lot.Points == 0 {
+			continue
+		}
+		if n := len(remaining); n > 0 && remaining[n-1].ExpiresAt.Equal(lot.ExpiresAt) {
+			remaining[n-1].Points += lot.Points
+			continue
+		}
+		remaining = append(remaining, lot)
+	}
+	return remaining
+}
+
+type expiryService struct {
+	users          repositories.AuthRepository
+	notices        repositories.ExpiryNoticeRepository
+	square         gateway.SquareGateway
+	jobs           JobService
+	sms            SMSSender
+	local          *localExpiry  // nil when POINTS_EXPIRATION is not set
+	noticeBefore   time.Duration // 0 sends no notices
+	noticeInterval time.Duration
+}
+
+func NewExpiryService(users repositories.AuthRepository, notices repositories.ExpiryNoticeRepository, squareGateway gateway.SquareGateway, jobs JobService, sms SMSSender) ExpiryService {
+	return &expiryService{
+		users:          users,
+		notices:        notices,
+		square:         squareGateway,
+		jobs:           jobs,
+		sms:            sms,
+		local:          loadLocalExpiry(),
+		noticeBefore:   config.GetEnvDuration("POINTS_EXPIRY_NOTICE_BEFORE", 30*24*time.Hour),
+		noticeInterval: config.GetEnvDuration("POINTS_EXPIRY_NOTICE_INTERVAL", 7*24*time.Hour),
+	}
+}
+
+// GetExpiringPoints lists the account's points by expiry date, optionally
+// only those expiring within the given number of days. Under the local
+// policy points past their date are listed until the nightly run removes them.
+func (s *expiryService) GetExpiringPoints(ctx context.Context, accountID string, query dto.ExpiringPointsQueryDTO) (*dto.ExpiringPointsDTO, error) {
+	program, err := s.square.GetProgram(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.schedule(ctx, program, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if query.Days > 0 {
+		until := time.Now().AddDate(0, 0, query.Days)
+		points := result.Points[:0]
+		for _, p := range result.Points {
+			if !p.ExpiresAt.After(until) {
+				points = append(points, p)
+			}
+		}
+		result.Points = points
+	}
+
+	for _, p := range result.Points {
+		result.Total += p.Points
+	}
+	return result, nil
+}
+
+// schedule is every point on the account by expiry date, from Square when
+// the program expires points and from the account's events under the local policy
+func (s *expiryService) schedule(ctx context.Context, program *square.LoyaltyProgram, accountID string) (*dto.ExpiringPointsDTO, error) {
+	result := &dto.ExpiringPointsDTO{Policy: dto.ExpiryPolicyNone, Points: []dto.ExpiringPointsEntry{}}
+
+	switch {
+	case program.ExpirationPolicy != nil:
+		account, err := s.square.GetLoyaltyAccount(ctx, accountID)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Policy = dto.ExpiryPolicySquare
+		result.Expiration = &program.ExpirationPolicy.ExpirationDuration
+		for _, deadline := range account.ExpiringPointDeadlines {
+			if deadline == nil || deadline.Points <= 0 {
+				continue
+			}
+			expiresAt, err := time.Parse(time.RFC3339, deadline.ExpiresAt)
+			if err != nil {
+				continue
+			}
+			result.Points = append(result.Points, dto.ExpiringPointsEntry{Points: deadline.Points, ExpiresAt: expiresAt})
+		}
+		sort.Slice(result.Points, func(i, j int) bool { return result.Points[i].ExpiresAt.Before(result.Points[j].ExpiresAt) })
+
+	case s.local != nil:
+		entries, err := s.ledger(ctx, accountID)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Policy = dto.ExpiryPolicyLocal
+		result.Expiration = &s.local.duration
+		result.Points = s.local.remainingPoints(entries)
+	}
+	return result, nil
+}
+
+// ledger is every event of the account, oldest first. Unlike the history it
+// skips the order and reward lookups.
+func (s *expiryService) ledger(ctx context.Context, accountID string) ([]dto.HistoryEntry, error) {
+	filter, err := eventFilter(accountID, dto.HistoryQueryDTO{})
+	if err != nil {
+		return nil, err
+	}
+
+	req := &square.SearchLoyaltyEventsRequest{
+		Query: &square.LoyaltyEventQuery{Filter: filter},
+		Limit: square.Int(maxHistoryPageSize),
+	}
+	var entries []dto.HistoryEntry
+	for {
+		resp, err := s.square.SearchEvents(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch loyalty events for account %s: %w", accountID, err)
+		}
+		for _, e := range resp.Events {
+			if e != nil {
+				entries = append(entries, historyEntry(e))
+			}
+		}
+
+		if c := resp.GetCursor(); c == nil || *c == "" {
+			break
+		}
+		req.Cursor = resp.GetCursor()
+	}
+
+	slices.Reverse(entries)
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].CreatedAt.Before(entries[j].CreatedAt) })
+	return entries, nil
+}
+
+// Process expires the customer's points that are due under the local policy
+// and tells them about points expiring soon
+func (s *expiryService) Process(ctx context.Context, userID uint) error {
+	user, err := s.users.GetByID(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if user.CustomerID == "" || user.AnonymizedAt != nil {
+		return nil
+	}
+
+	program, err := s.square.GetProgram(ctx)
+	if err != nil {
+		return err
+	}
+	result, err := s.schedule(ctx, program, user.CustomerID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	points := result.Points
+	if result.Policy == dto.ExpiryPolicyLocal {
+		due := 0
+		var through time.Time
+		for len(points) > 0 && !points[0].ExpiresAt.After(now) {
+			due += points[0].Points
+			through = points[0].ExpiresAt
+			points = points[1:]
+		}
+		if err := s.expire(ctx, user.CustomerID, due, through); err != nil {
+			return err
+		}
+	}
+
+	if s.noticeBefore > 0 {
+		return s.notify(user, points, now)
+	}
+	return nil
+}
+
+// expire removes points that reached their expiry date, never taking the
+// balance below zero. The idempotency key is derived from what is expired so
+// a retried run can't expire the same points twice.
+func (s *expiryService) expire(ctx context.Context, accountID string, points int, through time.Time) error {
+	if points <= 0 {
+		return nil
+	}
+
+	account, err := s.square.GetLoyaltyAccount(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	if account.Balance != nil {
+		points = min(points, *account.Balance)
+	}
+	if points <= 0 {
+		return nil
+	}
+
+	key := fmt.Sprintf("expire_points:%s:%d:%d", accountID, points, through.Unix())
+	return s.square.AdjustPoints(ctx, &loyalty.AdjustLoyaltyPointsRequest{
+		AccountID: accountID,
+		AdjustPoints: &square.LoyaltyEventAdjustPoints{
+			Points: -points,
+			Reason: square.String("Points expired"),
+		},
+		IdempotencyKey: uuid.NewSHA1(uuid.NameSpaceOID, []byte(key)).String(),
+	})
+}
+
+// notify texts the customer about points expiring within the notice period
+// that no earlier notice covered, at most once per notice interval
+func (s *expiryService) notify(user *models.User, points []dto.ExpiringPointsEntry, now time.Time) error {
+	notice, err := s.notices.GetByUserID(user.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		notice = &models.ExpiryNotice{UserID: user.ID}
+	} else if err != nil {
+		return err
+	}
+	if now.Sub(notice.SentAt) < s.noticeInterval {
+		return nil
+	}
+
+	total := 0
+	var first, last time.Time
+	for _, p := range points {
+		if !p.ExpiresAt.After(now) || p.ExpiresAt.After(now.Add(s.noticeBefore)) || !p.ExpiresAt.After(notice.NotifiedThrough) {
+			continue
+		}
+		if total == 0 {
+			first = p.ExpiresAt
+		}
+		total += p.Points
+		last = p.ExpiresAt
+	}
+	if total == 0 {
+		return nil
+	}
+
+	message := fmt.Sprintf("%d of your loyalty points expire soon, the first on %s. Use them before they're gone!",
+		total, first.UTC().Format("Jan 2, 2006"))
+	if err := s.sms.Send(user.Phone, message); err != nil {
+		return err
+	}
+
+	notice.NotifiedThrough = last
+	notice.SentAt = now
+	return s.notices.Save(notice)
+}
+
+// ProcessAll queues the expiry run of every customer with a loyalty account
+func (s *expiryService) ProcessAll() error {
+	if s.local == nil && s.noticeBefore == 0 {
+		return nil
+	}
+
+	users, err := s.users.List()
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		if user.CustomerID == "" || user.AnonymizedAt != nil {
+			continue
+		}
+		_, err := s.jobs.EnqueueUnique(JobProcessPointsExpiry, fmt.Sprintf("points_expiry:%d", user.ID),
+			processPointsExpiryPayload{UserID: user.ID}, time.Now())
+		if err != nil {
+			log.Printf("expiry: failed to queue expiry run of user %d: %v", user.ID, err)
+		}
+	}
+	return nil
+}
+
+// JobProcessPointsExpiry expires one customer's due points and sends their notice
+const JobProcessPointsExpiry = "process_points_expiry"
+
+// JobExpirePoints is the nightly job that processes every customer
+const JobExpirePoints = "expire_points"
+
+type processPointsExpiryPayload struct {
+	UserID uint `json:"user_id"`
+}
+
+// RegisterExpiryJobs registers expiry runs and schedules the nightly one, at
+// the given time after midnight UTC
+func RegisterExpiryJobs(jobs JobService, expiry ExpiryService, at time.Duration) {
+	jobs.Register(JobProcessPointsExpiry, func(ctx context.Context, job *models.Job) error {
+		var payload processPointsExpiryPayload
+		if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+			return err
+		}
+		return expiry.Process(ctx, payload.UserID)
+	}, JobOptions{MaxAttempts: 3, MaxConcurrency: 2})
+
+	jobs.Register(JobExpirePoints, func(ctx context.Context, job *models.Job) error {
+		return expiry.ProcessAll()
+	}, JobOptions{MaxConcurrency: 1})
+	jobs.Daily(JobExpirePoints, at)
+}
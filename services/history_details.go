@@ -0,0 +1,319 @@
+package services
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	square "github.com/square/square-go-sdk"
+
+	"github.com/gimhanr9/go-loyalty-api/dto"
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"github.com/gimhanr9/go-loyalty-api/utils"
+)
+
+// historyEntry maps a Square event, signing the points so that points leaving
+// the account are negative whatever sign Square reports them with
+func historyEntry(e *square.LoyaltyEvent) dto.HistoryEntry {
+	entry := dto.HistoryEntry{ID: e.ID, Type: string(e.Type)}
+	entry.CreatedAt, _ = time.Parse(time.RFC3339, e.CreatedAt)
+	if e.LocationID != nil {
+		entry.LocationID = *e.LocationID
+	}
+
+	switch e.Type {
+	case square.LoyaltyEventTypeAccumulatePoints:
+		if e.AccumulatePoints != nil {
+			if e.AccumulatePoints.Points != nil {
+				entry.Points = *e.AccumulatePoints.Points
+			}
+			if e.AccumulatePoints.OrderID != nil {
+				entry.OrderID = *e.AccumulatePoints.OrderID
+			}
+		}
+	case square.LoyaltyEventTypeAccumulatePromotionPoints:
+		if e.AccumulatePromotionPoints != nil {
+			entry.Points = e.AccumulatePromotionPoints.Points
+			entry.OrderID = e.AccumulatePromotionPoints.OrderID
+		}
+	case square.LoyaltyEventTypeCreateReward:
+		if e.CreateReward != nil {
+			entry.Points = -abs(e.CreateReward.Points)
+			entry.RewardID = stringValue(e.CreateReward.RewardID)
+		}
+	case square.LoyaltyEventTypeRedeemReward:
+		if e.RedeemReward != nil {
+			entry.RewardID = stringValue(e.RedeemReward.RewardID)
+			entry.OrderID = stringValue(e.RedeemReward.OrderID)
+		}
+	case square.LoyaltyEventTypeDeleteReward:
+		if e.DeleteReward != nil {
+			entry.Points = abs(e.DeleteReward.Points)
+			entry.RewardID = stringValue(e.DeleteReward.RewardID)
+		}
+	case square.LoyaltyEventTypeAdjustPoints:
+		if e.AdjustPoints != nil {
+			entry.Points = e.AdjustPoints.Points
+			entry.Description = stringValue(e.AdjustPoints.Reason)
+		}
+	case square.LoyaltyEventTypeExpirePoints:
+		if e.ExpirePoints != nil {
+			entry.Points = -abs(e.ExpirePoints.Points)
+		}
+	case square.LoyaltyEventTypeOther:
+		if e.OtherEvent != nil {
+			entry.Points = e.OtherEvent.Points
+		}
+	}
+	return entry
+}
+
+// addHistoryDetails fills in descriptions, order totals, location and reward tier
+// names and expiry dates. Details are best effort: a lookup that fails only
+// leaves its fields empty.
+func (s *loyaltyService) addHistoryDetails(ctx context.Context, entries []dto.HistoryEntry) {
+	if len(entries) == 0 {
+		return
+	}
+
+	// Operations made through this API know the purchase description, order and tier
+	var orderIDs, rewardIDs []string
+	for _, e := range entries {
+		if e.OrderID != "" {
+			orderIDs = append(orderIDs, e.OrderID)
+		}
+		if e.RewardID != "" {
+			rewardIDs = append(rewardIDs, e.RewardID)
+		}
+	}
+
+	byOrder := make(map[string]*models.PointsOperation)
+	byReward := make(map[string]*models.PointsOperation)
+	ops, err := s.operations.ListByOrderOrRewardIDs(orderIDs, rewardIDs)
+	if err != nil {
+		log.Printf("loyalty: failed to look up points operations for history: %v", err)
+	}
+	for i := range ops {
+		if ops[i].OrderID != "" {
+			byOrder[ops[i].OrderID] = &ops[i]
+		}
+		if ops[i].RewardID != "" {
+			byReward[ops[i].RewardID] = &ops[i]
+		}
+	}
+
+	for i := range entries {
+		e := &entries[i]
+		op := byOrder[e.OrderID]
+		if op == nil {
+			op = byReward[e.RewardID]
+		}
+		if op == nil {
+			continue
+		}
+
+		if e.OrderID == "" {
+			e.OrderID = op.OrderID
+		}
+		if e.RewardID != "" {
+			e.RewardTierID = op.RewardTierID
+		}
+		if e.Description == "" && describesPurchase(e.Type) {
+			e.Description = op.Description
+		}
+	}
+
+	orders := s.historyOrders(ctx, entries)
+	rewardTiers := s.historyRewardTiers(ctx, entries)
+
+	var tierNames map[string]string
+	var expiration string
+	var localExpiry *localExpiry
+	if program, err := s.square.GetProgram(ctx); err == nil {
+		tierNames = make(map[string]string)
+		for _, tier := range program.RewardTiers {
+			if tier != nil && tier.ID != nil && tier.Name != nil {
+				tierNames[*tier.ID] = *tier.Name
+			}
+		}
+		if program.ExpirationPolicy != nil {
+			expiration = program.ExpirationPolicy.ExpirationDuration
+		} else {
+			localExpiry = s.expiry
+		}
+	}
+
+	locationNames, err := s.square.LocationNames(ctx)
+	if err != nil {
+		log.Printf("loyalty: failed to look up location names for history: %v", err)
+	}
+
+	for i := range entries {
+		e := &entries[i]
+
+		if order := orders[e.OrderID]; order != nil {
+			if order.TotalMoney != nil && order.TotalMoney.Amount != nil {
+				e.OrderTotal = &dto.MoneyDTO{Amount: *order.TotalMoney.Amount}
+				if order.TotalMoney.Currency != nil {
+					e.OrderTotal.Currency = string(*order.TotalMoney.Currency)
+				}
+			}
+			if e.Description == "" && describesPurchase(e.Type) {
+				e.Description = lineItemNames(order)
+			}
+			if e.LocationID == "" {
+				e.LocationID = order.LocationID
+			}
+		}
+
+		if e.RewardTierID == "" {
+			e.RewardTierID = rewardTiers[e.RewardID]
+		}
+		e.RewardTierName = tierNames[e.RewardTierID]
+		e.LocationName = locationNames[e.LocationID]
+
+		if e.Points > 0 && isEarnEvent(e.Type) {
+			if expiration != "" {
+				if expiresAt, err := utils.AddISODuration(e.CreatedAt, expiration); err == nil {
+					e.ExpiresAt = &expiresAt
+				}
+			} else if localExpiry != nil {
+				expiresAt := localExpiry.expiresAt(e.CreatedAt)
+				e.ExpiresAt = &expiresAt
+			}
+		}
+
+		if e.Description == "" {
+			e.Description = defaultDescription(e)
+		}
+	}
+}
+
+// historyOrders fetches the entries' orders in one call
+func (s *loyaltyService) historyOrders(ctx context.Context, entries []dto.HistoryEntry) map[string]*square.Order {
+	seen := make(map[string]bool)
+	var orderIDs []string
+	for _, e := range entries {
+		if e.OrderID != "" && !seen[e.OrderID] {
+			seen[e.OrderID] = true
+			orderIDs = append(orderIDs, e.OrderID)
+		}
+	}
+
+	orders := make(map[string]*square.Order)
+	if len(orderIDs) == 0 {
+		return orders
+	}
+
+	found, err := s.square.BatchGetOrders(ctx, orderIDs)
+	if err != nil {
+		log.Printf("loyalty: failed to look up orders for history: %v", err)
+		return orders
+	}
+	for _, order := range found {
+		if order != nil && order.ID != nil {
+			orders[*order.ID] = order
+		}
+	}
+	return orders
+}
+
+// maxRewardLookups bounds the concurrent reward lookups of one history page
+const maxRewardLookups = 4
+
+// historyRewardTiers looks up the tier of rewards created outside this API, a few at a time
+func (s *loyaltyService) historyRewardTiers(ctx context.Context, entries []dto.HistoryEntry) map[string]string {
+	tiers := make(map[string]string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, maxRewardLookups)
+
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		if e.RewardID == "" || e.RewardTierID != "" || seen[e.RewardID] {
+			continue
+		}
+		seen[e.RewardID] = true
+
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(rewardID string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			reward, err := s.square.GetReward(ctx, rewardID)
+			if err != nil {
+				log.Printf("loyalty: failed to look up reward %s for history: %v", rewardID, err)
+				return
+			}
+			mu.Lock()
+			tiers[rewardID] = reward.RewardTierID
+			mu.Unlock()
+		}(e.RewardID)
+	}
+
+	wg.Wait()
+	return tiers
+}
+
+func isEarnEvent(eventType string) bool {
+	return eventType == string(square.LoyaltyEventTypeAccumulatePoints) ||
+		eventType == string(square.LoyaltyEventTypeAccumulatePromotionPoints)
+}
+
+// describesPurchase reports whether the event is best described by what was bought
+func describesPurchase(eventType string) bool {
+	return isEarnEvent(eventType) || eventType == string(square.LoyaltyEventTypeRedeemReward)
+}
+
+func lineItemNames(order *square.Order) string {
+	var names []string
+	for _, item := range order.LineItems {
+		if item != nil && item.Name != nil && *item.Name != "" {
+			names = append(names, *item.Name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+func defaultDescription(e *dto.HistoryEntry) string {
+	switch square.LoyaltyEventType(e.Type) {
+	case square.LoyaltyEventTypeAccumulatePoints:
+		return "Points earned"
+	case square.LoyaltyEventTypeAccumulatePromotionPoints:
+		return "Promotion points earned"
+	case square.LoyaltyEventTypeCreateReward:
+		if e.RewardTierName != "" {
+			return "Redeemed for " + e.RewardTierName
+		}
+		return "Reward redeemed"
+	case square.LoyaltyEventTypeRedeemReward:
+		if e.RewardTierName != "" {
+			return e.RewardTierName + " used"
+		}
+		return "Reward used"
+	case square.LoyaltyEventTypeDeleteReward:
+		return "Reward cancelled, points returned"
+	case square.LoyaltyEventTypeAdjustPoints:
+		return "Points adjusted"
+	case square.LoyaltyEventTypeExpirePoints:
+		return "Points expired"
+	default:
+		return "Points updated"
+	}
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
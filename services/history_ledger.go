@@ -0,0 +1,103 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	square "github.com/square/square-go-sdk"
+
+	"github.com/gimhanr9/go-loyalty-api/dto"
+	"github.com/gimhanr9/go-loyalty-api/models"
+)
+
+const ledgerCursorPrefix = "ledger:"
+
+// ledgerHistoryPage serves history from the earn and redeem operations made
+// through this API while Square is unavailable. Events made elsewhere, such as
+// at a Square POS, are missing, so the page is marked stale. It returns nil when
+// the account has no matching operations.
+func (s *loyaltyService) ledgerHistoryPage(accountID string, query dto.HistoryQueryDTO) (*dto.HistoryPage, error) {
+	offset, err := offsetCursor(query.Cursor, ledgerCursorPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	ops, err := s.operations.ListByAccountID(accountID, []string{models.PointsOperationEarn, models.PointsOperationRedeem})
+	if err != nil {
+		return nil, err
+	}
+
+	transactions := make([]dto.HistoryEntry, 0)
+	for _, op := range ops {
+		for _, entry := range ledgerEntries(&op) {
+			if matchesHistoryQuery(entry, query) {
+				transactions = append(transactions, entry)
+			}
+		}
+	}
+	if len(transactions) == 0 {
+		return nil, nil
+	}
+	if query.Sort == dto.HistorySortOldest {
+		slices.Reverse(transactions)
+	}
+
+	page := pageOf(transactions, offset, historyPageSize(query.Limit), ledgerCursorPrefix)
+	page.Stale = true
+	return page, nil
+}
+
+// ledgerEntries are the events an operation made in Square, newest first
+func ledgerEntries(op *models.PointsOperation) []dto.HistoryEntry {
+	var entries []dto.HistoryEntry
+	entry := func(eventType square.LoyaltyEventType, points int) dto.HistoryEntry {
+		return dto.HistoryEntry{
+			ID:        fmt.Sprintf("%s%d:%s", ledgerCursorPrefix, op.ID, eventType),
+			Type:      string(eventType),
+			Points:    points,
+			OrderID:   op.OrderID,
+			CreatedAt: op.UpdatedAt,
+		}
+	}
+
+	if op.Step == models.StepCompleted && op.BonusPoints > 0 {
+		bonus := entry(square.LoyaltyEventTypeAdjustPoints, op.BonusPoints)
+		bonus.Description = op.BonusReason
+		entries = append(entries, bonus)
+	}
+	if op.Step == models.StepAccumulated || op.Step == models.StepCompleted {
+		earned := entry(square.LoyaltyEventTypeAccumulatePoints, op.EarnedPoints)
+		earned.Description = op.Description
+		earned.LocationID = os.Getenv("LOCATION_ID")
+		entries = append(entries, earned)
+	}
+	if op.RewardID != "" {
+		reward := entry(square.LoyaltyEventTypeCreateReward, -op.RewardPoints)
+		reward.RewardID = op.RewardID
+		reward.RewardTierID = op.RewardTierID
+		entries = append(entries, reward)
+	}
+
+	for i := range entries {
+		if entries[i].Description == "" {
+			entries[i].Description = defaultDescription(&entries[i])
+		}
+	}
+	return entries
+}
+
+// matchesHistoryQuery applies the filters Square applies to its events
+func matchesHistoryQuery(entry dto.HistoryEntry, query dto.HistoryQueryDTO) bool {
+	if len(query.Types) > 0 && !slices.Contains(query.Types, historyType(entry.Type)) {
+		return false
+	}
+	from, to := query.Range()
+	if (from != nil && entry.CreatedAt.Before(*from)) || (to != nil && entry.CreatedAt.After(*to)) {
+		return false
+	}
+	if len(query.LocationIDs) > 0 && !slices.Contains(query.LocationIDs, entry.LocationID) {
+		return false
+	}
+	return query.OrderID == "" || entry.OrderID == query.OrderID
+}
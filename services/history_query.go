@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	square "github.com/square/square-go-sdk"
+
+	"github.com/gimhanr9/go-loyalty-api/apperrors"
+	"github.com/gimhanr9/go-loyalty-api/dto"
+)
+
+const (
+	defaultHistoryPageSize = 10
+	maxHistoryPageSize     = 30 // Square's limit for SearchLoyaltyEvents
+
+	oldestCursorPrefix = "oldest:"
+)
+
+// historyEventTypes maps the history type filters to Square's event types
+var historyEventTypes = map[string][]square.LoyaltyEventType{
+	dto.HistoryTypeEarned: {
+		square.LoyaltyEventTypeAccumulatePoints,
+		square.LoyaltyEventTypeAccumulatePromotionPoints,
+	},
+	dto.HistoryTypeRedeemed: {
+		square.LoyaltyEventTypeCreateReward,
+		square.LoyaltyEventTypeRedeemReward,
+		square.LoyaltyEventTypeDeleteReward,
+	},
+	dto.HistoryTypeAdjusted: {
+		square.LoyaltyEventTypeAdjustPoints,
+		square.LoyaltyEventTypeOther,
+	},
+	dto.HistoryTypeExpired: {
+		square.LoyaltyEventTypeExpirePoints,
+	},
+}
+
+// historyType is the type filter an event belongs to
+func historyType(eventType string) string {
+	for t, types := range historyEventTypes {
+		if slices.Contains(types, square.LoyaltyEventType(eventType)) {
+			return t
+		}
+	}
+	return dto.HistoryTypeAdjusted
+}
+
+func historyPageSize(limit int) int {
+	if limit <= 0 {
+		return defaultHistoryPageSize
+	}
+	return min(limit, maxHistoryPageSize)
+}
+
+// eventFilter translates the query into Square's LoyaltyEventFilter, which ANDs
+// the filters and ORs the values within each
+func eventFilter(accountID string, query dto.HistoryQueryDTO) (*square.LoyaltyEventFilter, error) {
+	filter := &square.LoyaltyEventFilter{
+		LoyaltyAccountFilter: &square.LoyaltyEventLoyaltyAccountFilter{
+			LoyaltyAccountID: accountID,
+		},
+	}
+
+	if len(query.Types) > 0 {
+		var types []square.LoyaltyEventType
+		for _, t := range query.Types {
+			types = append(types, historyEventTypes[t]...)
+		}
+		filter.TypeFilter = &square.LoyaltyEventTypeFilter{Types: types}
+	}
+
+	from, to := query.Range()
+	if from != nil && to != nil && to.Before(*from) {
+		return nil, apperrors.Validation(apperrors.FieldError{Field: "to", Message: "must not be before from"})
+	}
+	if from != nil || to != nil {
+		createdAt := &square.TimeRange{}
+		if from != nil {
+			createdAt.StartAt = square.String(from.Format(time.RFC3339))
+		}
+		if to != nil {
+			createdAt.EndAt = square.String(to.Format(time.RFC3339))
+		}
+		filter.DateTimeFilter = &square.LoyaltyEventDateTimeFilter{CreatedAt: createdAt}
+	}
+
+	if len(query.LocationIDs) > 0 {
+		filter.LocationFilter = &square.LoyaltyEventLocationFilter{LocationIDs: query.LocationIDs}
+	}
+
+	if query.OrderID != "" {
+		filter.OrderFilter = &square.LoyaltyEventOrderFilter{OrderID: query.OrderID}
+	}
+
+	return filter, nil
+}
+
+// walkHistory fetches every page matching the query, newest first
+func (s *loyaltyService) walkHistory(ctx context.Context, accountID string, query dto.HistoryQueryDTO) ([]dto.HistoryEntry, error) {
+	transactions, err := s.walkEvents(ctx, accountID, query)
+	if err != nil {
+		return nil, err
+	}
+	s.addHistoryDetails(ctx, transactions)
+	return transactions, nil
+}
+
+// walkEvents is walkHistory without the order, reward and location details
+func (s *loyaltyService) walkEvents(ctx context.Context, accountID string, query dto.HistoryQueryDTO) ([]dto.HistoryEntry, error) {
+	query.Cursor = ""
+	query.Limit = maxHistoryPageSize
+
+	transactions := make([]dto.HistoryEntry, 0)
+	for {
+		page, err := s.fetchEvents(ctx, accountID, query)
+		if err != nil {
+			return nil, err
+		}
+
+		transactions = append(transactions, page.Transactions...)
+
+		if page.Cursor == "" {
+			return transactions, nil
+		}
+		query.Cursor = page.Cursor
+	}
+}
+
+// oldestHistoryPage serves events oldest first. Square only lists newest first,
+// so the matching events are all fetched and paged here, the cursor being an
+// offset. Only the page served is looked up for details.
+func (s *loyaltyService) oldestHistoryPage(ctx context.Context, accountID string, query dto.HistoryQueryDTO) (*dto.HistoryPage, error) {
+	offset, err := offsetCursor(query.Cursor, oldestCursorPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions, err := s.walkEvents(ctx, accountID, query)
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(transactions)
+
+	page := pageOf(transactions, offset, historyPageSize(query.Limit), oldestCursorPrefix)
+	s.addHistoryDetails(ctx, page.Transactions)
+	return page, nil
+}
+
+// offsetCursor reads a cursor made by pageOf, an empty cursor being the first page
+func offsetCursor(cursor, prefix string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	raw, ok := strings.CutPrefix(cursor, prefix)
+	n, err := strconv.Atoi(raw)
+	if !ok || err != nil || n < 0 {
+		return 0, apperrors.Validation(apperrors.FieldError{Field: "cursor", Message: "is invalid"})
+	}
+	return n, nil
+}
+
+// pageOf slices a page of size from offset, with a cursor to the next page if there is one
+func pageOf(transactions []dto.HistoryEntry, offset, size int, prefix string) *dto.HistoryPage {
+	offset = min(offset, len(transactions))
+	end := min(offset+size, len(transactions))
+
+	page := &dto.HistoryPage{Transactions: transactions[offset:end]}
+	if end < len(transactions) {
+		page.Cursor = prefix + strconv.Itoa(end)
+	}
+	return page
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	square "github.com/square/square-go-sdk"
+
+	"github.com/gimhanr9/go-loyalty-api/database/dbtest"
+	"github.com/gimhanr9/go-loyalty-api/dto"
+	"github.com/gimhanr9/go-loyalty-api/gateway"
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"github.com/gimhanr9/go-loyalty-api/repositories"
+)
+
+// historySquare lists accumulate events newest first, each with its own order,
+// and records the orders looked up for details
+type historySquare struct {
+	gateway.SquareGateway
+	events      []*square.LoyaltyEvent
+	unavailable bool
+	lookedUpIDs []string
+}
+
+func newHistorySquare(count int) *historySquare {
+	q := &historySquare{}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := count - 1; i >= 0; i-- {
+		q.events = append(q.events, &square.LoyaltyEvent{
+			ID:        fmt.Sprintf("event-%d", i),
+			Type:      square.LoyaltyEventTypeAccumulatePoints,
+			CreatedAt: start.Add(time.Duration(i) * time.Hour).Format(time.RFC3339),
+			AccumulatePoints: &square.LoyaltyEventAccumulatePoints{
+				Points:  square.Int(10),
+				OrderID: square.String(fmt.Sprintf("order-%d", i)),
+			},
+		})
+	}
+	return q
+}
+
+func (q *historySquare) SearchEvents(ctx context.Context, req *square.SearchLoyaltyEventsRequest) (*square.SearchLoyaltyEventsResponse, error) {
+	if q.unavailable {
+		return nil, gateway.ErrCircuitOpen
+	}
+	offset := 0
+	if req.Cursor != nil {
+		offset, _ = strconv.Atoi(*req.Cursor)
+	}
+	end := min(offset+*req.Limit, len(q.events))
+	resp := &square.SearchLoyaltyEventsResponse{Events: q.events[offset:end]}
+	if end < len(q.events) {
+		resp.Cursor = square.String(strconv.Itoa(end))
+	}
+	return resp, nil
+}
+
+func (q *historySquare) BatchGetOrders(ctx context.Context, orderIDs []string) ([]*square.Order, error) {
+	q.lookedUpIDs = append(q.lookedUpIDs, orderIDs...)
+	return nil, nil
+}
+
+func (q *historySquare) GetProgram(ctx context.Context) (*square.LoyaltyProgram, error) {
+	return &square.LoyaltyProgram{}, nil
+}
+
+func (q *historySquare) LocationNames(ctx context.Context) (map[string]string, error) {
+	return map[string]string{}, nil
+}
+
+func newTestHistoryService(t *testing.T, q *historySquare) (*loyaltyService, repositories.PointsOperationRepository) {
+	t.Helper()
+	db := dbtest.Migrated(t)
+	operations := repositories.NewPointsOperationRepository(db)
+	return NewLoyaltyService(q, operations, repositories.NewAccountSnapshotRepository(db), nil).(*loyaltyService), operations
+}
+
+// Sorting oldest first walks every event but looks up details for the page only
+func TestOldestHistoryPageDetailsThePageOnly(t *testing.T) {
+	q := newHistorySquare(70)
+	s, _ := newTestHistoryService(t, q)
+
+	page, err := s.GetHistory(context.Background(), "acct", dto.HistoryQueryDTO{Sort: dto.HistorySortOldest, Limit: 5, Cursor: "oldest:10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Transactions) != 5 || page.Transactions[0].ID != "event-10" || page.Cursor != "oldest:15" {
+		t.Errorf("page starts at %s with cursor %q", page.Transactions[0].ID, page.Cursor)
+	}
+	if len(q.lookedUpIDs) != 5 || q.lookedUpIDs[0] != "order-10" {
+		t.Errorf("looked up orders %v, want the page's 5", q.lookedUpIDs)
+	}
+}
+
+func TestHistoryFromLocalLedger(t *testing.T) {
+	q := newHistorySquare(0)
+	q.unavailable = true
+	s, operations := newTestHistoryService(t, q)
+
+	ops := []*models.PointsOperation{
+		{Kind: models.PointsOperationEarn, AccountID: "acct", IdempotencyKey: "earn", Description: "Coffee", Step: models.StepCompleted, OrderID: "order-1", EarnedPoints: 10, BonusPoints: 5, BonusReason: "Gold bonus"},
+		{Kind: models.PointsOperationRedeem, AccountID: "acct", IdempotencyKey: "redeem", Step: models.StepCompleted, OrderID: "order-2", RewardID: "reward", RewardTierID: "tier", RewardPoints: 100, EarnedPoints: 2},
+		{Kind: models.PointsOperationEarn, AccountID: "acct", IdempotencyKey: "pending", Step: models.StepOrderCreated, OrderID: "order-3"},
+		{Kind: models.PointsOperationEarn, AccountID: "other", IdempotencyKey: "other", Step: models.StepCompleted, EarnedPoints: 10},
+	}
+	for _, op := range ops {
+		if err := operations.Create(op); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		query      dto.HistoryQueryDTO
+		wantPoints []int
+		wantCursor string
+	}{
+		{name: "newest first", query: dto.HistoryQueryDTO{}, wantPoints: []int{2, -100, 5, 10}},
+		{name: "by type", query: dto.HistoryQueryDTO{Types: []string{dto.HistoryTypeRedeemed}}, wantPoints: []int{-100}},
+		{name: "by order", query: dto.HistoryQueryDTO{OrderID: "order-1"}, wantPoints: []int{5, 10}},
+		{name: "paged", query: dto.HistoryQueryDTO{Limit: 3}, wantPoints: []int{2, -100, 5}, wantCursor: "ledger:3"},
+		{name: "next page", query: dto.HistoryQueryDTO{Limit: 3, Cursor: "ledger:3"}, wantPoints: []int{10}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := s.GetHistory(context.Background(), "acct", tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var points []int
+			for _, e := range page.Transactions {
+				points = append(points, e.Points)
+			}
+			if fmt.Sprint(points) != fmt.Sprint(tt.wantPoints) || page.Cursor != tt.wantCursor || !page.Stale {
+				t.Errorf("points %v cursor %q stale %v, want %v cursor %q stale", points, page.Cursor, page.Stale, tt.wantPoints, tt.wantCursor)
+			}
+		})
+	}
+
+	if _, err := s.GetHistory(context.Background(), "none", dto.HistoryQueryDTO{}); err == nil {
+		t.Error("an account with no ledger should get Square's error")
+	}
+}
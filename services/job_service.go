@@ -0,0 +1,442 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gimhanr9/go-loyalty-api/apperrors"
+	"github.com/gimhanr9/go-loyalty-api/config"
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"github.com/gimhanr9/go-loyalty-api/repositories"
+	"github.com/gimhanr9/go-loyalty-api/utils"
+	"gorm.io/gorm"
+)
+
+// JobHandler runs one job. The context is cancelled when the job is cancelled
+// or the runner's drain timeout expires.
+type JobHandler func(ctx context.Context, job *models.Job) error
+
+// JobOptions tune how a kind of job is run
+type JobOptions struct {
+	MaxAttempts    int // attempts before the job is dead-lettered, defaults to JOB_MAX_ATTEMPTS
+	MaxConcurrency int // jobs of this kind running at once, 0 means only the worker limit applies
+}
+
+type JobService interface {
+	Register(kind string, handler JobHandler, opts JobOptions)
+	Enqueue(kind string, payload interface{}, runAt time.Time) (*models.Job, error)
+	EnqueueUnique(kind, uniqueKey string, payload interface{}, runAt time.Time) (*models.Job, error)
+	Every(kind string, interval time.Duration)
+	Daily(kind string, at time.Duration)
+	List(status, kind string, limit int) ([]models.Job, error)
+	Retry(id uint) (*models.Job, error)
+	Cancel(id uint) (*models.Job, error)
+	Start()
+	Stop(timeout time.Duration) error
+}
+
+type registeredJob struct {
+	handler JobHandler
+	opts    JobOptions
+	slots   chan struct{}
+}
+
+type schedule struct {
+	kind     string
+	interval time.Duration
+	next     time.Time
+	aligned  bool // runs keep to the first run's time of day instead of drifting with the poll
+}
+
+type jobService struct {
+	repo         repositories.JobRepository
+	jobs         map[string]*registeredJob
+	schedules    []*schedule
+	workers      chan struct{}
+	pollInterval time.Duration
+	lease        time.Duration
+	maxAttempts  int
+	baseBackoff  time.Duration
+	maxBackoff   time.Duration
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	stop    chan struct{}
+	stopped chan struct{}
+	wg      sync.WaitGroup
+
+	mu      sync.Mutex
+	running map[uint]context.CancelFunc
+}
+
+func NewJobService(repo repositories.JobRepository) JobService {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &jobService{
+		repo:         repo,
+		jobs:         make(map[string]*registeredJob),
+		workers:      make(chan struct{}, config.GetEnvInt("JOB_CONCURRENCY", 4)),
+		pollInterval: config.GetEnvDuration("JOB_POLL_INTERVAL", time.Second),
+		lease:        config.GetEnvDuration("JOB_LEASE", 10*time.Minute),
+		maxAttempts:  config.GetEnvInt("JOB_MAX_ATTEMPTS", 5),
+		baseBackoff:  config.GetEnvDuration("JOB_BASE_BACKOFF", 10*time.Second),
+		maxBackoff:   config.GetEnvDuration("JOB_MAX_BACKOFF", time.Hour),
+		ctx:          ctx,
+		cancel:       cancel,
+		stop:         make(chan struct{}),
+		stopped:      make(chan struct{}),
+		running:      make(map[uint]context.CancelFunc),
+	}
+}
+
+// Register adds a handler. Call before Start.
+func (s *jobService) Register(kind string, handler JobHandler, opts JobOptions) {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = s.maxAttempts
+	}
+
+	job := &registeredJob{handler: handler, opts: opts}
+	if opts.MaxConcurrency > 0 {
+		job.slots = make(chan struct{}, opts.MaxConcurrency)
+	}
+	s.jobs[kind] = job
+}
+
+func (s *jobService) Enqueue(kind string, payload interface{}, runAt time.Time) (*models.Job, error) {
+	return s.EnqueueUnique(kind, "", payload, runAt)
+}
+
+// EnqueueUnique skips enqueueing while a queued or running job holds uniqueKey
+// and returns that job instead. The check is repeated by a unique index, so of
+// two replicas enqueueing at once only one job is queued.
+func (s *jobService) EnqueueUnique(kind, uniqueKey string, payload interface{}, runAt time.Time) (*models.Job, error) {
+	registered, ok := s.jobs[kind]
+	if !ok {
+		return nil, fmt.Errorf("no handler registered for job kind %q", kind)
+	}
+
+	if uniqueKey != "" {
+		existing, err := s.repo.GetActiveByUniqueKey(uniqueKey)
+		if err == nil {
+			return existing, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s payload: %w", kind, err)
+	}
+
+	job := &models.Job{
+		Kind:        kind,
+		Payload:     string(body),
+		UniqueKey:   uniqueKey,
+		Status:      models.JobQueued,
+		MaxAttempts: registered.opts.MaxAttempts,
+		RunAt:       runAt,
+	}
+	if err := s.repo.Create(job); err != nil {
+		if uniqueKey != "" && repositories.IsUniqueViolation(err) {
+			return s.repo.GetActiveByUniqueKey(uniqueKey)
+		}
+		return nil, err
+	}
+	return job, nil
+}
+
+// Every enqueues a job of kind once per interval. Call before Start.
+func (s *jobService) Every(kind string, interval time.Duration) {
+	s.schedules = append(s.schedules, &schedule{kind: kind, interval: interval, next: time.Now()})
+}
+
+// Daily enqueues a job of kind once a day, at the given time after midnight
+// UTC. The first run is the next one due, not one at startup. Call before Start.
+func (s *jobService) Daily(kind string, at time.Duration) {
+	now := time.Now().UTC()
+	next := now.Truncate(24 * time.Hour).Add(at)
+	for !next.After(now) {
+		next = next.Add(24 * time.Hour)
+	}
+	s.schedules = append(s.schedules, &schedule{kind: kind, interval: 24 * time.Hour, next: next, aligned: true})
+}
+
+func (s *jobService) List(status, kind string, limit int) ([]models.Job, error) {
+	return s.repo.List(status, kind, limit)
+}
+
+// Retry requeues a dead or cancelled job with a fresh attempt budget
+func (s *jobService) Retry(id uint) (*models.Job, error) {
+	job, err := s.getJob(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if job.Status != models.JobDead && job.Status != models.JobCancelled {
+		return nil, apperrors.Conflict(fmt.Sprintf("only dead or cancelled jobs can be retried, job is %s", job.Status))
+	}
+
+	job.Status = models.JobQueued
+	job.Attempts = 0
+	job.RunAt = time.Now()
+	job.FinishedAt = nil
+	if err := s.repo.Update(job); err != nil {
+		if repositories.IsUniqueViolation(err) {
+			return nil, apperrors.Conflict("another job with the same unique key is queued or running")
+		}
+		return nil, err
+	}
+	return job, nil
+}
+
+// Cancel stops a queued job from running, or signals a running one to stop
+func (s *jobService) Cancel(id uint) (*models.Job, error) {
+	job, err := s.getJob(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if job.Status != models.JobQueued && job.Status != models.JobRunning {
+		return nil, apperrors.Conflict(fmt.Sprintf("only queued or running jobs can be cancelled, job is %s", job.Status))
+	}
+
+	now := time.Now()
+	job.Status = models.JobCancelled
+	job.FinishedAt = &now
+	if err := s.repo.Update(job); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if cancel, ok := s.running[id]; ok {
+		cancel()
+	}
+	s.mu.Unlock()
+
+	return job, nil
+}
+
+func (s *jobService) getJob(id uint) (*models.Job, error) {
+	job, err := s.repo.GetByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperrors.NotFound("job not found")
+		}
+		return nil, err
+	}
+	return job, nil
+}
+
+// Start polls for due jobs in the background until Stop is called
+func (s *jobService) Start() {
+	go func() {
+		defer close(s.stopped)
+
+		ticker := time.NewTicker(s.pollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				s.enqueueScheduled()
+				s.poll()
+			}
+		}
+	}()
+}
+
+// Stop stops claiming new jobs and waits for running ones to finish. Jobs
+// still running after timeout have their context cancelled.
+func (s *jobService) Stop(timeout time.Duration) error {
+	close(s.stop)
+	<-s.stopped
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		s.cancel()
+		return nil
+	case <-time.After(timeout):
+		s.cancel()
+		<-done
+		return errors.New("job runner drain timed out, running jobs were cancelled")
+	}
+}
+
+// enqueueScheduled enqueues the scheduled jobs that are due. Every replica runs
+// the schedules, the run is enqueued by the one that claims it in the database.
+func (s *jobService) enqueueScheduled() {
+	now := time.Now()
+	for _, sch := range s.schedules {
+		if now.Before(sch.next) {
+			continue
+		}
+		if sch.aligned {
+			for !sch.next.After(now) {
+				sch.next = sch.next.Add(sch.interval)
+			}
+		} else {
+			sch.next = now.Add(sch.interval)
+		}
+
+		claimed, err := s.repo.ClaimScheduledRun(sch.kind, now, sch.next)
+		if err != nil {
+			log.Printf("job runner: failed to claim scheduled %s: %v", sch.kind, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		if _, err := s.EnqueueUnique(sch.kind, "schedule:"+sch.kind, nil, now); err != nil {
+			log.Printf("job runner: failed to schedule %s: %v", sch.kind, err)
+		}
+	}
+}
+
+func (s *jobService) poll() {
+	free := cap(s.workers) - len(s.workers)
+	if free == 0 || len(s.jobs) == 0 {
+		return
+	}
+
+	kinds := make([]string, 0, len(s.jobs))
+	for kind := range s.jobs {
+		kinds = append(kinds, kind)
+	}
+
+	now := time.Now()
+	due, err := s.repo.ListDue(now, now.Add(-s.lease), kinds, free*2)
+	if err != nil {
+		log.Printf("job runner: %v", err)
+		return
+	}
+
+	for i := range due {
+		job := due[i]
+		registered := s.jobs[job.Kind]
+
+		if registered.slots != nil {
+			select {
+			case registered.slots <- struct{}{}:
+			default:
+				continue
+			}
+		}
+
+		select {
+		case s.workers <- struct{}{}:
+		default:
+			if registered.slots != nil {
+				<-registered.slots
+			}
+			return
+		}
+
+		claimed, err := s.repo.Claim(&job)
+		if err != nil || !claimed {
+			if err != nil {
+				log.Printf("job runner: failed to claim job %d: %v", job.ID, err)
+			}
+			<-s.workers
+			if registered.slots != nil {
+				<-registered.slots
+			}
+			continue
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() { <-s.workers }()
+			if registered.slots != nil {
+				defer func() { <-registered.slots }()
+			}
+			s.run(&job, registered)
+		}()
+	}
+}
+
+func (s *jobService) run(job *models.Job, registered *registeredJob) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+
+	s.mu.Lock()
+	s.running[job.ID] = cancel
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, job.ID)
+		s.mu.Unlock()
+	}()
+
+	// Heartbeat so long jobs aren't reclaimed as stale by another replica
+	heartbeat := time.NewTicker(s.lease / 3)
+	defer heartbeat.Stop()
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-heartbeat.C:
+				if err := s.repo.Touch(job.ID); err != nil {
+					log.Printf("job runner: heartbeat for job %d failed: %v", job.ID, err)
+				}
+			}
+		}
+	}()
+
+	err := s.execute(ctx, job, registered.handler)
+
+	now := time.Now()
+	switch {
+	case err == nil:
+		job.Status = models.JobSucceeded
+		job.LastError = ""
+		job.FinishedAt = &now
+	case job.Attempts >= job.MaxAttempts:
+		// Dead-lettered, kept for inspection and manual retry
+		job.Status = models.JobDead
+		job.LastError = err.Error()
+		job.FinishedAt = &now
+	default:
+		job.Status = models.JobQueued
+		job.LastError = err.Error()
+		job.RunAt = now.Add(utils.JitteredBackoff(s.baseBackoff, s.maxBackoff, job.Attempts))
+	}
+
+	if updateErr := s.repo.Update(job); updateErr != nil {
+		if errors.Is(updateErr, repositories.ErrStaleJob) {
+			// Cancelled while running, keep the cancellation
+			return
+		}
+		log.Printf("job runner: failed to record result of job %d: %v", job.ID, updateErr)
+	}
+	if err != nil {
+		log.Printf("job runner: job %d (%s) attempt %d failed: %v", job.ID, job.Kind, job.Attempts, err)
+	}
+}
+
+// execute runs the handler, turning a panic into an error so one bad job can't crash the runner
+func (s *jobService) execute(ctx context.Context, job *models.Job, handler JobHandler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return handler(ctx, job)
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/gimhanr9/go-loyalty-api/database/dbtest"
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"github.com/gimhanr9/go-loyalty-api/repositories"
+)
+
+func newTestJobService(t *testing.T) (*jobService, repositories.JobRepository, *gorm.DB) {
+	t.Helper()
+	t.Setenv("JOB_BASE_BACKOFF", "1m")
+	t.Setenv("JOB_MAX_BACKOFF", "1m")
+	t.Setenv("JOB_LEASE", "10m")
+
+	db := dbtest.Migrated(t)
+	repo := repositories.NewJobRepository(db)
+	return NewJobService(repo).(*jobService), repo, db
+}
+
+func TestJobServiceRunOutcome(t *testing.T) {
+	tests := []struct {
+		name         string
+		handler      JobHandler
+		attempts     int // before this run
+		wantStatus   string
+		wantError    string
+		wantFinished bool
+		wantRetry    bool
+	}{
+		{
+			name:         "success",
+			handler:      func(ctx context.Context, job *models.Job) error { return nil },
+			wantStatus:   models.JobSucceeded,
+			wantFinished: true,
+		},
+		{
+			name:       "failure is retried with backoff",
+			handler:    func(ctx context.Context, job *models.Job) error { return errors.New("square down") },
+			wantStatus: models.JobQueued,
+			wantError:  "square down",
+			wantRetry:  true,
+		},
+		{
+			name:         "last attempt is dead-lettered",
+			handler:      func(ctx context.Context, job *models.Job) error { return errors.New("square down") },
+			attempts:     2,
+			wantStatus:   models.JobDead,
+			wantError:    "square down",
+			wantFinished: true,
+		},
+		{
+			name:       "panic is a failure",
+			handler:    func(ctx context.Context, job *models.Job) error { panic("nil map") },
+			wantStatus: models.JobQueued,
+			wantError:  "job panicked: nil map",
+			wantRetry:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, repo, _ := newTestJobService(t)
+			s.Register("k", tt.handler, JobOptions{MaxAttempts: 3})
+
+			job, err := s.Enqueue("k", nil, time.Now().Add(-time.Second))
+			if err != nil {
+				t.Fatal(err)
+			}
+			job.Attempts = tt.attempts
+			if err := repo.Update(job); err != nil {
+				t.Fatal(err)
+			}
+
+			s.poll()
+			s.wg.Wait()
+
+			got, _ := repo.GetByID(job.ID)
+			if got.Status != tt.wantStatus || got.LastError != tt.wantError {
+				t.Errorf("job = %s %q, want %s %q", got.Status, got.LastError, tt.wantStatus, tt.wantError)
+			}
+			if got.Attempts != tt.attempts+1 {
+				t.Errorf("attempts = %d, want %d", got.Attempts, tt.attempts+1)
+			}
+			if (got.FinishedAt != nil) != tt.wantFinished {
+				t.Errorf("finished_at = %v", got.FinishedAt)
+			}
+			if tt.wantRetry && !got.RunAt.After(time.Now().Add(30*time.Second)) {
+				t.Errorf("retry at %s, want after the backoff", got.RunAt)
+			}
+		})
+	}
+}
+
+// A job cancelled while running has its context cancelled and stays cancelled
+// when the handler returns
+func TestJobServiceCancelRunning(t *testing.T) {
+	s, repo, _ := newTestJobService(t)
+	started := make(chan struct{})
+	s.Register("k", func(ctx context.Context, job *models.Job) error {
+		close(started)
+		<-ctx.Done()
+		return nil
+	}, JobOptions{})
+
+	job, _ := s.Enqueue("k", nil, time.Now().Add(-time.Second))
+	s.poll()
+	<-started
+
+	if _, err := s.Cancel(job.ID); err != nil {
+		t.Fatal(err)
+	}
+	s.wg.Wait()
+
+	got, _ := repo.GetByID(job.ID)
+	if got.Status != models.JobCancelled {
+		t.Errorf("status = %s, want cancelled", got.Status)
+	}
+}
+
+// Replicas sharing a database enqueue each scheduled run once
+func TestJobServiceScheduleClaimedOnce(t *testing.T) {
+	first, repo, db := newTestJobService(t)
+	second := NewJobService(repositories.NewJobRepository(db)).(*jobService)
+	for _, s := range []*jobService{first, second} {
+		s.Register("k", func(ctx context.Context, job *models.Job) error { return nil }, JobOptions{})
+		s.Every("k", time.Hour)
+	}
+
+	first.enqueueScheduled()
+	jobs, _ := repo.List("", "k", 10)
+	if len(jobs) != 1 {
+		t.Fatalf("jobs = %d, want 1", len(jobs))
+	}
+
+	// The run finished before the other replica polled
+	jobs[0].Status = models.JobSucceeded
+	if err := repo.Update(&jobs[0]); err != nil {
+		t.Fatal(err)
+	}
+	second.enqueueScheduled()
+	if jobs, _ := repo.List("", "k", 10); len(jobs) != 1 {
+		t.Errorf("jobs = %d after the second replica polled, want 1", len(jobs))
+	}
+}
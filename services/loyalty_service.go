@@ -2,328 +2,280 @@ package services
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
+	"log"
 	"strconv"
-	"time"
+	"strings"
 
 	square "github.com/square/square-go-sdk"
-	client "github.com/square/square-go-sdk/client"
 	loyalty "github.com/square/square-go-sdk/loyalty"
-	option "github.com/square/square-go-sdk/option"
-
-	"github.com/google/uuid"
 
+	"github.com/gimhanr9/go-loyalty-api/apperrors"
 	"github.com/gimhanr9/go-loyalty-api/dto"
+	"github.com/gimhanr9/go-loyalty-api/gateway"
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"github.com/gimhanr9/go-loyalty-api/repositories"
 )
 
 type LoyaltyService interface {
-	EarnPoints(req dto.EarnPointsDTO) error
-	RedeemPoints(req dto.RedeemPointsDTO) error
-	GetBalance(accountID string) (int, error)
-	GetHistory(accountID string) ([]square.LoyaltyEvent, error)
-	GetDiscountPercentageByClosestRewardTier(accountID string) (*dto.RewardTierDTO, error)
+	EarnPoints(ctx context.Context, req dto.EarnPointsDTO) error
+	RedeemPoints(ctx context.Context, req dto.RedeemPointsDTO) error
+	GetBalance(ctx context.Context, accountID string) (int, error)
+	GetBalanceSnapshot(ctx context.Context, accountID string) (*dto.BalanceDTO, error)
+	GetHistory(ctx context.Context, accountID string, query dto.HistoryQueryDTO) (*dto.HistoryPage, error)
+	GetAllHistory(ctx context.Context, accountID string) ([]dto.HistoryEntry, error)
+	ListHistory(ctx context.Context, accountID string, query dto.HistoryQueryDTO) ([]dto.HistoryEntry, error)
+	AdjustPoints(ctx context.Context, accountID string, points int, reason, idempotencyKey string) error
+	GetDiscountPercentageByClosestRewardTier(ctx context.Context, accountID string) (*dto.RewardTierDTO, error)
+	ResumeOperation(ctx context.Context, operationID uint) error
+	OnBalanceChange(listener BalanceListener)
+	SetEarnMultiplier(multiplier EarnMultiplier)
 }
 
-// EarnPoints adds points to the loyalty account
-func EarnPoints(req dto.EarnPointsDTO) error {
-
-	squareClient := client.NewClient(
-		option.WithBaseURL(
-			square.Environments.Sandbox,
-		),
-		option.WithToken(os.Getenv("SQUARE_ACCESS_TOKEN")),
-	)
-
-	idempotencyKey := uuid.New().String()
-
-	//Get program Id
-	programRes, err := squareClient.Loyalty.Programs.Get(
-		context.TODO(),
-		&loyalty.GetProgramsRequest{
-			ProgramID: "main", //Default program ID
-		},
-	)
+// BalanceListener is called when a balance read from Square differs from the
+// last one seen for the account
+type BalanceListener func(accountID string, balance int)
+
+// EarnMultiplier is the multiple of the usual points an account earns, with
+// the reason shown on the bonus added on top
+type EarnMultiplier func(accountID string) (multiplier float64, reason string)
+
+type loyaltyService struct {
+	square     gateway.SquareGateway
+	operations repositories.PointsOperationRepository
+	snapshots  repositories.AccountSnapshotRepository
+	jobs       JobService
+	listeners  []BalanceListener
+	multiplier EarnMultiplier
+	expiry     *localExpiry // nil when POINTS_EXPIRATION is not set
+}
 
-	if err != nil {
-		return fmt.Errorf("failed to retrieve program: %w", err)
+func NewLoyaltyService(squareGateway gateway.SquareGateway, operations repositories.PointsOperationRepository, snapshots repositories.AccountSnapshotRepository, jobs JobService) LoyaltyService {
+	return &loyaltyService{
+		square:     squareGateway,
+		operations: operations,
+		snapshots:  snapshots,
+		jobs:       jobs,
+		expiry:     loadLocalExpiry(),
 	}
+}
 
-	programID = *programRes.Program.ID
-
-	customerRes, err := squareClient.Loyalty.Accounts.Search(
-		context.TODO(),
-		&loyalty.SearchLoyaltyAccountsRequest{
-			Limit: square.Int(
-				1,
-			),
-		},
-	)
-
+// EarnPoints adds points to the loyalty account
+func (s *loyaltyService) EarnPoints(ctx context.Context, req dto.EarnPointsDTO) error {
+	op, err := s.startOperation(opRequest{
+		kind:           models.PointsOperationEarn,
+		accountID:      req.AccountId,
+		idempotencyKey: req.IdempotencyKey,
+		amount:         req.Amount,
+		description:    req.Description,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to get customer: %w", err)
-	}
-
-	customerId := customerRes.LoyaltyAccounts[0].CustomerID
-
-	reqOrder := &square.CreateOrderRequest{
-		Order: &square.Order{
-			LineItems: []*square.OrderLineItem{
-				{
-					Name:     square.String(req.Description),
-					Quantity: "1",
-					BasePriceMoney: &square.Money{
-						Amount:   square.Int64(int64(req.Amount)),
-						Currency: square.CurrencyUsd.Ptr(),
-					},
-				},
-			},
-			CustomerID: customerId,
-			LocationID: os.Getenv("LOCATION_ID"),
-		},
-
-		IdempotencyKey: &idempotencyKey,
+		return err
 	}
 
-	resOrder, err := squareClient.Orders.Create(context.TODO(), reqOrder)
+	return s.runOperation(ctx, op)
+}
+
+// RedeemPoints redeems points for a reward tier
+func (s *loyaltyService) RedeemPoints(ctx context.Context, req dto.RedeemPointsDTO) error {
+	if err := s.checkRewardTier(ctx, req.RewardTierId); err != nil {
+		return err
+	}
+
+	op, err := s.startOperation(opRequest{
+		kind:           models.PointsOperationRedeem,
+		accountID:      req.AccountId,
+		idempotencyKey: req.IdempotencyKey,
+		amount:         req.Amount,
+		description:    req.Description,
+		rewardTierID:   req.RewardTierId,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to create order: %w", err)
+		return err
 	}
 
-	orderId := *resOrder.Order.ID
-
-	reqPayment := &square.CreatePaymentRequest{
-		SourceID: "cnon:card-nonce-ok",
-		AmountMoney: &square.Money{
-			Amount:   square.Int64(int64(req.Amount)),
-			Currency: square.CurrencyUsd.Ptr(),
-		},
-		OrderID:        square.String(orderId),
-		IdempotencyKey: idempotencyKey,
-	}
+	return s.runOperation(ctx, op)
+}
 
-	paymentRes, err := squareClient.Payments.Create(context.TODO(), reqPayment)
+// checkRewardTier rejects tiers that are not part of the loyalty program
+func (s *loyaltyService) checkRewardTier(ctx context.Context, rewardTierID string) error {
+	program, err := s.square.GetProgram(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to create payment: %w", err)
+		return err
 	}
 
-	if paymentRes.Payment == nil || paymentRes.Payment.Status == nil || *paymentRes.Payment.Status != "COMPLETED" {
-		return fmt.Errorf("payment not completed, status: %v", paymentRes.Payment.Status)
+	for _, tier := range program.RewardTiers {
+		if tier != nil && tier.ID != nil && *tier.ID == rewardTierID {
+			return nil
+		}
 	}
 
-	reqAccumulate := &loyalty.AccumulateLoyaltyPointsRequest{
-		AccountID: req.AccountId,
-		AccumulatePoints: &square.LoyaltyEventAccumulatePoints{
-			OrderID: square.String(orderId),
-		},
-		LocationID:     os.Getenv("LOCATION_ID"),
-		IdempotencyKey: idempotencyKey,
-	}
+	return apperrors.New(apperrors.CodeInvalidRewardTier, "The reward tier does not exist").
+		WithDetails([]apperrors.FieldError{{Field: "rewardtier", Message: "does not exist"}})
+}
 
-	_, err = squareClient.Loyalty.Accounts.AccumulatePoints(context.TODO(), reqAccumulate)
+// GetBalance fetches the points balance of the loyalty account
+func (s *loyaltyService) GetBalance(ctx context.Context, accountID string) (int, error) {
+	account, err := s.square.GetLoyaltyAccount(ctx, accountID)
 	if err != nil {
-		return fmt.Errorf("failed to accumulate points: %w", err)
+		return 0, fmt.Errorf("failed to get account %s balance: %w", accountID, err)
 	}
 
-	return nil
+	if account.Balance == nil {
+		return 0, fmt.Errorf("no balance information found for account %s", accountID)
+	}
+
+	s.saveBalance(accountID, *account.Balance)
+	return *account.Balance, nil
 }
 
-// RedeemPoints redeems points for a reward tier
-func RedeemPoints(req dto.RedeemPointsDTO) error {
-
-	squareClient := client.NewClient(
-		option.WithBaseURL(
-			square.Environments.Sandbox,
-		),
-		option.WithToken(os.Getenv("SQUARE_ACCESS_TOKEN")),
-	)
-
-	idempotencyKey := uuid.New().String()
-
-	//Create order
-	reqOrder := &square.CreateOrderRequest{
-		Order: &square.Order{
-			LineItems: []*square.OrderLineItem{
-				&square.OrderLineItem{
-					Name:     square.String(req.Description),
-					Quantity: "1",
-					BasePriceMoney: &square.Money{
-						Amount: square.Int64(
-							int64(req.Amount),
-						),
-						Currency: square.CurrencyUsd.Ptr(),
-					},
-				},
-			},
-			LocationID: os.Getenv("LOCATION_ID"),
-		},
-		IdempotencyKey: &idempotencyKey,
-	}
+// OnBalanceChange adds a listener. Call before serving requests.
+func (s *loyaltyService) OnBalanceChange(listener BalanceListener) {
+	s.listeners = append(s.listeners, listener)
+}
 
-	resOrder, err := squareClient.Orders.Create(context.TODO(), reqOrder)
-	if err != nil {
-		return fmt.Errorf("failed to create order: %w", err)
-	}
+// SetEarnMultiplier sets how many times the usual points each account earns,
+// every account earns the usual points until it is set. Call before serving requests.
+func (s *loyaltyService) SetEarnMultiplier(multiplier EarnMultiplier) {
+	s.multiplier = multiplier
+}
 
-	var orderId = *resOrder.Order.ID
+// saveBalance caches the balance and tells the listeners if it changed
+func (s *loyaltyService) saveBalance(accountID string, balance int) {
+	previous, err := s.snapshots.GetByAccountID(accountID)
+	changed := err != nil || previous.BalanceAt == nil || previous.Balance != balance
 
-	reqReward := &loyalty.CreateLoyaltyRewardRequest{
-		Reward: &square.LoyaltyReward{
-			LoyaltyAccountID: req.AccountId,
-			RewardTierID:     req.RewardTierId,
-			OrderID: square.String(
-				orderId,
-			),
-		},
-		IdempotencyKey: idempotencyKey,
+	if err := s.snapshots.SaveBalance(accountID, balance); err != nil {
+		log.Printf("loyalty: failed to cache balance for account %s: %v", accountID, err)
 	}
 
-	_, err = squareClient.Loyalty.Rewards.Create(context.TODO(), reqReward)
-	if err != nil {
-		return errors.New("failed to create reward")
+	if changed {
+		for _, listener := range s.listeners {
+			listener(accountID, balance)
+		}
 	}
+}
 
-	discountOrderRes, err := squareClient.Orders.Get(
-		context.TODO(),
-		&square.GetOrdersRequest{
-			OrderID: orderId,
-		},
-	)
-
-	if err != nil {
-		return fmt.Errorf("failed to get order details: %w", err)
+// GetBalanceSnapshot is GetBalance for display. While Square's circuit is open
+// it serves the last cached balance, marked stale.
+func (s *loyaltyService) GetBalanceSnapshot(ctx context.Context, accountID string) (*dto.BalanceDTO, error) {
+	balance, err := s.GetBalance(ctx, accountID)
+	if err == nil {
+		return &dto.BalanceDTO{Balance: balance}, nil
+	}
+	if !errors.Is(err, gateway.ErrCircuitOpen) {
+		return nil, err
 	}
 
-	reqPayment := &square.CreatePaymentRequest{
-		SourceID: "cnon:card-nonce-ok",
-		AmountMoney: &square.Money{
-			Amount:   discountOrderRes.Order.TotalMoney.Amount,
-			Currency: square.CurrencyUsd.Ptr(),
-		},
-		OrderID:        square.String(orderId),
-		IdempotencyKey: idempotencyKey,
+	snapshot, snapErr := s.snapshots.GetByAccountID(accountID)
+	if snapErr != nil || snapshot.BalanceAt == nil {
+		return nil, err
 	}
+	return &dto.BalanceDTO{Balance: snapshot.Balance, Stale: true, AsOf: snapshot.BalanceAt}, nil
+}
 
-	paymentRes, err := squareClient.Payments.Create(context.TODO(), reqPayment)
-	if err != nil {
-		return fmt.Errorf("failed to create payment: %w", err)
+// GetHistory retrieves a page of loyalty events (transactions, redemptions, etc.) for the account.
+// While Square's circuit is open the cached first unfiltered page is served,
+// marked stale, and other first pages are served from the local ledger when
+// it has matching operations.
+func (s *loyaltyService) GetHistory(ctx context.Context, accountID string, query dto.HistoryQueryDTO) (*dto.HistoryPage, error) {
+	if strings.HasPrefix(query.Cursor, ledgerCursorPrefix) {
+		return s.ledgerHistoryPage(accountID, query)
 	}
 
-	if paymentRes.Payment == nil || paymentRes.Payment.Status == nil || *paymentRes.Payment.Status != "COMPLETED" {
-		return fmt.Errorf("payment not completed, status: %v", paymentRes.Payment.Status)
+	var history *dto.HistoryPage
+	var err error
+	if query.Sort == dto.HistorySortOldest {
+		history, err = s.oldestHistoryPage(ctx, accountID, query)
+	} else {
+		history, err = s.fetchHistory(ctx, accountID, query)
 	}
 
-	reqAccumulate := &loyalty.AccumulateLoyaltyPointsRequest{
-		AccountID: req.AccountId,
-		AccumulatePoints: &square.LoyaltyEventAccumulatePoints{
-			OrderID:          square.String(orderId),
-			LoyaltyProgramID: &programID,
-		},
-		LocationID:     os.Getenv("LOCATION_ID"),
-		IdempotencyKey: idempotencyKey,
+	if err == nil {
+		if query.IsUnfiltered() {
+			if body, encodeErr := json.Marshal(history); encodeErr == nil {
+				if saveErr := s.snapshots.SaveHistory(accountID, string(body)); saveErr != nil {
+					log.Printf("loyalty: failed to cache history for account %s: %v", accountID, saveErr)
+				}
+			}
+		}
+		return history, nil
+	}
+	if !errors.Is(err, gateway.ErrCircuitOpen) || query.Cursor != "" {
+		return nil, err
 	}
 
-	_, err = squareClient.Loyalty.Accounts.AccumulatePoints(context.TODO(), reqAccumulate)
-	if err != nil {
-		return fmt.Errorf("failed to accumulate points: %w", err)
+	if query.IsUnfiltered() {
+		if cached := s.cachedHistory(accountID); cached != nil {
+			return cached, nil
+		}
 	}
 
-	return nil
+	ledger, ledgerErr := s.ledgerHistoryPage(accountID, query)
+	if ledgerErr != nil {
+		log.Printf("loyalty: failed to read the local ledger for account %s: %v", accountID, ledgerErr)
+	}
+	if ledger == nil {
+		return nil, err
+	}
+	return ledger, nil
 }
 
-// GetBalance fetches the points balance of the loyalty account
-func GetBalance(accountID string) (int, error) {
-
-	squareClient := client.NewClient(
-		option.WithBaseURL(
-			square.Environments.Sandbox,
-		),
-		option.WithToken(os.Getenv("SQUARE_ACCESS_TOKEN")),
-	)
-
-	resp, err := squareClient.Loyalty.Accounts.Get(context.TODO(),
-		&loyalty.GetAccountsRequest{
-			AccountID: accountID,
-		},
-	)
-	if err != nil {
-		return 0, fmt.Errorf("failed to get account %s balance: %w", accountID, err)
+// cachedHistory is the first history page saved for the account, or nil
+func (s *loyaltyService) cachedHistory(accountID string) *dto.HistoryPage {
+	snapshot, err := s.snapshots.GetByAccountID(accountID)
+	if err != nil || snapshot.HistoryAt == nil {
+		return nil
 	}
 
-	if resp == nil || resp.LoyaltyAccount == nil || resp.LoyaltyAccount.Balance == nil {
-		return 0, fmt.Errorf("no balance information found for account %s", accountID)
+	var cached dto.HistoryPage
+	if json.Unmarshal([]byte(snapshot.History), &cached) != nil {
+		return nil
 	}
 
-	return *resp.LoyaltyAccount.Balance, nil
+	// Later pages can't be served from the cache
+	cached.Cursor = ""
+	cached.Stale = true
+	cached.AsOf = snapshot.HistoryAt
+	return &cached
 }
 
-func formatTimestamp(raw string) string {
-	t, err := time.Parse(time.RFC3339, raw)
+func (s *loyaltyService) fetchHistory(ctx context.Context, accountID string, query dto.HistoryQueryDTO) (*dto.HistoryPage, error) {
+	page, err := s.fetchEvents(ctx, accountID, query)
 	if err != nil {
-		return raw
+		return nil, err
 	}
-	return t.Format("2 Jan 2006 15:04")
+	s.addHistoryDetails(ctx, page.Transactions)
+	return page, nil
 }
 
-// GetHistory retrieves loyalty events (transactions, redemptions, etc.) for the account
-func GetHistory(accountID string, cursor string) (*dto.MappedLoyaltyHistoryResponseDTO, error) {
-	squareClient := client.NewClient(
-		option.WithBaseURL(square.Environments.Sandbox),
-		option.WithToken(os.Getenv("SQUARE_ACCESS_TOKEN")),
-	)
+// fetchEvents is fetchHistory without the order, reward and location details
+func (s *loyaltyService) fetchEvents(ctx context.Context, accountID string, query dto.HistoryQueryDTO) (*dto.HistoryPage, error) {
+	filter, err := eventFilter(accountID, query)
+	if err != nil {
+		return nil, err
+	}
 
 	req := &square.SearchLoyaltyEventsRequest{
-		Query: &square.LoyaltyEventQuery{
-			Filter: &square.LoyaltyEventFilter{
-				LoyaltyAccountFilter: &square.LoyaltyEventLoyaltyAccountFilter{
-					LoyaltyAccountID: accountID,
-				},
-			},
-		},
-		Limit: square.Int(10),
+		Query: &square.LoyaltyEventQuery{Filter: filter},
+		Limit: square.Int(historyPageSize(query.Limit)),
 	}
 
-	if cursor != "" {
-		req.Cursor = square.String(cursor)
+	if query.Cursor != "" {
+		req.Cursor = square.String(query.Cursor)
 	}
 
-	resp, err := squareClient.Loyalty.SearchEvents(context.TODO(), req)
+	resp, err := s.square.SearchEvents(ctx, req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch loyalty history for account %s: %w", accountID, err)
 	}
 
-	transactions := make([]dto.TransactionDTO, 0)
-	if resp.Events != nil {
-		for _, e := range resp.Events {
-			if e == nil {
-				continue
-			}
-
-			points := 0
-			switch e.Type {
-			case square.LoyaltyEventTypeAccumulatePoints:
-				if e.AccumulatePoints != nil && e.AccumulatePoints.Points != nil {
-					points = int(*e.AccumulatePoints.Points)
-				}
-			case square.LoyaltyEventTypeAdjustPoints:
-				if e.AdjustPoints != nil {
-					points = e.AdjustPoints.Points
-				}
-			case square.LoyaltyEventTypeCreateReward:
-				if e.CreateReward != nil {
-					points = e.CreateReward.Points
-				}
-			default:
-				points = 0
-			}
-
-			transactions = append(transactions, dto.TransactionDTO{
-				Id:        e.ID,
-				Type:      string(e.Type),
-				Points:    points,
-				Timestamp: formatTimestamp(e.CreatedAt),
-			})
+	transactions := make([]dto.HistoryEntry, 0, len(resp.Events))
+	for _, e := range resp.Events {
+		if e != nil {
+			transactions = append(transactions, historyEntry(e))
 		}
 	}
 
@@ -332,7 +284,7 @@ func GetHistory(accountID string, cursor string) (*dto.MappedLoyaltyHistoryRespo
 		newCursor = *c
 	}
 
-	return &dto.MappedLoyaltyHistoryResponseDTO{
+	return &dto.HistoryPage{
 		Transactions: transactions,
 		Cursor:       newCursor,
 	}, nil
@@ -373,38 +325,55 @@ func MapClosestRewardTier(program *square.LoyaltyProgram, userBalance int) *dto.
 	}
 }
 
-// GetHistory retrieves loyalty events (transactions, redemptions, etc.) for the account
-func GetDiscountPercentageByClosestRewardTier(accountID string) (*dto.RewardTierDTO, error) {
-	squareClient := client.NewClient(
-		option.WithBaseURL(square.Environments.Sandbox),
-		option.WithToken(os.Getenv("SQUARE_ACCESS_TOKEN")),
-	)
-
+// GetDiscountPercentageByClosestRewardTier finds the best reward tier the account's balance reaches
+func (s *loyaltyService) GetDiscountPercentageByClosestRewardTier(ctx context.Context, accountID string) (*dto.RewardTierDTO, error) {
 	// Get loyalty account
-	resp, err := squareClient.Loyalty.Accounts.Get(context.TODO(),
-		&loyalty.GetAccountsRequest{AccountID: accountID})
-	if err != nil || resp.LoyaltyAccount == nil {
+	account, err := s.square.GetLoyaltyAccount(ctx, accountID)
+	if err != nil {
 		return &dto.RewardTierDTO{RewardTierId: "", DiscountPercentage: 0}, fmt.Errorf("failed to get account %s balance: %w", accountID, err)
 	}
 
 	// Safe balance
 	balance := 0
-	if resp.LoyaltyAccount.Balance != nil {
-		balance = *resp.LoyaltyAccount.Balance
+	if account.Balance != nil {
+		balance = *account.Balance
 	}
 
 	// Get loyalty program
-	programRes, err := squareClient.Loyalty.Programs.Get(context.TODO(),
-		&loyalty.GetProgramsRequest{ProgramID: "main"})
-	if err != nil || programRes.Program == nil {
+	program, err := s.square.GetProgram(ctx)
+	if err != nil {
 		return &dto.RewardTierDTO{RewardTierId: "", DiscountPercentage: 0}, fmt.Errorf("failed to retrieve loyalty program: %w", err)
 	}
 
 	// Get closest tier
-	rewardTier := MapClosestRewardTier(programRes.Program, balance)
+	rewardTier := MapClosestRewardTier(program, balance)
 	if rewardTier == nil {
 		return &dto.RewardTierDTO{RewardTierId: "", DiscountPercentage: 0}, nil
 	}
 
 	return rewardTier, nil
 }
+
+// GetAllHistory walks every page of loyalty events for the account
+func (s *loyaltyService) GetAllHistory(ctx context.Context, accountID string) ([]dto.HistoryEntry, error) {
+	return s.walkHistory(ctx, accountID, dto.HistoryQueryDTO{})
+}
+
+// ListHistory fetches every event matching the query's filters, newest first,
+// ignoring its cursor, limit and sort
+func (s *loyaltyService) ListHistory(ctx context.Context, accountID string, query dto.HistoryQueryDTO) ([]dto.HistoryEntry, error) {
+	return s.walkHistory(ctx, accountID, query)
+}
+
+// AdjustPoints adds (positive) or removes (negative) points from the loyalty
+// account. Retrying with the same idempotency key adjusts the account once.
+func (s *loyaltyService) AdjustPoints(ctx context.Context, accountID string, points int, reason, idempotencyKey string) error {
+	return s.square.AdjustPoints(ctx, &loyalty.AdjustLoyaltyPointsRequest{
+		AccountID:      accountID,
+		IdempotencyKey: idempotencyKey,
+		AdjustPoints: &square.LoyaltyEventAdjustPoints{
+			Points: points,
+			Reason: square.String(reason),
+		},
+	})
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gimhanr9/go-loyalty-api/apperrors"
+	"github.com/gimhanr9/go-loyalty-api/config"
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"github.com/gimhanr9/go-loyalty-api/repositories"
+	"github.com/gimhanr9/go-loyalty-api/utils"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// OutboxHandler executes the remote side effect of one outbox message. It must
+// be safe to repeat, using msg.IdempotencyKey for Square calls.
+type OutboxHandler func(ctx context.Context, msg *models.OutboxMessage) error
+
+type OutboxService interface {
+	Handle(kind string, handler OutboxHandler)
+	Dispatch(ctx context.Context, id uint) error
+	DispatchDue(ctx context.Context) error
+	List(status string, limit int) ([]models.OutboxMessage, error)
+	Retry(id uint) (*models.OutboxMessage, error)
+	Start(interval time.Duration)
+	Stop(ctx context.Context) error
+}
+
+type outboxService struct {
+	repo        repositories.OutboxRepository
+	handlers    map[string]OutboxHandler
+	maxAttempts int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+	lease       time.Duration
+
+	// ctx is given to handlers run by the dispatcher, cancelled when Stop gives up waiting
+	ctx     context.Context
+	cancel  context.CancelFunc
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+func NewOutboxService(repo repositories.OutboxRepository) OutboxService {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &outboxService{
+		repo:        repo,
+		handlers:    make(map[string]OutboxHandler),
+		maxAttempts: config.GetEnvInt("OUTBOX_MAX_ATTEMPTS", 10),
+		baseBackoff: config.GetEnvDuration("OUTBOX_BASE_BACKOFF", 5*time.Second),
+		maxBackoff:  config.GetEnvDuration("OUTBOX_MAX_BACKOFF", 30*time.Minute),
+		lease:       config.GetEnvDuration("OUTBOX_LEASE", 5*time.Minute),
+		ctx:         ctx,
+		cancel:      cancel,
+		stop:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+}
+
+// NewOutboxMessage builds a pending message to be created inside the caller's transaction
+func NewOutboxMessage(kind string, payload interface{}) (*models.OutboxMessage, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s payload: %w", kind, err)
+	}
+
+	return &models.OutboxMessage{
+		Kind:           kind,
+		Payload:        string(body),
+		IdempotencyKey: uuid.New().String(),
+		Status:         models.OutboxPending,
+		NextAttemptAt:  time.Now(),
+	}, nil
+}
+
+func (s *outboxService) Handle(kind string, handler OutboxHandler) {
+	s.handlers[kind] = handler
+}
+
+// Dispatch claims and executes one message, rescheduling it on failure.
+// The handler's error is returned so callers dispatching inline can react.
+func (s *outboxService) Dispatch(ctx context.Context, id uint) error {
+	msg, err := s.repo.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if msg.Status != models.OutboxPending {
+		return fmt.Errorf("outbox message %d is %s", id, msg.Status)
+	}
+	return s.run(ctx, msg)
+}
+
+func (s *outboxService) DispatchDue(ctx context.Context) error {
+	now := time.Now()
+	msgs, err := s.repo.ListDue(now, now.Add(-s.lease), 50)
+	if err != nil {
+		return err
+	}
+
+	for i := range msgs {
+		// Leave the rest of the batch pending once shutdown has begun
+		if s.stopping() {
+			return nil
+		}
+		if err := s.run(ctx, &msgs[i]); err != nil {
+			log.Printf("outbox message %d (%s) failed: %v", msgs[i].ID, msgs[i].Kind, err)
+		}
+	}
+	return nil
+}
+
+func (s *outboxService) run(ctx context.Context, msg *models.OutboxMessage) error {
+	claimed, err := s.repo.Claim(msg)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return fmt.Errorf("outbox message %d is already being processed", msg.ID)
+	}
+
+	handler, ok := s.handlers[msg.Kind]
+	if !ok {
+		handlerErr := fmt.Errorf("no handler for outbox kind %q", msg.Kind)
+		s.fail(msg, handlerErr, true)
+		return handlerErr
+	}
+
+	if handlerErr := handler(ctx, msg); handlerErr != nil {
+		s.fail(msg, handlerErr, msg.Attempts >= s.maxAttempts)
+		return handlerErr
+	}
+
+	now := time.Now()
+	msg.Status = models.OutboxDone
+	msg.LastError = ""
+	msg.CompletedAt = &now
+	return s.repo.Update(msg)
+}
+
+// fail records the error and schedules a retry with jittered exponential backoff
+func (s *outboxService) fail(msg *models.OutboxMessage, cause error, permanent bool) {
+	msg.LastError = cause.Error()
+
+	if permanent {
+		msg.Status = models.OutboxFailed
+	} else {
+		msg.Status = models.OutboxPending
+		msg.NextAttemptAt = time.Now().Add(utils.JitteredBackoff(s.baseBackoff, s.maxBackoff, msg.Attempts))
+	}
+
+	if err := s.repo.Update(msg); err != nil {
+		log.Printf("failed to record outbox failure for message %d: %v", msg.ID, err)
+	}
+}
+
+func (s *outboxService) List(status string, limit int) ([]models.OutboxMessage, error) {
+	return s.repo.List(status, limit)
+}
+
+// Retry puts a failed message back in the queue for immediate dispatch
+func (s *outboxService) Retry(id uint) (*models.OutboxMessage, error) {
+	msg, err := s.repo.GetByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperrors.NotFound("outbox message not found")
+		}
+		return nil, err
+	}
+
+	if msg.Status != models.OutboxFailed {
+		return nil, apperrors.Conflict(fmt.Sprintf("only failed messages can be retried, message is %s", msg.Status))
+	}
+
+	msg.Status = models.OutboxPending
+	msg.Attempts = 0
+	msg.NextAttemptAt = time.Now()
+	if err := s.repo.Update(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// Start polls for due messages in the background
+func (s *outboxService) Start(interval time.Duration) {
+	go func() {
+		defer close(s.stopped)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				if err := s.DispatchDue(s.ctx); err != nil {
+					log.Printf("outbox dispatcher: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops dispatching and waits for the message being dispatched to
+// finish. When ctx ends first its handler's context is cancelled, and the
+// failure is recorded so the message is retried rather than left claimed.
+func (s *outboxService) Stop(ctx context.Context) error {
+	close(s.stop)
+
+	select {
+	case <-s.stopped:
+		s.cancel()
+		return nil
+	case <-ctx.Done():
+		s.cancel()
+		<-s.stopped
+		return errors.New("outbox dispatcher drain timed out, the running dispatch was cancelled")
+	}
+}
+
+func (s *outboxService) stopping() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
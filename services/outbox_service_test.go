@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gimhanr9/go-loyalty-api/database/dbtest"
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"github.com/gimhanr9/go-loyalty-api/repositories"
+)
+
+func TestOutboxServiceStop(t *testing.T) {
+	tests := []struct {
+		name       string
+		handlerFor time.Duration // how long the handler runs unless cancelled
+		drain      time.Duration
+		wantErr    bool
+		wantStatus string
+	}{
+		{name: "waits for the running dispatch", handlerFor: 50 * time.Millisecond, drain: time.Second, wantStatus: models.OutboxDone},
+		{name: "cancels a dispatch that outlasts the drain", handlerFor: time.Minute, drain: 50 * time.Millisecond, wantErr: true, wantStatus: models.OutboxPending},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := repositories.NewOutboxRepository(dbtest.Migrated(t))
+			outbox := NewOutboxService(repo)
+
+			started := make(chan struct{})
+			outbox.Handle("slow", func(ctx context.Context, msg *models.OutboxMessage) error {
+				close(started)
+				select {
+				case <-time.After(tt.handlerFor):
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+
+			msg, err := NewOutboxMessage("slow", struct{}{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := repo.Create(msg); err != nil {
+				t.Fatal(err)
+			}
+
+			outbox.Start(10 * time.Millisecond)
+			<-started
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.drain)
+			defer cancel()
+			if err := outbox.Stop(ctx); (err != nil) != tt.wantErr {
+				t.Fatalf("Stop: err = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			stored, err := repo.GetByID(msg.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", stored.Status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestOutboxServiceStopBeforeDue(t *testing.T) {
+	repo := repositories.NewOutboxRepository(dbtest.Migrated(t))
+	outbox := NewOutboxService(repo)
+	outbox.Start(time.Hour)
+
+	if err := outbox.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop of an idle dispatcher: %v", err)
+	}
+}
@@ -0,0 +1,348 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"time"
+
+	"github.com/gimhanr9/go-loyalty-api/apperrors"
+	"github.com/gimhanr9/go-loyalty-api/gateway"
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"github.com/google/uuid"
+	square "github.com/square/square-go-sdk"
+	loyalty "github.com/square/square-go-sdk/loyalty"
+	"gorm.io/gorm"
+)
+
+// ErrOperationPending is returned when an earn or redeem was interrupted by a
+// cancelled request, a timeout or a Square outage. Its progress is saved and it finishes in the
+// background, or when the client retries with the same idempotency key.
+var ErrOperationPending = errors.New("points operation interrupted, it will be completed shortly")
+
+// ErrIdempotencyKeyReused is returned when a key is replayed with a different request
+var ErrIdempotencyKeyReused = apperrors.Conflict("idempotency key was already used for a different request")
+
+// JobResumePointsOperation finishes an interrupted earn or redeem
+const JobResumePointsOperation = "resume_points_operation"
+
+type resumePointsOperationPayload struct {
+	OperationID uint `json:"operation_id"`
+}
+
+type opRequest struct {
+	kind           string
+	accountID      string
+	idempotencyKey string
+	amount         int
+	description    string
+	rewardTierID   string
+}
+
+// startOperation returns the operation for the idempotency key, creating it on first use
+func (s *loyaltyService) startOperation(req opRequest) (*models.PointsOperation, error) {
+	if req.idempotencyKey == "" {
+		req.idempotencyKey = uuid.New().String()
+	}
+
+	existing, err := s.operations.GetByIdempotencyKey(req.idempotencyKey)
+	if err == nil {
+		if existing.Kind != req.kind || existing.AccountID != req.accountID || existing.Amount != req.amount || existing.RewardTierID != req.rewardTierID {
+			return nil, ErrIdempotencyKeyReused
+		}
+		return existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	op := &models.PointsOperation{
+		Kind:           req.kind,
+		AccountID:      req.accountID,
+		IdempotencyKey: req.idempotencyKey,
+		Amount:         req.amount,
+		Description:    req.description,
+		RewardTierID:   req.rewardTierID,
+		Step:           models.StepStarted,
+	}
+	if err := s.operations.Create(op); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+// runOperation drives the operation to completion. An interruption is handed
+// to the job runner so the customer still gets their points.
+func (s *loyaltyService) runOperation(ctx context.Context, op *models.PointsOperation) error {
+	err := s.advance(ctx, op)
+	if err == nil || !isInterrupted(ctx, err) {
+		return err
+	}
+
+	_, enqueueErr := s.jobs.EnqueueUnique(JobResumePointsOperation, fmt.Sprintf("points_operation:%d", op.ID),
+		resumePointsOperationPayload{OperationID: op.ID}, time.Now())
+	if enqueueErr != nil {
+		log.Printf("loyalty: failed to schedule resume of points operation %d: %v", op.ID, enqueueErr)
+	}
+	return ErrOperationPending
+}
+
+// ResumeOperation continues an interrupted operation from its last saved step
+func (s *loyaltyService) ResumeOperation(ctx context.Context, operationID uint) error {
+	op, err := s.operations.GetByID(operationID)
+	if err != nil {
+		return err
+	}
+	return s.advance(ctx, op)
+}
+
+// advance runs the remaining steps, saving after each so a retry never repeats
+// a completed step. Every Square call reuses the operation's idempotency key.
+func (s *loyaltyService) advance(ctx context.Context, op *models.PointsOperation) error {
+	for op.Step != models.StepCompleted {
+		var err error
+		if op.Kind == models.PointsOperationRedeem {
+			err = s.redeemStep(ctx, op)
+		} else {
+			err = s.earnStep(ctx, op)
+		}
+
+		if err != nil {
+			op.LastError = err.Error()
+			if saveErr := s.operations.Update(op); saveErr != nil {
+				log.Printf("loyalty: failed to save points operation %d: %v", op.ID, saveErr)
+			}
+			return err
+		}
+
+		op.LastError = ""
+		if err := s.operations.Update(op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *loyaltyService) earnStep(ctx context.Context, op *models.PointsOperation) error {
+	switch op.Step {
+	case models.StepStarted:
+		account, err := s.square.GetLoyaltyAccount(ctx, op.AccountID)
+		if err != nil {
+			return fmt.Errorf("failed to get customer: %w", err)
+		}
+
+		order, err := s.square.CreateOrder(ctx, newPointsOrder(op, account.CustomerID))
+		if err != nil {
+			return err
+		}
+		op.OrderID = *order.ID
+		op.Step = models.StepOrderCreated
+
+	case models.StepOrderCreated:
+		payment, err := s.square.CreatePayment(ctx, newPointsPayment(op, int64(op.Amount)))
+		if err != nil {
+			return err
+		}
+		op.PaymentID = paymentID(payment)
+		op.Step = models.StepPaid
+
+	case models.StepPaid:
+		return s.accumulate(ctx, op, nil)
+
+	case models.StepAccumulated:
+		return s.addBonus(ctx, op)
+
+	default:
+		return fmt.Errorf("unknown step %q for earn operation %d", op.Step, op.ID)
+	}
+	return nil
+}
+
+func (s *loyaltyService) redeemStep(ctx context.Context, op *models.PointsOperation) error {
+	switch op.Step {
+	case models.StepStarted:
+		order, err := s.square.CreateOrder(ctx, newPointsOrder(op, nil))
+		if err != nil {
+			return err
+		}
+		op.OrderID = *order.ID
+		op.Step = models.StepOrderCreated
+
+	case models.StepOrderCreated:
+		reward, err := s.square.CreateReward(ctx, &loyalty.CreateLoyaltyRewardRequest{
+			Reward: &square.LoyaltyReward{
+				LoyaltyAccountID: op.AccountID,
+				RewardTierID:     op.RewardTierID,
+				OrderID:          square.String(op.OrderID),
+			},
+			IdempotencyKey: op.IdempotencyKey,
+		})
+		if err != nil {
+			return err
+		}
+		if reward != nil && reward.ID != nil {
+			op.RewardID = *reward.ID
+		}
+		if reward != nil && reward.Points != nil {
+			op.RewardPoints = *reward.Points
+		}
+		op.Step = models.StepRewardCreated
+
+	case models.StepRewardCreated:
+		// Pay the discounted total now that the reward is on the order
+		order, err := s.square.GetOrder(ctx, op.OrderID)
+		if err != nil {
+			return err
+		}
+		if order.TotalMoney == nil || order.TotalMoney.Amount == nil {
+			return fmt.Errorf("order %s has no total", op.OrderID)
+		}
+
+		payment, err := s.square.CreatePayment(ctx, newPointsPayment(op, *order.TotalMoney.Amount))
+		if err != nil {
+			return err
+		}
+		op.PaymentID = paymentID(payment)
+		op.Step = models.StepPaid
+
+	case models.StepPaid:
+		program, err := s.square.GetProgram(ctx)
+		if err != nil {
+			return err
+		}
+
+		return s.accumulate(ctx, op, program.ID)
+
+	case models.StepAccumulated:
+		return s.addBonus(ctx, op)
+
+	default:
+		return fmt.Errorf("unknown step %q for redeem operation %d", op.Step, op.ID)
+	}
+	return nil
+}
+
+// accumulate earns the points for the paid order and works out the status
+// bonus on top, which is added as a separate step
+func (s *loyaltyService) accumulate(ctx context.Context, op *models.PointsOperation, programID *string) error {
+	events, err := s.square.AccumulatePoints(ctx, &loyalty.AccumulateLoyaltyPointsRequest{
+		AccountID: op.AccountID,
+		AccumulatePoints: &square.LoyaltyEventAccumulatePoints{
+			OrderID:          square.String(op.OrderID),
+			LoyaltyProgramID: programID,
+		},
+		LocationID:     os.Getenv("LOCATION_ID"),
+		IdempotencyKey: op.IdempotencyKey,
+	})
+	if err != nil {
+		return err
+	}
+
+	op.EarnedPoints = accumulatedPoints(events)
+	op.BonusPoints, op.BonusReason = s.bonus(op.AccountID, op.EarnedPoints)
+	if op.BonusPoints > 0 {
+		op.Step = models.StepAccumulated
+	} else {
+		op.Step = models.StepCompleted
+	}
+	return nil
+}
+
+// bonus is what the account's earn multiplier adds to the points earned.
+// Promotion points are not multiplied.
+func (s *loyaltyService) bonus(accountID string, points int) (int, string) {
+	if s.multiplier == nil || points <= 0 {
+		return 0, ""
+	}
+	multiplier, reason := s.multiplier(accountID)
+	if multiplier <= 1 {
+		return 0, ""
+	}
+	return int(math.Floor(float64(points)*(multiplier-1) + 1e-9)), reason
+}
+
+func (s *loyaltyService) addBonus(ctx context.Context, op *models.PointsOperation) error {
+	err := s.square.AdjustPoints(ctx, &loyalty.AdjustLoyaltyPointsRequest{
+		AccountID: op.AccountID,
+		AdjustPoints: &square.LoyaltyEventAdjustPoints{
+			Points: op.BonusPoints,
+			Reason: square.String(op.BonusReason),
+		},
+		IdempotencyKey: op.IdempotencyKey,
+	})
+	if err != nil {
+		return err
+	}
+	op.Step = models.StepCompleted
+	return nil
+}
+
+func accumulatedPoints(events []*square.LoyaltyEvent) int {
+	points := 0
+	for _, event := range events {
+		if event != nil && event.AccumulatePoints != nil && event.AccumulatePoints.Points != nil {
+			points += *event.AccumulatePoints.Points
+		}
+	}
+	return points
+}
+
+func newPointsOrder(op *models.PointsOperation, customerID *string) *square.CreateOrderRequest {
+	return &square.CreateOrderRequest{
+		Order: &square.Order{
+			LineItems: []*square.OrderLineItem{
+				{
+					Name:     square.String(op.Description),
+					Quantity: "1",
+					BasePriceMoney: &square.Money{
+						Amount:   square.Int64(int64(op.Amount)),
+						Currency: square.CurrencyUsd.Ptr(),
+					},
+				},
+			},
+			CustomerID: customerID,
+			LocationID: os.Getenv("LOCATION_ID"),
+		},
+		IdempotencyKey: square.String(op.IdempotencyKey),
+	}
+}
+
+func newPointsPayment(op *models.PointsOperation, amount int64) *square.CreatePaymentRequest {
+	return &square.CreatePaymentRequest{
+		SourceID: "cnon:card-nonce-ok",
+		AmountMoney: &square.Money{
+			Amount:   square.Int64(amount),
+			Currency: square.CurrencyUsd.Ptr(),
+		},
+		OrderID:        square.String(op.OrderID),
+		IdempotencyKey: op.IdempotencyKey,
+	}
+}
+
+func paymentID(payment *square.Payment) string {
+	if payment.ID == nil {
+		return ""
+	}
+	return *payment.ID
+}
+
+// isInterrupted reports whether err came from a cancelled request, a timeout or
+// Square being unavailable, rather than Square rejecting the call
+func isInterrupted(ctx context.Context, err error) bool {
+	return ctx.Err() != nil || errors.Is(err, context.Canceled) || gateway.IsTransient(err)
+}
+
+// RegisterLoyaltyJobs lets the job runner finish interrupted earn and redeem operations
+func RegisterLoyaltyJobs(jobs JobService, loyaltyService LoyaltyService) {
+	jobs.Register(JobResumePointsOperation, func(ctx context.Context, job *models.Job) error {
+		var payload resumePointsOperationPayload
+		if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+			return err
+		}
+		return loyaltyService.ResumeOperation(ctx, payload.OperationID)
+	}, JobOptions{})
+}
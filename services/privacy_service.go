@@ -0,0 +1,227 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gimhanr9/go-loyalty-api/apperrors"
+	"github.com/gimhanr9/go-loyalty-api/config"
+	"github.com/gimhanr9/go-loyalty-api/dto"
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"github.com/gimhanr9/go-loyalty-api/repositories"
+	"gorm.io/gorm"
+)
+
+type PrivacyService interface {
+	RequestDeletion(ctx context.Context, userID uint, actor string, immediate bool) (*models.User, error)
+	CancelDeletion(userID uint, actor string) (*models.User, error)
+	ProcessDueDeletions(ctx context.Context) error
+	Export(ctx context.Context, userID uint) ([]byte, error)
+}
+
+type privacyService struct {
+	repo        repositories.AuthRepository
+	auditRepo   repositories.AuditRepository
+	loyalty     LoyaltyService
+	transactor  repositories.Transactor
+	outbox      OutboxService
+	gracePeriod time.Duration
+}
+
+func NewPrivacyService(repo repositories.AuthRepository, auditRepo repositories.AuditRepository, loyalty LoyaltyService, transactor repositories.Transactor, outbox OutboxService) PrivacyService {
+	return &privacyService{
+		repo:        repo,
+		auditRepo:   auditRepo,
+		loyalty:     loyalty,
+		transactor:  transactor,
+		outbox:      outbox,
+		gracePeriod: config.GetEnvDuration("DELETION_GRACE_PERIOD", 30*24*time.Hour),
+	}
+}
+
+func (s *privacyService) getUser(userID uint) (*models.User, error) {
+	user, err := s.repo.GetByID(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperrors.NotFound("user not found")
+		}
+		return nil, err
+	}
+	if user.AnonymizedAt != nil {
+		return nil, apperrors.Conflict("user has already been deleted")
+	}
+	return user, nil
+}
+
+// RequestDeletion schedules the account for deletion after the grace period,
+// or deletes it straight away when immediate is set
+func (s *privacyService) RequestDeletion(ctx context.Context, userID uint, actor string, immediate bool) (*models.User, error) {
+	user, err := s.getUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if immediate {
+		if err := s.finalizeDeletion(ctx, user, actor); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+
+	if user.DeletionScheduledAt != nil {
+		return user, nil
+	}
+
+	scheduledAt := time.Now().Add(s.gracePeriod)
+	user.DeletionScheduledAt = &scheduledAt
+	if err := s.repo.Update(user); err != nil {
+		return nil, err
+	}
+
+	recordAudit(s.auditRepo, user.ID, "deletion_requested", actor, "scheduled for "+scheduledAt.Format(time.RFC3339))
+	return user, nil
+}
+
+func (s *privacyService) CancelDeletion(userID uint, actor string) (*models.User, error) {
+	user, err := s.getUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.DeletionScheduledAt == nil {
+		return nil, apperrors.Conflict("no deletion is scheduled")
+	}
+
+	user.DeletionScheduledAt = nil
+	if err := s.repo.Update(user); err != nil {
+		return nil, err
+	}
+
+	recordAudit(s.auditRepo, user.ID, "deletion_cancelled", actor, "")
+	return user, nil
+}
+
+// ProcessDueDeletions deletes every account whose grace period has ended
+func (s *privacyService) ProcessDueDeletions(ctx context.Context) error {
+	users, err := s.repo.ListDueForDeletion(time.Now())
+	if err != nil {
+		return err
+	}
+
+	for i := range users {
+		if err := s.finalizeDeletion(ctx, &users[i], ActorSystem); err != nil {
+			log.Printf("failed to delete user %d: %v", users[i].ID, err)
+		}
+	}
+	return nil
+}
+
+// finalizeDeletion removes the Square customer, anonymizes the local row and revokes tokens
+func (s *privacyService) finalizeDeletion(ctx context.Context, user *models.User, actor string) error {
+	accountID := user.CustomerID
+
+	now := time.Now()
+	user.Name = ""
+	user.Email = fmt.Sprintf("deleted-%d@invalid", user.ID)
+	user.Phone = fmt.Sprintf("deleted-%d", user.ID)
+	user.CustomerID = ""
+	user.DeletionScheduledAt = nil
+	user.AnonymizedAt = &now
+	user.TokensRevokedAt = &now
+
+	var msg *models.OutboxMessage
+	err := s.transactor.WithinTransaction(func(repos repositories.TxRepositories) error {
+		if err := repos.Users.Update(user); err != nil {
+			return err
+		}
+
+		if accountID != "" {
+			var err error
+			msg, err = NewOutboxMessage(OutboxDeleteSquareCustomer, squareCustomerPayload{AccountID: accountID})
+			if err != nil {
+				return err
+			}
+			if err := repos.Outbox.Create(msg); err != nil {
+				return err
+			}
+		}
+
+		recordAudit(repos.Audit, user.ID, "account_deleted", actor, "")
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The Square customer is deleted in the background if this first attempt fails
+	if msg != nil {
+		if err := s.outbox.Dispatch(ctx, msg.ID); err != nil {
+			log.Printf("Square customer deletion for user %d queued for retry: %v", user.ID, err)
+		}
+	}
+	return nil
+}
+
+// Export bundles the user's profile, points history and audit entries into a zip of JSON files
+func (s *privacyService) Export(ctx context.Context, userID uint) ([]byte, error) {
+	user, err := s.getUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := s.loyalty.GetAllHistory(ctx, user.CustomerID)
+	if err != nil {
+		return nil, err
+	}
+
+	audit, err := s.auditRepo.ListByUserID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]interface{}{
+		"profile.json": user,
+		"history.json": dto.NewTransactionDTOs(history),
+		"audit.json":   audit,
+	}
+
+	buf := new(bytes.Buffer)
+	archive := zip.NewWriter(buf)
+
+	for _, name := range []string{"profile.json", "history.json", "audit.json"} {
+		w, err := archive.Create(name)
+		if err != nil {
+			return nil, err
+		}
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(files[name]); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+
+	recordAudit(s.auditRepo, user.ID, "data_exported", ActorCustomer, "")
+	return buf.Bytes(), nil
+}
+
+// JobProcessDueDeletions is the scheduled job that finalizes deletions
+const JobProcessDueDeletions = "process_due_deletions"
+
+// RegisterPrivacyJobs schedules the sweep that deletes accounts whose grace period has ended
+func RegisterPrivacyJobs(jobs JobService, privacy PrivacyService, interval time.Duration) {
+	jobs.Register(JobProcessDueDeletions, func(ctx context.Context, job *models.Job) error {
+		return privacy.ProcessDueDeletions(ctx)
+	}, JobOptions{MaxConcurrency: 1})
+	jobs.Every(JobProcessDueDeletions, interval)
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/gimhanr9/go-loyalty-api/apperrors"
+	"github.com/gimhanr9/go-loyalty-api/config"
+	"github.com/gimhanr9/go-loyalty-api/dto"
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"github.com/gimhanr9/go-loyalty-api/repositories"
+	"github.com/gimhanr9/go-loyalty-api/utils"
+	"gorm.io/gorm"
+)
+
+const maxVerificationAttempts = 5
+
+type ProfileService interface {
+	GetProfile(customerID string) (*models.User, error)
+	UpdateProfile(customerID string, req dto.UpdateProfileDTO) (*models.User, error)
+	RequestPhoneChange(customerID string, req dto.PhoneChangeDTO) error
+	ConfirmPhoneChange(ctx context.Context, customerID string, req dto.VerifyPhoneChangeDTO) (*models.User, error)
+}
+
+type profileService struct {
+	repo       repositories.AuthRepository
+	phoneRepo  repositories.PhoneChangeRepository
+	auditRepo  repositories.AuditRepository
+	transactor repositories.Transactor
+	outbox     OutboxService
+	sms        SMSSender
+	codeTTL    time.Duration
+}
+
+func NewProfileService(repo repositories.AuthRepository, phoneRepo repositories.PhoneChangeRepository, auditRepo repositories.AuditRepository, transactor repositories.Transactor, outbox OutboxService, sms SMSSender) ProfileService {
+	return &profileService{
+		repo:       repo,
+		phoneRepo:  phoneRepo,
+		auditRepo:  auditRepo,
+		transactor: transactor,
+		outbox:     outbox,
+		sms:        sms,
+		codeTTL:    config.GetEnvDuration("PHONE_CHANGE_CODE_TTL", 10*time.Minute),
+	}
+}
+
+func (s *profileService) GetProfile(customerID string) (*models.User, error) {
+	user, err := s.repo.GetByCustomerID(customerID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperrors.NotFound("user not found")
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *profileService) UpdateProfile(customerID string, req dto.UpdateProfileDTO) (*models.User, error) {
+	user, err := s.GetProfile(customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			return nil, apperrors.InvalidRequest("name cannot be empty")
+		}
+		user.Name = name
+	}
+
+	if req.Email != nil {
+		email, err := utils.NormalizeEmail(*req.Email)
+		if err != nil {
+			return nil, err
+		}
+		user.Email = email
+	}
+
+	existing, _ := s.repo.GetOtherByEmailOrPhone(user.ID, user.Email, user.Phone)
+	if existing != nil {
+		return nil, apperrors.Conflict("user with email or phone already exists")
+	}
+
+	if err := s.repo.Update(user); err != nil {
+		return nil, err
+	}
+
+	recordAudit(s.auditRepo, user.ID, "profile_updated", ActorCustomer, "")
+	return user, nil
+}
+
+// RequestPhoneChange sends a verification code to the new phone number
+func (s *profileService) RequestPhoneChange(customerID string, req dto.PhoneChangeDTO) error {
+	user, err := s.GetProfile(customerID)
+	if err != nil {
+		return err
+	}
+
+	phone, err := utils.NormalizePhone(req.Phone)
+	if err != nil {
+		return err
+	}
+	if phone == user.Phone {
+		return apperrors.InvalidRequest("phone number is unchanged")
+	}
+
+	existing, _ := s.repo.GetOtherByEmailOrPhone(user.ID, user.Email, phone)
+	if existing != nil {
+		return apperrors.Conflict("user with email or phone already exists")
+	}
+
+	code, err := generateVerificationCode()
+	if err != nil {
+		return fmt.Errorf("failed to generate verification code: %w", err)
+	}
+
+	// Only the most recent request can be confirmed
+	if err := s.phoneRepo.DeleteByUserID(user.ID); err != nil {
+		return err
+	}
+
+	change := &models.PhoneChange{
+		UserID:    user.ID,
+		NewPhone:  phone,
+		CodeHash:  hashVerificationCode(code),
+		ExpiresAt: time.Now().Add(s.codeTTL),
+	}
+	if err := s.phoneRepo.Create(change); err != nil {
+		return err
+	}
+
+	recordAudit(s.auditRepo, user.ID, "phone_change_requested", ActorCustomer, "")
+	return s.sms.Send(phone, fmt.Sprintf("Your loyalty verification code is %s", code))
+}
+
+// ConfirmPhoneChange verifies the code, moves the Square customer to the new number and updates the user
+func (s *profileService) ConfirmPhoneChange(ctx context.Context, customerID string, req dto.VerifyPhoneChangeDTO) (*models.User, error) {
+	user, err := s.GetProfile(customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	change, err := s.phoneRepo.GetLatestByUserID(user.ID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperrors.NotFound("no pending phone number change")
+		}
+		return nil, err
+	}
+
+	if time.Now().After(change.ExpiresAt) || change.Attempts >= maxVerificationAttempts {
+		_ = s.phoneRepo.DeleteByUserID(user.ID)
+		return nil, apperrors.InvalidRequest("verification code expired, please request a new one")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashVerificationCode(strings.TrimSpace(req.Code))), []byte(change.CodeHash)) != 1 {
+		change.Attempts++
+		if err := s.phoneRepo.Update(change); err != nil {
+			return nil, err
+		}
+		return nil, apperrors.InvalidRequest("invalid verification code")
+	}
+
+	existing, _ := s.repo.GetOtherByEmailOrPhone(user.ID, user.Email, change.NewPhone)
+	if existing != nil {
+		return nil, apperrors.Conflict("user with email or phone already exists")
+	}
+
+	user.Phone = change.NewPhone
+
+	var msg *models.OutboxMessage
+	err = s.transactor.WithinTransaction(func(repos repositories.TxRepositories) error {
+		if err := repos.Users.Update(user); err != nil {
+			return err
+		}
+
+		msg, err = NewOutboxMessage(OutboxUpdateCustomerPhone, squareCustomerPayload{AccountID: user.CustomerID, Phone: user.Phone})
+		if err != nil {
+			return err
+		}
+		if err := repos.Outbox.Create(msg); err != nil {
+			return err
+		}
+
+		recordAudit(repos.Audit, user.ID, "phone_changed", ActorCustomer, "")
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.phoneRepo.DeleteByUserID(user.ID); err != nil {
+		return nil, err
+	}
+
+	// Square is updated in the background if this first attempt fails
+	if err := s.outbox.Dispatch(ctx, msg.ID); err != nil {
+		log.Printf("phone change for user %d queued for retry: %v", user.ID, err)
+	}
+
+	return user, nil
+}
+
+func generateVerificationCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+func hashVerificationCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,598 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	square "github.com/square/square-go-sdk"
+	"github.com/square/square-go-sdk/loyalty"
+	"gorm.io/gorm"
+
+	"github.com/gimhanr9/go-loyalty-api/apperrors"
+	"github.com/gimhanr9/go-loyalty-api/config"
+	"github.com/gimhanr9/go-loyalty-api/dto"
+	"github.com/gimhanr9/go-loyalty-api/gateway"
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"github.com/gimhanr9/go-loyalty-api/repositories"
+)
+
+// Why a referral was rejected at registration or later
+const (
+	ReferralRejectSelf           = "self_referral"
+	ReferralRejectSameDevice     = "same_device"
+	ReferralRejectPhoneReferred  = "phone_already_referred"
+	ReferralRejectCapReached     = "cap_reached"
+	ReferralRejectAccountDeleted = "account_deleted"
+)
+
+// referralCodeAlphabet leaves out 0, O, 1 and I, which are easy to misread
+const referralCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+const referralCodeLength = 8
+
+// ReferralService runs refer-a-friend: every customer gets a code, and once a
+// friend who registered with it completes their first qualifying earn both
+// accounts receive bonus points. The program is off while neither bonus is set.
+type ReferralService interface {
+	Enroll(repos repositories.TxRepositories, user *models.User, req dto.RegisterDTO) error
+	GetStatus(userID uint) (*dto.ReferralStatusDTO, error)
+	BalanceChanged(accountID string, balance int)
+	Check(ctx context.Context, referralID uint) error
+	CheckAll() error
+}
+
+type referralService struct {
+	users          repositories.AuthRepository
+	referrals      repositories.ReferralRepository
+	audit          repositories.AuditRepository
+	loyalty        LoyaltyService
+	square         gateway.SquareGateway
+	jobs           JobService
+	referrerPoints int
+	refereePoints  int
+	minEarn        int
+	maxReferrals   int           // 0 for no cap
+	qualifyWithin  time.Duration // 0 for no limit
+	hashKey        []byte        // keys the phone and device hashes
+}
+
+// NewReferralService fails on invalid REFERRAL_* settings, and when the
+// program is on without REFERRAL_HASH_KEY
+func NewReferralService(users repositories.AuthRepository, referrals repositories.ReferralRepository, audit repositories.AuditRepository, loyalty LoyaltyService, squareGateway gateway.SquareGateway, jobs JobService) (ReferralService, error) {
+	s := &referralService{
+		users:          users,
+		referrals:      referrals,
+		audit:          audit,
+		loyalty:        loyalty,
+		square:         squareGateway,
+		jobs:           jobs,
+		referrerPoints: config.GetEnvInt("REFERRAL_REFERRER_POINTS", 0),
+		refereePoints:  config.GetEnvInt("REFERRAL_REFEREE_POINTS", 0),
+		minEarn:        config.GetEnvInt("REFERRAL_QUALIFYING_POINTS", 1),
+		maxReferrals:   config.GetEnvInt("REFERRAL_MAX_PER_REFERRER", 10),
+		qualifyWithin:  config.GetEnvDuration("REFERRAL_QUALIFY_WITHIN", 90*24*time.Hour),
+		hashKey:        []byte(config.GetEnv("REFERRAL_HASH_KEY", "")),
+	}
+	if s.referrerPoints < 0 || s.refereePoints < 0 {
+		return nil, errors.New("REFERRAL_REFERRER_POINTS and REFERRAL_REFEREE_POINTS can't be negative")
+	}
+	if s.minEarn < 1 {
+		return nil, errors.New("REFERRAL_QUALIFYING_POINTS must be at least 1")
+	}
+	if s.maxReferrals < 0 {
+		return nil, errors.New("REFERRAL_MAX_PER_REFERRER can't be negative")
+	}
+	if s.enabled() && len(s.hashKey) < 32 {
+		return nil, errors.New("the referral program needs REFERRAL_HASH_KEY, a secret of at least 32 characters")
+	}
+	return s, nil
+}
+
+func (s *referralService) enabled() bool {
+	return s.referrerPoints > 0 || s.refereePoints > 0
+}
+
+// Enroll gives a newly registered user their own code and records who
+// referred them, as part of the registration's transaction. An unknown code
+// fails the registration so the customer can correct it. A referral caught
+// by the fraud guards is recorded as rejected and the registration goes ahead.
+func (s *referralService) Enroll(repos repositories.TxRepositories, user *models.User, req dto.RegisterDTO) error {
+	if !s.enabled() {
+		return nil
+	}
+
+	var referrer *models.User
+	var referrerCode *models.ReferralCode
+	if code := normalizeReferralCode(req.ReferralCode); code != "" {
+		var err error
+		referrerCode, err = repos.Referrals.GetCode(code)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apperrors.InvalidRequest("unknown referral code")
+		} else if err != nil {
+			return err
+		}
+
+		referrer, err = repos.Users.GetByID(referrerCode.UserID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apperrors.InvalidRequest("unknown referral code")
+		} else if err != nil {
+			return err
+		}
+		if referrer.AnonymizedAt != nil || referrer.DeletionScheduledAt != nil {
+			return apperrors.InvalidRequest("unknown referral code")
+		}
+	}
+
+	deviceHash := s.hashIdentifier(strings.TrimSpace(req.DeviceID))
+	if _, err := createReferralCode(repos.Referrals, user.ID, deviceHash); err != nil {
+		return err
+	}
+
+	if referrer == nil {
+		return nil
+	}
+
+	referral := &models.Referral{
+		ReferrerID: referrer.ID,
+		RefereeID:  user.ID,
+		Status:     models.ReferralPending,
+		PhoneHash:  s.hashIdentifier(user.Phone),
+		DeviceHash: deviceHash,
+	}
+	reason, err := s.fraudCheck(repos.Referrals, referrer, referrerCode, user, referral)
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		referral.Status = models.ReferralRejected
+		referral.RejectReason = reason
+	}
+	if err := repos.Referrals.Create(referral); err != nil {
+		return err
+	}
+
+	details := fmt.Sprintf("referred by user %d", referrer.ID)
+	if reason != "" {
+		recordAudit(repos.Audit, user.ID, "referral_rejected", ActorSystem, details+": "+reason)
+		return nil
+	}
+	recordAudit(repos.Audit, user.ID, "referral_started", ActorCustomer, details)
+	return nil
+}
+
+// fraudCheck is the reason to reject the referral, "" when it may go ahead.
+// Phones and devices count once across every referral ever made, so deleting
+// an account and registering again doesn't earn a second bonus.
+func (s *referralService) fraudCheck(referrals repositories.ReferralRepository, referrer *models.User, referrerCode *models.ReferralCode, referee *models.User, referral *models.Referral) (string, error) {
+	if referrer.ID == referee.ID || canonicalEmail(referrer.Email) == canonicalEmail(referee.Email) {
+		return ReferralRejectSelf, nil
+	}
+
+	if referral.DeviceHash != "" {
+		if referral.DeviceHash == referrerCode.DeviceHash {
+			return ReferralRejectSameDevice, nil
+		}
+		referred, err := referrals.DeviceReferred(referral.DeviceHash)
+		if err != nil {
+			return "", err
+		}
+		if referred {
+			return ReferralRejectSameDevice, nil
+		}
+	}
+
+	referred, err := referrals.PhoneReferred(referral.PhoneHash)
+	if err != nil {
+		return "", err
+	}
+	if referred {
+		return ReferralRejectPhoneReferred, nil
+	}
+
+	if s.maxReferrals > 0 {
+		count, err := referrals.CountTowardsCap(referrer.ID)
+		if err != nil {
+			return "", err
+		}
+		if count >= int64(s.maxReferrals) {
+			return ReferralRejectCapReached, nil
+		}
+	}
+	return "", nil
+}
+
+// GetStatus is the customer's code and their referrals. Customers who
+// registered before the program, or by linking an in-store account, get
+// their code here.
+func (s *referralService) GetStatus(userID uint) (*dto.ReferralStatusDTO, error) {
+	if !s.enabled() {
+		return nil, apperrors.NotFound("the referral program is not running")
+	}
+
+	if _, err := s.users.GetByID(userID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperrors.NotFound("user not found")
+		}
+		return nil, err
+	}
+
+	code, err := s.referrals.GetCodeByUserID(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		code, err = createReferralCode(s.referrals, userID, "")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	referrals, err := s.referrals.ListByReferrer(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &dto.ReferralStatusDTO{
+		Code:             code.Code,
+		ReferrerPoints:   s.referrerPoints,
+		RefereePoints:    s.refereePoints,
+		QualifyingPoints: s.minEarn,
+		Referrals:        make([]dto.ReferralDTO, 0, len(referrals)),
+	}
+	for _, referral := range referrals {
+		entry := s.referralEntry(referral, referral.ReferrerPoints)
+		if referee, err := s.users.GetByID(referral.RefereeID); err == nil {
+			entry.Name = firstName(referee.Name)
+		}
+		status.Referrals = append(status.Referrals, entry)
+		status.PointsEarned += referral.ReferrerPoints
+	}
+
+	if s.maxReferrals > 0 {
+		counted, err := s.referrals.CountTowardsCap(userID)
+		if err != nil {
+			return nil, err
+		}
+		limit := s.maxReferrals
+		remaining := max(0, limit-int(counted))
+		status.MaxReferrals = &limit
+		status.Remaining = &remaining
+	}
+
+	own, err := s.referrals.GetByRefereeID(userID)
+	if err == nil {
+		entry := s.referralEntry(*own, own.RefereePoints)
+		status.ReferredBy = &entry
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	return status, nil
+}
+
+func (s *referralService) referralEntry(referral models.Referral, points int) dto.ReferralDTO {
+	entry := dto.ReferralDTO{
+		Status:     referral.Status,
+		Points:     points,
+		CreatedAt:  referral.CreatedAt,
+		RewardedAt: referral.RewardedAt,
+	}
+	if referral.Status == models.ReferralPending && s.qualifyWithin > 0 {
+		qualifyBy := referral.CreatedAt.Add(s.qualifyWithin)
+		entry.QualifyBy = &qualifyBy
+	}
+	return entry
+}
+
+// BalanceChanged checks a referee's open referral when their balance moves,
+// which is usually their first earn
+func (s *referralService) BalanceChanged(accountID string, balance int) {
+	if !s.enabled() {
+		return
+	}
+
+	user, err := s.users.GetByCustomerID(accountID)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("referral: failed to look up user of account %s: %v", accountID, err)
+		}
+		return
+	}
+	referral, err := s.referrals.GetByRefereeID(user.ID)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("referral: failed to look up referral of user %d: %v", user.ID, err)
+		}
+		return
+	}
+	if referral.Status == models.ReferralPending || referral.Status == models.ReferralQualified {
+		s.queueCheck(referral.ID)
+	}
+}
+
+// Check qualifies a pending referral once the referee has earned enough, or
+// expires it when they didn't in time, and adds the bonuses of a qualified one
+func (s *referralService) Check(ctx context.Context, referralID uint) error {
+	referral, err := s.referrals.GetByID(referralID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	switch referral.Status {
+	case models.ReferralPending:
+		return s.qualify(ctx, referral)
+	case models.ReferralQualified:
+		return s.reward(ctx, referral)
+	default:
+		return nil
+	}
+}
+
+func (s *referralService) qualify(ctx context.Context, referral *models.Referral) error {
+	referee, err := s.users.GetByID(referral.RefereeID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if err != nil || referee.AnonymizedAt != nil {
+		return s.close(referral, models.ReferralRejected, ReferralRejectAccountDeleted)
+	}
+
+	now := time.Now()
+	var deadline time.Time
+	if s.qualifyWithin > 0 {
+		deadline = referral.CreatedAt.Add(s.qualifyWithin)
+	}
+
+	// The loyalty account is still being created
+	if referee.CustomerID == "" {
+		if !deadline.IsZero() && now.After(deadline) {
+			return s.close(referral, models.ReferralExpired, "")
+		}
+		return nil
+	}
+
+	// Adjustments, such as status and referral bonuses, aren't earns
+	entries, err := s.loyalty.ListHistory(ctx, referee.CustomerID, dto.HistoryQueryDTO{
+		Types: []string{dto.HistoryTypeEarned},
+		From:  referral.CreatedAt.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+
+	var qualifiedAt *time.Time
+	for _, entry := range entries {
+		if entry.Points < s.minEarn || (!deadline.IsZero() && entry.CreatedAt.After(deadline)) {
+			continue
+		}
+		if qualifiedAt == nil || entry.CreatedAt.Before(*qualifiedAt) {
+			createdAt := entry.CreatedAt
+			qualifiedAt = &createdAt
+		}
+	}
+
+	if qualifiedAt == nil {
+		if !deadline.IsZero() && now.After(deadline) {
+			return s.close(referral, models.ReferralExpired, "")
+		}
+		return nil
+	}
+
+	referral.Status = models.ReferralQualified
+	referral.QualifiedAt = qualifiedAt
+	if err := s.referrals.Update(referral); err != nil {
+		return err
+	}
+	return s.reward(ctx, referral)
+}
+
+// reward adds the referee's bonus and then the referrer's, saving after each
+// so a retry doesn't add either twice. A side whose account was deleted
+// meanwhile gets nothing.
+func (s *referralService) reward(ctx context.Context, referral *models.Referral) error {
+	if referral.RefereePoints == 0 && s.refereePoints > 0 {
+		referee, err := s.users.GetByID(referral.RefereeID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err == nil && referee.AnonymizedAt == nil && referee.CustomerID != "" {
+			if err := s.addBonus(ctx, referral, "referee", referee.CustomerID, s.refereePoints, "Welcome bonus for joining with a referral"); err != nil {
+				return err
+			}
+			referral.RefereePoints = s.refereePoints
+			if err := s.referrals.Update(referral); err != nil {
+				return err
+			}
+			recordAudit(s.audit, referee.ID, "referral_rewarded", ActorSystem, fmt.Sprintf("%d points for joining with a referral", s.refereePoints))
+		}
+	}
+
+	if referral.ReferrerPoints == 0 && s.referrerPoints > 0 {
+		referrer, err := s.users.GetByID(referral.ReferrerID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err == nil && referrer.AnonymizedAt == nil {
+			if referrer.CustomerID == "" {
+				return fmt.Errorf("loyalty account of referrer %d is not set up yet", referrer.ID)
+			}
+			if err := s.addBonus(ctx, referral, "referrer", referrer.CustomerID, s.referrerPoints, "Bonus for referring a friend"); err != nil {
+				return err
+			}
+			referral.ReferrerPoints = s.referrerPoints
+			if err := s.referrals.Update(referral); err != nil {
+				return err
+			}
+			recordAudit(s.audit, referrer.ID, "referral_rewarded", ActorSystem, fmt.Sprintf("%d points for referring user %d", s.referrerPoints, referral.RefereeID))
+		}
+	}
+
+	now := time.Now()
+	referral.Status = models.ReferralRewarded
+	referral.RewardedAt = &now
+	return s.referrals.Update(referral)
+}
+
+func (s *referralService) addBonus(ctx context.Context, referral *models.Referral, side, accountID string, points int, reason string) error {
+	key := fmt.Sprintf("referral_bonus:%d:%s", referral.ID, side)
+	return s.square.AdjustPoints(ctx, &loyalty.AdjustLoyaltyPointsRequest{
+		AccountID: accountID,
+		AdjustPoints: &square.LoyaltyEventAdjustPoints{
+			Points: points,
+			Reason: square.String(reason),
+		},
+		IdempotencyKey: uuid.NewSHA1(uuid.NameSpaceOID, []byte(key)).String(),
+	})
+}
+
+func (s *referralService) close(referral *models.Referral, status, reason string) error {
+	referral.Status = status
+	referral.RejectReason = reason
+	if err := s.referrals.Update(referral); err != nil {
+		return err
+	}
+	recordAudit(s.audit, referral.RefereeID, "referral_"+status, ActorSystem, reason)
+	return nil
+}
+
+// CheckAll queues a check of every open referral, catching earns that
+// happened without a balance read
+func (s *referralService) CheckAll() error {
+	if !s.enabled() {
+		return nil
+	}
+
+	referrals, err := s.referrals.ListOpen()
+	if err != nil {
+		return err
+	}
+	for _, referral := range referrals {
+		s.queueCheck(referral.ID)
+	}
+	return nil
+}
+
+func (s *referralService) queueCheck(referralID uint) {
+	_, err := s.jobs.EnqueueUnique(JobCheckReferral, fmt.Sprintf("referral:%d", referralID),
+		checkReferralPayload{ReferralID: referralID}, time.Now())
+	if err != nil {
+		log.Printf("referral: failed to queue check of referral %d: %v", referralID, err)
+	}
+}
+
+// createReferralCode gives the user a random code. The unique index on codes
+// decides whether a code is free: a taken code is replaced by a new one, and
+// when the user got a code meanwhile, from a concurrent request, that one is
+// returned.
+func createReferralCode(referrals repositories.ReferralRepository, userID uint, deviceHash string) (*models.ReferralCode, error) {
+	for attempt := 0; attempt < 5; attempt++ {
+		code, err := newReferralCode()
+		if err != nil {
+			return nil, err
+		}
+
+		referralCode := &models.ReferralCode{UserID: userID, Code: code, DeviceHash: deviceHash}
+		err = referrals.CreateCode(referralCode)
+		if err == nil {
+			return referralCode, nil
+		}
+		if !repositories.IsUniqueViolation(err) {
+			return nil, err
+		}
+
+		existing, err := referrals.GetCodeByUserID(userID)
+		if err == nil {
+			return existing, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+	return nil, errors.New("failed to generate a unique referral code")
+}
+
+func newReferralCode() (string, error) {
+	code := make([]byte, referralCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(referralCodeAlphabet))))
+		if err != nil {
+			return "", fmt.Errorf("failed to generate referral code: %w", err)
+		}
+		code[i] = referralCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// normalizeReferralCode accepts codes typed in lower case or with spaces and dashes
+func normalizeReferralCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.NewReplacer(" ", "", "-", "").Replace(code)
+}
+
+// canonicalEmail drops what mail providers ignore, "+tags" and dots in the
+// local part, so variations of one address compare equal
+func canonicalEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return strings.ToLower(email)
+	}
+	local, domain := email[:at], email[at+1:]
+	local, _, _ = strings.Cut(local, "+")
+	return strings.ToLower(strings.ReplaceAll(local, ".", "") + "@" + domain)
+}
+
+// hashIdentifier keeps phones and devices comparable without storing them,
+// "" stays "". The HMAC key keeps a leaked table from being reversed by
+// hashing every phone number.
+func (s *referralService) hashIdentifier(value string) string {
+	if value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, s.hashKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func firstName(name string) string {
+	if fields := strings.Fields(name); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
+
+// JobCheckReferral checks one open referral
+const JobCheckReferral = "check_referral"
+
+// JobCheckReferrals is the nightly job that checks every open referral
+const JobCheckReferrals = "check_referrals"
+
+type checkReferralPayload struct {
+	ReferralID uint `json:"referral_id"`
+}
+
+// RegisterReferralJobs registers referral checks and schedules the nightly
+// run, at the given time after midnight UTC
+func RegisterReferralJobs(jobs JobService, referrals ReferralService, at time.Duration) {
+	jobs.Register(JobCheckReferral, func(ctx context.Context, job *models.Job) error {
+		var payload checkReferralPayload
+		if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+			return err
+		}
+		return referrals.Check(ctx, payload.ReferralID)
+	}, JobOptions{MaxAttempts: 3, MaxConcurrency: 2})
+
+	jobs.Register(JobCheckReferrals, func(ctx context.Context, job *models.Job) error {
+		return referrals.CheckAll()
+	}, JobOptions{MaxConcurrency: 1})
+	jobs.Daily(JobCheckReferrals, at)
+}
@@ -0,0 +1,300 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/gimhanr9/go-loyalty-api/apperrors"
+	"github.com/gimhanr9/go-loyalty-api/database/dbtest"
+	"github.com/gimhanr9/go-loyalty-api/dto"
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"github.com/gimhanr9/go-loyalty-api/repositories"
+)
+
+const testReferralHashKey = "0123456789abcdef0123456789abcdef"
+
+func newTestReferralService(referrals repositories.ReferralRepository, maxReferrals int) *referralService {
+	return &referralService{
+		referrals:      referrals,
+		referrerPoints: 100,
+		refereePoints:  50,
+		minEarn:        1,
+		maxReferrals:   maxReferrals,
+		hashKey:        []byte(testReferralHashKey),
+	}
+}
+
+func TestReferralFraudGuards(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxReferrals int
+		email        string
+		deviceID     string
+		earlier      []models.Referral // referrals made before, by the referrer unless set
+		wantStatus   string
+		wantReason   string
+	}{
+		{name: "clean referral", email: "bob@example.com", deviceID: "bob-phone", wantStatus: models.ReferralPending},
+		{name: "without a device", email: "bob@example.com", wantStatus: models.ReferralPending},
+		{name: "referrer's own email", email: "Ann@Example.com", wantStatus: models.ReferralRejected, wantReason: ReferralRejectSelf},
+		{name: "referrer's email with dots and a tag", email: "a.nn+friend@example.com", wantStatus: models.ReferralRejected, wantReason: ReferralRejectSelf},
+		{name: "referrer's device", email: "bob@example.com", deviceID: "ann-phone", wantStatus: models.ReferralRejected, wantReason: ReferralRejectSameDevice},
+		{
+			name: "device referred before", email: "bob@example.com", deviceID: "bob-phone",
+			earlier:    []models.Referral{{ReferrerID: 99, RefereeID: 100, Status: models.ReferralRewarded, DeviceHash: "bob-phone"}},
+			wantStatus: models.ReferralRejected, wantReason: ReferralRejectSameDevice,
+		},
+		{
+			name: "phone referred before, by a deleted account", email: "bob@example.com",
+			earlier:    []models.Referral{{ReferrerID: 99, RefereeID: 100, Status: models.ReferralRejected, PhoneHash: "+14155550101"}},
+			wantStatus: models.ReferralRejected, wantReason: ReferralRejectPhoneReferred,
+		},
+		{
+			name: "cap reached", email: "bob@example.com", maxReferrals: 1,
+			earlier:    []models.Referral{{RefereeID: 100, Status: models.ReferralPending}},
+			wantStatus: models.ReferralRejected, wantReason: ReferralRejectCapReached,
+		},
+		{
+			name: "rejected and expired referrals don't count towards the cap", email: "bob@example.com", maxReferrals: 1,
+			earlier: []models.Referral{
+				{RefereeID: 100, Status: models.ReferralRejected},
+				{RefereeID: 101, Status: models.ReferralExpired},
+			},
+			wantStatus: models.ReferralPending,
+		},
+		{
+			name: "no cap", email: "bob@example.com",
+			earlier:    []models.Referral{{RefereeID: 100, Status: models.ReferralRewarded}, {RefereeID: 101, Status: models.ReferralPending}},
+			wantStatus: models.ReferralPending,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dbtest.Migrated(t)
+			repos := repositories.TxRepositories{
+				Users:     repositories.NewAuthRepository(db),
+				Audit:     repositories.NewAuditRepository(db),
+				Referrals: repositories.NewReferralRepository(db),
+			}
+			s := newTestReferralService(repos.Referrals, tt.maxReferrals)
+
+			referrer := &models.User{Name: "Ann", Email: "ann@example.com", Phone: "+14155550100"}
+			if err := db.Create(referrer).Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := repos.Referrals.CreateCode(&models.ReferralCode{UserID: referrer.ID, Code: "ANNCODE2", DeviceHash: s.hashIdentifier("ann-phone")}); err != nil {
+				t.Fatal(err)
+			}
+			for _, earlier := range tt.earlier {
+				if earlier.ReferrerID == 0 {
+					earlier.ReferrerID = referrer.ID
+				}
+				earlier.PhoneHash = s.hashIdentifier(earlier.PhoneHash)
+				earlier.DeviceHash = s.hashIdentifier(earlier.DeviceHash)
+				if err := repos.Referrals.Create(&earlier); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			referee := &models.User{Name: "Bob", Email: tt.email, Phone: "+14155550101"}
+			if err := db.Create(referee).Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Enroll(repos, referee, dto.RegisterDTO{ReferralCode: "ann-code2", DeviceID: tt.deviceID}); err != nil {
+				t.Fatalf("Enroll: %v", err)
+			}
+
+			referral, err := repos.Referrals.GetByRefereeID(referee.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if referral.Status != tt.wantStatus || referral.RejectReason != tt.wantReason {
+				t.Errorf("referral = %s %q, want %s %q", referral.Status, referral.RejectReason, tt.wantStatus, tt.wantReason)
+			}
+			if referral.PhoneHash == referee.Phone || referral.PhoneHash == "" {
+				t.Errorf("phone hash = %q", referral.PhoneHash)
+			}
+			if _, err := repos.Referrals.GetCodeByUserID(referee.ID); err != nil {
+				t.Errorf("referee has no code of their own: %v", err)
+			}
+		})
+	}
+}
+
+func TestEnrollUnknownCode(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(db *gorm.DB, referrer *models.User)
+	}{
+		{name: "no such code"},
+		{name: "referrer scheduled for deletion", setup: func(db *gorm.DB, referrer *models.User) {
+			db.Model(referrer).Update("deletion_scheduled_at", time.Now())
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dbtest.Migrated(t)
+			repos := repositories.TxRepositories{Users: repositories.NewAuthRepository(db), Referrals: repositories.NewReferralRepository(db)}
+			s := newTestReferralService(repos.Referrals, 0)
+
+			referrer := &models.User{Name: "Ann", Email: "ann@example.com", Phone: "+14155550100"}
+			db.Create(referrer)
+			repos.Referrals.CreateCode(&models.ReferralCode{UserID: referrer.ID, Code: "ANNCODE2"})
+			code := "NOSUCHCD"
+			if tt.setup != nil {
+				tt.setup(db, referrer)
+				code = "ANNCODE2"
+			}
+
+			referee := &models.User{Name: "Bob", Email: "bob@example.com", Phone: "+14155550101"}
+			db.Create(referee)
+			err := s.Enroll(repos, referee, dto.RegisterDTO{ReferralCode: code})
+
+			var appErr *apperrors.Error
+			if !errors.As(err, &appErr) || appErr.Code != apperrors.CodeInvalidRequest {
+				t.Errorf("err = %v, want invalid_request", err)
+			}
+		})
+	}
+}
+
+// collidingReferrals hands out a taken code for the first collisions calls
+type collidingReferrals struct {
+	repositories.ReferralRepository
+	collisions int
+}
+
+func (r *collidingReferrals) CreateCode(code *models.ReferralCode) error {
+	if r.collisions > 0 {
+		r.collisions--
+		code.Code = "TAKEN234"
+	}
+	return r.ReferralRepository.CreateCode(code)
+}
+
+func TestCreateReferralCode(t *testing.T) {
+	tests := []struct {
+		name       string
+		collisions int
+		hasCode    bool // the user got a code from a concurrent request
+		wantErr    bool
+	}{
+		{name: "free code"},
+		{name: "taken code is replaced", collisions: 2},
+		{name: "gives up after five taken codes", collisions: 5, wantErr: true},
+		{name: "returns the code the user got meanwhile", collisions: 1, hasCode: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dbtest.Migrated(t)
+			users := []*models.User{
+				{Name: "Ann", Email: "ann@example.com", Phone: "+14155550100"},
+				{Name: "Bob", Email: "bob@example.com", Phone: "+14155550101"},
+			}
+			for _, user := range users {
+				db.Create(user)
+			}
+			existing := &models.ReferralCode{UserID: users[0].ID, Code: "TAKEN234"}
+			if tt.hasCode {
+				existing.UserID = users[1].ID
+			}
+			if err := db.Create(existing).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			// Inside a transaction, as at registration, which must stay usable
+			err := db.Transaction(func(tx *gorm.DB) error {
+				referrals := &collidingReferrals{ReferralRepository: repositories.NewReferralRepository(tx), collisions: tt.collisions}
+				code, err := createReferralCode(referrals, users[1].ID, "")
+				if err != nil {
+					return err
+				}
+				if tt.hasCode && code.ID != existing.ID {
+					t.Errorf("code = %+v, want the existing %+v", code, existing)
+				}
+				if !tt.hasCode && (code.Code == "TAKEN234" || len(code.Code) != referralCodeLength) {
+					t.Errorf("code = %q", code.Code)
+				}
+				return tx.Create(&models.Referral{ReferrerID: users[0].ID, RefereeID: users[1].ID, Status: models.ReferralPending}).Error
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHashIdentifier(t *testing.T) {
+	s := newTestReferralService(nil, 0)
+	other := newTestReferralService(nil, 0)
+	other.hashKey = []byte(strings.Repeat("x", 32))
+
+	tests := []struct {
+		name  string
+		a, b  string
+		other bool // hash b with a different key
+		equal bool
+	}{
+		{name: "same value", a: "+14155550100", b: "+14155550100", equal: true},
+		{name: "different values", a: "+14155550100", b: "+14155550101"},
+		{name: "different keys", a: "+14155550100", b: "+14155550100", other: true},
+		{name: "empty stays empty", a: "", b: "", equal: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hashB := s.hashIdentifier(tt.b)
+			if tt.other {
+				hashB = other.hashIdentifier(tt.b)
+			}
+			if got := s.hashIdentifier(tt.a) == hashB; got != tt.equal {
+				t.Errorf("equal = %v, want %v", got, tt.equal)
+			}
+		})
+	}
+	if got := s.hashIdentifier(""); got != "" {
+		t.Errorf("hash of \"\" = %q", got)
+	}
+	if got := s.hashIdentifier("+14155550100"); got == hashVerificationCode("+14155550100") {
+		t.Error("hash is not keyed")
+	}
+}
+
+func TestNewReferralServiceConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "off by default"},
+		{name: "on with a key", env: map[string]string{"REFERRAL_REFERRER_POINTS": "100", "REFERRAL_HASH_KEY": testReferralHashKey}},
+		{name: "on without a key", env: map[string]string{"REFERRAL_REFEREE_POINTS": "50"}, wantErr: "needs REFERRAL_HASH_KEY"},
+		{name: "short key", env: map[string]string{"REFERRAL_REFEREE_POINTS": "50", "REFERRAL_HASH_KEY": "short"}, wantErr: "needs REFERRAL_HASH_KEY"},
+		{name: "negative bonus", env: map[string]string{"REFERRAL_REFERRER_POINTS": "-1"}, wantErr: "can't be negative"},
+		{name: "qualifying points below one", env: map[string]string{"REFERRAL_QUALIFYING_POINTS": "0"}, wantErr: "at least 1"},
+		{name: "negative cap", env: map[string]string{"REFERRAL_MAX_PER_REFERRER": "-1"}, wantErr: "can't be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"REFERRAL_REFERRER_POINTS", "REFERRAL_REFEREE_POINTS", "REFERRAL_QUALIFYING_POINTS", "REFERRAL_MAX_PER_REFERRER", "REFERRAL_HASH_KEY"} {
+				t.Setenv(key, tt.env[key])
+			}
+
+			_, err := NewReferralService(nil, nil, nil, nil, nil, nil)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
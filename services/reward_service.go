@@ -0,0 +1,340 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	square "github.com/square/square-go-sdk"
+	loyalty "github.com/square/square-go-sdk/loyalty"
+	"gorm.io/gorm"
+
+	"github.com/gimhanr9/go-loyalty-api/apperrors"
+	"github.com/gimhanr9/go-loyalty-api/dto"
+	"github.com/gimhanr9/go-loyalty-api/gateway"
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"github.com/gimhanr9/go-loyalty-api/repositories"
+)
+
+// RewardService manages rewards a customer claims now and uses at a later
+// checkout. Square takes the points when a reward is issued and gives them back
+// when it is deleted.
+type RewardService interface {
+	IssueReward(ctx context.Context, accountID, rewardTierID, idempotencyKey string) (*dto.RewardV2DTO, error)
+	ListIssuedRewards(ctx context.Context, accountID string) ([]dto.RewardV2DTO, error)
+	CancelReward(ctx context.Context, accountID, rewardID string) error
+	ApplyReward(ctx context.Context, accountID, rewardID string, req dto.ApplyRewardV2DTO, idempotencyKey string) (*dto.RewardV2DTO, error)
+}
+
+type rewardService struct {
+	square     gateway.SquareGateway
+	operations repositories.PointsOperationRepository
+}
+
+func NewRewardService(squareGateway gateway.SquareGateway, operations repositories.PointsOperationRepository) RewardService {
+	return &rewardService{square: squareGateway, operations: operations}
+}
+
+// IssueReward takes the tier's points and issues a reward not yet tied to an order
+func (s *rewardService) IssueReward(ctx context.Context, accountID, rewardTierID, idempotencyKey string) (*dto.RewardV2DTO, error) {
+	tiers, err := s.tierNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := tiers[rewardTierID]; !ok {
+		return nil, apperrors.New(apperrors.CodeInvalidRewardTier, "The reward tier does not exist").
+			WithDetails([]apperrors.FieldError{{Field: "reward_tier_id", Message: "does not exist"}})
+	}
+
+	reward, err := s.square.CreateReward(ctx, &loyalty.CreateLoyaltyRewardRequest{
+		Reward: &square.LoyaltyReward{
+			LoyaltyAccountID: accountID,
+			RewardTierID:     rewardTierID,
+		},
+		IdempotencyKey: idempotencyKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := newRewardDTO(reward, tiers)
+	return &result, nil
+}
+
+// ListIssuedRewards returns the account's rewards that haven't been redeemed or deleted
+func (s *rewardService) ListIssuedRewards(ctx context.Context, accountID string) ([]dto.RewardV2DTO, error) {
+	tiers, err := s.tierNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &loyalty.SearchLoyaltyRewardsRequest{
+		Query: &square.SearchLoyaltyRewardsRequestLoyaltyRewardQuery{
+			LoyaltyAccountID: accountID,
+			Status:           square.LoyaltyRewardStatusIssued.Ptr(),
+		},
+		Limit: square.Int(30),
+	}
+
+	rewards := make([]dto.RewardV2DTO, 0)
+	for {
+		res, err := s.square.SearchRewards(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, reward := range res.Rewards {
+			if reward != nil {
+				rewards = append(rewards, newRewardDTO(reward, tiers))
+			}
+		}
+
+		if res.Cursor == nil || *res.Cursor == "" {
+			return rewards, nil
+		}
+		req.Cursor = res.Cursor
+	}
+}
+
+// CancelReward deletes an issued reward, which returns its points
+func (s *rewardService) CancelReward(ctx context.Context, accountID, rewardID string) error {
+	if _, err := s.issuedReward(ctx, accountID, rewardID); err != nil {
+		return err
+	}
+	return s.square.DeleteReward(ctx, rewardID)
+}
+
+// ApplyReward uses an issued reward at checkout. A Square reward can't be moved
+// onto an order once issued, so for an order it is deleted and issued again
+// with the order ID, and the returned reward has a new ID. The move is saved as
+// a points operation before the delete, so a retry with the same idempotency
+// key finishes it rather than finding the deleted reward. Until it is finished
+// the points are back on the account.
+func (s *rewardService) ApplyReward(ctx context.Context, accountID, rewardID string, req dto.ApplyRewardV2DTO, idempotencyKey string) (*dto.RewardV2DTO, error) {
+	if req.OrderID != "" {
+		return s.moveRewardToOrder(ctx, accountID, rewardID, req.OrderID, idempotencyKey)
+	}
+
+	if _, err := s.issuedReward(ctx, accountID, rewardID); err != nil {
+		return nil, err
+	}
+
+	locationID := req.LocationID
+	if locationID == "" {
+		locationID = os.Getenv("LOCATION_ID")
+	}
+	_, err := s.square.RedeemReward(ctx, &loyalty.RedeemLoyaltyRewardRequest{
+		RewardID:       rewardID,
+		IdempotencyKey: rewardCallKey(idempotencyKey, "redeem"),
+		LocationID:     locationID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	reward, err := s.square.GetReward(ctx, rewardID)
+	if err != nil {
+		return nil, err
+	}
+	return s.rewardDTO(ctx, reward)
+}
+
+// moveRewardToOrder issues the reward again on the order, resuming the
+// operation saved under the idempotency key if there is one
+func (s *rewardService) moveRewardToOrder(ctx context.Context, accountID, rewardID, orderID, idempotencyKey string) (*dto.RewardV2DTO, error) {
+	op, err := s.operations.GetByIdempotencyKey(idempotencyKey)
+	switch {
+	case err == nil:
+		if op.Kind != models.PointsOperationApplyReward || op.AccountID != accountID || op.SourceRewardID != rewardID || op.OrderID != orderID {
+			return nil, ErrIdempotencyKeyReused
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		reward, err := s.issuedReward(ctx, accountID, rewardID)
+		if err != nil {
+			return nil, err
+		}
+		if reward.OrderID != nil && *reward.OrderID != "" {
+			if *reward.OrderID == orderID {
+				return s.rewardDTO(ctx, reward)
+			}
+			return nil, apperrors.Conflict("The reward is already applied to another order")
+		}
+
+		order, err := s.square.GetOrder(ctx, orderID)
+		if err != nil {
+			return nil, err
+		}
+		if order.State != nil && *order.State != square.OrderStateOpen {
+			return nil, apperrors.Conflict("The order is no longer open")
+		}
+
+		op = &models.PointsOperation{
+			Kind:           models.PointsOperationApplyReward,
+			AccountID:      accountID,
+			IdempotencyKey: idempotencyKey,
+			RewardTierID:   reward.RewardTierID,
+			OrderID:        orderID,
+			SourceRewardID: rewardID,
+			Step:           models.StepStarted,
+		}
+		if err := s.operations.Create(op); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	for op.Step != models.StepCompleted {
+		if err := s.moveStep(ctx, op); err != nil {
+			op.LastError = err.Error()
+			if saveErr := s.operations.Update(op); saveErr != nil {
+				log.Printf("rewards: failed to save points operation %d: %v", op.ID, saveErr)
+			}
+			return nil, err
+		}
+
+		op.LastError = ""
+		if err := s.operations.Update(op); err != nil {
+			return nil, err
+		}
+	}
+
+	reward, err := s.square.GetReward(ctx, op.RewardID)
+	if err != nil {
+		return nil, err
+	}
+	return s.rewardDTO(ctx, reward)
+}
+
+func (s *rewardService) moveStep(ctx context.Context, op *models.PointsOperation) error {
+	switch op.Step {
+	case models.StepStarted:
+		// The delete may have gone through on an earlier attempt that failed to save
+		source, err := s.square.GetReward(ctx, op.SourceRewardID)
+		if err != nil {
+			return err
+		}
+		if rewardStatus(source) != dto.RewardStatusDeleted {
+			if err := s.square.DeleteReward(ctx, op.SourceRewardID); err != nil {
+				return err
+			}
+		}
+		op.Step = models.StepRewardDeleted
+
+	case models.StepRewardDeleted:
+		reward, err := s.square.CreateReward(ctx, &loyalty.CreateLoyaltyRewardRequest{
+			Reward: &square.LoyaltyReward{
+				LoyaltyAccountID: op.AccountID,
+				RewardTierID:     op.RewardTierID,
+				OrderID:          square.String(op.OrderID),
+			},
+			IdempotencyKey: rewardCallKey(op.IdempotencyKey, "create"),
+		})
+		if err != nil {
+			return err
+		}
+		op.RewardID = stringValue(reward.ID)
+		op.Step = models.StepCompleted
+
+	default:
+		return fmt.Errorf("unknown step %q for apply reward operation %d", op.Step, op.ID)
+	}
+	return nil
+}
+
+// rewardCallKey derives the idempotency key of one Square call made for the
+// caller's key, so calls made for the same request never share a key
+func rewardCallKey(idempotencyKey, call string) string {
+	key := fmt.Sprintf("reward:%s:%s", idempotencyKey, call)
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(key)).String()
+}
+
+// issuedReward fetches one of the account's rewards that can still be used or cancelled.
+// Other accounts' rewards are reported as not found.
+func (s *rewardService) issuedReward(ctx context.Context, accountID, rewardID string) (*square.LoyaltyReward, error) {
+	reward, err := s.square.GetReward(ctx, rewardID)
+	if err != nil {
+		return nil, err
+	}
+	if reward.LoyaltyAccountID != accountID {
+		return nil, apperrors.NotFound("Reward not found")
+	}
+
+	switch rewardStatus(reward) {
+	case dto.RewardStatusRedeemed:
+		return nil, apperrors.Conflict("The reward has already been redeemed")
+	case dto.RewardStatusDeleted:
+		return nil, apperrors.Conflict("The reward has been cancelled")
+	}
+	return reward, nil
+}
+
+func (s *rewardService) rewardDTO(ctx context.Context, reward *square.LoyaltyReward) (*dto.RewardV2DTO, error) {
+	tiers, err := s.tierNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := newRewardDTO(reward, tiers)
+	return &result, nil
+}
+
+// tierNames maps the program's reward tier IDs to their names
+func (s *rewardService) tierNames(ctx context.Context) (map[string]string, error) {
+	program, err := s.square.GetProgram(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]string, len(program.RewardTiers))
+	for _, tier := range program.RewardTiers {
+		if tier != nil && tier.ID != nil {
+			names[*tier.ID] = stringValue(tier.Name)
+		}
+	}
+	return names, nil
+}
+
+func rewardStatus(reward *square.LoyaltyReward) string {
+	if reward.Status == nil {
+		return dto.RewardStatusIssued
+	}
+	return strings.ToLower(string(*reward.Status))
+}
+
+func newRewardDTO(reward *square.LoyaltyReward, tiers map[string]string) dto.RewardV2DTO {
+	result := dto.RewardV2DTO{
+		ID:           stringValue(reward.ID),
+		Status:       rewardStatus(reward),
+		RewardTierID: reward.RewardTierID,
+		OrderID:      reward.OrderID,
+		CreatedAt:    parseSquareTime(reward.CreatedAt),
+		RedeemedAt:   parseSquareTime(reward.RedeemedAt),
+	}
+	if name := tiers[reward.RewardTierID]; name != "" {
+		result.RewardTierName = &name
+	}
+	if reward.Points != nil {
+		result.Points = *reward.Points
+	}
+	if result.OrderID != nil && *result.OrderID == "" {
+		result.OrderID = nil
+	}
+	return result
+}
+
+// parseSquareTime reads an optional RFC 3339 timestamp from Square
+func parseSquareTime(value *string) *time.Time {
+	if value == nil {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, *value)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
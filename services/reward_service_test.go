@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	square "github.com/square/square-go-sdk"
+	loyalty "github.com/square/square-go-sdk/loyalty"
+
+	"github.com/gimhanr9/go-loyalty-api/database/dbtest"
+	"github.com/gimhanr9/go-loyalty-api/dto"
+	"github.com/gimhanr9/go-loyalty-api/gateway"
+	"github.com/gimhanr9/go-loyalty-api/repositories"
+)
+
+// rewardSquare keeps rewards in memory and, like Square, creates one reward per
+// idempotency key
+type rewardSquare struct {
+	gateway.SquareGateway
+	rewards    map[string]*square.LoyaltyReward
+	keys       map[string]string
+	failCreate bool
+	deletes    int
+}
+
+func (q *rewardSquare) GetProgram(ctx context.Context) (*square.LoyaltyProgram, error) {
+	return &square.LoyaltyProgram{}, nil
+}
+
+func (q *rewardSquare) GetOrder(ctx context.Context, orderID string) (*square.Order, error) {
+	return &square.Order{ID: square.String(orderID), State: square.OrderStateOpen.Ptr()}, nil
+}
+
+func (q *rewardSquare) GetReward(ctx context.Context, rewardID string) (*square.LoyaltyReward, error) {
+	reward, ok := q.rewards[rewardID]
+	if !ok {
+		return nil, errors.New("reward not found")
+	}
+	return reward, nil
+}
+
+func (q *rewardSquare) DeleteReward(ctx context.Context, rewardID string) error {
+	q.deletes++
+	if *q.rewards[rewardID].Status == square.LoyaltyRewardStatusDeleted {
+		return errors.New("reward already deleted")
+	}
+	q.rewards[rewardID].Status = square.LoyaltyRewardStatusDeleted.Ptr()
+	return nil
+}
+
+func (q *rewardSquare) CreateReward(ctx context.Context, req *loyalty.CreateLoyaltyRewardRequest) (*square.LoyaltyReward, error) {
+	if q.failCreate {
+		return nil, errors.New("square unavailable")
+	}
+	if id, ok := q.keys[req.IdempotencyKey]; ok {
+		return q.rewards[id], nil
+	}
+	reward := *req.Reward
+	reward.ID = square.String("reward-" + req.IdempotencyKey)
+	reward.Status = square.LoyaltyRewardStatusIssued.Ptr()
+	q.rewards[*reward.ID] = &reward
+	q.keys[req.IdempotencyKey] = *reward.ID
+	return &reward, nil
+}
+
+func TestApplyRewardToOrderResumes(t *testing.T) {
+	q := &rewardSquare{
+		rewards: map[string]*square.LoyaltyReward{
+			"issued": {ID: square.String("issued"), LoyaltyAccountID: "acct", RewardTierID: "tier", Status: square.LoyaltyRewardStatusIssued.Ptr()},
+		},
+		keys:       map[string]string{},
+		failCreate: true,
+	}
+	svc := NewRewardService(q, repositories.NewPointsOperationRepository(dbtest.Migrated(t)))
+	req := dto.ApplyRewardV2DTO{OrderID: "order"}
+
+	if _, err := svc.ApplyReward(context.Background(), "acct", "issued", req, "key"); err == nil {
+		t.Fatal("first attempt should fail")
+	}
+
+	q.failCreate = false
+	reward, err := svc.ApplyReward(context.Background(), "acct", "issued", req, "key")
+	if err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if reward.OrderID == nil || *reward.OrderID != "order" || reward.ID == "issued" {
+		t.Errorf("reward = %+v, want a new reward on the order", reward)
+	}
+
+	again, err := svc.ApplyReward(context.Background(), "acct", "issued", req, "key")
+	if err != nil || again.ID != reward.ID {
+		t.Errorf("replay = %+v, %v, want reward %s", again, err, reward.ID)
+	}
+	if q.deletes != 1 || len(q.keys) != 1 {
+		t.Errorf("deletes = %d, creates = %d, want one of each", q.deletes, len(q.keys))
+	}
+
+	if _, err := svc.ApplyReward(context.Background(), "acct", "issued", dto.ApplyRewardV2DTO{OrderID: "other"}, "key"); !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Errorf("key reused for another order: err = %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gimhanr9/go-loyalty-api/config"
+)
+
+// SMS providers selectable with SMS_PROVIDER
+const (
+	SMSProviderLog    = "log"
+	SMSProviderTwilio = "twilio"
+)
+
+// SMSSender delivers text messages to a phone number
+type SMSSender interface {
+	Send(phone, message string) error
+}
+
+// NewSMSSender builds the sender named by SMS_PROVIDER: twilio by default in
+// production and log elsewhere. The log sender writes verification codes to
+// the server log, so it is refused in production.
+func NewSMSSender() (SMSSender, error) {
+	production := os.Getenv("APP_ENV") == "production"
+	fallback := SMSProviderLog
+	if production {
+		fallback = SMSProviderTwilio
+	}
+
+	switch provider := config.GetEnv("SMS_PROVIDER", fallback); provider {
+	case SMSProviderLog:
+		if production {
+			return nil, errors.New("SMS_PROVIDER=log would write verification codes to the log, it is only allowed outside production")
+		}
+		return NewLogSMSSender(), nil
+	case SMSProviderTwilio:
+		accountSID := os.Getenv("TWILIO_ACCOUNT_SID")
+		authToken := os.Getenv("TWILIO_AUTH_TOKEN")
+		from := os.Getenv("TWILIO_FROM")
+		if accountSID == "" || authToken == "" || from == "" {
+			return nil, errors.New("SMS_PROVIDER=twilio needs TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN and TWILIO_FROM")
+		}
+		return newTwilioSMSSender(accountSID, authToken, from,
+			config.GetEnv("TWILIO_BASE_URL", "https://api.twilio.com"),
+			config.GetEnvDuration("SMS_TIMEOUT", 10*time.Second)), nil
+	default:
+		return nil, fmt.Errorf("unknown SMS_PROVIDER %q, expected log or twilio", provider)
+	}
+}
+
+type logSMSSender struct{}
+
+// NewLogSMSSender returns a sender that writes messages to the server log.
+// It stands in for a real SMS provider in development.
+func NewLogSMSSender() SMSSender {
+	return &logSMSSender{}
+}
+
+func (s *logSMSSender) Send(phone, message string) error {
+	log.Printf("SMS to %s: %s", phone, message)
+	return nil
+}
+
+type twilioSMSSender struct {
+	client     *http.Client
+	accountSID string
+	authToken  string
+	from       string // a phone number or messaging service SID
+	baseURL    string
+}
+
+func newTwilioSMSSender(accountSID, authToken, from, baseURL string, timeout time.Duration) SMSSender {
+	return &twilioSMSSender{
+		client:     &http.Client{Timeout: timeout},
+		accountSID: accountSID,
+		authToken:  authToken,
+		from:       from,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+// Send queues the message with Twilio's Messages API
+func (s *twilioSMSSender) Send(phone, message string) error {
+	form := url.Values{"To": {phone}, "Body": {message}}
+	if strings.HasPrefix(s.from, "MG") {
+		form.Set("MessagingServiceSid", s.from)
+	} else {
+		form.Set("From", s.from)
+	}
+
+	req, err := http.NewRequest(http.MethodPost,
+		s.baseURL+"/2010-04-01/Accounts/"+url.PathEscape(s.accountSID)+"/Messages.json", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(s.accountSID, s.authToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send SMS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("twilio answered %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewSMSSender(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    string // type of sender, "" when an error is expected
+		wantErr string
+	}{
+		{name: "log by default in development", want: "log"},
+		{name: "log refused in production", env: map[string]string{"APP_ENV": "production", "SMS_PROVIDER": "log"}, wantErr: "only allowed outside production"},
+		{name: "twilio by default in production", env: map[string]string{"APP_ENV": "production"}, wantErr: "needs TWILIO_ACCOUNT_SID"},
+		{
+			name: "twilio configured",
+			env:  map[string]string{"APP_ENV": "production", "TWILIO_ACCOUNT_SID": "AC1", "TWILIO_AUTH_TOKEN": "secret", "TWILIO_FROM": "+15550000"},
+			want: "twilio",
+		},
+		{name: "unknown provider", env: map[string]string{"SMS_PROVIDER": "pigeon"}, wantErr: "unknown SMS_PROVIDER"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"APP_ENV", "SMS_PROVIDER", "TWILIO_ACCOUNT_SID", "TWILIO_AUTH_TOKEN", "TWILIO_FROM"} {
+				t.Setenv(key, tt.env[key])
+			}
+
+			sender, err := NewSMSSender()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got := "log"
+			if _, ok := sender.(*twilioSMSSender); ok {
+				got = "twilio"
+			}
+			if got != tt.want {
+				t.Errorf("sender = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTwilioSMSSenderSend(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string
+		status  int
+		fromKey string
+		wantErr bool
+	}{
+		{name: "from a phone number", from: "+15550000", status: http.StatusCreated, fromKey: "From"},
+		{name: "from a messaging service", from: "MG123", status: http.StatusCreated, fromKey: "MessagingServiceSid"},
+		{name: "rejected by Twilio", from: "+15550000", status: http.StatusBadRequest, fromKey: "From", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *http.Request
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				r.ParseForm()
+				got = r
+				w.WriteHeader(tt.status)
+				w.Write([]byte(`{"message": "error"}`))
+			}))
+			defer server.Close()
+
+			sender := newTwilioSMSSender("AC1", "secret", tt.from, server.URL, time.Second)
+			err := sender.Send("+15551234", "Your code is 123456")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got.URL.Path != "/2010-04-01/Accounts/AC1/Messages.json" {
+				t.Errorf("path = %s", got.URL.Path)
+			}
+			if user, pass, _ := got.BasicAuth(); user != "AC1" || pass != "secret" {
+				t.Errorf("basic auth = %s:%s", user, pass)
+			}
+			if got.PostForm.Get("To") != "+15551234" || got.PostForm.Get("Body") != "Your code is 123456" || got.PostForm.Get(tt.fromKey) != tt.from {
+				t.Errorf("form = %v", got.PostForm)
+			}
+		})
+	}
+}
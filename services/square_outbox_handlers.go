@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gimhanr9/go-loyalty-api/apperrors"
+	"github.com/gimhanr9/go-loyalty-api/gateway"
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"github.com/gimhanr9/go-loyalty-api/repositories"
+)
+
+// Outbox message kinds for Square side effects
+const (
+	OutboxCreateLoyaltyAccount = "create_loyalty_account"
+	OutboxUpdateCustomerPhone  = "update_customer_phone"
+	OutboxDeleteSquareCustomer = "delete_square_customer"
+)
+
+type createLoyaltyAccountPayload struct {
+	UserID uint   `json:"user_id"`
+	Phone  string `json:"phone"`
+}
+
+type squareCustomerPayload struct {
+	AccountID string `json:"account_id"`
+	Phone     string `json:"phone,omitempty"`
+}
+
+// RegisterSquareOutboxHandlers wires the Square calls executed by the outbox dispatcher
+func RegisterSquareOutboxHandlers(outbox OutboxService, users repositories.AuthRepository, squareGateway gateway.SquareGateway) {
+	outbox.Handle(OutboxCreateLoyaltyAccount, func(ctx context.Context, msg *models.OutboxMessage) error {
+		var payload createLoyaltyAccountPayload
+		if err := json.Unmarshal([]byte(msg.Payload), &payload); err != nil {
+			return err
+		}
+
+		user, err := users.GetByID(payload.UserID)
+		if err != nil {
+			return fmt.Errorf("failed to load user %d: %w", payload.UserID, err)
+		}
+		if user.CustomerID != "" {
+			return nil
+		}
+
+		// Retries reuse the idempotency key, so Square returns the account created
+		// by an earlier attempt whose local update was lost
+		account, err := squareGateway.CreateLoyaltyAccount(ctx, payload.Phone, msg.IdempotencyKey)
+		if err != nil {
+			return err
+		}
+
+		user.CustomerID = *account.ID
+		return users.Update(user)
+	})
+
+	// Square has no endpoint to edit a loyalty account mapping directly, the account
+	// follows the phone number of its linked customer profile
+	outbox.Handle(OutboxUpdateCustomerPhone, func(ctx context.Context, msg *models.OutboxMessage) error {
+		var payload squareCustomerPayload
+		if err := json.Unmarshal([]byte(msg.Payload), &payload); err != nil {
+			return err
+		}
+
+		account, err := squareGateway.GetLoyaltyAccount(ctx, payload.AccountID)
+		if err != nil {
+			return err
+		}
+		if account.CustomerID == nil {
+			return fmt.Errorf("loyalty account %s has no linked customer", payload.AccountID)
+		}
+		return squareGateway.UpdateCustomerPhone(ctx, *account.CustomerID, payload.Phone)
+	})
+
+	// Square does not allow loyalty accounts to be deleted, removing the customer
+	// unlinks the personal data from the account
+	outbox.Handle(OutboxDeleteSquareCustomer, func(ctx context.Context, msg *models.OutboxMessage) error {
+		var payload squareCustomerPayload
+		if err := json.Unmarshal([]byte(msg.Payload), &payload); err != nil {
+			return err
+		}
+
+		account, err := squareGateway.GetLoyaltyAccount(ctx, payload.AccountID)
+		if err != nil {
+			return err
+		}
+		if account.CustomerID == nil {
+			return nil
+		}
+		// Not found means an earlier attempt deleted it before its response was lost
+		err = squareGateway.DeleteCustomer(ctx, *account.CustomerID)
+		if err != nil && apperrors.From(err).Code == apperrors.CodeNotFound {
+			return nil
+		}
+		return err
+	})
+}
@@ -0,0 +1,265 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+
+	"github.com/gimhanr9/go-loyalty-api/dto"
+)
+
+// statementTypes orders the per type totals
+var statementTypes = []string{dto.HistoryTypeEarned, dto.HistoryTypeRedeemed, dto.HistoryTypeAdjusted, dto.HistoryTypeExpired}
+
+var statementTypeLabels = map[string]string{
+	dto.HistoryTypeEarned:   "Earned",
+	dto.HistoryTypeRedeemed: "Redeemed",
+	dto.HistoryTypeAdjusted: "Adjusted",
+	dto.HistoryTypeExpired:  "Expired",
+}
+
+// statementData is what a statement shows, whatever its format
+type statementData struct {
+	name        string
+	accountID   string
+	from        *time.Time // nil when the statement starts at account opening
+	to          time.Time  // exclusive
+	generatedAt time.Time
+	opening     int
+	closing     int
+	totals      map[string]int
+	entries     []dto.HistoryEntry // oldest first
+}
+
+func (d *statementData) periodStart() string {
+	if d.from == nil {
+		return "Account opening"
+	}
+	return d.from.UTC().Format(time.DateOnly)
+}
+
+// periodEnd is the last day the statement covers
+func (d *statementData) periodEnd() string {
+	return d.to.Add(-time.Nanosecond).UTC().Format(time.DateOnly)
+}
+
+func (d *statementData) filename(format string) string {
+	start := "start"
+	if d.from != nil {
+		start = d.from.UTC().Format("20060102")
+	}
+	end := d.to.Add(-time.Nanosecond).UTC().Format("20060102")
+	return fmt.Sprintf("loyalty-statement-%s-%s.%s", start, end, format)
+}
+
+func (d *statementData) summary() [][2]string {
+	rows := [][2]string{{"Opening balance", strconv.Itoa(d.opening)}}
+	for _, t := range statementTypes {
+		rows = append(rows, [2]string{statementTypeLabels[t], signedPoints(d.totals[t])})
+	}
+	return append(rows, [2]string{"Closing balance", strconv.Itoa(d.closing)})
+}
+
+func signedPoints(points int) string {
+	if points > 0 {
+		return "+" + strconv.Itoa(points)
+	}
+	return strconv.Itoa(points)
+}
+
+// csvText stops spreadsheet apps reading a description as a formula
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// writeStatementCSV writes the summary rows, a blank line, then one row per event
+func writeStatementCSV(d *statementData) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	w := csv.NewWriter(buf)
+
+	rows := [][]string{
+		{"Customer", csvText(d.name)},
+		{"Loyalty account", d.accountID},
+		{"Period start", d.periodStart()},
+		{"Period end", d.periodEnd()},
+		{"Generated at", d.generatedAt.UTC().Format(time.RFC3339)},
+	}
+	for _, row := range d.summary() {
+		rows = append(rows, row[:])
+	}
+	rows = append(rows, nil, []string{"Date", "Type", "Event", "Description", "Points", "Balance", "Order", "Order total", "Location", "Reward tier"})
+
+	balance := d.opening
+	for _, e := range d.entries {
+		balance += e.Points
+		orderTotal := ""
+		if e.OrderTotal != nil {
+			orderTotal = formatMoney(e.OrderTotal)
+		}
+		rows = append(rows, []string{
+			e.CreatedAt.UTC().Format(time.RFC3339),
+			statementTypeLabels[historyType(e.Type)],
+			e.Type,
+			csvText(e.Description),
+			strconv.Itoa(e.Points),
+			strconv.Itoa(balance),
+			e.OrderID,
+			orderTotal,
+			csvText(e.LocationName),
+			csvText(e.RewardTierName),
+		})
+	}
+
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// formatMoney shows an amount in minor units with two decimals, e.g. 12.50 USD
+func formatMoney(m *dto.MoneyDTO) string {
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	return fmt.Sprintf("%s%d.%02d %s", sign, amount/100, amount%100, m.Currency)
+}
+
+// Transaction table columns, in mm across the 180mm wide A4 body
+var statementColumns = []struct {
+	title string
+	width float64
+	align string
+}{
+	{"Date", 24, "L"},
+	{"Type", 22, "L"},
+	{"Description", 94, "L"},
+	{"Points", 20, "R"},
+	{"Balance", 20, "R"},
+}
+
+const (
+	statementMargin = 15.0
+	statementRow    = 6.0
+)
+
+// writeStatementPDF lays the statement out on A4 pages, repeating the table
+// header on each page
+func writeStatementPDF(d *statementData) ([]byte, error) {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(statementMargin, statementMargin, statementMargin)
+	pdf.SetAutoPageBreak(false, statementMargin)
+	pdf.SetTitle("Loyalty points statement", true)
+	pdf.AliasNbPages("")
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-statementMargin)
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.CellFormat(0, 5, fmt.Sprintf("Page %d of {nb}", pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.CellFormat(0, 10, "Loyalty points statement", "", 1, "L", false, 0, "")
+
+	pdf.SetFont("Helvetica", "", 10)
+	for _, line := range [][2]string{
+		{"Customer", d.name},
+		{"Loyalty account", d.accountID},
+		{"Period", d.periodStart() + " to " + d.periodEnd()},
+		{"Generated", d.generatedAt.UTC().Format("2006-01-02 15:04 MST")},
+	} {
+		pdf.CellFormat(35, statementRow, line[0], "", 0, "L", false, 0, "")
+		pdf.CellFormat(0, statementRow, tr(line[1]), "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(4)
+
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(0, 8, "Summary", "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	for i, row := range d.summary() {
+		style := ""
+		if i == 0 || i == len(statementTypes)+1 {
+			style = "B"
+		}
+		pdf.SetFont("Helvetica", style, 10)
+		pdf.CellFormat(60, statementRow, row[0], "B", 0, "L", false, 0, "")
+		pdf.CellFormat(30, statementRow, row[1], "B", 1, "R", false, 0, "")
+	}
+	pdf.Ln(6)
+
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(0, 8, "Transactions", "", 1, "L", false, 0, "")
+	if len(d.entries) == 0 {
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.CellFormat(0, statementRow, "No transactions in this period.", "", 1, "L", false, 0, "")
+	} else {
+		writeStatementTableHeader(pdf)
+	}
+
+	_, pageHeight := pdf.GetPageSize()
+	balance := d.opening
+	for _, e := range d.entries {
+		if pdf.GetY()+statementRow > pageHeight-statementMargin-5 {
+			pdf.AddPage()
+			writeStatementTableHeader(pdf)
+		}
+
+		balance += e.Points
+		description := tr(e.Description)
+		cells := []string{
+			e.CreatedAt.UTC().Format(time.DateOnly),
+			statementTypeLabels[historyType(e.Type)],
+			truncateToWidth(pdf, description, statementColumns[2].width-2),
+			signedPoints(e.Points),
+			strconv.Itoa(balance),
+		}
+		for i, col := range statementColumns {
+			ln := 0
+			if i == len(statementColumns)-1 {
+				ln = 1
+			}
+			pdf.CellFormat(col.width, statementRow, cells[i], "B", ln, col.align, false, 0, "")
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := pdf.Output(buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeStatementTableHeader(pdf *fpdf.Fpdf) {
+	pdf.SetFont("Helvetica", "B", 9)
+	pdf.SetFillColor(235, 235, 235)
+	for i, col := range statementColumns {
+		ln := 0
+		if i == len(statementColumns)-1 {
+			ln = 1
+		}
+		pdf.CellFormat(col.width, statementRow, col.title, "B", ln, col.align, true, 0, "")
+	}
+	pdf.SetFont("Helvetica", "", 9)
+}
+
+// truncateToWidth shortens s with an ellipsis so it fits in width mm
+func truncateToWidth(pdf *fpdf.Fpdf, s string, width float64) string {
+	if pdf.GetStringWidth(s) <= width {
+		return s
+	}
+	for len(s) > 0 && pdf.GetStringWidth(s+"...") > width {
+		s = s[:len(s)-1]
+	}
+	return s + "..."
+}
@@ -0,0 +1,297 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/gimhanr9/go-loyalty-api/apperrors"
+	"github.com/gimhanr9/go-loyalty-api/config"
+	"github.com/gimhanr9/go-loyalty-api/dto"
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"github.com/gimhanr9/go-loyalty-api/repositories"
+	"gorm.io/gorm"
+)
+
+type StatementService interface {
+	Export(ctx context.Context, userID uint, query dto.StatementQueryDTO) (*models.Statement, error)
+	Get(userID, id uint) (*models.Statement, error)
+	Generate(ctx context.Context, id uint) error
+	MarkFailed(id uint, err error)
+	PurgeExpired() error
+}
+
+type statementService struct {
+	users      repositories.AuthRepository
+	statements repositories.StatementRepository
+	loyalty    LoyaltyService
+	jobs       JobService
+	inlineDays int
+	retention  time.Duration
+}
+
+func NewStatementService(users repositories.AuthRepository, statements repositories.StatementRepository, loyalty LoyaltyService, jobs JobService) StatementService {
+	return &statementService{
+		users:      users,
+		statements: statements,
+		loyalty:    loyalty,
+		jobs:       jobs,
+		inlineDays: config.GetEnvInt("STATEMENT_INLINE_MAX_DAYS", 92),
+		retention:  config.GetEnvDuration("STATEMENT_RETENTION", 7*24*time.Hour),
+	}
+}
+
+// Export generates a statement straight away when its period is short enough,
+// otherwise it queues one and returns it pending
+func (s *statementService) Export(ctx context.Context, userID uint, query dto.StatementQueryDTO) (*models.Statement, error) {
+	user, err := s.getUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	from, to := query.Range()
+	if from != nil && to != nil && to.Before(*from) {
+		return nil, apperrors.Validation(apperrors.FieldError{Field: "to", Message: "must not be before from"})
+	}
+
+	now := time.Now()
+	statement := &models.Statement{
+		UserID:    user.ID,
+		AccountID: user.CustomerID,
+		Format:    query.Format,
+		From:      query.From,
+		To:        query.To,
+		Status:    models.StatementPending,
+		ExpiresAt: now.Add(s.retention),
+	}
+
+	if s.fitsInline(from, to, now) {
+		if err := s.render(ctx, user, statement); err != nil {
+			return nil, err
+		}
+		return statement, nil
+	}
+
+	if err := s.statements.Create(statement); err != nil {
+		return nil, err
+	}
+	if _, err := s.jobs.Enqueue(JobGenerateStatement, generateStatementPayload{StatementID: statement.ID}, now); err != nil {
+		s.MarkFailed(statement.ID, err)
+		return nil, err
+	}
+	return statement, nil
+}
+
+// fitsInline reports whether the period is short enough to answer within the request.
+// Periods without a start cover the whole account and always run in the background.
+func (s *statementService) fitsInline(from, to *time.Time, now time.Time) bool {
+	if from == nil {
+		return false
+	}
+	end := now
+	if to != nil && to.Before(now) {
+		end = *to
+	}
+	return end.Sub(*from) <= time.Duration(s.inlineDays)*24*time.Hour
+}
+
+// Get returns one of the user's statements that hasn't expired
+func (s *statementService) Get(userID, id uint) (*models.Statement, error) {
+	statement, err := s.statements.GetByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperrors.NotFound("statement not found")
+		}
+		return nil, err
+	}
+	if statement.UserID != userID || time.Now().After(statement.ExpiresAt) {
+		return nil, apperrors.NotFound("statement not found")
+	}
+	return statement, nil
+}
+
+// Generate renders a queued statement
+func (s *statementService) Generate(ctx context.Context, id uint) error {
+	statement, err := s.statements.GetByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Purged before it ran
+			return nil
+		}
+		return err
+	}
+	if statement.Status != models.StatementPending {
+		return nil
+	}
+
+	user, err := s.getUser(statement.UserID)
+	if err != nil {
+		var appErr *apperrors.Error
+		if errors.As(err, &appErr) {
+			// Deleted since it was requested, retrying won't help
+			s.MarkFailed(id, err)
+			return nil
+		}
+		return err
+	}
+
+	if err := s.render(ctx, user, statement); err != nil {
+		return err
+	}
+	return s.statements.Update(statement)
+}
+
+// MarkFailed gives up on a queued statement
+func (s *statementService) MarkFailed(id uint, cause error) {
+	statement, err := s.statements.GetByID(id)
+	if err != nil {
+		log.Printf("statements: failed to load statement %d: %v", id, err)
+		return
+	}
+
+	statement.Status = models.StatementFailed
+	statement.LastError = cause.Error()
+	if err := s.statements.Update(statement); err != nil {
+		log.Printf("statements: failed to mark statement %d failed: %v", id, err)
+	}
+}
+
+// PurgeExpired deletes statements past their retention
+func (s *statementService) PurgeExpired() error {
+	deleted, err := s.statements.DeleteExpired(time.Now())
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		log.Printf("statements: purged %d expired statements", deleted)
+	}
+	return nil
+}
+
+func (s *statementService) getUser(userID uint) (*models.User, error) {
+	user, err := s.users.GetByID(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperrors.NotFound("user not found")
+		}
+		return nil, err
+	}
+	if user.AnonymizedAt != nil {
+		return nil, apperrors.Conflict("user has already been deleted")
+	}
+	if user.CustomerID == "" {
+		return nil, apperrors.Conflict("loyalty account is not set up yet")
+	}
+	return user, nil
+}
+
+// render collects the statement's events and balances and writes the file
+func (s *statementService) render(ctx context.Context, user *models.User, statement *models.Statement) error {
+	data, err := s.collect(ctx, user, statement)
+	if err != nil {
+		return err
+	}
+
+	var content []byte
+	switch statement.Format {
+	case models.StatementPDF:
+		content, err = writeStatementPDF(data)
+	default:
+		content, err = writeStatementCSV(data)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s statement: %w", statement.Format, err)
+	}
+
+	statement.Content = content
+	statement.Filename = data.filename(statement.Format)
+	statement.Status = models.StatementReady
+	statement.LastError = ""
+	return nil
+}
+
+// collect fetches every event in the period. Square only reports the current
+// balance, so the closing balance takes off the points moved since the period
+// ended and the opening balance those moved within it.
+func (s *statementService) collect(ctx context.Context, user *models.User, statement *models.Statement) (*statementData, error) {
+	query := dto.StatementQueryDTO{From: statement.From, To: statement.To}
+	from, to := query.Range()
+	now := time.Now()
+
+	balance, err := s.loyalty.GetBalance(ctx, user.CustomerID)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := s.loyalty.ListHistory(ctx, user.CustomerID, dto.HistoryQueryDTO{From: statement.From, To: statement.To})
+	if err != nil {
+		return nil, err
+	}
+
+	closing := balance
+	if to != nil && to.Before(now) {
+		later, err := s.loyalty.ListHistory(ctx, user.CustomerID, dto.HistoryQueryDTO{From: to.Format(time.RFC3339)})
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range later {
+			closing -= e.Points
+		}
+	} else {
+		to = &now
+	}
+
+	data := &statementData{
+		name:        user.Name,
+		accountID:   user.CustomerID,
+		from:        from,
+		to:          *to,
+		generatedAt: now,
+		closing:     closing,
+		opening:     closing,
+		totals:      make(map[string]int),
+	}
+	for _, e := range entries {
+		data.opening -= e.Points
+		data.totals[historyType(e.Type)] += e.Points
+	}
+
+	slices.Reverse(entries)
+	data.entries = entries
+	return data, nil
+}
+
+// JobGenerateStatement renders a statement queued by Export
+const JobGenerateStatement = "generate_statement"
+
+// JobPurgeStatements is the scheduled job that deletes expired statements
+const JobPurgeStatements = "purge_statements"
+
+type generateStatementPayload struct {
+	StatementID uint `json:"statement_id"`
+}
+
+// RegisterStatementJobs registers statement generation and schedules the purge of expired statements
+func RegisterStatementJobs(jobs JobService, statements StatementService, purgeInterval time.Duration) {
+	jobs.Register(JobGenerateStatement, func(ctx context.Context, job *models.Job) error {
+		var payload generateStatementPayload
+		if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+			return err
+		}
+
+		err := statements.Generate(ctx, payload.StatementID)
+		if err != nil && job.Attempts >= job.MaxAttempts {
+			statements.MarkFailed(payload.StatementID, err)
+		}
+		return err
+	}, JobOptions{MaxAttempts: 3, MaxConcurrency: 2})
+
+	jobs.Register(JobPurgeStatements, func(ctx context.Context, job *models.Job) error {
+		return statements.PurgeExpired()
+	}, JobOptions{MaxConcurrency: 1})
+	jobs.Every(JobPurgeStatements, purgeInterval)
+}
@@ -0,0 +1,375 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/gimhanr9/go-loyalty-api/config"
+	"github.com/gimhanr9/go-loyalty-api/dto"
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"github.com/gimhanr9/go-loyalty-api/repositories"
+)
+
+// StatusService places customers in status levels such as Silver, Gold and
+// Platinum on top of their points. Unlike Square's reward tiers, which are
+// spent, a level is earned by lifetime points or by spend over a rolling
+// window, and multiplies the points the customer earns. Levels are evaluated
+// nightly: an upgrade applies at once, a downgrade only after a grace period.
+type StatusService interface {
+	GetStatus(userID uint) (*dto.StatusDTO, error)
+	Evaluate(ctx context.Context, userID uint) error
+	EvaluateAll() error
+	EarnMultiplier(accountID string) (float64, string)
+}
+
+// StatusLevel is one level, reached once the qualifying value meets its threshold
+type StatusLevel struct {
+	Key        string
+	Name       string
+	Threshold  int
+	Multiplier float64
+}
+
+type statusService struct {
+	users    repositories.AuthRepository
+	statuses repositories.StatusRepository
+	audit    repositories.AuditRepository
+	loyalty  LoyaltyService
+	jobs     JobService
+	levels   []StatusLevel // lowest first, empty when status levels are off
+	basis    string
+	window   time.Duration // 0 counts the account's whole history
+	grace    time.Duration
+}
+
+func NewStatusService(users repositories.AuthRepository, statuses repositories.StatusRepository, audit repositories.AuditRepository, loyalty LoyaltyService, jobs JobService) StatusService {
+	levels, err := parseStatusLevels(os.Getenv("STATUS_LEVELS"))
+	if err != nil {
+		log.Fatalf("Invalid STATUS_LEVELS: %v", err)
+	}
+
+	basis := config.GetEnv("STATUS_BASIS", dto.StatusBasisPoints)
+	var window time.Duration
+	switch basis {
+	case dto.StatusBasisPoints:
+	case dto.StatusBasisSpend:
+		window = 365 * 24 * time.Hour
+	default:
+		log.Fatalf("Invalid STATUS_BASIS %q, expected points or spend", basis)
+	}
+
+	return &statusService{
+		users:    users,
+		statuses: statuses,
+		audit:    audit,
+		loyalty:  loyalty,
+		jobs:     jobs,
+		levels:   levels,
+		basis:    basis,
+		window:   config.GetEnvDuration("STATUS_WINDOW", window),
+		grace:    config.GetEnvDuration("STATUS_GRACE_PERIOD", 30*24*time.Hour),
+	}
+}
+
+// parseStatusLevels reads levels written as name:threshold:multiplier, e.g.
+// "Silver:1000:1.25,Gold:5000:1.5", in ascending order of threshold
+func parseStatusLevels(spec string) ([]StatusLevel, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+
+	var levels []StatusLevel
+	for _, item := range strings.Split(spec, ",") {
+		parts := strings.Split(strings.TrimSpace(item), ":")
+		if len(parts) != 3 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("level %q is not name:threshold:multiplier", item)
+		}
+		name := strings.TrimSpace(parts[0])
+
+		threshold, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || threshold <= 0 {
+			return nil, fmt.Errorf("level %s needs a positive threshold", name)
+		}
+		multiplier, err := strconv.ParseFloat(strings.TrimSpace(parts[2]), 64)
+		if err != nil || multiplier < 1 {
+			return nil, fmt.Errorf("level %s needs a multiplier of at least 1", name)
+		}
+		if n := len(levels); n > 0 && threshold <= levels[n-1].Threshold {
+			return nil, fmt.Errorf("level %s must have a higher threshold than %s", name, levels[n-1].Name)
+		}
+
+		key := strings.ToLower(name)
+		for _, level := range levels {
+			if level.Key == key {
+				return nil, fmt.Errorf("level %s is listed twice", name)
+			}
+		}
+		levels = append(levels, StatusLevel{Key: key, Name: name, Threshold: threshold, Multiplier: multiplier})
+	}
+	return levels, nil
+}
+
+// levelIndex is the position of the level, -1 for none or one no longer configured
+func (s *statusService) levelIndex(key string) int {
+	for i, level := range s.levels {
+		if level.Key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// qualifyingIndex is the highest level the value reaches, -1 for none
+func (s *statusService) qualifyingIndex(value int) int {
+	index := -1
+	for i, level := range s.levels {
+		if value >= level.Threshold {
+			index = i
+		}
+	}
+	return index
+}
+
+// GetStatus is the customer's level and progress to the next one, nil when
+// status levels are off. A customer not evaluated yet is queued for evaluation.
+func (s *statusService) GetStatus(userID uint) (*dto.StatusDTO, error) {
+	if len(s.levels) == 0 {
+		return nil, nil
+	}
+
+	status, err := s.statuses.GetByUserID(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		s.queueEvaluation(userID)
+		status = &models.CustomerStatus{UserID: userID}
+	} else if err != nil {
+		return nil, err
+	}
+
+	result := &dto.StatusDTO{
+		EarnMultiplier:  1,
+		Basis:           s.basis,
+		QualifyingValue: status.QualifyingValue,
+		AchievedAt:      status.AchievedAt,
+		DowngradeAt:     status.DowngradeAt,
+	}
+	if !status.EvaluatedAt.IsZero() {
+		evaluatedAt := status.EvaluatedAt
+		result.EvaluatedAt = &evaluatedAt
+	}
+
+	index := s.levelIndex(status.Level)
+	if index >= 0 {
+		level := s.levels[index]
+		result.Level = &level.Key
+		result.Name = &level.Name
+		result.EarnMultiplier = level.Multiplier
+	}
+	if index+1 < len(s.levels) {
+		next := s.levels[index+1]
+		result.NextLevel = &next.Key
+		result.NextLevelAt = &next.Threshold
+	}
+	return result, nil
+}
+
+// EarnMultiplier is the multiplier of the account's level, which it keeps
+// during a downgrade's grace period
+func (s *statusService) EarnMultiplier(accountID string) (float64, string) {
+	if len(s.levels) == 0 {
+		return 1, ""
+	}
+
+	status, err := s.statuses.GetByAccountID(accountID)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("status: failed to look up status of account %s: %v", accountID, err)
+		}
+		return 1, ""
+	}
+
+	index := s.levelIndex(status.Level)
+	if index < 0 {
+		return 1, ""
+	}
+	level := s.levels[index]
+	return level.Multiplier, level.Name + " status bonus"
+}
+
+// Evaluate recomputes the customer's qualifying value from their loyalty
+// events and moves them between levels
+func (s *statusService) Evaluate(ctx context.Context, userID uint) error {
+	if len(s.levels) == 0 {
+		return nil
+	}
+
+	user, err := s.users.GetByID(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return s.statuses.DeleteByUserID(userID)
+		}
+		return err
+	}
+	if user.CustomerID == "" || user.AnonymizedAt != nil {
+		return s.statuses.DeleteByUserID(userID)
+	}
+
+	now := time.Now()
+	value, err := s.qualifyingValue(ctx, user.CustomerID, now)
+	if err != nil {
+		return err
+	}
+
+	status, err := s.statuses.GetByUserID(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		status = &models.CustomerStatus{UserID: userID}
+	} else if err != nil {
+		return err
+	}
+
+	previous := status.Level
+	status.AccountID = user.CustomerID
+	status.QualifyingValue = value
+	status.EvaluatedAt = now
+	s.applyRules(status, value, now)
+
+	if err := s.statuses.Save(status); err != nil {
+		return err
+	}
+
+	if status.Level != previous {
+		action := "status_upgraded"
+		if s.levelIndex(status.Level) < s.levelIndex(previous) || status.Level == "" {
+			action = "status_downgraded"
+		}
+		recordAudit(s.audit, userID, action, ActorSystem, fmt.Sprintf("from %q to %q", previous, status.Level))
+	}
+	return nil
+}
+
+// applyRules upgrades as soon as the value reaches a higher level. When it no
+// longer reaches the current level a grace period starts, and the customer is
+// moved down to the level they do reach once it ends. Qualifying again during
+// the grace period cancels the downgrade.
+func (s *statusService) applyRules(status *models.CustomerStatus, value int, now time.Time) {
+	current := s.levelIndex(status.Level)
+	reached := s.qualifyingIndex(value)
+
+	switch {
+	case reached > current, current < 0 && status.Level != "":
+		s.setLevel(status, reached, now)
+	case reached == current:
+		status.DowngradeAt = nil
+	case status.DowngradeAt == nil && s.grace > 0:
+		downgradeAt := now.Add(s.grace)
+		status.DowngradeAt = &downgradeAt
+	case status.DowngradeAt != nil && now.Before(*status.DowngradeAt):
+		// still in the grace period
+	default:
+		s.setLevel(status, reached, now)
+	}
+}
+
+func (s *statusService) setLevel(status *models.CustomerStatus, index int, now time.Time) {
+	status.DowngradeAt = nil
+	if index < 0 {
+		status.Level = ""
+		status.AchievedAt = nil
+		return
+	}
+	status.Level = s.levels[index].Key
+	status.AchievedAt = &now
+}
+
+// qualifyingValue totals the points earned, or the spend on orders that
+// earned points, within the window. Adjustments, including status bonuses,
+// don't count.
+func (s *statusService) qualifyingValue(ctx context.Context, accountID string, now time.Time) (int, error) {
+	query := dto.HistoryQueryDTO{Types: []string{dto.HistoryTypeEarned}}
+	if s.window > 0 {
+		query.From = now.Add(-s.window).UTC().Format(time.RFC3339)
+	}
+
+	entries, err := s.loyalty.ListHistory(ctx, accountID, query)
+	if err != nil {
+		return 0, err
+	}
+
+	value := 0
+	orders := make(map[string]bool)
+	for _, entry := range entries {
+		if s.basis == dto.StatusBasisPoints {
+			value += entry.Points
+			continue
+		}
+		// An order can earn base and promotion points, count its spend once
+		if entry.OrderID == "" || entry.OrderTotal == nil || orders[entry.OrderID] {
+			continue
+		}
+		orders[entry.OrderID] = true
+		value += int(entry.OrderTotal.Amount)
+	}
+	return value, nil
+}
+
+// EvaluateAll queues the evaluation of every customer with a loyalty account
+func (s *statusService) EvaluateAll() error {
+	if len(s.levels) == 0 {
+		return nil
+	}
+
+	users, err := s.users.List()
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		if user.CustomerID == "" || user.AnonymizedAt != nil {
+			continue
+		}
+		s.queueEvaluation(user.ID)
+	}
+	return nil
+}
+
+func (s *statusService) queueEvaluation(userID uint) {
+	_, err := s.jobs.EnqueueUnique(JobEvaluateStatus, fmt.Sprintf("status:%d", userID),
+		evaluateStatusPayload{UserID: userID}, time.Now())
+	if err != nil {
+		log.Printf("status: failed to queue evaluation of user %d: %v", userID, err)
+	}
+}
+
+// JobEvaluateStatus re-evaluates one customer's status level
+const JobEvaluateStatus = "evaluate_status"
+
+// JobEvaluateStatuses is the nightly job that re-evaluates every customer
+const JobEvaluateStatuses = "evaluate_statuses"
+
+type evaluateStatusPayload struct {
+	UserID uint `json:"user_id"`
+}
+
+// RegisterStatusJobs registers status evaluations and schedules the nightly
+// run, at the given time after midnight UTC
+func RegisterStatusJobs(jobs JobService, statuses StatusService, at time.Duration) {
+	jobs.Register(JobEvaluateStatus, func(ctx context.Context, job *models.Job) error {
+		var payload evaluateStatusPayload
+		if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+			return err
+		}
+		return statuses.Evaluate(ctx, payload.UserID)
+	}, JobOptions{MaxAttempts: 3, MaxConcurrency: 2})
+
+	jobs.Register(JobEvaluateStatuses, func(ctx context.Context, job *models.Job) error {
+		return statuses.EvaluateAll()
+	}, JobOptions{MaxConcurrency: 1})
+	jobs.Daily(JobEvaluateStatuses, at)
+}
@@ -0,0 +1,675 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	square "github.com/square/square-go-sdk"
+	"gorm.io/gorm"
+
+	"github.com/gimhanr9/go-loyalty-api/apperrors"
+	"github.com/gimhanr9/go-loyalty-api/config"
+	"github.com/gimhanr9/go-loyalty-api/dto"
+	"github.com/gimhanr9/go-loyalty-api/gateway"
+	"github.com/gimhanr9/go-loyalty-api/models"
+	"github.com/gimhanr9/go-loyalty-api/repositories"
+	"github.com/gimhanr9/go-loyalty-api/wallet"
+)
+
+// WalletService issues customers' Apple Wallet and Google Wallet passes and
+// keeps them up to date. Apple devices register with the pass web service and
+// are pushed a notification when a pass changes, Google Wallet objects are
+// updated through the Google Wallet API.
+type WalletService interface {
+	ApplePass(ctx context.Context, userID uint) (*PassFile, error)
+	GooglePass(ctx context.Context, userID uint) (*dto.GoogleWalletPassDTO, error)
+	RegisterDevice(deviceLibraryID string, ref PassRef, pushToken string) (bool, error)
+	UnregisterDevice(deviceLibraryID string, ref PassRef) error
+	UpdatedPasses(deviceLibraryID, passTypeID, passesUpdatedSince string) (*dto.UpdatedPassesDTO, error)
+	LatestPass(ctx context.Context, ref PassRef) (*PassFile, error)
+	BalanceChanged(accountID string, balance int)
+	Refresh(ctx context.Context, passID uint) error
+	SyncAll() error
+}
+
+// PassRef is how the pass web service names a pass, with the authentication
+// token the device presented
+type PassRef struct {
+	PassTypeID   string
+	SerialNumber string
+	AuthToken    string
+}
+
+// PassFile is a signed .pkpass
+type PassFile struct {
+	Filename     string
+	Content      []byte
+	LastModified time.Time
+}
+
+// passContent is everything a pass shows. It is stored on the pass as JSON,
+// a wallet is only told about the pass when it changes.
+type passContent struct {
+	Voided    bool   `json:"voided,omitempty"`
+	Name      string `json:"name"`
+	AccountID string `json:"account_id"`
+	Balance   int    `json:"balance"`
+	TierLabel string `json:"tier_label,omitempty"`
+	TierValue string `json:"tier_value,omitempty"`
+	Code      string `json:"code,omitempty"`
+}
+
+type appleWallet struct {
+	identity      *wallet.AppleIdentity
+	passTypeID    string
+	teamID        string
+	organization  string
+	webServiceURL string
+	images        map[string][]byte
+	pusher        wallet.Pusher
+}
+
+type googleWallet struct {
+	account  *wallet.GoogleServiceAccount
+	client   wallet.GoogleWalletClient
+	issuerID string
+	classID  string
+	origins  []string
+}
+
+type walletService struct {
+	users   repositories.AuthRepository
+	wallets repositories.WalletRepository
+	loyalty LoyaltyService
+	cards   CardService
+	square  gateway.SquareGateway
+	jobs    JobService
+	apple   *appleWallet  // nil when APPLE_PASS_CERT_FILE is not set
+	google  *googleWallet // nil when GOOGLE_WALLET_KEY_FILE is not set
+}
+
+func NewWalletService(users repositories.AuthRepository, wallets repositories.WalletRepository, loyalty LoyaltyService, cards CardService, squareGateway gateway.SquareGateway, jobs JobService) WalletService {
+	s := &walletService{
+		users:   users,
+		wallets: wallets,
+		loyalty: loyalty,
+		cards:   cards,
+		square:  squareGateway,
+		jobs:    jobs,
+	}
+
+	timeout := config.GetEnvDuration("WALLET_HTTP_TIMEOUT", 10*time.Second)
+
+	if certFile := os.Getenv("APPLE_PASS_CERT_FILE"); certFile != "" {
+		identity, err := wallet.LoadAppleIdentity(certFile, os.Getenv("APPLE_PASS_KEY_FILE"), os.Getenv("APPLE_WWDR_CERT_FILE"))
+		if err != nil {
+			log.Fatalf("Failed to load Apple Wallet certificates: %v", err)
+		}
+		images, err := loadPassImages(os.Getenv("APPLE_PASS_IMAGES_DIR"))
+		if err != nil {
+			log.Fatalf("Failed to load Apple Wallet pass images: %v", err)
+		}
+
+		passTypeID := os.Getenv("APPLE_PASS_TYPE_ID")
+		s.apple = &appleWallet{
+			identity:      identity,
+			passTypeID:    passTypeID,
+			teamID:        os.Getenv("APPLE_TEAM_ID"),
+			organization:  config.GetEnv("APPLE_PASS_ORGANIZATION", "Loyalty"),
+			webServiceURL: strings.TrimSuffix(os.Getenv("WALLET_WEB_SERVICE_URL"), "/"),
+			images:        images,
+			pusher:        wallet.NewAPNsPusher(identity, passTypeID, config.GetEnv("APNS_URL", "https://api.push.apple.com"), timeout),
+		}
+	}
+
+	if keyFile := os.Getenv("GOOGLE_WALLET_KEY_FILE"); keyFile != "" {
+		account, err := wallet.LoadGoogleServiceAccount(keyFile)
+		if err != nil {
+			log.Fatalf("Failed to load Google Wallet service account: %v", err)
+		}
+
+		var origins []string
+		for _, origin := range strings.Split(os.Getenv("GOOGLE_WALLET_ORIGINS"), ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				origins = append(origins, origin)
+			}
+		}
+
+		issuerID := os.Getenv("GOOGLE_WALLET_ISSUER_ID")
+		s.google = &googleWallet{
+			account:  account,
+			client:   wallet.NewGoogleWalletClient(account, config.GetEnv("GOOGLE_WALLET_API_URL", "https://walletobjects.googleapis.com"), timeout),
+			issuerID: issuerID,
+			classID:  issuerID + "." + config.GetEnv("GOOGLE_WALLET_CLASS_ID", "loyalty"),
+			origins:  origins,
+		}
+	}
+
+	return s
+}
+
+// loadPassImages reads every PNG in dir, such as icon.png, icon@2x.png and
+// logo.png. A plain icon is used when dir has none, Wallet requires one.
+func loadPassImages(dir string) (map[string][]byte, error) {
+	images := make(map[string][]byte)
+	if dir != "" {
+		files, err := filepath.Glob(filepath.Join(dir, "*.png"))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			images[filepath.Base(file)] = content
+		}
+	}
+
+	if _, ok := images["icon.png"]; !ok {
+		images["icon.png"] = plainIcon(29)
+		images["icon@2x.png"] = plainIcon(58)
+	}
+	return images, nil
+}
+
+// plainIcon is a size pixel square in a neutral grey
+func plainIcon(size int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{R: 0x60, G: 0x60, B: 0x60, A: 0xff}), image.Point{}, draw.Src)
+
+	buf := new(bytes.Buffer)
+	png.Encode(buf, img) // writing to a buffer can't fail
+	return buf.Bytes()
+}
+
+// ApplePass returns the user's signed pass, creating the pass on first use
+func (s *walletService) ApplePass(ctx context.Context, userID uint) (*PassFile, error) {
+	if s.apple == nil {
+		return nil, apperrors.New(apperrors.CodeForbidden, "Apple Wallet passes are disabled")
+	}
+
+	pass, content, err := s.issue(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.applePassFile(pass, content)
+}
+
+// GooglePass returns a link that saves the user's pass to Google Wallet
+func (s *walletService) GooglePass(ctx context.Context, userID uint) (*dto.GoogleWalletPassDTO, error) {
+	if s.google == nil {
+		return nil, apperrors.New(apperrors.CodeForbidden, "Google Wallet passes are disabled")
+	}
+
+	pass, content, err := s.issue(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if pass.GoogleIssuedAt == nil {
+		now := time.Now()
+		pass.GoogleIssuedAt = &now
+		if err := s.wallets.Update(pass); err != nil {
+			return nil, err
+		}
+	}
+
+	token, err := s.google.account.SaveJWT(s.googleObject(pass, content), s.google.origins)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign Google Wallet pass: %w", err)
+	}
+	return &dto.GoogleWalletPassDTO{JWT: token, SaveURL: wallet.GoogleSaveURL + token}, nil
+}
+
+// issue returns the user's pass with its current content
+func (s *walletService) issue(ctx context.Context, userID uint) (*models.WalletPass, *passContent, error) {
+	user, err := s.users.GetByID(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, apperrors.NotFound("user not found")
+		}
+		return nil, nil, err
+	}
+	if user.AnonymizedAt != nil {
+		return nil, nil, apperrors.Conflict("user has already been deleted")
+	}
+	if user.CustomerID == "" {
+		return nil, nil, apperrors.Conflict("loyalty account is not set up yet")
+	}
+
+	pass, err := s.wallets.GetByUserID(user.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		pass, err = s.createPass(user)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	content, err := s.currentContent(ctx, pass)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pass, content, nil
+}
+
+func (s *walletService) createPass(user *models.User) (*models.WalletPass, error) {
+	token := make([]byte, 24)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+
+	pass := &models.WalletPass{
+		UserID:       user.ID,
+		AccountID:    user.CustomerID,
+		SerialNumber: uuid.New().String(),
+		AuthToken:    hex.EncodeToString(token),
+	}
+	if err := s.wallets.Create(pass); err != nil {
+		// Created by a concurrent request
+		if existing, getErr := s.wallets.GetByUserID(user.ID); getErr == nil {
+			return existing, nil
+		}
+		return nil, err
+	}
+	return pass, nil
+}
+
+// currentContent builds the pass's content from Square and saves it if it
+// changed, queueing a refresh to tell the wallets. The last content is served
+// when Square is unavailable.
+func (s *walletService) currentContent(ctx context.Context, pass *models.WalletPass) (*passContent, error) {
+	content, err := s.build(ctx, pass)
+	if err != nil {
+		if stored := storedContent(pass); stored != nil {
+			log.Printf("wallet: serving last content of pass %d: %v", pass.ID, err)
+			return stored, nil
+		}
+		return nil, err
+	}
+
+	changed, err := s.save(pass, content)
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		s.queueRefresh(pass.ID)
+	}
+	return content, nil
+}
+
+// build collects what the pass shows. Passes of deleted users are voided.
+func (s *walletService) build(ctx context.Context, pass *models.WalletPass) (*passContent, error) {
+	user, err := s.users.GetByID(pass.UserID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if user == nil || user.AnonymizedAt != nil || user.CustomerID == "" {
+		return &passContent{Voided: true}, nil
+	}
+
+	balance, err := s.loyalty.GetBalanceSnapshot(ctx, user.CustomerID)
+	if err != nil {
+		return nil, err
+	}
+	program, err := s.square.GetProgram(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	content := &passContent{Name: user.Name, AccountID: user.CustomerID, Balance: balance.Balance}
+	content.TierLabel, content.TierValue = closestTierField(program.RewardTiers, balance.Balance)
+	content.Code, _ = s.cards.PassCode(user.ID, time.Now())
+	return content, nil
+}
+
+// save stores the content if it differs from the last issued, reporting whether it did
+func (s *walletService) save(pass *models.WalletPass, content *passContent) (bool, error) {
+	encoded, err := json.Marshal(content)
+	if err != nil {
+		return false, err
+	}
+	if string(encoded) == pass.Content && (content.Voided || pass.AccountID == content.AccountID) {
+		return false, nil
+	}
+
+	pass.Content = string(encoded)
+	// Apple compares update tags, keep them to what every database stores
+	pass.ContentUpdatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	if !content.Voided {
+		pass.AccountID = content.AccountID
+	}
+	return true, s.wallets.Update(pass)
+}
+
+func storedContent(pass *models.WalletPass) *passContent {
+	if pass.Content == "" {
+		return nil
+	}
+	var content passContent
+	if json.Unmarshal([]byte(pass.Content), &content) != nil {
+		return nil
+	}
+	return &content
+}
+
+// closestTierField describes the best reward the balance reaches, or else the
+// cheapest one and the points it needs
+func closestTierField(tiers []*square.LoyaltyProgramRewardTier, balance int) (string, string) {
+	var reached, cheapest *square.LoyaltyProgramRewardTier
+	for _, tier := range tiers {
+		if tier == nil {
+			continue
+		}
+		if tier.Points <= balance && (reached == nil || tier.Points > reached.Points) {
+			reached = tier
+		}
+		if cheapest == nil || tier.Points < cheapest.Points {
+			cheapest = tier
+		}
+	}
+
+	switch {
+	case reached != nil:
+		return "Reward", stringValue(reached.Name)
+	case cheapest != nil:
+		return "Next reward", fmt.Sprintf("%s at %d points", stringValue(cheapest.Name), cheapest.Points)
+	default:
+		return "", ""
+	}
+}
+
+func (s *walletService) applePassFile(pass *models.WalletPass, content *passContent) (*PassFile, error) {
+	file, err := wallet.BuildPass(s.apple.identity, s.applePass(pass, content), s.apple.images)
+	if err != nil {
+		return nil, err
+	}
+	return &PassFile{Filename: "loyalty.pkpass", Content: file, LastModified: pass.ContentUpdatedAt}, nil
+}
+
+func (s *walletService) applePass(pass *models.WalletPass, content *passContent) *wallet.ApplePass {
+	p := &wallet.ApplePass{
+		FormatVersion:      1,
+		PassTypeIdentifier: s.apple.passTypeID,
+		SerialNumber:       pass.SerialNumber,
+		TeamIdentifier:     s.apple.teamID,
+		OrganizationName:   s.apple.organization,
+		Description:        "Loyalty card",
+		Voided:             content.Voided,
+	}
+	if s.apple.webServiceURL != "" {
+		p.WebServiceURL = s.apple.webServiceURL + "/api/wallet/apple"
+		p.AuthenticationToken = pass.AuthToken
+	}
+	if content.Voided {
+		p.StoreCard.PrimaryFields = []wallet.AppleField{{Key: "name", Label: "Member", Value: "Account closed"}}
+		return p
+	}
+
+	p.StoreCard = wallet.AppleFieldGroup{
+		HeaderFields:  []wallet.AppleField{{Key: "balance", Label: "Points", Value: content.Balance, ChangeMessage: "You now have %@ points"}},
+		PrimaryFields: []wallet.AppleField{{Key: "name", Label: "Member", Value: content.Name}},
+		BackFields:    []wallet.AppleField{{Key: "account", Label: "Loyalty account", Value: content.AccountID}},
+	}
+	if content.TierLabel != "" {
+		p.StoreCard.SecondaryFields = []wallet.AppleField{{Key: "reward", Label: content.TierLabel, Value: content.TierValue, ChangeMessage: "%@"}}
+	}
+	if content.Code != "" {
+		p.Barcodes = []wallet.AppleBarcode{{Format: wallet.AppleBarcodeQR, Message: content.Code, MessageEncoding: "iso-8859-1", AltText: content.Code}}
+	}
+	return p
+}
+
+func (s *walletService) googleObject(pass *models.WalletPass, content *passContent) *wallet.GoogleLoyaltyObject {
+	object := &wallet.GoogleLoyaltyObject{
+		ID:      s.google.issuerID + "." + pass.SerialNumber,
+		ClassID: s.google.classID,
+		State:   wallet.GoogleStateActive,
+	}
+	if content.Voided {
+		object.State = wallet.GoogleStateInactive
+		return object
+	}
+
+	object.AccountID = content.AccountID
+	object.AccountName = content.Name
+	object.LoyaltyPoints = &wallet.GoogleLoyaltyPoints{Label: "Points", Balance: wallet.GoogleLoyaltyPointsBalance{Int: content.Balance}}
+	if content.TierLabel != "" {
+		object.TextModulesData = []wallet.GoogleTextModule{{ID: "reward", Header: content.TierLabel, Body: content.TierValue}}
+	}
+	if content.Code != "" {
+		object.Barcode = &wallet.GoogleBarcode{Type: wallet.GoogleBarcodeQR, Value: content.Code, AlternateText: content.Code}
+	}
+	return object
+}
+
+// authenticate finds the pass a device names, checking its token
+func (s *walletService) authenticate(ref PassRef) (*models.WalletPass, error) {
+	if s.apple == nil {
+		return nil, apperrors.New(apperrors.CodeForbidden, "Apple Wallet passes are disabled")
+	}
+
+	unauthorized := apperrors.Unauthorized("Invalid pass authentication token")
+	if ref.PassTypeID != s.apple.passTypeID {
+		return nil, unauthorized
+	}
+	pass, err := s.wallets.GetBySerialNumber(ref.SerialNumber)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, unauthorized
+		}
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(ref.AuthToken), []byte(pass.AuthToken)) != 1 {
+		return nil, unauthorized
+	}
+	return pass, nil
+}
+
+// RegisterDevice subscribes a device to updates of the pass, reporting whether it is a new registration
+func (s *walletService) RegisterDevice(deviceLibraryID string, ref PassRef, pushToken string) (bool, error) {
+	pass, err := s.authenticate(ref)
+	if err != nil {
+		return false, err
+	}
+	return s.wallets.Register(&models.WalletRegistration{DeviceLibraryID: deviceLibraryID, PassID: pass.ID, PushToken: pushToken})
+}
+
+// UnregisterDevice stops updates of the pass to the device, once it was removed from Wallet
+func (s *walletService) UnregisterDevice(deviceLibraryID string, ref PassRef) error {
+	pass, err := s.authenticate(ref)
+	if err != nil {
+		return err
+	}
+	return s.wallets.Unregister(deviceLibraryID, pass.ID)
+}
+
+// UpdatedPasses lists the device's passes that changed since the tag it
+// received last time, nil when none did
+func (s *walletService) UpdatedPasses(deviceLibraryID, passTypeID, passesUpdatedSince string) (*dto.UpdatedPassesDTO, error) {
+	if s.apple == nil {
+		return nil, apperrors.New(apperrors.CodeForbidden, "Apple Wallet passes are disabled")
+	}
+	if passTypeID != s.apple.passTypeID {
+		return nil, nil
+	}
+
+	var since time.Time
+	if passesUpdatedSince != "" {
+		micros, err := strconv.ParseInt(passesUpdatedSince, 10, 64)
+		if err != nil {
+			return nil, apperrors.Validation(apperrors.FieldError{Field: "passesUpdatedSince", Message: "is not an update tag"})
+		}
+		since = time.UnixMicro(micros).UTC()
+	}
+
+	passes, err := s.wallets.ListUpdatedForDevice(deviceLibraryID, since)
+	if err != nil || len(passes) == 0 {
+		return nil, err
+	}
+
+	updated := &dto.UpdatedPassesDTO{SerialNumbers: make([]string, 0, len(passes))}
+	var latest time.Time
+	for _, pass := range passes {
+		updated.SerialNumbers = append(updated.SerialNumbers, pass.SerialNumber)
+		if pass.ContentUpdatedAt.After(latest) {
+			latest = pass.ContentUpdatedAt
+		}
+	}
+	updated.LastUpdated = strconv.FormatInt(latest.UnixMicro(), 10)
+	return updated, nil
+}
+
+// LatestPass returns the current version of a pass to the device holding it
+func (s *walletService) LatestPass(ctx context.Context, ref PassRef) (*PassFile, error) {
+	pass, err := s.authenticate(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := s.currentContent(ctx, pass)
+	if err != nil {
+		return nil, err
+	}
+	return s.applePassFile(pass, content)
+}
+
+// BalanceChanged queues a refresh of the account's pass, if it has one
+func (s *walletService) BalanceChanged(accountID string, balance int) {
+	pass, err := s.wallets.GetByAccountID(accountID)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("wallet: failed to look up pass of account %s: %v", accountID, err)
+		}
+		return
+	}
+	s.queueRefresh(pass.ID)
+}
+
+func (s *walletService) queueRefresh(passID uint) {
+	_, err := s.jobs.EnqueueUnique(JobRefreshWalletPass, fmt.Sprintf("wallet_pass:%d", passID),
+		refreshWalletPassPayload{PassID: passID}, time.Now())
+	if err != nil {
+		log.Printf("wallet: failed to queue refresh of pass %d: %v", passID, err)
+	}
+}
+
+// Refresh rebuilds the pass and tells the wallets holding it about any change
+// they have not been told about yet
+func (s *walletService) Refresh(ctx context.Context, passID uint) error {
+	pass, err := s.wallets.GetByID(passID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	content, err := s.build(ctx, pass)
+	if err != nil {
+		return err
+	}
+	if _, err := s.save(pass, content); err != nil {
+		return err
+	}
+	if pass.PushedAt != nil && !pass.PushedAt.Before(pass.ContentUpdatedAt) {
+		return nil
+	}
+
+	if err := s.push(ctx, pass, content); err != nil {
+		return err
+	}
+	pushed := pass.ContentUpdatedAt
+	pass.PushedAt = &pushed
+	return s.wallets.Update(pass)
+}
+
+// push notifies the Apple devices registered for the pass and updates its
+// Google Wallet object. Devices that no longer hold the pass are dropped.
+func (s *walletService) push(ctx context.Context, pass *models.WalletPass, content *passContent) error {
+	var failed error
+
+	if s.apple != nil {
+		registrations, err := s.wallets.ListRegistrations(pass.ID)
+		if err != nil {
+			return err
+		}
+		for _, registration := range registrations {
+			err := s.apple.pusher.Push(ctx, registration.PushToken)
+			switch {
+			case errors.Is(err, wallet.ErrDeviceGone):
+				if err := s.wallets.DeleteRegistration(registration.ID); err != nil {
+					log.Printf("wallet: failed to drop registration %d: %v", registration.ID, err)
+				}
+			case err != nil:
+				log.Printf("wallet: failed to push pass %d to a device: %v", pass.ID, err)
+				failed = err
+			}
+		}
+	}
+
+	if s.google != nil && pass.GoogleIssuedAt != nil {
+		err := s.google.client.UpdateLoyaltyObject(ctx, s.googleObject(pass, content))
+		if err != nil && !errors.Is(err, wallet.ErrObjectNotFound) {
+			log.Printf("wallet: failed to update Google Wallet object of pass %d: %v", pass.ID, err)
+			failed = err
+		}
+	}
+	return failed
+}
+
+// SyncAll queues a refresh of every pass held in a wallet, picking up balances
+// changed outside this API and rotated codes
+func (s *walletService) SyncAll() error {
+	ids, err := s.wallets.ListInWallets()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		s.queueRefresh(id)
+	}
+	return nil
+}
+
+// JobRefreshWalletPass rebuilds a pass and pushes it to wallets if it changed
+const JobRefreshWalletPass = "refresh_wallet_pass"
+
+// JobSyncWalletPasses is the scheduled job that refreshes every pass held in a wallet
+const JobSyncWalletPasses = "sync_wallet_passes"
+
+type refreshWalletPassPayload struct {
+	PassID uint `json:"pass_id"`
+}
+
+// RegisterWalletJobs registers pass refreshes and schedules the sync of every pass
+func RegisterWalletJobs(jobs JobService, wallets WalletService, syncInterval time.Duration) {
+	jobs.Register(JobRefreshWalletPass, func(ctx context.Context, job *models.Job) error {
+		var payload refreshWalletPassPayload
+		if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+			return err
+		}
+		return wallets.Refresh(ctx, payload.PassID)
+	}, JobOptions{MaxAttempts: 3, MaxConcurrency: 4})
+
+	jobs.Register(JobSyncWalletPasses, func(ctx context.Context, job *models.Job) error {
+		return wallets.SyncAll()
+	}, JobOptions{MaxConcurrency: 1})
+	jobs.Every(JobSyncWalletPasses, syncInterval)
+}
@@ -0,0 +1,20 @@
+package utils
+
+import (
+	"math/rand"
+	"time"
+)
+
+// JitteredBackoff doubles base for every attempt up to max, then picks a delay
+// between half and all of it so replicas don't retry in lockstep
+func JitteredBackoff(base, max time.Duration, attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	delay := base << uint(attempts-1)
+	if delay <= 0 || delay > max {
+		delay = max
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"net/mail"
+	"strings"
+
+	"github.com/gimhanr9/go-loyalty-api/apperrors"
+	"github.com/gimhanr9/go-loyalty-api/config"
+	"github.com/nyaruka/phonenumbers"
+)
+
+// NormalizePhone parses a phone number and formats it as E.164. Numbers
+// without a country code are read in DEFAULT_PHONE_REGION.
+func NormalizePhone(raw string) (string, error) {
+	region := strings.ToUpper(config.GetEnv("DEFAULT_PHONE_REGION", "US"))
+
+	number, err := phonenumbers.Parse(strings.TrimSpace(raw), region)
+	if err != nil || !phonenumbers.IsValidNumber(number) {
+		return "", apperrors.InvalidRequest("invalid phone number")
+	}
+
+	return phonenumbers.Format(number, phonenumbers.E164), nil
+}
+
+// NormalizeEmail validates an email address and case-folds it
+func NormalizeEmail(raw string) (string, error) {
+	trimmed := strings.TrimSpace(raw)
+
+	// Reject display names ("Jane <jane@example.com>") and dotless domains
+	address, err := mail.ParseAddress(trimmed)
+	if err != nil || address.Address != trimmed {
+		return "", apperrors.InvalidRequest("invalid email address")
+	}
+	domain := address.Address[strings.LastIndex(address.Address, "@")+1:]
+	if !strings.Contains(domain, ".") {
+		return "", apperrors.InvalidRequest("invalid email address")
+	}
+
+	return strings.ToLower(address.Address), nil
+}
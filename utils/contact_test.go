@@ -0,0 +1,62 @@
+package utils
+
+import "testing"
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		name    string
+		region  string // DEFAULT_PHONE_REGION, US when empty
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{name: "already E.164", raw: "+16502530000", want: "+16502530000"},
+		{name: "national format in the default region", raw: "(650) 253-0000", want: "+16502530000"},
+		{name: "dots and spaces", raw: " 650.253.0000 ", want: "+16502530000"},
+		{name: "international with a country code", raw: "+44 20 7946 0958", want: "+442079460958"},
+		{name: "national format in another region", region: "gb", raw: "020 7946 0958", want: "+442079460958"},
+		{name: "too short", raw: "12345", wantErr: true},
+		{name: "not a valid number in the region", raw: "+1 000 000 0000", wantErr: true},
+		{name: "empty", raw: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DEFAULT_PHONE_REGION", tt.region)
+
+			got, err := NormalizePhone(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizePhone(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{raw: "ann@example.com", want: "ann@example.com"},
+		{raw: "  Ann.Lee+Tag@Example.COM ", want: "ann.lee+tag@example.com"},
+		{raw: "Ann <ann@example.com>", wantErr: true},
+		{raw: "ann@localhost", wantErr: true},
+		{raw: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := NormalizeEmail(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeEmail(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
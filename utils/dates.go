@@ -0,0 +1,21 @@
+package utils
+
+import "time"
+
+// ParseDateOrTime accepts an RFC 3339 time or a date such as "2025-01-31",
+// read as midnight UTC. With endOfDay a date means the midnight that ends it,
+// so a range ending on that date includes the whole day.
+func ParseDateOrTime(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
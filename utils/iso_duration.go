@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var isoDurationPattern = regexp.MustCompile(`^P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// AddISODuration adds an ISO 8601 duration such as "P1Y", "P18M" or "P30D",
+// the format Square uses for loyalty point expiry, to t. Years and months
+// follow the calendar.
+func AddISODuration(t time.Time, duration string) (time.Time, error) {
+	match := isoDurationPattern.FindStringSubmatch(duration)
+	if match == nil || duration == "P" || duration[len(duration)-1] == 'T' {
+		return time.Time{}, fmt.Errorf("invalid ISO 8601 duration %q", duration)
+	}
+
+	n := make([]int, len(match))
+	for i, part := range match[1:] {
+		if part != "" {
+			n[i+1], _ = strconv.Atoi(part)
+		}
+	}
+
+	t = t.AddDate(n[1], n[2], n[3]*7+n[4])
+	return t.Add(time.Duration(n[5])*time.Hour + time.Duration(n[6])*time.Minute + time.Duration(n[7])*time.Second), nil
+}
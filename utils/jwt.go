@@ -13,6 +13,7 @@ var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
 func GenerateToken(customerID string) (string, error) {
 	claims := jwt.MapClaims{
 		"customer_id": customerID,
+		"iat":         time.Now().Unix(),
 		"exp":         time.Now().Add(time.Hour * 72).Unix(), // 3 days
 	}
 
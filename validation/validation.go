@@ -0,0 +1,117 @@
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/gimhanr9/go-loyalty-api/apperrors"
+	"github.com/gimhanr9/go-loyalty-api/utils"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// Setup configures gin's binding: unknown JSON fields are rejected, field
+// errors use JSON names, and the notblank, phone, contact_email and date_or_time rules are registered
+func Setup() {
+	binding.EnableDecoderDisallowUnknownFields = true
+
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+
+	v.RegisterValidation("notblank", func(fl validator.FieldLevel) bool {
+		return strings.TrimSpace(fl.Field().String()) != ""
+	})
+	v.RegisterValidation("phone", func(fl validator.FieldLevel) bool {
+		_, err := utils.NormalizePhone(fl.Field().String())
+		return err == nil
+	})
+	v.RegisterValidation("contact_email", func(fl validator.FieldLevel) bool {
+		_, err := utils.NormalizeEmail(fl.Field().String())
+		return err == nil
+	})
+	v.RegisterValidation("date_or_time", func(fl validator.FieldLevel) bool {
+		_, err := utils.ParseDateOrTime(fl.Field().String(), false)
+		return err == nil
+	})
+}
+
+// Error turns a binding failure into an invalid_request error with one entry per field
+func Error(err error) error {
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		fields := make([]apperrors.FieldError, 0, len(validationErrs))
+		for _, fieldErr := range validationErrs {
+			fields = append(fields, apperrors.FieldError{Field: fieldErr.Field(), Message: message(fieldErr)})
+		}
+		return apperrors.Validation(fields...)
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return apperrors.Validation(apperrors.FieldError{Field: typeErr.Field, Message: "must be a " + typeErr.Type.String()})
+	}
+
+	// encoding/json has no typed error for unknown fields
+	if name, found := strings.CutPrefix(err.Error(), "json: unknown field "); found {
+		return apperrors.Validation(apperrors.FieldError{Field: strings.Trim(name, `"`), Message: "is not a known field"})
+	}
+
+	if errors.Is(err, io.EOF) {
+		return apperrors.InvalidRequest("Request body is required")
+	}
+	return apperrors.InvalidRequest("Request body is not valid JSON")
+}
+
+func message(fieldErr validator.FieldError) string {
+	isText := fieldErr.Kind() == reflect.String
+
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "required_without":
+		return "is required when " + strings.ToLower(fieldErr.Param()) + " is not given"
+	case "min":
+		if isText {
+			return fmt.Sprintf("must be at least %s characters", fieldErr.Param())
+		}
+		return "must be at least " + fieldErr.Param()
+	case "max":
+		if isText {
+			return fmt.Sprintf("must be at most %s characters", fieldErr.Param())
+		}
+		return "must be at most " + fieldErr.Param()
+	case "len":
+		return fmt.Sprintf("must be exactly %s characters", fieldErr.Param())
+	case "notblank":
+		return "must not be blank"
+	case "numeric":
+		return "must contain only digits"
+	case "phone":
+		return "must be a valid phone number"
+	case "contact_email":
+		return "must be a valid email address"
+	case "oneof":
+		return "must be one of " + strings.ReplaceAll(fieldErr.Param(), " ", ", ")
+	case "date_or_time":
+		return "must be a date (2006-01-02) or an RFC 3339 time"
+	default:
+		return "is invalid"
+	}
+}
@@ -0,0 +1,76 @@
+package wallet
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrDeviceGone means the push token is no longer valid, the pass was removed
+// from the device or the app reinstalled
+var ErrDeviceGone = errors.New("device is no longer registered for pushes")
+
+// Pusher tells a device to fetch the latest version of its passes
+type Pusher interface {
+	Push(ctx context.Context, pushToken string) error
+}
+
+type apnsPusher struct {
+	client  *http.Client
+	baseURL string
+	topic   string
+}
+
+// NewAPNsPusher sends pass update notifications through APNs, authenticated
+// with the pass certificate. The topic is the pass type identifier.
+func NewAPNsPusher(id *AppleIdentity, topic, baseURL string, timeout time.Duration) Pusher {
+	transport := &http.Transport{
+		TLSClientConfig:   &tls.Config{Certificates: []tls.Certificate{id.TLSCertificate()}},
+		ForceAttemptHTTP2: true, // APNs only speaks HTTP/2
+	}
+	return &apnsPusher{
+		client:  &http.Client{Transport: transport, Timeout: timeout},
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		topic:   topic,
+	}
+}
+
+// Push sends the empty notification Wallet expects, the device then asks the
+// pass web service what changed
+func (p *apnsPusher) Push(ctx context.Context, pushToken string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		p.baseURL+"/3/device/"+url.PathEscape(pushToken), bytes.NewReader([]byte("{}")))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("apns-topic", p.topic)
+	req.Header.Set("apns-push-type", "background")
+	req.Header.Set("apns-priority", "5") // required for background pushes
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return nil
+	case resp.StatusCode == http.StatusGone:
+		return ErrDeviceGone
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		if resp.StatusCode == http.StatusBadRequest && strings.Contains(string(body), "BadDeviceToken") {
+			return ErrDeviceGone
+		}
+		return fmt.Errorf("APNs answered %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+}
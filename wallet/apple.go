@@ -0,0 +1,199 @@
+// Package wallet builds loyalty passes for Apple Wallet and Google Wallet and
+// tells the wallets when a pass changes. It knows the wallet formats and
+// protocols, not where a pass's content comes from.
+package wallet
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/smallstep/pkcs7"
+)
+
+// ApplePass is pass.json for a store card pass
+type ApplePass struct {
+	FormatVersion       int             `json:"formatVersion"`
+	PassTypeIdentifier  string          `json:"passTypeIdentifier"`
+	SerialNumber        string          `json:"serialNumber"`
+	TeamIdentifier      string          `json:"teamIdentifier"`
+	OrganizationName    string          `json:"organizationName"`
+	Description         string          `json:"description"`
+	WebServiceURL       string          `json:"webServiceURL,omitempty"`
+	AuthenticationToken string          `json:"authenticationToken,omitempty"`
+	ForegroundColor     string          `json:"foregroundColor,omitempty"`
+	BackgroundColor     string          `json:"backgroundColor,omitempty"`
+	LabelColor          string          `json:"labelColor,omitempty"`
+	Barcodes            []AppleBarcode  `json:"barcodes,omitempty"`
+	StoreCard           AppleFieldGroup `json:"storeCard"`
+	Voided              bool            `json:"voided,omitempty"`
+}
+
+// AppleFieldGroup is where fields sit on the front and back of the pass
+type AppleFieldGroup struct {
+	HeaderFields    []AppleField `json:"headerFields,omitempty"`
+	PrimaryFields   []AppleField `json:"primaryFields,omitempty"`
+	SecondaryFields []AppleField `json:"secondaryFields,omitempty"`
+	BackFields      []AppleField `json:"backFields,omitempty"`
+}
+
+// AppleField is one labelled value. A ChangeMessage, containing %@ for the new
+// value, is shown as a notification when an update changes the value.
+type AppleField struct {
+	Key           string      `json:"key"`
+	Label         string      `json:"label,omitempty"`
+	Value         interface{} `json:"value"`
+	ChangeMessage string      `json:"changeMessage,omitempty"`
+}
+
+type AppleBarcode struct {
+	Format          string `json:"format"`
+	Message         string `json:"message"`
+	MessageEncoding string `json:"messageEncoding"`
+	AltText         string `json:"altText,omitempty"`
+}
+
+// Apple barcode formats
+const (
+	AppleBarcodeQR      = "PKBarcodeFormatQR"
+	AppleBarcodeCode128 = "PKBarcodeFormatCode128"
+)
+
+// AppleIdentity is the Pass Type ID certificate passes are signed with, and
+// Apple's WWDR intermediate certificate that issued it
+type AppleIdentity struct {
+	Certificate *x509.Certificate
+	PrivateKey  crypto.PrivateKey
+	WWDR        *x509.Certificate
+}
+
+// LoadAppleIdentity reads the PEM encoded pass certificate, its unencrypted
+// private key and the WWDR certificate
+func LoadAppleIdentity(certFile, keyFile, wwdrFile string) (*AppleIdentity, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pass certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pass certificate: %w", err)
+	}
+
+	wwdr, err := loadCertificate(wwdrFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load WWDR certificate: %w", err)
+	}
+	if err := cert.CheckSignatureFrom(wwdr); err != nil {
+		return nil, fmt.Errorf("pass certificate was not issued by the WWDR certificate: %w", err)
+	}
+
+	return &AppleIdentity{Certificate: cert, PrivateKey: pair.PrivateKey, WWDR: wwdr}, nil
+}
+
+func loadCertificate(file string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		// Apple hands out the WWDR certificate DER encoded
+		return x509.ParseCertificate(data)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// TLSCertificate authenticates APNs connections with the pass certificate
+func (id *AppleIdentity) TLSCertificate() tls.Certificate {
+	return tls.Certificate{
+		Certificate: [][]byte{id.Certificate.Raw},
+		PrivateKey:  id.PrivateKey,
+		Leaf:        id.Certificate,
+	}
+}
+
+// BuildPass bundles pass.json and the images into a signed .pkpass. images
+// maps file names such as icon.png and logo@2x.png to their contents, Wallet
+// refuses passes without icon.png.
+func BuildPass(id *AppleIdentity, pass *ApplePass, images map[string][]byte) ([]byte, error) {
+	if _, ok := images["icon.png"]; !ok {
+		return nil, errors.New("pass has no icon.png")
+	}
+
+	passJSON, err := json.Marshal(pass)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string][]byte{"pass.json": passJSON}
+	for name, content := range images {
+		files[name] = content
+	}
+
+	manifest := make(map[string]string, len(files))
+	for name, content := range files {
+		sum := sha1.Sum(content)
+		manifest[name] = hex.EncodeToString(sum[:])
+	}
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := sign(id, manifestJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign pass: %w", err)
+	}
+	files["manifest.json"] = manifestJSON
+	files["signature"] = signature
+
+	return zipFiles(files)
+}
+
+// sign makes the detached PKCS #7 signature of the manifest
+func sign(id *AppleIdentity, manifest []byte) ([]byte, error) {
+	signed, err := pkcs7.NewSignedData(manifest)
+	if err != nil {
+		return nil, err
+	}
+	signed.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+	if err := signed.AddSignerChain(id.Certificate, id.PrivateKey, []*x509.Certificate{id.WWDR}, pkcs7.SignerInfoConfig{}); err != nil {
+		return nil, err
+	}
+	signed.Detach()
+	return signed.Finish()
+}
+
+func zipFiles(files map[string][]byte) ([]byte, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for _, name := range names {
+		w, err := zw.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(files[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
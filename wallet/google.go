@@ -0,0 +1,241 @@
+package wallet
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// GoogleSaveURL is followed by a save JWT to add a pass to Google Wallet
+const GoogleSaveURL = "https://pay.google.com/gp/v/save/"
+
+const googleWalletScope = "https://www.googleapis.com/auth/wallet_object.issuer"
+
+// ErrObjectNotFound means the customer never saved the pass to Google Wallet
+var ErrObjectNotFound = errors.New("loyalty object not found")
+
+// GoogleLoyaltyObject is a customer's pass, an instance of the issuer's loyalty class
+type GoogleLoyaltyObject struct {
+	ID              string               `json:"id"`
+	ClassID         string               `json:"classId"`
+	State           string               `json:"state"`
+	AccountID       string               `json:"accountId,omitempty"`
+	AccountName     string               `json:"accountName,omitempty"`
+	LoyaltyPoints   *GoogleLoyaltyPoints `json:"loyaltyPoints,omitempty"`
+	Barcode         *GoogleBarcode       `json:"barcode,omitempty"`
+	TextModulesData []GoogleTextModule   `json:"textModulesData,omitempty"`
+}
+
+// Google loyalty object states
+const (
+	GoogleStateActive   = "ACTIVE"
+	GoogleStateInactive = "INACTIVE"
+)
+
+type GoogleLoyaltyPoints struct {
+	Label   string                     `json:"label"`
+	Balance GoogleLoyaltyPointsBalance `json:"balance"`
+}
+
+type GoogleLoyaltyPointsBalance struct {
+	Int int `json:"int"`
+}
+
+type GoogleBarcode struct {
+	Type          string `json:"type"`
+	Value         string `json:"value"`
+	AlternateText string `json:"alternateText,omitempty"`
+}
+
+// Google barcode types
+const (
+	GoogleBarcodeQR      = "QR_CODE"
+	GoogleBarcodeCode128 = "CODE_128"
+)
+
+type GoogleTextModule struct {
+	ID     string `json:"id,omitempty"`
+	Header string `json:"header"`
+	Body   string `json:"body"`
+}
+
+// GoogleServiceAccount is the issuer's service account, from its JSON key file
+type GoogleServiceAccount struct {
+	ClientEmail string
+	PrivateKey  *rsa.PrivateKey
+	TokenURI    string
+}
+
+// LoadGoogleServiceAccount reads a service account key file downloaded from Google Cloud
+func LoadGoogleServiceAccount(file string) (*GoogleServiceAccount, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var key struct {
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("failed to read service account key: %w", err)
+	}
+	if key.ClientEmail == "" {
+		return nil, errors.New("service account key has no client_email")
+	}
+
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(key.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account private key: %w", err)
+	}
+
+	if key.TokenURI == "" {
+		key.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	return &GoogleServiceAccount{ClientEmail: key.ClientEmail, PrivateKey: privateKey, TokenURI: key.TokenURI}, nil
+}
+
+// SaveJWT signs the token behind an Add to Google Wallet link carrying the
+// object. origins are the web origins allowed to show the save button.
+func (a *GoogleServiceAccount) SaveJWT(object *GoogleLoyaltyObject, origins []string) (string, error) {
+	claims := jwt.MapClaims{
+		"iss":     a.ClientEmail,
+		"aud":     "google",
+		"typ":     "savetowallet",
+		"iat":     time.Now().Unix(),
+		"origins": origins,
+		"payload": map[string]interface{}{
+			"loyaltyObjects": []*GoogleLoyaltyObject{object},
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(a.PrivateKey)
+}
+
+// GoogleWalletClient updates saved loyalty objects through the Google Wallet API
+type GoogleWalletClient interface {
+	UpdateLoyaltyObject(ctx context.Context, object *GoogleLoyaltyObject) error
+}
+
+type googleWalletClient struct {
+	account *GoogleServiceAccount
+	baseURL string
+	client  *http.Client
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+func NewGoogleWalletClient(account *GoogleServiceAccount, baseURL string, timeout time.Duration) GoogleWalletClient {
+	return &googleWalletClient{
+		account: account,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+// UpdateLoyaltyObject replaces a saved object, Google Wallet then refreshes
+// it on the customer's devices
+func (c *googleWalletClient) UpdateLoyaltyObject(ctx context.Context, object *GoogleLoyaltyObject) error {
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut,
+		c.baseURL+"/walletobjects/v1/loyaltyObject/"+url.PathEscape(object.ID), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return ErrObjectNotFound
+	default:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("google wallet answered %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+}
+
+// accessToken exchanges a signed assertion for an OAuth token, reused until
+// shortly before it expires
+func (c *googleWalletClient) accessToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Now().Before(c.tokenExpiry) {
+		return c.token, nil
+	}
+
+	now := time.Now()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   c.account.ClientEmail,
+		"scope": googleWalletScope,
+		"aud":   c.account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(c.account.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.account.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("google token endpoint answered %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+
+	c.token = token.AccessToken
+	c.tokenExpiry = now.Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return c.token, nil
+}